@@ -0,0 +1,82 @@
+package templates
+
+import "sort"
+
+// Analysis is the structure of a template found by AnalyzeTemplate. It can be
+// encoded as JSON, and the fields are always lists, empty if there is
+// nothing to report, so tools don't need to handle null.
+type Analysis struct {
+	// Fields are the sorted paths of the fields of the template data read by
+	// the template, in the dotted notation of TemplateError.Path, like
+	// "Subject.CommonName". The elements of a field used in a range loop are
+	// "[]", so {{ range .SANs }}{{ .Value }}{{ end }} reads "SANs" and
+	// "SANs[].Value". A field is only reported without its nested fields if
+	// it's used as a whole, like in {{ toJson .Subject }}.
+	Fields []string `json:"fields"`
+	// Functions are the sorted names of the functions called by the template,
+	// including the ones predefined by text/template, like Result.Functions.
+	Functions []string `json:"functions"`
+	// Templates are the sorted names of the templates defined with define or
+	// block.
+	Templates []string `json:"templates"`
+}
+
+// AnalyzeTemplate parses a template and returns the fields it reads, the
+// functions it calls and the templates it defines, so tools can check the
+// structure of a template, like denying functions or checking that some data
+// covers the fields, without executing it or parsing it again.
+//
+// The template is parsed like in LintTemplate, without resolving the function
+// names, so unknown functions are reported instead of making the parse fail;
+// only the delimiters of the options are used. The fields are found
+// statically like in DryRunRender, following the value of dot and variables
+// in with and range blocks and in the templates called, so the fields of a
+// defined template are only reported if it's called.
+func AnalyzeTemplate(data []byte, opts ...Option) (*Analysis, error) {
+	return analyzeTemplate(data, newOptions(opts))
+}
+
+// analyzeTemplate returns the Analysis of a template with the options o.
+func analyzeTemplate(data []byte, o *options) (*Analysis, error) {
+	trees, err := parseTrees(data, o)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Analysis{
+		Fields:    []string{},
+		Functions: usedFuncs(trees),
+		Templates: []string{},
+	}
+	for name := range trees {
+		if name != "template" {
+			a.Templates = append(a.Templates, name)
+		}
+	}
+	sort.Strings(a.Templates)
+
+	if root := trees["template"]; root != nil {
+		s := &placeholderScanner{trees: trees, root: newPlaceholder()}
+		s.scan(root.Root, s.root, map[string]*placeholder{"$": s.root})
+		s.root.paths("", func(path string) {
+			a.Fields = append(a.Fields, path)
+		})
+	}
+	sort.Strings(a.Fields)
+	return a, nil
+}
+
+// paths calls fn with the path of the fields of the placeholder that are
+// read, the ones without nested fields, used as a whole or in range loops.
+// The elements of a list are only reported if they are read.
+func (p *placeholder) paths(path string, fn func(path string)) {
+	if path != "" && (p.whole || p.list || p.object || len(p.fields) == 0) {
+		fn(path)
+	}
+	for name, f := range p.fields {
+		f.paths(joinPath(path, name), fn)
+	}
+	if e := p.elem; e != nil && (e.whole || e.list || len(e.fields) > 0) {
+		e.paths(path+"[]", fn)
+	}
+}
@@ -0,0 +1,83 @@
+package templates
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyzeTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		opts    []Option
+		want    *Analysis
+		wantErr string
+	}{
+		{"empty", ``, nil, &Analysis{Fields: []string{}, Functions: []string{}, Templates: []string{}}, ""},
+		{"fields", `{"subject": {"commonName": {{ toJson .Subject.CommonName }}}, "keyUsage": {{ keyUsage .KeyUsage | toJson }}}`, nil, &Analysis{
+			Fields:    []string{"KeyUsage", "Subject.CommonName"},
+			Functions: []string{"keyUsage", "toJson"},
+			Templates: []string{},
+		}, ""},
+		{"whole", `{"subject": {{ toJson .Subject }}{{ if .Subject.Organization }}, "o": 1{{ end }}}`, nil, &Analysis{
+			Fields:    []string{"Subject", "Subject.Organization"},
+			Functions: []string{"toJson"},
+			Templates: []string{},
+		}, ""},
+		{"range", `{"sans": [{{ range $i, $san := .SANs }}{{ if $i }},{{ end }}{{ jsonQuote $san.Value }}{{ end }}], "ips": [{{ range .IPs }}"x"{{ end }}]}`, nil, &Analysis{
+			Fields:    []string{"IPs", "SANs", "SANs[].Value"},
+			Functions: []string{"jsonQuote"},
+			Templates: []string{},
+		}, ""},
+		{"with", `{{ with .Token.Claims }}{"cn": {{ toJson .sub }}, "e": {{ toJson $.Insecure.User.email }}}{{ end }}`, nil, &Analysis{
+			Fields:    []string{"Insecure.User.email", "Token.Claims.sub"},
+			Functions: []string{"toJson"},
+			Templates: []string{},
+		}, ""},
+		{"templates", `{{ define "subject" }}{"commonName": {{ toJson .CommonName }}}{{ end }}{{ define "unused" }}{{ .Other }}{{ end }}{{ block "extra" . }}{{ end }}{"subject": {{ template "subject" .Subject }}}`, nil, &Analysis{
+			Fields:    []string{"Subject.CommonName"},
+			Functions: []string{"toJson"},
+			Templates: []string{"extra", "subject", "unused"},
+		}, ""},
+		{"unknown-func", `{"cn": {{ .CN | toJsn }}, "ok": {{ and .A (not .B) }}}`, nil, &Analysis{
+			Fields:    []string{"A", "B", "CN"},
+			Functions: []string{"and", "not", "toJsn"},
+			Templates: []string{},
+		}, ""},
+		{"delims", `{"cn": [[ toJson .CN ]], "raw": "{{ .NotAField }}"}`, []Option{WithDelims("[[", "]]")}, &Analysis{
+			Fields:    []string{"CN"},
+			Functions: []string{"toJson"},
+			Templates: []string{},
+		}, ""},
+		{"fail", `{{ if }}`, nil, nil, "error parsing template: template: template:1: missing value for if"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := AnalyzeTemplate([]byte(tt.text), tt.opts...)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				assert.Nil(t, got)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAnalysis_json(t *testing.T) {
+	a, err := AnalyzeTemplate([]byte(`{{ define "x" }}{{ end }}{"cn": {{ toJson .CN }}}`))
+	require.NoError(t, err)
+	b, err := json.Marshal(a)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"fields": ["CN"], "functions": ["toJson"], "templates": ["x"]}`, string(b))
+
+	a, err = AnalyzeTemplate([]byte(`{}`))
+	require.NoError(t, err)
+	b, err = json.Marshal(a)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"fields": [], "functions": [], "templates": []}`, string(b))
+}
@@ -0,0 +1,52 @@
+package templates
+
+import (
+	"runtime"
+	"sync"
+)
+
+// BatchValidate validates a template with each of the given template data,
+// like ValidateTemplateWithData does, and returns the error of each one, nil
+// if it's valid, at the same index of the data. The template is parsed only
+// once, and the data is validated concurrently by the number of workers set
+// with WithWorkers, by default the number of CPUs. If the template cannot be
+// parsed, the error is returned for every data.
+func BatchValidate(text []byte, datas [][]byte, opts ...Option) []error {
+	errs := make([]error, len(datas))
+	if len(text) == 0 {
+		return errs
+	}
+	t, err := ParseTemplate(text, opts...)
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+
+	workers := t.o.workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(datas) {
+		workers = len(datas)
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			// Each index is written by a single worker.
+			for i := range indexes {
+				errs[i] = t.Validate(datas[i])
+			}
+		}()
+	}
+	for i := range datas {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return errs
+}
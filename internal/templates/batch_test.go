@@ -0,0 +1,101 @@
+package templates
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchValidate(t *testing.T) {
+	text := []byte(`{{ if not .Name }}{{ fail "E_NAME" "name is required" }}{{ end }}{"subject": {"commonName": {{ toJson .Name }}}}`)
+	datas := [][]byte{
+		[]byte(`{"Name": "foo"}`),
+		[]byte(`{}`),
+		[]byte(`{"Name": `),
+		[]byte(`{"Name": "bar"}`),
+		nil,
+	}
+	for _, workers := range []int{0, 1, 2, 10} {
+		t.Run(fmt.Sprintf("workers-%d", workers), func(t *testing.T) {
+			errs := BatchValidate(text, datas, WithWorkers(workers))
+			if assert.Len(t, errs, len(datas)) {
+				assert.NoError(t, errs[0])
+				assert.EqualError(t, errs[1], "error executing template: name is required")
+				var fe *FailError
+				if assert.True(t, errors.As(errs[1], &fe)) {
+					assert.Equal(t, "E_NAME", fe.Code)
+				}
+				var te *TemplateError
+				if assert.True(t, errors.As(errs[2], &te)) {
+					assert.Equal(t, JSONError, te.Kind)
+				}
+				assert.NoError(t, errs[3])
+				assert.EqualError(t, errs[4], "error executing template: name is required")
+			}
+		})
+	}
+
+	// The failures of concurrent executions are not mixed.
+	many := make([][]byte, 200)
+	for i := range many {
+		if i%2 == 0 {
+			many[i] = []byte(fmt.Sprintf(`{"Name": "name-%d"}`, i))
+		}
+	}
+	for i, err := range BatchValidate(text, many, WithWorkers(8)) {
+		if i%2 == 0 {
+			assert.NoError(t, err, i)
+		} else {
+			assert.EqualError(t, err, "error executing template: name is required", i)
+		}
+	}
+}
+
+func TestBatchValidate_parseError(t *testing.T) {
+	errs := BatchValidate([]byte(`{{ if }}`), [][]byte{[]byte(`{}`), []byte(`{"a": 1}`)})
+	if assert.Len(t, errs, 2) {
+		var te *TemplateError
+		if assert.True(t, errors.As(errs[0], &te)) {
+			assert.Equal(t, ParseError, te.Kind)
+		}
+		assert.Same(t, errs[0], errs[1])
+	}
+
+	assert.Equal(t, []error{nil, nil}, BatchValidate(nil, [][]byte{[]byte(`{}`), []byte(`{`)}))
+	assert.Empty(t, BatchValidate([]byte(`{}`), nil))
+}
+
+func batchData(n int) (text []byte, datas [][]byte) {
+	text, data := largeTemplate(100)
+	datas = make([][]byte, n)
+	for i := range datas {
+		datas[i] = data
+	}
+	return text, datas
+}
+
+func BenchmarkBatchValidate(b *testing.B) {
+	text, datas := batchData(100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, err := range BatchValidate(text, datas) {
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkBatchValidate_loop(b *testing.B) {
+	text, datas := batchData(100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, data := range datas {
+			if err := ValidateTemplateWithData(text, data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package templates
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// maxExhaustiveBranches is the maximum number of if conditions for which
+// BranchCoverageValidate renders all their combinations, 2^6 = 64 renders.
+const maxExhaustiveBranches = 6
+
+// Branch is an if condition forced by BranchCoverageValidate.
+type Branch struct {
+	// Line and Column are the 1-based position of the condition of the if in
+	// the template.
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	// Taken is true if the if branch was rendered, and false if the else
+	// branch was, or nothing without one.
+	Taken bool `json:"taken"`
+}
+
+// BranchError is the error returned by BranchCoverageValidate when a
+// combination of branches doesn't render valid JSON. Err is the error of the
+// render, usually a *TemplateError, with the position of the invalid output.
+type BranchError struct {
+	// Branches are the conditions of the render, in the order of the template,
+	// the definitions sorted by name after the main template.
+	Branches []Branch
+	Err      error
+}
+
+// Error implements the error interface and returns the error of the render
+// prefixed by the branches taken, like
+// "error validating branches (if at line 1, column 9: false): ...".
+func (e *BranchError) Error() string {
+	parts := make([]string, len(e.Branches))
+	for i, b := range e.Branches {
+		parts[i] = "if at line " + strconv.Itoa(b.Line) + ", column " + strconv.Itoa(b.Column) + ": " + strconv.FormatBool(b.Taken)
+	}
+	return "error validating branches (" + strings.Join(parts, "; ") + "): " + e.Err.Error()
+}
+
+// Unwrap returns the error of the render.
+func (e *BranchError) Unwrap() error {
+	return e.Err
+}
+
+// BranchCoverageValidate validates a template with its data like
+// ValidateTemplateWithData, and then renders it again forcing the conditions
+// of its if actions, including the else if ones, so the branches that the
+// data doesn't take are validated too. The conditions are replaced by true or
+// false, the rest of the template, like with and range blocks, uses the data
+// as usual, so the data should have the fields used inside the branches. The
+// first combination that fails is returned as a *BranchError.
+//
+// With up to 6 conditions all their combinations are rendered. With more, to
+// bound the number of renders, the template is rendered with all of them true,
+// all of them false, and with each one in turn different from all the others,
+// so every branch is rendered at least once, and the errors that depend on a
+// single branch are found, but not all the ones that need a combination of
+// several.
+func BranchCoverageValidate(text, data []byte, opts ...Option) error {
+	if len(text) == 0 {
+		return nil
+	}
+	t, err := ParseTemplate(text, opts...)
+	if err != nil {
+		return err
+	}
+	if err := t.Validate(data); err != nil {
+		return err
+	}
+
+	var branches []Branch
+	walkBranchConditions(t.tmpl, func(n *parse.IfNode) {
+		line, col := position(t.text, int(n.Position()))
+		branches = append(branches, Branch{Line: line, Column: col})
+	})
+	for _, taken := range branchCombinations(len(branches)) {
+		tmpl, err := forceBranches(t.tmpl, taken)
+		if err != nil {
+			return newTemplateError(ExecError, err, "error executing template: "+err.Error())
+		}
+		ft := &Template{text: t.text, tmpl: tmpl, o: t.o}
+		if err := ft.Validate(data); err != nil {
+			be := &BranchError{Branches: make([]Branch, len(branches)), Err: err}
+			for i, b := range branches {
+				b.Taken = taken[i]
+				be.Branches[i] = b
+			}
+			return be
+		}
+	}
+	return nil
+}
+
+// branchCombinations returns the values of n conditions to render, all the
+// combinations for up to maxExhaustiveBranches conditions, and otherwise all
+// true, all false, and each one different from the others.
+func branchCombinations(n int) [][]bool {
+	if n == 0 {
+		return nil
+	}
+	var combos [][]bool
+	if n <= maxExhaustiveBranches {
+		for bits := 0; bits < 1<<n; bits++ {
+			c := make([]bool, n)
+			for i := range c {
+				c[i] = bits&(1<<i) != 0
+			}
+			combos = append(combos, c)
+		}
+		return combos
+	}
+	for _, all := range []bool{true, false} {
+		c := make([]bool, n)
+		for i := range c {
+			c[i] = all
+		}
+		combos = append(combos, c)
+	}
+	for i := 0; i < n; i++ {
+		for _, all := range []bool{false, true} {
+			c := make([]bool, n)
+			for j := range c {
+				c[j] = all
+			}
+			c[i] = !all
+			combos = append(combos, c)
+		}
+	}
+	return combos
+}
+
+// walkBranchConditions calls fn for each if of tmpl and its associated
+// templates, in the same order on every copy of them: the main template first
+// and the others sorted by name.
+func walkBranchConditions(tmpl *template.Template, fn func(*parse.IfNode)) {
+	ts := tmpl.Templates()
+	sort.Slice(ts, func(i, j int) bool {
+		if ts[i].Name() == tmpl.Name() || ts[j].Name() == tmpl.Name() {
+			return ts[i].Name() == tmpl.Name()
+		}
+		return ts[i].Name() < ts[j].Name()
+	})
+	for _, t := range ts {
+		if t.Tree == nil {
+			continue
+		}
+		walkTree(t.Tree.Root, func(node parse.Node) bool {
+			if n, ok := node.(*parse.IfNode); ok {
+				fn(n)
+			}
+			return true
+		})
+	}
+}
+
+// forceBranches returns a clone of tmpl with copies of the parse trees where
+// the condition of the i-th if, in the order of walkBranchConditions, is
+// replaced by the constant taken[i].
+func forceBranches(tmpl *template.Template, taken []bool) (*template.Template, error) {
+	clone, err := tmpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+	// The trees are shared with the original template.
+	for _, t := range clone.Templates() {
+		if t.Tree != nil {
+			t.Tree = t.Tree.Copy()
+		}
+	}
+	i := 0
+	walkBranchConditions(clone, func(n *parse.IfNode) {
+		pos := n.Pipe.Position()
+		n.Pipe = &parse.PipeNode{
+			NodeType: parse.NodePipe,
+			Pos:      pos,
+			Line:     n.Pipe.Line,
+			Cmds: []*parse.CommandNode{{
+				NodeType: parse.NodeCommand,
+				Pos:      pos,
+				Args:     []parse.Node{&parse.BoolNode{NodeType: parse.NodeBool, Pos: pos, True: taken[i]}},
+			}},
+		}
+		i++
+	})
+	return clone, nil
+}
@@ -0,0 +1,106 @@
+package templates
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBranchCoverageValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		data    string
+		opts    []Option
+		wantErr string
+	}{
+		{"ok/empty", ``, `{}`, nil, ""},
+		{"ok/no-branches", `{"cn": {{ toJson .CN }}}`, `{"CN": "foo"}`, nil, ""},
+		{"ok/if-else", `{"isCA": {{ if .IsCA }}true{{ else }}false{{ end }}}`, `{"IsCA": true}`, nil, ""},
+		{"ok/if", `{"cn": "foo"{{ if .SANs }}, "sans": {{ toJson .SANs }}{{ end }}}`, `{}`, nil, ""},
+		{"ok/else-if", `{"type": {{ if eq .T "a" }}"a"{{ else if eq .T "b" }}"b"{{ else }}"c"{{ end }}}`, `{"T": "a"}`, nil, ""},
+		{"ok/define", `{{ define "ca" }}{{ if .IsCA }}true{{ else }}false{{ end }}{{ end }}{"isCA": {{ template "ca" . }}}`, `{"IsCA": false}`, nil, ""},
+		{"fail/else", `{"isCA": {{ if .IsCA }}true{{ else }}flase{{ end }}}`, `{"IsCA": true}`, nil,
+			"error validating branches (if at line 1, column 16: false): error validating json template data: invalid JSON at template line 1, column 39: invalid character 'l' in literal false (expecting 'a')"},
+		{"fail/if", `{"cn": "foo"{{ if .SANs }} "sans": {{ toJson .SANs }}{{ end }}}`, `{}`, nil,
+			"error validating branches (if at line 1, column 19: true): error validating json template data: invalid JSON at template line 1, column 28: invalid character '\"' after object key:value pair"},
+		{"fail/combination", `{"a": 1{{ if .A }},{{ end }}{{ if .B }} "b": 2{{ end }}}`, `{"A": true, "B": true}`, nil,
+			"error validating branches (if at line 1, column 14: true; if at line 1, column 35: false): error validating json template data: invalid JSON at template line 1, column 56: invalid character '}' looking for beginning of object key string"},
+		{"fail/data", `{"isCA": {{ if .IsCA }}true{{ else }}false{{ end }}}`, `{`, nil,
+			"error validating json template data: invalid JSON at (root) (line 1, column 1): unexpected end of JSON input"},
+		{"fail/strict", `{"cn": {{ if .CN }}{{ toJson .CN }}{{ else }}{{ toJson .Default }}{{ end }}}`, `{"CN": "foo"}`, []Option{WithStrict(true)},
+			"error validating branches (if at line 1, column 14: false): error executing template: missing key \"Default\" in .Default: template: template:1:55: executing \"template\" at <.Default>: map has no entry for key \"Default\""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := BranchCoverageValidate([]byte(tt.text), []byte(tt.data), tt.opts...)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestBranchCoverageValidate_error(t *testing.T) {
+	text := []byte("{\"a\": 1,\n{{ if .A }}\"b\": 2{{ else }}\"b\": {{ end }}}")
+	err := BranchCoverageValidate(text, []byte(`{"A": true}`))
+	var be *BranchError
+	require.True(t, errors.As(err, &be))
+	assert.Equal(t, []Branch{{Line: 2, Column: 7, Taken: false}}, be.Branches)
+	var te *TemplateError
+	if assert.True(t, errors.As(err, &te)) {
+		assert.Equal(t, JSONError, te.Kind)
+		assert.Equal(t, 2, te.Line)
+	}
+
+	// The original template is not modified.
+	tmpl, err := ParseTemplate(text)
+	require.NoError(t, err)
+	_, err = forceBranches(tmpl.tmpl, []bool{false})
+	require.NoError(t, err)
+	assert.NoError(t, tmpl.Validate([]byte(`{"A": true}`)))
+}
+
+func TestBranchCoverageValidate_many(t *testing.T) {
+	// Only the tenth condition false breaks the output.
+	var sb strings.Builder
+	sb.WriteString(`{"a": 0`)
+	for i := 0; i < 10; i++ {
+		if i == 9 {
+			fmt.Fprintf(&sb, `{{ if .C%d }}, "c%d": %d{{ else }}, "c%d"{{ end }}`, i, i, i, i)
+		} else {
+			fmt.Fprintf(&sb, `{{ if .C%d }}, "c%d": %d{{ end }}`, i, i, i)
+		}
+	}
+	sb.WriteString(`}`)
+
+	err := BranchCoverageValidate([]byte(sb.String()), []byte(`{"C9": true}`))
+	var be *BranchError
+	if assert.True(t, errors.As(err, &be)) && assert.Len(t, be.Branches, 10) {
+		assert.False(t, be.Branches[9].Taken)
+	}
+}
+
+func Test_branchCombinations(t *testing.T) {
+	assert.Nil(t, branchCombinations(0))
+	assert.Equal(t, [][]bool{{false}, {true}}, branchCombinations(1))
+	assert.Len(t, branchCombinations(maxExhaustiveBranches), 1<<maxExhaustiveBranches)
+
+	n := maxExhaustiveBranches + 1
+	combos := branchCombinations(n)
+	assert.Len(t, combos, 2*n+2)
+	for i := 0; i < n; i++ {
+		var taken, notTaken bool
+		for _, c := range combos {
+			taken = taken || c[i]
+			notTaken = notTaken || !c[i]
+		}
+		assert.True(t, taken && notTaken, "condition %d", i)
+	}
+}
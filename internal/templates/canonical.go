@@ -0,0 +1,353 @@
+package templates
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// canonicalJSON returns the canonical form of the JSON document data defined
+// by the JSON Canonicalization Scheme (JCS) of RFC 8785, so the same document
+// always has the same bytes, like when they are signed: without white space,
+// with the keys of the objects sorted by their UTF-16 code units, the strings
+// with the minimal escaping, and the numbers in the shortest form of ECMAScript
+// for their IEEE 754 double value. The document must be valid JSON that is
+// also I-JSON, RFC 7493, so a duplicate key, a string that is not valid
+// Unicode, like a lone surrogate, or a number that is not a finite double is
+// an error.
+func canonicalJSON(data []byte) ([]byte, error) {
+	var v json.RawMessage
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("error canonicalizing json: %w", err)
+	}
+	c := &canonicalizer{data: data}
+	out, err := c.value()
+	if err != nil {
+		return nil, fmt.Errorf("error canonicalizing json: %w", err)
+	}
+	return out, nil
+}
+
+// canonicalizer writes the canonical form of a valid JSON document.
+type canonicalizer struct {
+	data []byte
+	i    int
+}
+
+func (c *canonicalizer) skipSpace() {
+	for c.i < len(c.data) && isTrimSpace(c.data[c.i]) {
+		c.i++
+	}
+}
+
+// value returns the canonical form of the value at the current position.
+func (c *canonicalizer) value() ([]byte, error) {
+	c.skipSpace()
+	switch ch := c.data[c.i]; ch {
+	case '{':
+		return c.object()
+	case '[':
+		return c.array()
+	case '"':
+		s, err := c.string()
+		if err != nil {
+			return nil, err
+		}
+		return appendCanonicalString(nil, s), nil
+	case 't', 'n':
+		c.i += 4
+		return c.data[c.i-4 : c.i], nil
+	case 'f':
+		c.i += 5
+		return c.data[c.i-5 : c.i], nil
+	default:
+		return c.number()
+	}
+}
+
+// canonicalMember is a member of an object with its canonical value.
+type canonicalMember struct {
+	key   string
+	utf16 []uint16
+	value []byte
+}
+
+func (c *canonicalizer) object() ([]byte, error) {
+	c.i++
+	var members []canonicalMember
+	seen := make(map[string]bool)
+	for {
+		c.skipSpace()
+		if c.data[c.i] == '}' {
+			c.i++
+			break
+		}
+		if c.data[c.i] == ',' {
+			c.i++
+			c.skipSpace()
+		}
+		key, err := c.string()
+		if err != nil {
+			return nil, err
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("duplicate key %q", key)
+		}
+		seen[key] = true
+		c.skipSpace()
+		c.i++ // the colon
+		value, err := c.value()
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, canonicalMember{key: key, utf16: utf16.Encode([]rune(key)), value: value})
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		a, b := members[i].utf16, members[j].utf16
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	out := []byte{'{'}
+	for i, m := range members {
+		if i > 0 {
+			out = append(out, ',')
+		}
+		out = appendCanonicalString(out, m.key)
+		out = append(out, ':')
+		out = append(out, m.value...)
+	}
+	return append(out, '}'), nil
+}
+
+func (c *canonicalizer) array() ([]byte, error) {
+	c.i++
+	out := []byte{'['}
+	for {
+		c.skipSpace()
+		switch c.data[c.i] {
+		case ']':
+			c.i++
+			return append(out, ']'), nil
+		case ',':
+			c.i++
+			out = append(out, ',')
+		}
+		value, err := c.value()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, value...)
+	}
+}
+
+// string returns the decoded string at the current position. Unlike
+// encoding/json, that replaces them, invalid UTF-8 and lone surrogates are an
+// error.
+func (c *canonicalizer) string() (string, error) {
+	c.i++
+	var sb strings.Builder
+	for {
+		start := c.i
+		for c.data[c.i] != '"' && c.data[c.i] != '\\' {
+			c.i++
+		}
+		if !utf8.Valid(c.data[start:c.i]) {
+			return "", errors.New("string is not valid UTF-8")
+		}
+		sb.Write(c.data[start:c.i])
+		if c.data[c.i] == '"' {
+			c.i++
+			return sb.String(), nil
+		}
+
+		c.i++
+		switch e := c.data[c.i]; e {
+		case 'u':
+			r := c.hex4()
+			if utf16.IsSurrogate(r) {
+				var r2 rune = -1
+				if c.i+1 < len(c.data) && c.data[c.i] == '\\' && c.data[c.i+1] == 'u' {
+					c.i++
+					r2 = c.hex4()
+				}
+				if r = utf16.DecodeRune(r, r2); r == utf8.RuneError {
+					return "", errors.New("string has a lone surrogate")
+				}
+			}
+			sb.WriteRune(r)
+			continue
+		case 'b':
+			sb.WriteByte('\b')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 't':
+			sb.WriteByte('\t')
+		default:
+			// The quote, the reverse solidus and the solidus.
+			sb.WriteByte(e)
+		}
+		c.i++
+	}
+}
+
+// hex4 returns the code unit of the four hexadecimal digits after the 'u' of
+// an escape sequence at the current position, and moves after them.
+func (c *canonicalizer) hex4() rune {
+	n, _ := strconv.ParseUint(string(c.data[c.i+1:c.i+5]), 16, 16)
+	c.i += 5
+	return rune(n)
+}
+
+func (c *canonicalizer) number() ([]byte, error) {
+	start := c.i
+	for c.i < len(c.data) && strings.IndexByte("+-.0123456789eE", c.data[c.i]) >= 0 {
+		c.i++
+	}
+	s := string(c.data[start:c.i])
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsInf(f, 0) {
+		return nil, fmt.Errorf("number %s is not a finite IEEE 754 double", s)
+	}
+	return []byte(formatES6Number(f)), nil
+}
+
+// formatES6Number returns the shortest form of the finite number f like
+// Number.prototype.toString of ECMAScript, the serialization of numbers of
+// RFC 8785.
+func formatES6Number(f float64) string {
+	if f == 0 {
+		// Both 0 and -0.
+		return "0"
+	}
+	var sign string
+	if f < 0 {
+		sign, f = "-", -f
+	}
+	// The shortest digits that round trip, and the position n of the
+	// decimal point, like in ECMAScript: f = 0.digits * 10^n.
+	e := strconv.FormatFloat(f, 'e', -1, 64)
+	i := strings.IndexByte(e, 'e')
+	digits := strings.Replace(e[:i], ".", "", 1)
+	exp, _ := strconv.Atoi(e[i+1:])
+	n, k := exp+1, len(digits)
+
+	switch {
+	case k <= n && n <= 21:
+		return sign + digits + strings.Repeat("0", n-k)
+	case 0 < n && n <= 21:
+		return sign + digits[:n] + "." + digits[n:]
+	case -6 < n && n <= 0:
+		return sign + "0." + strings.Repeat("0", -n) + digits
+	}
+	s := sign + digits[:1]
+	if k > 1 {
+		s += "." + digits[1:]
+	}
+	if n-1 >= 0 {
+		return s + "e+" + strconv.Itoa(n-1)
+	}
+	return s + "e-" + strconv.Itoa(1-n)
+}
+
+// appendCanonicalString appends the JSON string s with the escaping of RFC
+// 8785: only the quote, the reverse solidus and the control characters are
+// escaped, with the short forms when JSON has them.
+func appendCanonicalString(out []byte, s string) []byte {
+	out = append(out, '"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\':
+			out = append(out, '\\', c)
+		case '\b':
+			out = append(out, '\\', 'b')
+		case '\f':
+			out = append(out, '\\', 'f')
+		case '\n':
+			out = append(out, '\\', 'n')
+		case '\r':
+			out = append(out, '\\', 'r')
+		case '\t':
+			out = append(out, '\\', 't')
+		default:
+			if c < 0x20 {
+				out = append(out, fmt.Sprintf("\\u%04x", c)...)
+			} else {
+				out = append(out, c)
+			}
+		}
+	}
+	return append(out, '"')
+}
+
+// canonicalJSONValue returns the canonical form of v like canonicalJSON. A
+// string or a byte slice is a JSON document, and any other value, like an
+// object of the template data, is encoded as JSON first.
+func canonicalJSONValue(v interface{}) (string, error) {
+	var data []byte
+	switch s := v.(type) {
+	case string:
+		data = []byte(s)
+	case []byte:
+		data = s
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", fmt.Errorf("error canonicalizing json: %w", err)
+		}
+		data = b
+	}
+	out, err := canonicalJSON(data)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// RenderCanonical executes the template like Render, validates the output,
+// and returns it in the canonical form of the JSON Canonicalization Scheme of
+// RFC 8785, so the same certificate definition is always rendered to the same
+// bytes, for example to sign it. Unlike the formats of WithRenderMode, the
+// keys are sorted and the strings and numbers are encoded again, and a
+// duplicate key, a string that is not valid Unicode or a number that is too
+// large, is a JSONError.
+func (t *Template) RenderCanonical(data []byte, opts ...Option) ([]byte, error) {
+	if len(opts) > 0 {
+		o := *t.o
+		for _, fn := range opts {
+			fn(&o)
+		}
+		t = &Template{text: t.text, tmpl: t.tmpl, o: &o}
+	}
+	out, m, err := t.render(context.Background(), "", data, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateOutput(out, t.text, m, t.o); err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil, nil
+	}
+	canonical, err := canonicalJSON(out)
+	if err != nil {
+		return nil, newTemplateError(JSONError, err, err.Error())
+	}
+	return canonical, nil
+}
@@ -0,0 +1,150 @@
+package templates
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_canonicalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    string
+		wantErr string
+	}{
+		// RFC 8785, section 3.2.2.
+		{"ok/rfc8785", `{
+  "numbers": [333333333.33333329, 1E30, 4.50, 2e-3, 0.000000000000000000000000001],
+  "string": "\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/",
+  "literals": [null, true, false]
+}`, `{"literals":[null,true,false],"numbers":[333333333.3333333,1e+30,4.5,0.002,1e-27],"string":"€$\u000f\nA'B\"\\\\\"/"}`, ""},
+		// RFC 8785, section 3.2.3.
+		{"ok/sorting", `{
+  "€": "Euro Sign",
+  "\r": "Carriage Return",
+  "דּ": "Hebrew Letter Dalet With Dagesh",
+  "1": "One",
+  "😀": "Emoji: Grinning Face",
+  "\u0080": "Control",
+  "ö": "Latin Small Letter O With Diaeresis"
+}`, `{"\r":"Carriage Return","1":"One","` + "\u0080" + `":"Control","ö":"Latin Small Letter O With Diaeresis","€":"Euro Sign","😀":"Emoji: Grinning Face","` + "\ufb33" + `":"Hebrew Letter Dalet With Dagesh"}`, ""},
+		{"ok/nested", ` { "b" : [ 1 , { "d" : 2, "c" : [] } ] , "a" : {} } `, `{"a":{},"b":[1,{"c":[],"d":2}]}`, ""},
+		{"ok/controls", `"\u0000\u001f\b\t\u007f"`, `"\u0000\u001f\b\t` + "\u007f" + `"`, ""},
+		{"ok/underflow", `[1e-400, -0.0]`, `[0,0]`, ""},
+		{"ok/literal", `true`, `true`, ""},
+		{"fail/duplicate", `{"a": 1, "b": {"c": 1, "c": 2}}`, "", `error canonicalizing json: duplicate key "c"`},
+		{"fail/lone-surrogate", `["\ud83d"]`, "", "error canonicalizing json: string has a lone surrogate"},
+		{"fail/invalid-surrogate-pair", `["\ude00\ud83d"]`, "", "error canonicalizing json: string has a lone surrogate"},
+		{"fail/utf8", "[\"\xff\"]", "", "error canonicalizing json: string is not valid UTF-8"},
+		{"fail/overflow", `{"n": 1e400}`, "", "error canonicalizing json: number 1e400 is not a finite IEEE 754 double"},
+		{"fail/syntax", `{"a": 1,}`, "", "error canonicalizing json: invalid character '}' looking for beginning of object key string"},
+		{"fail/empty", ``, "", "error canonicalizing json: unexpected end of JSON input"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := canonicalJSON([]byte(tt.data))
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
+
+func Test_formatES6Number(t *testing.T) {
+	// RFC 8785, appendix B.
+	tests := []struct {
+		bits uint64
+		want string
+	}{
+		{0x0000000000000000, "0"},
+		{0x8000000000000000, "0"},
+		{0x0000000000000001, "5e-324"},
+		{0x8000000000000001, "-5e-324"},
+		{0x7fefffffffffffff, "1.7976931348623157e+308"},
+		{0xffefffffffffffff, "-1.7976931348623157e+308"},
+		{0x4340000000000000, "9007199254740992"},
+		{0xc340000000000000, "-9007199254740992"},
+		{0x4430000000000000, "295147905179352830000"},
+		{0x44b52d02c7e14af5, "9.999999999999997e+22"},
+		{0x44b52d02c7e14af6, "1e+23"},
+		{0x44b52d02c7e14af7, "1.0000000000000001e+23"},
+		{0x444b1ae4d6e2ef4e, "999999999999999700000"},
+		{0x444b1ae4d6e2ef4f, "999999999999999900000"},
+		{0x444b1ae4d6e2ef50, "1e+21"},
+		{0x3eb0c6f7a0b5ed8c, "9.999999999999997e-7"},
+		{0x3eb0c6f7a0b5ed8d, "0.000001"},
+		{0x41b3de4355555553, "333333333.3333332"},
+		{0x41b3de4355555554, "333333333.33333325"},
+		{0x41b3de4355555555, "333333333.3333333"},
+		{0x41b3de4355555556, "333333333.3333334"},
+		{0x41b3de4355555557, "333333333.33333343"},
+		{0xbecbf647612f3696, "-0.0000033333333333333333"},
+		{0x43143ff3c1cb0959, "1424953923781206.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, tt.want, formatES6Number(math.Float64frombits(tt.bits)))
+		})
+	}
+}
+
+func TestTemplate_canonicalJSON(t *testing.T) {
+	text := []byte(`{"subject": {"commonName": {{ .CN | jsonQuote }}}, "claims": {{ canonicalJSON .Claims }}, "raw": {{ canonicalJSON .Raw | jsonQuote }}}`)
+	tmpl, err := ParseTemplate(text)
+	require.NoError(t, err)
+	out, err := tmpl.Render([]byte(`{"CN": "foo", "Claims": {"sub": "foo", "aud": ["b", "a"], "exp": 1.0E9}, "Raw": "{\"b\": 1, \"a\": 2}"}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"subject": {"commonName": "foo"}, "claims": {"aud":["b","a"],"exp":1000000000,"sub":"foo"}, "raw": "{\"a\":2,\"b\":1}"}`, string(out))
+
+	err = tmpl.Validate([]byte(`{"CN": "foo", "Claims": {}, "Raw": "{\"a\": 1, \"a\": 2}"}`))
+	assert.EqualError(t, err, `error executing template: error canonicalizing json: duplicate key "a"`)
+
+	lints, err := LintTemplate(text)
+	require.NoError(t, err)
+	assert.Empty(t, lints)
+}
+
+func TestTemplate_RenderCanonical(t *testing.T) {
+	text := []byte(`{
+	"subject": {{ toJson .Subject }},
+	"sans": {{ toJson .SANs }},
+	"keyUsage": ["digitalSignature"]
+}`)
+	tmpl, err := ParseTemplate(text)
+	require.NoError(t, err)
+
+	want := `{"keyUsage":["digitalSignature"],"sans":[{"type":"dns","value":"foo.example.com"}],"subject":{"commonName":"foo","country":"US"}}`
+	out, err := tmpl.RenderCanonical([]byte(`{"Subject": {"country": "US", "commonName": "foo"}, "SANs": [{"value": "foo.example.com", "type": "dns"}]}`))
+	require.NoError(t, err)
+	assert.Equal(t, want, string(out))
+
+	// The same definition with the keys in another order.
+	out, err = tmpl.RenderCanonical([]byte(`{"SANs": [{"type": "dns", "value": "foo.example.com"}], "Subject": {"commonName": "foo", "country": "US"}}`))
+	require.NoError(t, err)
+	assert.Equal(t, want, string(out))
+
+	tmpl, err = ParseTemplate([]byte(`{"subject": {{ toJson .Subject }}, "serialNumber": 1e400}`))
+	require.NoError(t, err)
+	_, err = tmpl.RenderCanonical([]byte(`{"Subject": {"commonName": "foo"}}`))
+	assert.EqualError(t, err, "error canonicalizing json: number 1e400 is not a finite IEEE 754 double")
+	var te *TemplateError
+	require.ErrorAs(t, err, &te)
+	assert.Equal(t, JSONError, te.Kind)
+
+	tmpl, err = ParseTemplate([]byte(`{"a": 1, "a": 2}`))
+	require.NoError(t, err)
+	_, err = tmpl.RenderCanonical(nil)
+	assert.Error(t, err)
+
+	tmpl, err = ParseTemplate([]byte(`{{ if .Empty }}{}{{ end }}`))
+	require.NoError(t, err)
+	out, err = tmpl.RenderCanonical(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, out)
+}
@@ -0,0 +1,184 @@
+package templates
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// RenderDiff is the difference between the outputs of two templates rendered
+// by CompareRenders. The paths use the notation of TemplateError.Path, like
+// "extKeyUsage[1]", and "(root)" for the whole document.
+type RenderDiff struct {
+	// Added are the values only in the output of the new template.
+	Added []DiffValue `json:"added"`
+	// Removed are the values only in the output of the old template.
+	Removed []DiffValue `json:"removed"`
+	// Changed are the values in both outputs with a different value.
+	Changed []DiffChange `json:"changed"`
+}
+
+// DiffValue is a value added or removed in a RenderDiff.
+type DiffValue struct {
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// DiffChange is a value changed in a RenderDiff.
+type DiffChange struct {
+	Path string          `json:"path"`
+	Old  json.RawMessage `json:"old"`
+	New  json.RawMessage `json:"new"`
+}
+
+// IsEmpty reports whether the outputs are the same.
+func (d *RenderDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// CompareRenders renders the old and the new template text with the same
+// template data and returns the difference of their outputs, normalized with
+// NormalizeJSON so the white space and the order of the keys don't matter, as
+// the JSON encoding of a RenderDiff, like
+// {"added": [{"path": "extKeyUsage[1]", "value": "clientAuth"}], ...}. Objects
+// are compared by key and arrays by index, so a value inserted in an array
+// changes the elements after it. The options are used to parse and render
+// both templates.
+//
+// If a template cannot be rendered, or its output is not valid JSON, the error
+// is returned saying if it's the old or the new template, and if both fail,
+// both errors are returned in an Errors.
+func CompareRenders(oldText, newText, data []byte, opts ...Option) (string, error) {
+	d, err := compareRenders(oldText, newText, data, opts)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error encoding diff: %w", err)
+	}
+	return string(b), nil
+}
+
+func compareRenders(oldText, newText, data []byte, opts []Option) (*RenderDiff, error) {
+	oldValue, oldErr := renderValue(oldText, data, opts)
+	if oldErr != nil {
+		oldErr = fmt.Errorf("error rendering the old template: %w", oldErr)
+	}
+	newValue, newErr := renderValue(newText, data, opts)
+	if newErr != nil {
+		newErr = fmt.Errorf("error rendering the new template: %w", newErr)
+	}
+	switch {
+	case oldErr != nil && newErr != nil:
+		return nil, Errors{oldErr, newErr}
+	case oldErr != nil:
+		return nil, oldErr
+	case newErr != nil:
+		return nil, newErr
+	}
+
+	d := &RenderDiff{
+		Added:   []DiffValue{},
+		Removed: []DiffValue{},
+		Changed: []DiffChange{},
+	}
+	d.compare("", oldValue, newValue)
+	return d, nil
+}
+
+// renderValue renders text with data and returns the normalized output
+// decoded with UseNumber, or nil for an empty output.
+func renderValue(text, data []byte, opts []Option) (interface{}, error) {
+	tmpl, err := ParseTemplate(text, opts...)
+	if err != nil {
+		return nil, err
+	}
+	// The output is validated like in Validate, so the errors have the
+	// position in the template.
+	out, err := tmpl.Render(data, WithRenderMode(RenderCompact))
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil, nil
+	}
+	out, err = NormalizeJSON(out)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(out))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// compare adds to d the differences between the values a and b at path.
+func (d *RenderDiff) compare(path string, a, b interface{}) {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		if bv, ok := b.(map[string]interface{}); ok {
+			keys := make([]string, 0, len(av)+len(bv))
+			for k := range av {
+				keys = append(keys, k)
+			}
+			for k := range bv {
+				if _, ok := av[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				d.compareMember(joinPath(path, k), av, bv, k)
+			}
+			return
+		}
+	case []interface{}:
+		if bv, ok := b.([]interface{}); ok {
+			for i := 0; i < len(av) || i < len(bv); i++ {
+				switch {
+				case i >= len(bv):
+					d.Removed = append(d.Removed, DiffValue{Path: displayPath(indexPath(path, i)), Value: rawValue(av[i])})
+				case i >= len(av):
+					d.Added = append(d.Added, DiffValue{Path: displayPath(indexPath(path, i)), Value: rawValue(bv[i])})
+				default:
+					d.compare(indexPath(path, i), av[i], bv[i])
+				}
+			}
+			return
+		}
+	}
+	if ra, rb := rawValue(a), rawValue(b); !bytes.Equal(ra, rb) {
+		d.Changed = append(d.Changed, DiffChange{Path: displayPath(path), Old: ra, New: rb})
+	}
+}
+
+// compareMember adds to d the differences in the member k of the objects a
+// and b.
+func (d *RenderDiff) compareMember(path string, a, b map[string]interface{}, k string) {
+	av, inA := a[k]
+	bv, inB := b[k]
+	switch {
+	case !inB:
+		d.Removed = append(d.Removed, DiffValue{Path: path, Value: rawValue(av)})
+	case !inA:
+		d.Added = append(d.Added, DiffValue{Path: path, Value: rawValue(bv)})
+	default:
+		d.compare(path, av, bv)
+	}
+}
+
+// rawValue returns the compact JSON encoding of a decoded value.
+func rawValue(v interface{}) json.RawMessage {
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return json.RawMessage("null")
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n")
+}
@@ -0,0 +1,98 @@
+package templates
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareRenders(t *testing.T) {
+	data := []byte(`{"CN": "foo.example.com", "SANs": ["foo.example.com"]}`)
+	oldText := []byte(`{"subject": {"commonName": {{ toJson .CN }}}, "sans": {{ toJson .SANs }}, "extKeyUsage": ["serverAuth"], "keyUsage": ["digitalSignature", "keyEncipherment"]}`)
+	tests := []struct {
+		name    string
+		newText string
+		want    *RenderDiff
+	}{
+		{"same", `{
+			"keyUsage": ["digitalSignature", "keyEncipherment"],
+			"extKeyUsage": ["serverAuth"],
+			"sans": {{ toJson .SANs }},
+			"subject": {"commonName": {{ toJson .CN }}}
+		}`, &RenderDiff{Added: []DiffValue{}, Removed: []DiffValue{}, Changed: []DiffChange{}}},
+		{"added", `{"subject": {"commonName": {{ toJson .CN }}, "organization": "Acme"}, "sans": {{ toJson .SANs }}, "extKeyUsage": ["serverAuth", "clientAuth"], "keyUsage": ["digitalSignature", "keyEncipherment"]}`, &RenderDiff{
+			Added: []DiffValue{
+				{Path: "extKeyUsage[1]", Value: json.RawMessage(`"clientAuth"`)},
+				{Path: "subject.organization", Value: json.RawMessage(`"Acme"`)},
+			},
+			Removed: []DiffValue{},
+			Changed: []DiffChange{},
+		}},
+		{"removed-changed", `{"subject": {"commonName": {{ .CN | upper | toJson }}}, "extKeyUsage": "serverAuth", "keyUsage": ["digitalSignature"]}`, &RenderDiff{
+			Added: []DiffValue{},
+			Removed: []DiffValue{
+				{Path: "keyUsage[1]", Value: json.RawMessage(`"keyEncipherment"`)},
+				{Path: "sans", Value: json.RawMessage(`["foo.example.com"]`)},
+			},
+			Changed: []DiffChange{
+				{Path: "extKeyUsage", Old: json.RawMessage(`["serverAuth"]`), New: json.RawMessage(`"serverAuth"`)},
+				{Path: "subject.commonName", Old: json.RawMessage(`"foo.example.com"`), New: json.RawMessage(`"FOO.EXAMPLE.COM"`)},
+			},
+		}},
+		{"root", `[1, 2]`, &RenderDiff{
+			Added:   []DiffValue{},
+			Removed: []DiffValue{},
+			Changed: []DiffChange{
+				{Path: "(root)", Old: json.RawMessage(`{"extKeyUsage":["serverAuth"],"keyUsage":["digitalSignature","keyEncipherment"],"sans":["foo.example.com"],"subject":{"commonName":"foo.example.com"}}`), New: json.RawMessage(`[1,2]`)},
+			},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CompareRenders(oldText, []byte(tt.newText), data)
+			require.NoError(t, err)
+			want, err := json.MarshalIndent(tt.want, "", "  ")
+			require.NoError(t, err)
+			assert.JSONEq(t, string(want), got)
+
+			d, err := compareRenders(oldText, []byte(tt.newText), data, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tt.name == "same", d.IsEmpty())
+		})
+	}
+}
+
+func TestCompareRenders_numbers(t *testing.T) {
+	got, err := CompareRenders([]byte(`{"maxPathLen": 1, "big": 12345678901234567890}`), []byte(`{"maxPathLen": 1.0, "big": 12345678901234567891}`), nil)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"added": [], "removed": [], "changed": [
+		{"path": "big", "old": 12345678901234567890, "new": 12345678901234567891},
+		{"path": "maxPathLen", "old": 1, "new": 1.0}
+	]}`, got)
+}
+
+func TestCompareRenders_errors(t *testing.T) {
+	valid := []byte(`{"a": {{ toJson .A }}}`)
+	invalid := []byte(`{"a": {{ .A }}}`)
+	data := []byte(`{"A": "foo"}`)
+
+	_, err := CompareRenders(valid, invalid, data)
+	assert.EqualError(t, err, "error rendering the new template: error validating json template data: invalid JSON at offset 7, near template line 1, column 10: invalid character 'o' in literal false (expecting 'a')")
+	var te *TemplateError
+	if assert.True(t, errors.As(err, &te)) {
+		assert.Equal(t, JSONError, te.Kind)
+	}
+
+	_, err = CompareRenders([]byte(`{{ fail "no" }}`), valid, data)
+	assert.EqualError(t, err, "error rendering the old template: error executing template: no")
+
+	_, err = CompareRenders([]byte(`{{ if }}`), invalid, data)
+	var errs Errors
+	if assert.True(t, errors.As(err, &errs)) && assert.Len(t, errs, 2) {
+		assert.EqualError(t, errs[0], "error rendering the old template: error parsing template: template: template:1: missing value for if")
+		assert.ErrorContains(t, errs[1], "error rendering the new template: ")
+	}
+}
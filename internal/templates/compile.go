@@ -0,0 +1,90 @@
+package templates
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+// CompiledTemplate is the cacheable form of a Template, returned by Compile
+// and loaded with LoadTemplate, so a service that loads many templates when
+// it starts can store them, encoded as JSON, and skip the work already done
+// on the source. A parsed text/template cannot be serialized, so the source
+// is parsed again when it's loaded, but if it hasn't changed, the checks of
+// ParseTemplate that only depend on the source are skipped, and the analysis
+// of the template is not done again.
+type CompiledTemplate struct {
+	// Hash is the content hash of the source, like TemplateHash returns, so it
+	// can be used as the key of a cache.
+	Hash string `json:"hash"`
+	// FuncMapVersion is the version of the functions the template was parsed
+	// with.
+	FuncMapVersion int `json:"funcMapVersion"`
+	// LeftDelim and RightDelim are the delimiters the template was parsed with.
+	LeftDelim  string `json:"leftDelim"`
+	RightDelim string `json:"rightDelim"`
+	// Source is the text of the template.
+	Source string `json:"source"`
+	// Analysis is the structure of the template, like AnalyzeTemplate returns.
+	Analysis *Analysis `json:"analysis"`
+}
+
+// TemplateHash returns the hex encoded SHA-256 digest of the text of a
+// template, the Hash of its CompiledTemplate.
+func TemplateHash(text []byte) string {
+	sum := sha256.Sum256(text)
+	return hex.EncodeToString(sum[:])
+}
+
+// Compile returns the CompiledTemplate of the template, with its source, the
+// delimiters and the version of the functions it was parsed with, and its
+// analysis.
+func (t *Template) Compile() (*CompiledTemplate, error) {
+	a := t.analysis
+	if a == nil {
+		var err error
+		if a, err = analyzeTemplate(t.text, t.o); err != nil {
+			return nil, err
+		}
+	}
+	left, right := t.o.delims()
+	return &CompiledTemplate{
+		Hash:           TemplateHash(t.text),
+		FuncMapVersion: funcMapVersion,
+		LeftDelim:      left,
+		RightDelim:     right,
+		Source:         string(t.text),
+		Analysis:       a,
+	}, nil
+}
+
+// LoadTemplate returns the Template of a CompiledTemplate, parsed with the
+// given options like ParseTemplate does. The output of the template is the
+// same as the one of the template it was compiled from with the same options.
+//
+// If the Hash is the one of the source, and the version of the functions and
+// the delimiters are the same ones used to parse it, the checks already done
+// on the source are skipped, like the {{/* requires funcmap >= N */}} comment
+// and the names of the templates and variables. The options are always
+// checked, so a denied function is still a ParseError. Otherwise, the source
+// has changed or it was compiled by another version of this package, and it's
+// parsed and analyzed like a new template.
+func LoadTemplate(c *CompiledTemplate, opts ...Option) (*Template, error) {
+	if c == nil {
+		err := errors.New("compiled template is nil")
+		return nil, newTemplateError(ParseError, err, "error parsing template: "+err.Error())
+	}
+	text := []byte(c.Source)
+	o := newOptions(opts)
+	left, right := o.delims()
+	if c.Hash != TemplateHash(text) || c.FuncMapVersion != funcMapVersion ||
+		c.LeftDelim != left || c.RightDelim != right || c.Analysis == nil {
+		return parseTemplate(text, o, true)
+	}
+	t, err := parseTemplate(text, o, false)
+	if err != nil {
+		return nil, err
+	}
+	t.analysis = c.Analysis
+	return t, nil
+}
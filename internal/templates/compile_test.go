@@ -0,0 +1,142 @@
+package templates
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplate_Compile(t *testing.T) {
+	text := []byte(`{{ define "cn" }}{{ toJson .CommonName }}{{ end }}{"subject": {"commonName": {{ template "cn" .Subject }}}, "sans": {{ toJson .SANs }}}`)
+	data := []byte(`{"Subject": {"CommonName": "foo"}, "SANs": ["foo", "bar"]}`)
+	tmpl, err := ParseTemplate(text)
+	require.NoError(t, err)
+	want, err := tmpl.Render(data)
+	require.NoError(t, err)
+
+	c, err := tmpl.Compile()
+	require.NoError(t, err)
+	assert.Equal(t, &CompiledTemplate{
+		Hash:           TemplateHash(text),
+		FuncMapVersion: FuncMapVersion(),
+		LeftDelim:      "{{",
+		RightDelim:     "}}",
+		Source:         string(text),
+		Analysis: &Analysis{
+			Fields:    []string{"SANs", "Subject.CommonName"},
+			Functions: []string{"toJson"},
+			Templates: []string{"cn"},
+		},
+	}, c)
+	assert.Len(t, c.Hash, 64)
+
+	b, err := json.Marshal(c)
+	require.NoError(t, err)
+	var stored CompiledTemplate
+	require.NoError(t, json.Unmarshal(b, &stored))
+	assert.Equal(t, c, &stored)
+
+	loaded, err := LoadTemplate(&stored)
+	require.NoError(t, err)
+	got, err := loaded.Render(data)
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+	assert.NoError(t, loaded.Validate(data))
+
+	// The analysis is kept when the loaded template is compiled again.
+	again, err := loaded.Compile()
+	require.NoError(t, err)
+	assert.Equal(t, c, again)
+	assert.Same(t, stored.Analysis, again.Analysis)
+}
+
+func TestTemplate_Compile_delims(t *testing.T) {
+	text := []byte(`{"cn": [[ toJson .CN ]]}`)
+	tmpl, err := ParseTemplate(text, WithDelims("[[", "]]"))
+	require.NoError(t, err)
+	c, err := tmpl.Compile()
+	require.NoError(t, err)
+	assert.Equal(t, "[[", c.LeftDelim)
+	assert.Equal(t, "]]", c.RightDelim)
+	assert.Equal(t, []string{"CN"}, c.Analysis.Fields)
+
+	loaded, err := LoadTemplate(c, WithDelims("[[", "]]"))
+	require.NoError(t, err)
+	out, err := loaded.Render([]byte(`{"CN": "foo"}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"cn": "foo"}`, string(out))
+
+	// With other delimiters the source is parsed as a new template.
+	loaded, err = LoadTemplate(c)
+	require.NoError(t, err)
+	out, err = loaded.Render([]byte(`{"CN": "foo"}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"cn": [[ toJson .CN ]]}`, string(out))
+}
+
+func TestLoadTemplate(t *testing.T) {
+	// The source defines a template with the name of a function, so a
+	// compiled template with it can only be created by hand, to check when
+	// the checks of the source are skipped.
+	reserved := `{{ define "include" }}{{ end }}{"a": 1}`
+	compiled := func(source string) *CompiledTemplate {
+		return &CompiledTemplate{
+			Hash:           TemplateHash([]byte(source)),
+			FuncMapVersion: FuncMapVersion(),
+			LeftDelim:      "{{",
+			RightDelim:     "}}",
+			Source:         source,
+			Analysis:       &Analysis{Fields: []string{}, Functions: []string{}, Templates: []string{"include"}},
+		}
+	}
+	modify := func(fn func(c *CompiledTemplate)) *CompiledTemplate {
+		c := compiled(reserved)
+		fn(c)
+		return c
+	}
+	reservedErr := `error parsing template: template: template:1: template "include" has the name of a function`
+
+	tests := []struct {
+		name    string
+		c       *CompiledTemplate
+		opts    []Option
+		want    string
+		wantErr string
+	}{
+		{"ok", compiled(`{"a": {{ toJson .A }}}`), nil, `{"a": "foo"}`, ""},
+		{"ok/skip-checks", compiled(reserved), nil, `{"a": 1}`, ""},
+		{"fail/hash", modify(func(c *CompiledTemplate) { c.Hash = TemplateHash([]byte("{}")) }), nil, "", reservedErr},
+		{"fail/empty-hash", modify(func(c *CompiledTemplate) { c.Hash = "" }), nil, "", reservedErr},
+		{"fail/version", modify(func(c *CompiledTemplate) { c.FuncMapVersion-- }), nil, "", reservedErr},
+		{"fail/delims", modify(func(c *CompiledTemplate) { c.LeftDelim, c.RightDelim = "[[", "]]" }), nil, "", reservedErr},
+		{"fail/analysis", modify(func(c *CompiledTemplate) { c.Analysis = nil }), nil, "", reservedErr},
+		{"fail/funcs", compiled(reserved), []Option{WithFuncs(template.FuncMap{"foo": func() string { return "" }})}, "", reservedErr},
+		{"fail/requires", modify(func(c *CompiledTemplate) {
+			c.Source = `{{/* requires funcmap >= 999 */}}{}`
+			c.Hash = ""
+		}), nil, "", "error parsing template: template requires newer func map: version 999 required, have " + strconv.Itoa(FuncMapVersion())},
+		{"fail/denied", compiled(`{"a": {{ env "A" | toJson }}}`), []Option{WithDeniedFuncs("env")}, "", `error parsing template: template: template:1:10: function "env" is denied`},
+		{"fail/nil", nil, nil, "", "error parsing template: compiled template is nil"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := LoadTemplate(tt.c, tt.opts...)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				var te *TemplateError
+				if assert.ErrorAs(t, err, &te) {
+					assert.Equal(t, ParseError, te.Kind)
+				}
+				return
+			}
+			require.NoError(t, err)
+			out, err := tmpl.Render([]byte(`{"A": "foo"}`))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(out))
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package templates
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// FindingProfileDefault is the code of the informational findings of
+// ValidateAll for the defaults of a profile applied to the output.
+const FindingProfileDefault = "profile-default"
+
+// profileDefaults are the values of the top-level fields of the output of a
+// template that each profile uses if the template doesn't set them, in JSON.
+var profileDefaults = map[Profile]map[string]string{
+	ProfileLeaf: {
+		"keyUsage":    `["digitalSignature"]`,
+		"extKeyUsage": `["serverAuth","clientAuth"]`,
+	},
+	ProfileCA: {
+		"keyUsage":         `["certSign","crlSign"]`,
+		"basicConstraints": `{"isCA":true,"maxPathLen":0}`,
+	},
+	ProfileSSHHost: {},
+	ProfileSSHUser: {
+		"extensions": `{"permit-X11-forwarding":"","permit-agent-forwarding":"","permit-port-forwarding":"","permit-pty":"","permit-user-rc":""}`,
+	},
+}
+
+// ProfileDefaults returns a copy of the default values of the profile p, the
+// top-level fields added with WithProfileDefaults to the output of a template
+// that doesn't set them, decoded like the template data. They are:
+//
+//   - ProfileLeaf: the "keyUsage" digitalSignature, and the "extKeyUsage"
+//     serverAuth and clientAuth.
+//   - ProfileCA: the "keyUsage" certSign and crlSign, and "basicConstraints"
+//     with "isCA" set to true and a "maxPathLen" of 0.
+//   - ProfileSSHHost: none.
+//   - ProfileSSHUser: the "extensions" permit-X11-forwarding,
+//     permit-agent-forwarding, permit-port-forwarding, permit-pty and
+//     permit-user-rc.
+//
+// It returns nil if p is not a known profile.
+func ProfileDefaults(p Profile) map[string]interface{} {
+	defaults, ok := profileDefaults[p]
+	if !ok {
+		return nil
+	}
+	values := make(map[string]interface{}, len(defaults))
+	for k, v := range defaults {
+		var value interface{}
+		if err := json.Unmarshal([]byte(v), &value); err != nil {
+			panic(fmt.Sprintf("error parsing the default %q of profile %s: %v", k, p, err))
+		}
+		values[k] = value
+	}
+	return values
+}
+
+// WithProfileDefaults is an option that adds the default values of the profile
+// set with WithProfile, see ProfileDefaults, to the rendered output of a
+// template before it's validated, so a template can leave out the fields with
+// the usual values, and the validation and the output of Template.Render are
+// the ones of the effective certificate. Only the top-level fields that are
+// not in the output are added, at the end of the object, and outputs that are
+// not a JSON object are left as they are. ValidateAll reports the defaults
+// applied as findings with SeverityInfo and the code FindingProfileDefault. By
+// default, the output is validated as it's rendered.
+func WithProfileDefaults(apply bool) Option {
+	return func(o *options) {
+		o.applyProfileDefaults = apply
+	}
+}
+
+// WithProfileDefaultValues is an option that replaces the default values of
+// the profile p used with WithProfileDefaults. Each value replaces the default
+// of the same field, and the other defaults are kept; a nil value removes the
+// default of the field. The values are encoded as JSON when they are added to
+// the output. It can be used more than once, and the last value given for a
+// field wins.
+func WithProfileDefaultValues(p Profile, values map[string]interface{}) Option {
+	return func(o *options) {
+		// Copy the map so the defaults of a Template are not changed by the
+		// options of a render.
+		overrides := make(map[Profile]map[string]interface{}, len(o.profileDefaults)+1)
+		for k, v := range o.profileDefaults {
+			overrides[k] = v
+		}
+		merged := make(map[string]interface{}, len(overrides[p])+len(values))
+		for k, v := range overrides[p] {
+			merged[k] = v
+		}
+		for k, v := range values {
+			merged[k] = v
+		}
+		overrides[p] = merged
+		o.profileDefaults = overrides
+	}
+}
+
+// AppliedDefault is a default value of a profile added to the output of a
+// template with WithProfileDefaults.
+type AppliedDefault struct {
+	// Field is the name of the top-level field added.
+	Field string `json:"field"`
+	// Value is the JSON value of the field.
+	Value json.RawMessage `json:"value"`
+}
+
+// defaultValues returns the JSON values of the defaults of the profile p,
+// with the ones of WithProfileDefaultValues.
+func defaultValues(p Profile, o *options) (map[string][]byte, error) {
+	values := make(map[string][]byte, len(profileDefaults[p]))
+	for k, v := range profileDefaults[p] {
+		values[k] = []byte(v)
+	}
+	for k, v := range o.profileDefaults[p] {
+		if v == nil {
+			delete(values, k)
+			continue
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding the default %q of profile %s: %w", k, p, err)
+		}
+		values[k] = b
+	}
+	return values, nil
+}
+
+// applyProfileDefaults returns out with the default values of the profile p
+// that are not in it, and the defaults added, sorted by field. If out is not a
+// JSON object it's returned as it is. The sourceMap m, if any, is updated so
+// the fields added are mapped to the action or text that rendered the closing
+// brace of the object.
+func applyProfileDefaults(out []byte, m *sourceMap, p Profile, o *options) ([]byte, []AppliedDefault, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(out, &fields); err != nil || fields == nil {
+		return out, nil, nil
+	}
+	values, err := defaultValues(p, o)
+	if err != nil {
+		return nil, nil, newTemplateError(ExecError, err, "error applying profile defaults: "+err.Error())
+	}
+
+	var applied []AppliedDefault
+	for k, v := range values {
+		if _, ok := fields[k]; !ok {
+			applied = append(applied, AppliedDefault{Field: k, Value: v})
+		}
+	}
+	if len(applied) == 0 {
+		return out, nil, nil
+	}
+	sort.Slice(applied, func(i, j int) bool {
+		return applied[i].Field < applied[j].Field
+	})
+
+	end := bytes.LastIndexByte(out, '}')
+	var buf bytes.Buffer
+	for i, d := range applied {
+		if i > 0 || len(fields) > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(d.Field)
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(d.Value)
+	}
+	m.insert(end, buf.Len())
+
+	result := make([]byte, 0, len(out)+buf.Len())
+	result = append(result, out[:end]...)
+	result = append(result, buf.Bytes()...)
+	result = append(result, out[end:]...)
+	return result, applied, nil
+}
+
+// insert updates the sourceMap for n bytes inserted in the output at offset,
+// mapping them like the byte at offset.
+func (m *sourceMap) insert(offset, n int) {
+	if m == nil || len(m.segments) == 0 {
+		return
+	}
+	pos, _ := m.lookup(offset)
+	segments := make([]segment, 0, len(m.segments)+2)
+	for _, s := range m.segments {
+		switch {
+		case s.end <= offset:
+			segments = append(segments, s)
+		case s.start >= offset:
+			s.start += n
+			s.end += n
+			segments = append(segments, s)
+		default:
+			// Split the segment at the offset.
+			before, after := s, s
+			before.end = offset
+			after.start, after.end = offset+n, s.end+n
+			if s.literal {
+				after.pos = s.pos + (offset - s.start)
+				after.action = -1
+			}
+			segments = append(segments, before, after)
+		}
+	}
+	added := segment{start: offset, end: offset + n, pos: pos, action: -1}
+	i := sort.Search(len(segments), func(i int) bool {
+		return segments[i].start >= offset+n
+	})
+	segments = append(segments[:i], append([]segment{added}, segments[i:]...)...)
+	m.segments = segments
+}
+
+// AppliedDefaults renders the template with the given template data and
+// returns the defaults of its profile that WithProfileDefaults adds to the
+// output, sorted by field, so the effective fields of a certificate can be
+// reported. It returns nil if the template doesn't have a profile, or if the
+// output sets all the fields. The output is not validated.
+func (t *Template) AppliedDefaults(data []byte) ([]AppliedDefault, error) {
+	if len(t.text) == 0 || t.o.profile == 0 {
+		return nil, nil
+	}
+	o := *t.o
+	o.applyProfileDefaults = false
+	rt := &Template{text: t.text, tmpl: t.tmpl, o: &o}
+	out, _, err := rt.render(context.Background(), "", data, nil)
+	if err != nil {
+		return nil, err
+	}
+	_, applied, err := applyProfileDefaults(out, nil, o.profile, &o)
+	return applied, err
+}
@@ -0,0 +1,118 @@
+package templates
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfileDefaults(t *testing.T) {
+	assert.Equal(t, map[string]interface{}{
+		"keyUsage":    []interface{}{"digitalSignature"},
+		"extKeyUsage": []interface{}{"serverAuth", "clientAuth"},
+	}, ProfileDefaults(ProfileLeaf))
+	assert.Equal(t, map[string]interface{}{
+		"keyUsage":         []interface{}{"certSign", "crlSign"},
+		"basicConstraints": map[string]interface{}{"isCA": true, "maxPathLen": float64(0)},
+	}, ProfileDefaults(ProfileCA))
+	assert.Equal(t, map[string]interface{}{}, ProfileDefaults(ProfileSSHHost))
+	assert.Len(t, ProfileDefaults(ProfileSSHUser)["extensions"], 5)
+	assert.Nil(t, ProfileDefaults(0))
+
+	// The result is a copy.
+	ProfileDefaults(ProfileLeaf)["keyUsage"] = "certSign"
+	assert.Equal(t, []interface{}{"digitalSignature"}, ProfileDefaults(ProfileLeaf)["keyUsage"])
+}
+
+func TestTemplate_Render_profileDefaults(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		opts    []Option
+		want    string
+		wantErr string
+	}{
+		{"ok/leaf", `{"subject": {{ toJson .Subject }}}`, []Option{WithProfile(ProfileLeaf)},
+			`{"subject": {"commonName":"foo"},"extKeyUsage":["serverAuth","clientAuth"],"keyUsage":["digitalSignature"]}`, ""},
+		{"ok/leaf-set", `{"subject": {{ toJson .Subject }}, "keyUsage": ["keyEncipherment"]}`, []Option{WithProfile(ProfileLeaf)},
+			`{"subject": {"commonName":"foo"}, "keyUsage": ["keyEncipherment"],"extKeyUsage":["serverAuth","clientAuth"]}`, ""},
+		{"ok/leaf-null", `{"subject": {{ toJson .Subject }}, "keyUsage": null, "extKeyUsage": null}`, []Option{WithProfile(ProfileLeaf)},
+			`{"subject": {"commonName":"foo"}, "keyUsage": null, "extKeyUsage": null}`, ""},
+		{"ok/ca", `{"subject": {{ toJson .Subject }}}`, []Option{WithProfile(ProfileCA)},
+			`{"subject": {"commonName":"foo"},"basicConstraints":{"isCA":true,"maxPathLen":0},"keyUsage":["certSign","crlSign"]}`, ""},
+		{"ok/sshHost", `{"type": "host", "principals": ["foo"]}`, []Option{WithProfile(ProfileSSHHost)},
+			`{"type": "host", "principals": ["foo"]}`, ""},
+		{"ok/empty-object", `{}`, []Option{WithProfile(ProfileLeaf)},
+			`{"extKeyUsage":["serverAuth","clientAuth"],"keyUsage":["digitalSignature"]}`, ""},
+		{"ok/override", `{"subject": {{ toJson .Subject }}}`, []Option{WithProfile(ProfileLeaf), WithProfileDefaultValues(ProfileLeaf, map[string]interface{}{
+			"extKeyUsage": []string{"serverAuth"}, "keyUsage": nil, "ocspServer": "https://ocsp.example.com",
+		})}, `{"subject": {"commonName":"foo"},"extKeyUsage":["serverAuth"],"ocspServer":"https://ocsp.example.com"}`, ""},
+		{"ok/override-other-profile", `{"subject": {{ toJson .Subject }}}`, []Option{WithProfile(ProfileLeaf), WithProfileDefaultValues(ProfileCA, map[string]interface{}{
+			"keyUsage": nil,
+		})}, `{"subject": {"commonName":"foo"},"extKeyUsage":["serverAuth","clientAuth"],"keyUsage":["digitalSignature"]}`, ""},
+		{"ok/no-profile", `{"subject": {{ toJson .Subject }}}`, nil, `{"subject": {"commonName":"foo"}}`, ""},
+		{"fail/ca", `{"subject": {{ toJson .Subject }}, "basicConstraints": {"isCA": false}}`, []Option{WithProfile(ProfileCA)},
+			"", "error validating json template data: value at basicConstraints.isCA (template line 1, column 57) is not valid for the ca profile: value false is not true"},
+		{"fail/default", `{"subject": {{ toJson .Subject }}}`, []Option{WithProfile(ProfileLeaf), WithProfileDefaultValues(ProfileLeaf, map[string]interface{}{
+			"keyUsage": "certSign",
+		})}, "", `error validating json template data: value at keyUsage (offset 75, near template line 1, column 16) is not valid for the leaf profile: value "certSign" does not match "` + leafKeyUsagePattern + `"`},
+		{"fail/encoding", `{}`, []Option{WithProfile(ProfileLeaf), WithProfileDefaultValues(ProfileLeaf, map[string]interface{}{
+			"keyUsage": func() {},
+		})}, "", `error applying profile defaults: error encoding the default "keyUsage" of profile leaf: json: unsupported type: func()`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseTemplate([]byte(tt.text), append(tt.opts, WithProfileDefaults(true), WithAllowCommonNameOnly(true), WithRenderMode(RenderRaw))...)
+			require.NoError(t, err)
+			data := []byte(`{"Subject": {"commonName": "foo"}}`)
+			if tt.wantErr != "" {
+				assert.EqualError(t, tmpl.Validate(data), tt.wantErr)
+				return
+			}
+			assert.NoError(t, tmpl.Validate(data))
+			out, err := tmpl.Render(data)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(out))
+		})
+	}
+}
+
+func TestTemplate_AppliedDefaults(t *testing.T) {
+	text := []byte(`{"subject": {{ toJson .Subject }}, "keyUsage": ["keyEncipherment"]}`)
+	tmpl, err := ParseTemplate(text, WithProfile(ProfileLeaf))
+	require.NoError(t, err)
+	applied, err := tmpl.AppliedDefaults(nil)
+	require.NoError(t, err)
+	assert.Equal(t, []AppliedDefault{
+		{Field: "extKeyUsage", Value: json.RawMessage(`["serverAuth","clientAuth"]`)},
+	}, applied)
+
+	tmpl, err = ParseTemplate(text)
+	require.NoError(t, err)
+	applied, err = tmpl.AppliedDefaults(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, applied)
+
+	tmpl, err = ParseTemplate([]byte(`{{ fail "no" }}`), WithProfile(ProfileLeaf))
+	require.NoError(t, err)
+	_, err = tmpl.AppliedDefaults(nil)
+	assert.EqualError(t, err, "error executing template: no")
+}
+
+func TestValidateAll_profileDefaults(t *testing.T) {
+	text := []byte(`{"subject": {{ toJson .Subject }}}`)
+	data := []byte(`{"Subject": {"commonName": "foo"}}`)
+	res, err := ValidateAll(text, data, ProfileCA, WithProfileDefaults(true))
+	require.NoError(t, err)
+	assert.True(t, res.IsValid)
+	assert.Equal(t, []Finding{
+		{Stage: StageProfile, Severity: SeverityInfo, Code: FindingProfileDefault, Message: `default basicConstraints applied for the ca profile: {"isCA":true,"maxPathLen":0}`, Path: "basicConstraints"},
+		{Stage: StageProfile, Severity: SeverityInfo, Code: FindingProfileDefault, Message: `default keyUsage applied for the ca profile: ["certSign","crlSign"]`, Path: "keyUsage"},
+	}, res.Findings)
+
+	// Without the defaults, the CA requires basicConstraints.
+	_, err = ValidateAll(text, data, ProfileCA)
+	assert.Error(t, err)
+}
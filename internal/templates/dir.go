@@ -0,0 +1,94 @@
+package templates
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+const (
+	// TemplateExtension is the extension of the files validated by
+	// ValidateTemplateDir.
+	TemplateExtension = ".tmpl"
+	// DefaultDataFile is the name of the template data file used by the
+	// templates in a directory that don't have their own data file.
+	DefaultDataFile = "data.json"
+)
+
+// ValidateTemplateDir validates all the templates in the file system fsys. The
+// templates are the files with the extension ".tmpl", and each one is
+// validated with the template data in the file with the same name and the
+// extension ".json", or if it doesn't exist, with the data in the file
+// "data.json" in the same directory. A template without a data file is only
+// parsed, like in ValidateTemplate.
+//
+// All the files are validated, even if some of them fail, and the returned
+// error is an Errors with one error per failing file, prefixed by the name of
+// the file.
+func ValidateTemplateDir(fsys fs.FS, opts ...Option) error {
+	var errs Errors
+	fail := func(name string, err error) {
+		errs = append(errs, fmt.Errorf("%s: %w", name, err))
+	}
+
+	// The data files are validated only once, and a template with invalid
+	// data is only parsed. readData returns nil if the file is not valid, and
+	// false if it doesn't exist.
+	dataFiles := make(map[string][]byte)
+	readData := func(name string) ([]byte, bool) {
+		if b, ok := dataFiles[name]; ok {
+			return b, true
+		}
+		b, err := fs.ReadFile(fsys, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, false
+		}
+		if err == nil {
+			err = ValidateTemplateData(b, opts...)
+		}
+		if err != nil {
+			fail(name, err)
+			b = nil
+		}
+		dataFiles[name] = b
+		return b, true
+	}
+
+	// Errors are collected and never returned, so the walk always finishes.
+	_ = fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			fail(name, err)
+			return nil
+		}
+		if d.IsDir() || path.Ext(name) != TemplateExtension {
+			return nil
+		}
+
+		text, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			fail(name, err)
+			return nil
+		}
+
+		data, found := readData(strings.TrimSuffix(name, TemplateExtension) + ".json")
+		if !found {
+			data, _ = readData(path.Join(path.Dir(name), DefaultDataFile))
+		}
+		if data != nil {
+			err = ValidateTemplateWithData(text, data, opts...)
+		} else {
+			err = ValidateTemplate(text, opts...)
+		}
+		if err != nil {
+			fail(name, err)
+		}
+		return nil
+	})
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
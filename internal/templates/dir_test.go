@@ -0,0 +1,84 @@
+package templates
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTemplateDir(t *testing.T) {
+	file := func(s string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(s)}
+	}
+
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+		opts []Option
+		errs []string
+	}{
+		{"ok", fstest.MapFS{
+			"leaf.tmpl":       file(`{"subject": {{ toJson .Subject }}}`),
+			"leaf.json":       file(`{"Subject": {"commonName": "foo"}}`),
+			"prod/leaf.tmpl":  file(`{{ if not .SANs }}{{ fail "SANs required" }}{{ end }}{"sans": {{ toJson .SANs }}}`),
+			"prod/data.json":  file(`{"SANs": ["foo.com"]}`),
+			"other/only.tmpl": file(`{{ if not .SANs }}{{ fail "SANs required" }}{{ end }}{}`),
+			"README.md":       file(`not a template`),
+		}, nil, nil},
+		{"ok/empty", fstest.MapFS{}, nil, nil},
+		{"fail", fstest.MapFS{
+			"a.tmpl":         file(`{"subject": {{ unknownFunction .Subject }}}`),
+			"b.tmpl":         file(`{"subject": {{ toJson .Subject }}}`),
+			"b.json":         file(`{"Subject": }`),
+			"c.tmpl":         file(`{"subject": {{ toJson .Subject }}}`),
+			"d.tmpl":         file(`{"subject": {{ .Subject }}}`),
+			"dir/data.json":  file(`{"SANs": []}`),
+			"dir/e.tmpl":     file(`{{ if not .SANs }}{{ fail "SANs required" }}{{ end }}{}`),
+			"dir/f.tmpl":     file(`{{ if not .Subject }}{{ fail "Subject required" }}{{ end }}{}`),
+			"dir/f.json":     file(`{"Subject": "foo"}`),
+			"data.json":      file(`{"Subject": "foo"}`),
+			"dir/sub/g.tmpl": file(`{"a": {{ toJson .a }}}`),
+		}, nil, []string{
+			`a.tmpl: error parsing template: template: template:1: function "unknownFunction" not defined`,
+			`b.json: error validating json template data: invalid JSON at Subject (line 1, column 13): invalid character '}' looking for beginning of value`,
+			`d.tmpl: error validating json template data: invalid JSON at offset 13, near template line 1, column 16: invalid character 'o' in literal false (expecting 'a')`,
+			`dir/e.tmpl: error executing template: SANs required`,
+		}},
+		{"fail/options", fstest.MapFS{
+			"a.tmpl": file(`{"cn": {{ toJson .Subject.CommonName }}}`),
+			"a.json": file(`{"Subject": {}}`),
+		}, []Option{WithStrict(true)}, []string{
+			`a.tmpl: error executing template: missing key "CommonName" in .Subject.CommonName: template: template:1:25: executing "template" at <.Subject.CommonName>: map has no entry for key "CommonName"`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateTemplateDir(tt.fsys, tt.opts...)
+			if tt.errs == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			var errs Errors
+			if assert.True(t, errors.As(err, &errs)) {
+				var got []string
+				for _, e := range errs {
+					got = append(got, e.Error())
+				}
+				assert.Equal(t, tt.errs, got)
+			}
+		})
+	}
+}
+
+func TestValidateTemplateDir_errorKind(t *testing.T) {
+	err := ValidateTemplateDir(fstest.MapFS{
+		"a.tmpl": &fstest.MapFile{Data: []byte(`{{ if }}`)},
+	})
+	var te *TemplateError
+	if assert.True(t, errors.As(err, &te)) {
+		assert.Equal(t, ParseError, te.Kind)
+	}
+}
@@ -0,0 +1,357 @@
+package templates
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// dnAttribute is an attribute type with a short name in RFC 4514, or commonly
+// used in certificates. The field is the key of the attribute in the subject
+// of a certificate template, or empty if it goes in "extraNames".
+type dnAttribute struct {
+	name  string
+	oid   string
+	field string
+}
+
+var dnAttributes = []dnAttribute{
+	{"CN", "2.5.4.3", "commonName"},
+	{"SERIALNUMBER", "2.5.4.5", "serialNumber"},
+	{"C", "2.5.4.6", "country"},
+	{"L", "2.5.4.7", "locality"},
+	{"ST", "2.5.4.8", "province"},
+	{"STREET", "2.5.4.9", "streetAddress"},
+	{"O", "2.5.4.10", "organization"},
+	{"OU", "2.5.4.11", "organizationalUnit"},
+	{"POSTALCODE", "2.5.4.17", "postalCode"},
+	{"UID", "0.9.2342.19200300.100.1.1", ""},
+	{"DC", "0.9.2342.19200300.100.1.25", ""},
+}
+
+// dnAttributeByName returns the attribute with the given short name or
+// object identifier. Short names are case insensitive.
+func dnAttributeByName(s string) (dnAttribute, bool) {
+	for _, a := range dnAttributes {
+		if strings.EqualFold(a.name, s) || a.oid == s {
+			return a, true
+		}
+	}
+	return dnAttribute{}, false
+}
+
+var (
+	dnKeywordRegexp = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9-]*$`)
+	dnOIDRegexp     = regexp.MustCompile(`^(0|[1-9][0-9]*)(\.(0|[1-9][0-9]*))+$`)
+)
+
+// dnValue is an attribute type and value in a distinguished name. If the
+// value was a hex string, raw has the BER encoding, and isString is true if
+// it's a string.
+type dnValue struct {
+	typ      string
+	value    string
+	raw      []byte
+	isString bool
+}
+
+// parseDN parses a distinguished name in the string format of RFC 4514, like
+// "CN=foo,O=Acme\, Inc.+OU=Engineering", and returns its relative
+// distinguished names in the order of the string. Short attribute types are
+// uppercased, and the known object identifiers are replaced by their short
+// names. Unescaped spaces around the types and the values are ignored.
+func parseDN(s string) ([][]dnValue, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	var rdns [][]dnValue
+	var rdn []dnValue
+	for i := 0; ; {
+		// Attribute type.
+		eq := strings.IndexByte(s[i:], '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("error parsing dn %q: missing '=' after %q", s, strings.TrimSpace(s[i:]))
+		}
+		typ := strings.TrimSpace(s[i : i+eq])
+		if a, ok := dnAttributeByName(typ); ok {
+			typ = a.name
+		} else if dnKeywordRegexp.MatchString(typ) {
+			typ = strings.ToUpper(typ)
+		} else if !dnOIDRegexp.MatchString(typ) {
+			return nil, fmt.Errorf("error parsing dn %q: invalid attribute type %q", s, typ)
+		}
+		i += eq + 1
+
+		// Attribute value, up to the next unescaped ',' or '+'.
+		v, n, err := parseDNValue(s[i:])
+		if err != nil {
+			return nil, fmt.Errorf("error parsing dn %q: %w", s, err)
+		}
+		v.typ = typ
+		rdn = append(rdn, v)
+		i += n
+		if i == len(s) {
+			return append(rdns, rdn), nil
+		}
+		if s[i] == ',' {
+			rdns, rdn = append(rdns, rdn), nil
+		}
+		i++
+	}
+}
+
+// parseDNValue parses the attribute value at the start of s. It returns the
+// value and the number of bytes read, up to the separator that ends it.
+func parseDNValue(s string) (dnValue, int, error) {
+	i := 0
+	for i < len(s) && s[i] == ' ' {
+		i++
+	}
+
+	if i < len(s) && s[i] == '#' {
+		j := i + 1
+		for j < len(s) && s[j] != ',' && s[j] != '+' {
+			j++
+		}
+		h := strings.TrimRight(s[i+1:j], " ")
+		raw, err := hex.DecodeString(h)
+		if err != nil || len(raw) == 0 {
+			return dnValue{}, 0, fmt.Errorf("invalid hex value %q", s[i:j])
+		}
+		var v asn1.RawValue
+		if rest, err := asn1.Unmarshal(raw, &v); err != nil || len(rest) > 0 {
+			return dnValue{}, 0, fmt.Errorf("invalid hex value %q: it's not BER encoded", s[i:j])
+		}
+		value := dnValue{raw: raw}
+		if _, err := asn1.Unmarshal(raw, &value.value); err == nil {
+			value.isString = true
+		}
+		return value, j, nil
+	}
+
+	var buf bytes.Buffer
+	// end is the length of buf without the unescaped trailing spaces.
+	end := 0
+	for ; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case ',', '+':
+			return checkDNValue(buf.Bytes()[:end], i)
+		case '\\':
+			if i+1 == len(s) {
+				return dnValue{}, 0, fmt.Errorf("invalid escape at the end of %q", s)
+			}
+			if strings.IndexByte(`"+,;<>\ #=`, s[i+1]) >= 0 {
+				buf.WriteByte(s[i+1])
+				i++
+			} else if b, err := hex.DecodeString(s[i+1 : minIndex(i+3, len(s))]); err == nil && len(b) == 1 {
+				buf.WriteByte(b[0])
+				i += 2
+			} else {
+				return dnValue{}, 0, fmt.Errorf("invalid escape %q", s[i:minIndex(i+3, len(s))])
+			}
+			end = buf.Len()
+			continue
+		case '"', ';', '<', '>':
+			return dnValue{}, 0, fmt.Errorf("character %q must be escaped", c)
+		}
+		buf.WriteByte(c)
+		if c != ' ' {
+			end = buf.Len()
+		}
+	}
+	return checkDNValue(buf.Bytes()[:end], i)
+}
+
+func checkDNValue(b []byte, n int) (dnValue, int, error) {
+	if !utf8.Valid(b) {
+		return dnValue{}, 0, fmt.Errorf("value %q is not valid UTF-8", b)
+	}
+	return dnValue{value: string(b)}, n, nil
+}
+
+func minIndex(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// escapeDNValue escapes a value using the rules of RFC 4514.
+func escapeDNValue(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case strings.IndexByte(`"+,;<>\`, c) >= 0,
+			(c == ' ' || c == '#') && i == 0,
+			c == ' ' && i == len(s)-1:
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == 0:
+			b.WriteString(`\00`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// dn returns the canonical form of the distinguished name s: the types are
+// short names in uppercase, or object identifiers, the values of each
+// relative distinguished name are sorted by type, and the values are escaped
+// with the minimum escaping of RFC 4514. Values given as hex strings are kept
+// as they are.
+func dn(s string) (string, error) {
+	rdns, err := parseDN(s)
+	if err != nil {
+		return "", err
+	}
+	parts := make([]string, len(rdns))
+	for i, rdn := range rdns {
+		avas := make([]string, len(rdn))
+		for j, v := range rdn {
+			if v.raw != nil {
+				avas[j] = v.typ + "=#" + hex.EncodeToString(v.raw)
+			} else {
+				avas[j] = v.typ + "=" + escapeDNValue(v.value)
+			}
+		}
+		sort.Strings(avas)
+		parts[i] = strings.Join(avas, "+")
+	}
+	return strings.Join(parts, ","), nil
+}
+
+// dnObject returns the distinguished name s as the JSON object used in the
+// subject and issuer of a certificate template, like
+// {"commonName":"foo","organization":["Acme"]}. The values are added in the
+// order of the string, and the attributes without a field, or a second common
+// name or serial number, are added to "extraNames" with their object
+// identifier.
+func dnObject(s string) (rawJSON, error) {
+	rdns, err := parseDN(s)
+	if err != nil {
+		return "", err
+	}
+
+	type extraName struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}
+	obj := make(map[string]interface{})
+	var extra []extraName
+	for _, rdn := range rdns {
+		for _, v := range rdn {
+			if v.raw != nil && !v.isString {
+				return "", fmt.Errorf("error parsing dn %q: value of %s is not a string", s, v.typ)
+			}
+			a, _ := dnAttributeByName(v.typ)
+			switch {
+			case a.field == "" || (a.field == "commonName" || a.field == "serialNumber") && obj[a.field] != nil:
+				oid := a.oid
+				if oid == "" {
+					if !dnOIDRegexp.MatchString(v.typ) {
+						return "", fmt.Errorf("error parsing dn %q: unknown attribute type %q", s, v.typ)
+					}
+					oid = v.typ
+				}
+				extra = append(extra, extraName{Type: oid, Value: v.value})
+			case a.field == "commonName" || a.field == "serialNumber":
+				obj[a.field] = v.value
+			default:
+				list, _ := obj[a.field].([]string)
+				obj[a.field] = append(list, v.value)
+			}
+		}
+	}
+	if extra != nil {
+		obj["extraNames"] = extra
+	}
+
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return "", fmt.Errorf("error parsing dn %q: %w", s, err)
+	}
+	return rawJSON(b), nil
+}
+
+// The upper bounds of the attributes of a distinguished name in X.520.
+const (
+	// maxCommonNameLength is ub-common-name.
+	maxCommonNameLength = 64
+	// maxLocalityLength is ub-locality-name.
+	maxLocalityLength = 128
+	// maxProvinceLength is ub-state-name.
+	maxProvinceLength = 128
+)
+
+// commonName returns s without leading and trailing white space, if it's a
+// valid common name. The limit of 64 characters is counted in code points,
+// like in the PrintableString or UTF8String used to encode it, not in bytes.
+// Longer names are an error, or are cut to the first 64 characters, without
+// trailing white space, if truncate is true.
+func commonName(s string, truncate ...bool) (string, error) {
+	return dnAttributeValue("commonName", maxCommonNameLength, s, truncate)
+}
+
+// locality returns s without leading and trailing white space, if it's a valid
+// locality name of at most 128 characters, like commonName does.
+func locality(s string, truncate ...bool) (string, error) {
+	return dnAttributeValue("locality", maxLocalityLength, s, truncate)
+}
+
+// province returns s without leading and trailing white space, if it's a valid
+// state or province name of at most 128 characters, like commonName does.
+func province(s string, truncate ...bool) (string, error) {
+	return dnAttributeValue("province", maxProvinceLength, s, truncate)
+}
+
+// dnAttributeValue returns s without leading and trailing white space, if it's
+// a valid value of the attribute name with at most max code points, or the
+// first max code points if it's longer and truncate is true.
+func dnAttributeValue(name string, max int, s string, truncate []bool) (string, error) {
+	if len(truncate) > 1 {
+		return "", fmt.Errorf("error validating %s: too many arguments", name)
+	}
+	if !utf8.ValidString(s) {
+		return "", fmt.Errorf("error validating %s %q: invalid UTF-8", name, s)
+	}
+	v := strings.TrimSpace(s)
+	n := utf8.RuneCountInString(v)
+	if n <= max {
+		return v, nil
+	}
+	if len(truncate) == 0 || !truncate[0] {
+		return "", fmt.Errorf("error validating %s %q: %d characters exceed the maximum of %d", name, v, n, max)
+	}
+	i := 0
+	for j := 0; j < max; j++ {
+		_, size := utf8.DecodeRuneInString(v[i:])
+		i += size
+	}
+	return strings.TrimRightFunc(v[:i], unicode.IsSpace), nil
+}
+
+// country returns s in uppercase and without leading and trailing white space,
+// if it's an ISO 3166-1 alpha-2 country code, like "US" or "de". Other values,
+// like the alpha-3 code "USA" or the exceptional reservation "UK", are an
+// error.
+func country(s string) (string, error) {
+	c := strings.ToUpper(strings.TrimSpace(s))
+	if len(c) != 2 {
+		return "", fmt.Errorf("error validating country %q: a country is a code of 2 letters", s)
+	}
+	if _, ok := countryCodes[c]; !ok {
+		return "", fmt.Errorf("error validating country %q: %s is not an ISO 3166-1 country code", s, c)
+	}
+	return c, nil
+}
@@ -0,0 +1,220 @@
+package templates
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_dn(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    string
+		wantErr string
+	}{
+		{"ok", "CN=foo,O=Acme,C=US", "CN=foo,O=Acme,C=US", ""},
+		{"ok/empty", "", "", ""},
+		{"ok/spaces", "  cn = foo , o=Acme  ", "CN=foo,O=Acme", ""},
+		{"ok/oid", "2.5.4.3=foo,0.9.2342.19200300.100.1.25=example,1.2.3.4=bar", "CN=foo,DC=example,1.2.3.4=bar", ""},
+		{"ok/keyword", "emailAddress=jane@example.com", "EMAILADDRESS=jane@example.com", ""},
+		{"ok/multi-valued", "OU=Sales+CN=J. Smith,DC=example", "CN=J. Smith+OU=Sales,DC=example", ""},
+		{"ok/escaped", `CN=Acme\, Inc.,O=R&D \+ Ops\;\<x\>\"q\"\\\=`, `CN=Acme\, Inc.,O=R&D \+ Ops\;\<x\>\"q\"\\=`, ""},
+		{"fail/escape-other", `O=R\&D`, "", `error parsing dn "O=R\\&D": invalid escape "\\&D"`},
+		{"ok/escaped-hex", `CN=Lu\C4\8Di\C4\87,O=a\2Cb`, `CN=Lučić,O=a\,b`, ""},
+		{"ok/leading-trailing", `CN=\ foo\ ,O=\#1,OU=a#b`, `CN=\ foo\ ,O=\#1,OU=a#b`, ""},
+		{"ok/empty-value", "CN=,O=Acme", "CN=,O=Acme", ""},
+		{"ok/hex", "1.3.6.1.4.1.1466.0=#04024869,CN=#0c03666f6f", "1.3.6.1.4.1.1466.0=#04024869,CN=#0c03666f6f", ""},
+		{"ok/nul", `CN=a\00b`, `CN=a\00b`, ""},
+		{"fail/no-equal", "CN=foo,Acme", "", `error parsing dn "CN=foo,Acme": missing '=' after "Acme"`},
+		{"fail/trailing-comma", "CN=foo,", "", `error parsing dn "CN=foo,": missing '=' after ""`},
+		{"fail/type", "C N=foo", "", `error parsing dn "C N=foo": invalid attribute type "C N"`},
+		{"fail/empty-type", "=foo", "", `error parsing dn "=foo": invalid attribute type ""`},
+		{"fail/oid", "1.02=foo", "", `error parsing dn "1.02=foo": invalid attribute type "1.02"`},
+		{"fail/unescaped", `CN=a<b`, "", `error parsing dn "CN=a<b": character '<' must be escaped`},
+		{"fail/semicolon", `CN=a;O=b`, "", `error parsing dn "CN=a;O=b": character ';' must be escaped`},
+		{"fail/escape", `CN=a\x`, "", `error parsing dn "CN=a\\x": invalid escape "\\x"`},
+		{"fail/escape-end", `CN=a\`, "", `error parsing dn "CN=a\\": invalid escape at the end of "a\\"`},
+		{"fail/utf8", `CN=\FF`, "", `error parsing dn "CN=\\FF": value "\xff" is not valid UTF-8`},
+		{"fail/hex", "CN=#0c0", "", `error parsing dn "CN=#0c0": invalid hex value "#0c0"`},
+		{"fail/hex-ber", "CN=#0102", "", `error parsing dn "CN=#0102": invalid hex value "#0102": it's not BER encoded`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := dn(tt.s)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+
+			// The canonical form is stable.
+			again, err := dn(got)
+			require.NoError(t, err)
+			assert.Equal(t, got, again)
+		})
+	}
+}
+
+func Test_dnObject(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    string
+		wantErr string
+	}{
+		{"ok", "CN=foo,OU=Eng+OU=Sales,O=Acme\\, Inc.,L=SF,ST=CA,C=US", `{"commonName":"foo","country":["US"],"locality":["SF"],"organization":["Acme, Inc."],"organizationalUnit":["Eng","Sales"],"province":["CA"]}`, ""},
+		{"ok/empty", "", `{}`, ""},
+		{"ok/extra", "CN=foo,CN=bar,DC=example,UID=jdoe,1.2.3.4=#0c03626172", `{"commonName":"foo","extraNames":[{"type":"2.5.4.3","value":"bar"},{"type":"0.9.2342.19200300.100.1.25","value":"example"},{"type":"0.9.2342.19200300.100.1.1","value":"jdoe"},{"type":"1.2.3.4","value":"bar"}]}`, ""},
+		{"ok/all-fields", "SERIALNUMBER=123,STREET=1 Main St,POSTALCODE=94105", `{"postalCode":["94105"],"serialNumber":"123","streetAddress":["1 Main St"]}`, ""},
+		{"fail/unknown", "emailAddress=jane@example.com", "", `error parsing dn "emailAddress=jane@example.com": unknown attribute type "EMAILADDRESS"`},
+		{"fail/not-string", "CN=#04024869", "", `error parsing dn "CN=#04024869": value of CN is not a string`},
+		{"fail/parse", "CN", "", `error parsing dn "CN": missing '=' after "CN"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := dnObject(tt.s)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, rawJSON(tt.want), got)
+			assert.True(t, json.Valid([]byte(got)))
+		})
+	}
+}
+
+func TestTemplate_dn(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"subject": {{ dnObject .Subject }}, "issuer": {{ dn .Issuer | jsonQuote }}}`))
+	require.NoError(t, err)
+	data := []byte(`{"Subject": "CN=foo+UID=jdoe,O=Acme", "Issuer": "o=Acme, cn = Acme \"CA\""}`)
+	// The quote in the issuer is not escaped in the DN.
+	err = tmpl.Validate(data)
+	assert.EqualError(t, err, `error executing template: error parsing dn "o=Acme, cn = Acme \"CA\"": character '"' must be escaped`)
+
+	data = []byte(`{"Subject": "CN=foo+UID=jdoe,O=Acme", "Issuer": "o=Acme, cn = Acme \\\"CA\\\""}`)
+	require.NoError(t, tmpl.Validate(data))
+	out, err := tmpl.Render(data)
+	require.NoError(t, err)
+	assert.Equal(t, `{"subject": {"commonName":"foo","extraNames":[{"type":"0.9.2342.19200300.100.1.1","value":"jdoe"}],"organization":["Acme"]}, "issuer": "O=Acme,CN=Acme \\\"CA\\\""}`, string(out))
+}
+
+func Test_commonName(t *testing.T) {
+	long := strings.Repeat("a", 60) + ".example.com"
+	tests := []struct {
+		name     string
+		s        string
+		truncate []bool
+		want     string
+		wantErr  string
+	}{
+		{"ok", "foo.example.com", nil, "foo.example.com", ""},
+		{"ok/trim", "  Jane Doe\t\n", nil, "Jane Doe", ""},
+		{"ok/empty", "", nil, "", ""},
+		{"ok/max", strings.Repeat("a", 64), nil, strings.Repeat("a", 64), ""},
+		{"ok/max-trimmed", " " + strings.Repeat("a", 64) + " ", nil, strings.Repeat("a", 64), ""},
+		{"ok/runes", strings.Repeat("é", 64), nil, strings.Repeat("é", 64), ""},
+		{"ok/truncate", long, []bool{true}, strings.Repeat("a", 60) + ".exa", ""},
+		{"ok/truncate-runes", strings.Repeat("日本", 40), []bool{true}, strings.Repeat("日本", 32), ""},
+		{"ok/truncate-space", strings.Repeat("a", 63) + "  b", []bool{true}, strings.Repeat("a", 63), ""},
+		{"ok/truncate-short", "foo", []bool{true}, "foo", ""},
+		{"fail/long", long, nil, "", `error validating commonName "` + long + `": 72 characters exceed the maximum of 64`},
+		{"fail/no-truncate", long, []bool{false}, "", `error validating commonName "` + long + `": 72 characters exceed the maximum of 64`},
+		{"fail/runes", strings.Repeat("é", 65), nil, "", `error validating commonName "` + strings.Repeat("é", 65) + `": 65 characters exceed the maximum of 64`},
+		{"fail/utf8", "foo\xff", nil, "", `error validating commonName "foo\xff": invalid UTF-8`},
+		{"fail/args", "foo", []bool{true, true}, "", "error validating commonName: too many arguments"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := commonName(tt.s, tt.truncate...)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestTemplate_commonName(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"subject": {"commonName": {{ .Name | commonName | toJson }}}, "keyId": {{ commonName .Name true | toJson }}}`))
+	require.NoError(t, err)
+
+	out, err := tmpl.Render([]byte(`{"Name": " foo.example.com "}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"subject": {"commonName": "foo.example.com"}, "keyId": "foo.example.com"}`, string(out))
+
+	name := strings.Repeat("x", 65)
+	err = tmpl.Validate([]byte(`{"Name": "` + name + `"}`))
+	assert.EqualError(t, err, `error executing template: error validating commonName "`+name+`": 65 characters exceed the maximum of 64`)
+}
+
+func Test_localityProvince(t *testing.T) {
+	max := strings.Repeat("a", 128)
+	got, err := locality(" San Francisco ")
+	assert.NoError(t, err)
+	assert.Equal(t, "San Francisco", got)
+	got, err = province(max)
+	assert.NoError(t, err)
+	assert.Equal(t, max, got)
+	got, err = locality(max+"b", true)
+	assert.NoError(t, err)
+	assert.Equal(t, max, got)
+
+	_, err = locality(max + "b")
+	assert.EqualError(t, err, `error validating locality "`+max+`b": 129 characters exceed the maximum of 128`)
+	_, err = province(max + "b")
+	assert.EqualError(t, err, `error validating province "`+max+`b": 129 characters exceed the maximum of 128`)
+	_, err = province("a\xff")
+	assert.EqualError(t, err, `error validating province "a\xff": invalid UTF-8`)
+}
+
+func Test_country(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    string
+		wantErr string
+	}{
+		{"ok", "US", "US", ""},
+		{"ok/lower", "de", "DE", ""},
+		{"ok/trim", " gb\n", "GB", ""},
+		{"ok/aland", "AX", "AX", ""},
+		{"fail/empty", "", "", `error validating country "": a country is a code of 2 letters`},
+		{"fail/alpha-3", "USA", "", `error validating country "USA": a country is a code of 2 letters`},
+		{"fail/name", "Spain", "", `error validating country "Spain": a country is a code of 2 letters`},
+		{"fail/unknown", "xx", "", `error validating country "xx": XX is not an ISO 3166-1 country code`},
+		{"fail/reserved", "UK", "", `error validating country "UK": UK is not an ISO 3166-1 country code`},
+		{"fail/digits", "12", "", `error validating country "12": 12 is not an ISO 3166-1 country code`},
+		{"fail/unicode", "é", "", `error validating country "é": É is not an ISO 3166-1 country code`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := country(tt.s)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestTemplate_country(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"subject": {"country": {{ country .C | toJson }}, "province": {{ province .ST | toJson }}, "locality": {{ locality .L | toJson }}}}`))
+	require.NoError(t, err)
+
+	out, err := tmpl.Render([]byte(`{"C": "us", "ST": " California", "L": "San Francisco "}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"subject": {"country": "US", "province": "California", "locality": "San Francisco"}}`, string(out))
+
+	err = tmpl.Validate([]byte(`{"C": "USA", "ST": "California", "L": "San Francisco"}`))
+	assert.EqualError(t, err, `error executing template: error validating country "USA": a country is a code of 2 letters`)
+}
@@ -0,0 +1,254 @@
+package templates
+
+import (
+	"context"
+	"encoding/json"
+	"text/template/parse"
+)
+
+const (
+	// placeholderValue is the value used by DryRunRender for the fields that
+	// are only used as scalars.
+	placeholderValue = "placeholder"
+	// placeholderItems is the number of elements of the slices generated by
+	// DryRunRender for the fields used in range loops.
+	placeholderItems = 2
+	// maxTemplateDepth is the maximum number of nested {{ template }} calls
+	// followed by DryRunRender, so recursive templates finish.
+	maxTemplateDepth = 10
+)
+
+// placeholder is a field referenced by a template, and the fields referenced
+// inside it.
+type placeholder struct {
+	fields map[string]*placeholder
+	// list is true if the field is used in a range loop, elem are the fields
+	// referenced in the elements.
+	list bool
+	elem *placeholder
+	// object is true if the field must be an object even if no fields are
+	// known, like the data of the template calls that are not followed.
+	object bool
+	// whole is true if the value itself is used, like in {{ toJson .Subject }},
+	// so all its fields are read.
+	whole bool
+}
+
+func newPlaceholder() *placeholder {
+	return &placeholder{fields: make(map[string]*placeholder)}
+}
+
+// field returns the placeholder for the field name, creating it if necessary.
+func (p *placeholder) field(name string) *placeholder {
+	f, ok := p.fields[name]
+	if !ok {
+		f = newPlaceholder()
+		p.fields[name] = f
+	}
+	return f
+}
+
+// path returns the placeholder for a chain of field names.
+func (p *placeholder) path(names []string) *placeholder {
+	for _, name := range names {
+		p = p.field(name)
+	}
+	return p
+}
+
+// element marks p as a list and returns the placeholder of its elements.
+func (p *placeholder) element() *placeholder {
+	p.list = true
+	if p.elem == nil {
+		p.elem = newPlaceholder()
+	}
+	return p.elem
+}
+
+// value returns the synthetic value for the placeholder, keeping the values in
+// the given data.
+func (p *placeholder) value(data interface{}) interface{} {
+	switch {
+	case p.list:
+		if data != nil {
+			return data
+		}
+		items := make([]interface{}, placeholderItems)
+		for i := range items {
+			items[i] = p.elem.value(nil)
+		}
+		return items
+	case p.object || len(p.fields) > 0:
+		if data == nil {
+			data = make(map[string]interface{})
+		}
+		m, ok := data.(map[string]interface{})
+		if !ok {
+			return data
+		}
+		for name, f := range p.fields {
+			m[name] = f.value(m[name])
+		}
+		return m
+	case data != nil:
+		return data
+	default:
+		return placeholderValue
+	}
+}
+
+// placeholderScanner finds the fields referenced by a template, following the
+// value of dot and variables in with and range blocks.
+type placeholderScanner struct {
+	// trees are the templates that can be called, by name.
+	trees map[string]*parse.Tree
+	root  *placeholder
+	depth int
+}
+
+func (s *placeholderScanner) scan(node parse.Node, dot *placeholder, vars map[string]*placeholder) {
+	if node == nil || isNilNode(node) {
+		return
+	}
+
+	switch n := node.(type) {
+	case *parse.ListNode:
+		for _, c := range n.Nodes {
+			s.scan(c, dot, vars)
+		}
+	case *parse.ActionNode:
+		if p := s.pipe(n.Pipe, dot, vars); p != nil && len(n.Pipe.Decl) == 0 {
+			p.whole = true
+		}
+	case *parse.IfNode:
+		s.pipe(n.Pipe, dot, vars)
+		s.scan(n.List, dot, vars)
+		s.scan(n.ElseList, dot, vars)
+	case *parse.WithNode:
+		p := s.pipe(n.Pipe, dot, vars)
+		if p == nil {
+			p = newPlaceholder()
+		}
+		s.scan(n.List, p, vars)
+		s.scan(n.ElseList, dot, vars)
+	case *parse.RangeNode:
+		elem := newPlaceholder()
+		if p := s.pipe(n.Pipe, dot, vars); p != nil {
+			elem = p.element()
+		}
+		// The last variable declared is the element, the first one the index.
+		if d := n.Pipe.Decl; len(d) > 0 {
+			vars[d[len(d)-1].Ident[0]] = elem
+		}
+		s.scan(n.List, elem, vars)
+		s.scan(n.ElseList, dot, vars)
+	case *parse.TemplateNode:
+		p := s.pipe(n.Pipe, dot, vars)
+		tree := s.trees[n.Name]
+		if p == nil || tree == nil {
+			return
+		}
+		if s.depth >= maxTemplateDepth {
+			p.object = true
+			return
+		}
+		s.depth++
+		s.scan(tree.Root, p, map[string]*placeholder{"$": p})
+		s.depth--
+	}
+}
+
+// pipe scans a pipeline and returns the placeholder of its value if it's a
+// field, or nil otherwise. Variables declared in the pipeline are set to that
+// value.
+func (s *placeholderScanner) pipe(pipe *parse.PipeNode, dot *placeholder, vars map[string]*placeholder) *placeholder {
+	if pipe == nil {
+		return nil
+	}
+	var value *placeholder
+	for i, cmd := range pipe.Cmds {
+		// The value of the previous command is the last argument of this one.
+		if i > 0 && value != nil {
+			value.whole = true
+		}
+		value = nil
+		for _, arg := range cmd.Args {
+			value = s.arg(arg, dot, vars)
+			if value != nil && len(cmd.Args) != 1 {
+				value.whole = true
+			}
+		}
+		if len(cmd.Args) != 1 {
+			value = nil
+		}
+	}
+	if value != nil {
+		for _, d := range pipe.Decl {
+			vars[d.Ident[0]] = value
+		}
+	}
+	return value
+}
+
+// arg returns the placeholder of a command argument that references a field,
+// or nil for any other argument.
+func (s *placeholderScanner) arg(node parse.Node, dot *placeholder, vars map[string]*placeholder) *placeholder {
+	switch n := node.(type) {
+	case *parse.DotNode:
+		return dot
+	case *parse.FieldNode:
+		return dot.path(n.Ident)
+	case *parse.VariableNode:
+		if v, ok := vars[n.Ident[0]]; ok {
+			return v.path(n.Ident[1:])
+		}
+	case *parse.PipeNode:
+		if p := s.pipe(n, dot, vars); p != nil {
+			p.whole = true
+		}
+	case *parse.ChainNode:
+		if p := s.arg(n.Node, dot, vars); p != nil {
+			return p.path(n.Field)
+		}
+	}
+	return nil
+}
+
+// DryRunRender renders the template with synthetic data for all the fields it
+// references and validates that the output is valid JSON. This way templates
+// can be checked with their fields populated without writing sample data.
+//
+// The fields are found statically, following the value of dot in with and
+// range blocks and in template calls. Fields used in range loops get a slice
+// with two elements, fields with nested fields get an object, and any other
+// field gets the string "placeholder". The values in data, which can be
+// empty, are kept, and only the missing fields are added.
+func (t *Template) DryRunRender(data []byte) ([]byte, error) {
+	if t.o.lenientJSON {
+		data = stripJSONExtensions(data)
+	}
+	if err := validateData(data, t.o); err != nil {
+		return nil, err
+	}
+	values, err := unmarshalData(data)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &placeholderScanner{trees: templateTrees(t.tmpl), root: newPlaceholder()}
+	if t.tmpl.Tree != nil {
+		s.scan(t.tmpl.Tree.Root, s.root, map[string]*placeholder{"$": s.root})
+	}
+	b, err := json.Marshal(s.root.value(values))
+	if err != nil {
+		return nil, newTemplateError(JSONError, err, "error marshaling template data: "+err.Error())
+	}
+	out, m, err := t.render(context.Background(), "", b, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateOutput(out, t.text, m, t.o); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
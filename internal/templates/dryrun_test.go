@@ -0,0 +1,59 @@
+package templates
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplate_DryRunRender(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		opts    []Option
+		data    []byte
+		want    string
+		wantErr string
+	}{
+		{"ok/fields", `{"subject": {{ toJson .Subject.CommonName }}, "cn": "{{ .CommonName }}"}`, nil, nil,
+			`{"subject": "placeholder", "cn": "placeholder"}`, ""},
+		{"ok/range", `{"sans": [{{ range $i, $san := .SANs }}{{ if $i }},{{ end }}{{ toJson $san.Value }}{{ end }}]}`, nil, nil,
+			`{"sans": ["placeholder","placeholder"]}`, ""},
+		{"ok/range-dot", `{"names": {{ toJson .Names }}, "values": [{{ range .Values }}{{ toJson .Name }},{{ end }}null]}`, nil, nil,
+			`{"names": "placeholder", "values": ["placeholder","placeholder",null]}`, ""},
+		{"ok/with", `{{ with .Subject }}{"cn": {{ toJson .CommonName }}, "root": {{ toJson $.Root }}}{{ end }}`, nil, nil,
+			`{"cn": "placeholder", "root": "placeholder"}`, ""},
+		{"ok/variables", `{{ $s := .Subject }}{"cn": {{ toJson $s.CommonName }}}`, nil, nil,
+			`{"cn": "placeholder"}`, ""},
+		{"ok/template", `{{ define "cn" }}{{ toJson .CommonName }}{{ end }}{"cn": {{ template "cn" .Subject }}}`, nil, nil,
+			`{"cn": "placeholder"}`, ""},
+		{"ok/recursive-template", `{{ define "t" }}{{ if .Next }}{{ template "t" .Next }}{{ end }}{{ end }}{{ template "t" . }}{}`, nil, nil,
+			`{}`, ""},
+		{"ok/data", `{"cn": {{ toJson .Subject.CommonName }}, "sans": {{ toJson .SANs }}}`, nil, []byte(`{"Subject": {"CommonName": "foo"}}`),
+			`{"cn": "foo", "sans": "placeholder"}`, ""},
+		{"ok/strict", `{"cn": {{ toJson .Subject.CommonName }}}`, []Option{WithStrict(true)}, nil,
+			`{"cn": "placeholder"}`, ""},
+		{"ok/empty", ``, nil, nil, ``, ""},
+		{"fail/output", `{"cn": {{ .CommonName }}}`, nil, nil,
+			"", "error validating json template data: invalid JSON at offset 7, near template line 1, column 11: invalid character 'p' looking for beginning of value"},
+		{"fail/data", `{}`, nil, []byte(`{"Subject"}`),
+			"", "error validating json template data: invalid JSON at Subject (line 1, column 11): invalid character '}' after object key"},
+		{"fail/execute", `{{ fail "failed" }}`, nil, nil,
+			"", "error executing template: failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseTemplate([]byte(tt.text), tt.opts...)
+			require.NoError(t, err)
+			got, err := tmpl.DryRunRender(tt.data)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				assert.Nil(t, got)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package templates
+
+import "strings"
+
+// ErrorKind is the category of a TemplateError.
+type ErrorKind int
+
+const (
+	// ParseError is the kind of errors caused by a template that cannot be
+	// parsed.
+	ParseError ErrorKind = iota + 1
+	// ExecError is the kind of errors caused by a template that fails to
+	// execute, including the errors reported using the "fail" function.
+	ExecError
+	// JSONError is the kind of errors caused by invalid JSON, in the template
+	// data or in the rendered output of a template.
+	JSONError
+	// SchemaError is the kind of errors caused by a rendered template that
+	// doesn't match the expected schema.
+	SchemaError
+)
+
+// String returns the name of the error kind.
+func (k ErrorKind) String() string {
+	switch k {
+	case ParseError:
+		return "ParseError"
+	case ExecError:
+		return "ExecError"
+	case JSONError:
+		return "JSONError"
+	case SchemaError:
+		return "SchemaError"
+	default:
+		return "UnknownError"
+	}
+}
+
+// TemplateError is the error returned by the validation functions. The Kind
+// can be used to distinguish the different failure categories, and Err holds
+// the underlying cause, if any.
+type TemplateError struct {
+	Kind ErrorKind
+	Err  error
+	// Path is the template data field that caused the error. For missing keys
+	// in strict mode, it's the field used in the template, like
+	// ".Subject.CommonName", and for invalid template data, it's the path of
+	// the JSON value, like "subject.names[2].type", or empty for the root.
+	Path string
+	// Line and Column are the 1-based position of the error, or 0 if it's not
+	// known. The position is in the template data for errors in the data, and
+	// in the template text for errors in the template or its output.
+	Line   int
+	Column int
+	// Name is the name of the template defined with {{ define }} that caused
+	// the error, when ValidateTemplate validates each definition, or empty for
+	// the main template.
+	Name string
+	msg  string
+}
+
+func newTemplateError(kind ErrorKind, err error, msg string) *TemplateError {
+	return &TemplateError{
+		Kind: kind,
+		Err:  err,
+		msg:  msg,
+	}
+}
+
+// FailError is the cause of the TemplateError returned when a template fails
+// with the "fail" function, or with any function that fails like it does.
+// Code is the code given to {{ fail "E_NO_SAN" "at least one SAN is required" }},
+// or empty if the function was called only with a message, and can be used to
+// map the failures to exit codes or API responses.
+type FailError struct {
+	Code    string
+	Message string
+	err     error
+}
+
+// Error implements the error interface and returns the message.
+func (e *FailError) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the error of the template execution.
+func (e *FailError) Unwrap() error {
+	return e.err
+}
+
+// setPosition sets the line and column of the byte at offset. Like in locate,
+// if a sourceMap is given, the offset is in the rendered output of src.
+func (e *TemplateError) setPosition(offset int, src []byte, m *sourceMap) {
+	if src == nil {
+		return
+	}
+	if m != nil {
+		pos, _ := m.lookup(offset)
+		if pos < 0 {
+			return
+		}
+		offset = pos
+	}
+	e.Line, e.Column = position(src, offset)
+}
+
+// Error implements the error interface.
+func (e *TemplateError) Error() string {
+	return e.msg
+}
+
+// Unwrap returns the underlying cause of the error.
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// Errors is a list of errors reported as a single error.
+type Errors []error
+
+// Error implements the error interface and returns the messages of all the
+// errors separated by a semicolon.
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the list of errors.
+func (e Errors) Unwrap() []error {
+	return e
+}
@@ -0,0 +1,60 @@
+package templates
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorKind_String(t *testing.T) {
+	assert.Equal(t, "ParseError", ParseError.String())
+	assert.Equal(t, "ExecError", ExecError.String())
+	assert.Equal(t, "JSONError", JSONError.String())
+	assert.Equal(t, "UnknownError", ErrorKind(0).String())
+}
+
+func TestTemplateError(t *testing.T) {
+	var (
+		execError   template.ExecError
+		syntaxError *json.SyntaxError
+	)
+
+	tests := []struct {
+		name   string
+		err    error
+		kind   ErrorKind
+		target interface{}
+	}{
+		{"parse", ValidateTemplate([]byte(`{{ unknownFunction }}`)), ParseError, nil},
+		{"parse-with-data", ValidateTemplateWithData([]byte(`{{ if }}`), nil), ParseError, nil},
+		{"exec", ValidateTemplateWithData([]byte(`{{ .a.b }}`), []byte(`{"a": null}`)), ExecError, &execError},
+		{"exec-fail", ValidateTemplateWithData([]byte(`{{ fail "fail message" }}`), nil), ExecError, &execError},
+		{"json-data", ValidateTemplateData([]byte(`{"a":}`)), JSONError, &syntaxError},
+		{"json-output", ValidateTemplateWithData([]byte(`{"a": {{ .a }}}`), []byte(`{"a": "b"}`)), JSONError, &syntaxError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var te *TemplateError
+			if assert.True(t, errors.As(tt.err, &te)) {
+				assert.Equal(t, tt.kind, te.Kind)
+				assert.Error(t, te.Unwrap())
+				assert.Equal(t, tt.err.Error(), te.Error())
+			}
+			if tt.target != nil {
+				assert.True(t, errors.As(tt.err, tt.target))
+			}
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	err1 := errors.New("error one")
+	err2 := newTemplateError(JSONError, nil, "error two")
+	errs := Errors{err1, err2}
+	assert.EqualError(t, errs, "error one; error two")
+	assert.Equal(t, []error{err1, err2}, errs.Unwrap())
+	assert.EqualError(t, Errors{}, "")
+}
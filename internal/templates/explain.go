@@ -0,0 +1,158 @@
+package templates
+
+import "errors"
+
+// Sources of a Diagnostic.
+const (
+	// SourceTemplate is used for the diagnostics with a position in the
+	// template text.
+	SourceTemplate = "template"
+	// SourceData is used for the diagnostics with a position in the template
+	// data.
+	SourceData = "data"
+)
+
+// Diagnostic is a problem found by ExplainTemplate, an error or a lint. It can
+// be encoded as JSON to report the problems of a template in a machine
+// readable way.
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	// Code is the code of the lint, like "raw-output", or for errors the kind
+	// of error, "parse-error", "exec-error", "json-error" or "schema-error".
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Source is SourceTemplate or SourceData, the document Line and Column
+	// refer to. Line and Column are 1-based, or 0 if they are not known.
+	Source string `json:"source"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	// Path is the field or the JSON value that caused an error, see
+	// TemplateError.
+	Path string `json:"path,omitempty"`
+	// FailCode is the code given to the "fail" function, if any.
+	FailCode string `json:"failCode,omitempty"`
+	// Fix is the suggested fix, like "use {{ toJson .Name }} instead of
+	// {{.Name}}", if there's one.
+	Fix string `json:"fix,omitempty"`
+}
+
+// errorCodes are the codes of the diagnostics for each kind of error.
+var errorCodes = map[ErrorKind]string{
+	ParseError:  "parse-error",
+	ExecError:   "exec-error",
+	JSONError:   "json-error",
+	SchemaError: "schema-error",
+}
+
+// ExplainTemplate runs all the checks on a template and its data in one pass,
+// and returns the problems found as diagnostics: the errors in the data, the
+// error parsing the template, the error rendering it with the data and
+// validating its output, the lints found by LintTemplate, and the keys of the
+// data not used by the template, found with Template.UnusedKeys. With the
+// WithAllErrors option, each error reported is a diagnostic. The errors come
+// first, followed by the lints in the order of the template and then the
+// unused keys.
+//
+// The use of unknown functions is reported only by the lints, with the
+// closest function as the suggested fix. The returned error is the first
+// error found, like the one returned by ValidateTemplateWithData, so the
+// diagnostics are returned even if the template is not valid.
+func ExplainTemplate(text, data []byte, opts ...Option) ([]Diagnostic, error) {
+	o := newOptions(opts)
+	diags := []Diagnostic{}
+	var firstErr error
+	addError := func(err error, source string) {
+		if firstErr == nil {
+			firstErr = err
+		}
+		diags = append(diags, errorDiagnostics(err, source)...)
+	}
+
+	dataErr := ValidateTemplateData(data, opts...)
+	if dataErr != nil {
+		addError(dataErr, SourceData)
+	}
+	if len(text) == 0 {
+		return diags, firstErr
+	}
+
+	l, err := lintTemplate(text, o)
+	if err != nil {
+		addError(err, SourceTemplate)
+		return diags, firstErr
+	}
+	unknownFuncs := false
+	for _, lint := range l.lints {
+		unknownFuncs = unknownFuncs || lint.Code == LintUnknownFunction
+	}
+
+	var unused *linter
+	if t, err := ParseTemplate(text, opts...); err != nil {
+		// All the unknown functions are reported by the lints.
+		if !unknownFuncs {
+			addError(err, SourceTemplate)
+		} else if firstErr == nil {
+			firstErr = err
+		}
+	} else if dataErr == nil {
+		if err := t.Validate(data); err != nil {
+			addError(err, SourceTemplate)
+		}
+		unused, _ = t.unusedKeys(data)
+	}
+
+	diags = append(diags, lintDiagnostics(l, SourceTemplate)...)
+	if unused != nil {
+		diags = append(diags, lintDiagnostics(unused, SourceData)...)
+	}
+	return diags, firstErr
+}
+
+// errorDiagnostics returns the diagnostics for an error, one for each error
+// in an Errors.
+func errorDiagnostics(err error, source string) []Diagnostic {
+	var errs Errors
+	if errors.As(err, &errs) {
+		var diags []Diagnostic
+		for _, e := range errs {
+			diags = append(diags, errorDiagnostics(e, source)...)
+		}
+		return diags
+	}
+
+	d := Diagnostic{
+		Severity: SeverityError,
+		Code:     "error",
+		Message:  err.Error(),
+		Source:   source,
+	}
+	var te *TemplateError
+	if errors.As(err, &te) {
+		if code, ok := errorCodes[te.Kind]; ok {
+			d.Code = code
+		}
+		d.Line, d.Column, d.Path = te.Line, te.Column, te.Path
+	}
+	var fe *FailError
+	if errors.As(err, &fe) {
+		d.FailCode = fe.Code
+	}
+	return []Diagnostic{d}
+}
+
+// lintDiagnostics returns the diagnostics for the lints of l.
+func lintDiagnostics(l *linter, source string) []Diagnostic {
+	diags := make([]Diagnostic, len(l.lints))
+	for i, lint := range l.lints {
+		diags[i] = Diagnostic{
+			Severity: lint.Severity,
+			Code:     lint.Code,
+			Message:  lint.Message,
+			Source:   source,
+			Line:     lint.Line,
+			Column:   lint.Column,
+			Fix:      l.fixes[i],
+		}
+	}
+	return diags
+}
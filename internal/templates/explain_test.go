@@ -0,0 +1,67 @@
+package templates
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplainTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		data    string
+		opts    []Option
+		want    []Diagnostic
+		wantErr string
+	}{
+		{"ok", `{"cn": {{ toJson .CommonName }}}`, `{"CommonName": "foo"}`, nil, []Diagnostic{}, ""},
+		{"ok/empty", ``, ``, nil, []Diagnostic{}, ""},
+		{"lints", `{"cn": "{{ .CommonName }}", "sans": {{ tojson .SANs }}, "o": {{ .O | lower }}}`, `{"CommonName": "foo"}`, nil, []Diagnostic{
+			{Severity: SeverityWarning, Code: LintUnescapedString, Message: `output of {{.CommonName}} is not escaped inside a JSON string, use {{ jsonQuote .CommonName }} instead of "{{.CommonName}}"`, Source: SourceTemplate, Line: 1, Column: 12, Fix: `use {{ jsonQuote .CommonName }} instead of "{{.CommonName}}"`},
+			{Severity: SeverityWarning, Code: LintRawOutput, Message: `output of {{tojson .SANs}} is not JSON encoded, consider using toJson`, Source: SourceTemplate, Line: 1, Column: 40, Fix: `use {{ tojson .SANs | toJson }} instead of {{tojson .SANs}}`},
+			{Severity: SeverityError, Code: LintUnknownFunction, Message: `function "tojson" not defined`, Source: SourceTemplate, Line: 1, Column: 40, Fix: "use toJson instead of tojson"},
+			{Severity: SeverityWarning, Code: LintRawOutput, Message: `output of {{.O | lower}} is not JSON encoded, consider using toJson`, Source: SourceTemplate, Line: 1, Column: 65, Fix: `use {{ .O | lower | toJson }} instead of {{.O | lower}}`},
+		}, `error parsing template: template: template:1: function "tojson" not defined`},
+		{"render", `{"cn": {{ toJson .CommonName }}, "o": {{ .Org }}}`, `{"CommonName": "foo", "Org": "Acme", "Old": 1}`, nil, []Diagnostic{
+			{Severity: SeverityError, Code: "json-error", Message: "error validating json template data: invalid JSON at offset 19, near template line 1, column 42: invalid character 'A' looking for beginning of value", Source: SourceTemplate, Line: 1, Column: 42},
+			{Severity: SeverityWarning, Code: LintRawOutput, Message: `output of {{.Org}} is not JSON encoded, consider using toJson`, Source: SourceTemplate, Line: 1, Column: 42, Fix: `use {{ toJson .Org }} instead of {{.Org}}`},
+			{Severity: SeverityWarning, Code: LintUnusedKey, Message: "key Old is not used by the template", Source: SourceData, Line: 1, Column: 38, Fix: "remove Old from the data, or rename it to the field used by the template"},
+		}, "error validating json template data: invalid JSON at offset 19, near template line 1, column 42: invalid character 'A' looking for beginning of value"},
+		{"fail", `{{ if not .CommonName }}{{ fail "E_CN" "a common name is required" }}{{ end }}{}`, `{}`, nil, []Diagnostic{
+			{Severity: SeverityError, Code: "exec-error", Message: "error executing template: a common name is required", Source: SourceTemplate, FailCode: "E_CN"},
+		}, "error executing template: a common name is required"},
+		{"parse", "{\n{{ if }}", `{"a": }`, nil, []Diagnostic{
+			{Severity: SeverityError, Code: "json-error", Message: "error validating json template data: invalid JSON at a (line 1, column 7): invalid character '}' looking for beginning of value", Source: SourceData, Line: 1, Column: 7, Path: "a"},
+			{Severity: SeverityError, Code: "parse-error", Message: "error parsing template: template: template:2: missing value for if", Source: SourceTemplate, Line: 2, Column: 1},
+		}, "error validating json template data: invalid JSON at a (line 1, column 7): invalid character '}' looking for beginning of value"},
+		{"all-errors", `{}`, `{"a": , "b": }`, []Option{WithAllErrors(true)}, []Diagnostic{
+			{Severity: SeverityError, Code: "json-error", Message: "error validating json template data: invalid JSON at a (line 1, column 7): invalid character ',' looking for beginning of value", Source: SourceData, Line: 1, Column: 7, Path: "a"},
+			{Severity: SeverityError, Code: "json-error", Message: "error validating json template data: invalid JSON at b (line 1, column 14): invalid character '}' looking for beginning of value", Source: SourceData, Line: 1, Column: 14, Path: "b"},
+		}, "error validating json template data: invalid JSON at a (line 1, column 7): invalid character ',' looking for beginning of value; error validating json template data: invalid JSON at b (line 1, column 14): invalid character '}' looking for beginning of value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExplainTemplate([]byte(tt.text), []byte(tt.data), tt.opts...)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestExplainTemplate_json(t *testing.T) {
+	diags, err := ExplainTemplate([]byte(`{"cn": {{ .CommonName }}}`), []byte(`{"CommonName": "foo"}`))
+	require.Error(t, err)
+	b, err := json.Marshal(diags)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"severity": "error", "code": "json-error", "message": "error validating json template data: invalid JSON at offset 8, near template line 1, column 11: invalid character 'o' in literal false (expecting 'a')", "source": "template", "line": 1, "column": 11},
+		{"severity": "warning", "code": "raw-output", "message": "output of {{.CommonName}} is not JSON encoded, consider using toJson", "source": "template", "line": 1, "column": 11, "fix": "use {{ toJson .CommonName }} instead of {{.CommonName}}"}
+	]`, string(b))
+}
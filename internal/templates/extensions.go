@@ -0,0 +1,163 @@
+package templates
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// criticality is the value that RFC 5280 requires in the critical flag of an
+// extension.
+type criticality int
+
+const (
+	mustBeCritical criticality = iota + 1
+	mustNotBeCritical
+)
+
+// extensionRules are the extensions whose critical flag is required by RFC
+// 5280, by object identifier, with the name used by "oid". The rules of
+// ca are only checked with ProfileCA.
+var extensionRules = map[string]struct {
+	name string
+	all  criticality
+	ca   criticality
+}{
+	"2.5.29.14":          {name: "subjectKeyIdentifier", all: mustNotBeCritical},
+	"2.5.29.19":          {name: "basicConstraints", ca: mustBeCritical},
+	"2.5.29.30":          {name: "nameConstraints", all: mustBeCritical},
+	"2.5.29.35":          {name: "authorityKeyIdentifier", all: mustNotBeCritical},
+	"2.5.29.36":          {name: "policyConstraints", all: mustBeCritical},
+	"2.5.29.54":          {name: "inhibitAnyPolicy", all: mustBeCritical},
+	"1.3.6.1.5.5.7.1.1":  {name: "authorityInfoAccess", all: mustNotBeCritical},
+	"1.3.6.1.5.5.7.1.11": {name: "subjectInfoAccess", all: mustNotBeCritical},
+}
+
+// extensionCriticalPath matches the path of the critical flag of an extension
+// in the output of an X.509 template.
+var extensionCriticalPath = regexp.MustCompile(`^extensions\[[0-9]+\]\.critical$`)
+
+// checkExtensions returns the violations of the critical flags of the
+// extensions in the valid JSON document data, the output of an X.509
+// template with the profile p. The flag must be a boolean, and the extensions
+// in extensionRules must have the value required by RFC 5280; a missing flag
+// is false, like x509util does. Extensions that are not objects with an "id"
+// string are left to the schema.
+func checkExtensions(data []byte, p Profile) Errors {
+	var v struct {
+		Extensions []json.RawMessage `json:"extensions"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil
+	}
+
+	var errs Errors
+	for i, raw := range v.Extensions {
+		var ext map[string]json.RawMessage
+		var id string
+		if err := json.Unmarshal(raw, &ext); err != nil || json.Unmarshal(ext["id"], &id) != nil || id == "" {
+			continue
+		}
+		path := indexPath("extensions", i)
+		rule := extensionRules[id]
+		name := id
+		if rule.name != "" {
+			name = rule.name + " (" + id + ")"
+		}
+
+		flag, hasFlag := ext["critical"]
+		var critical bool
+		if hasFlag {
+			if bytes.Equal(flag, []byte("null")) || json.Unmarshal(flag, &critical) != nil {
+				errs = append(errs, &schemaViolation{
+					path: joinPath(path, "critical"),
+					msg:  fmt.Sprintf("the critical flag of extension %s must be a boolean, not %s", name, flag),
+				})
+				continue
+			}
+		}
+
+		want := rule.all
+		if p == ProfileCA && rule.ca != 0 {
+			want = rule.ca
+		}
+		var msg string
+		switch {
+		case want == mustBeCritical && !critical:
+			msg = fmt.Sprintf("extension %s must be critical", name)
+		case want == mustNotBeCritical && critical:
+			msg = fmt.Sprintf("extension %s must not be critical", name)
+		default:
+			continue
+		}
+		if !hasFlag {
+			errs = append(errs, &schemaViolation{path: path, key: "critical", msg: msg})
+		} else {
+			errs = append(errs, &schemaViolation{path: joinPath(path, "critical"), msg: msg})
+		}
+	}
+	return errs
+}
+
+// extensionValue returns the JSON string with the value of an extension, the
+// standard base64 of a DER value, like x509util expects in the "value" of a
+// custom extension. The value can be given in base64, or in DER as a byte
+// slice. The DER must be a single well-formed ASN.1 value, with every
+// constructed value in it well-formed too, but its type is not checked.
+func extensionValue(v interface{}) (string, error) {
+	var der []byte
+	switch s := v.(type) {
+	case nil:
+		return "", errors.New("error validating extension value: value is missing")
+	case string:
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+		if err != nil {
+			return "", fmt.Errorf("error validating extension value: value is not base64: %w", err)
+		}
+		der = b
+	case []byte:
+		der = s
+	default:
+		return "", fmt.Errorf("error validating extension value: unsupported value %v of type %T", v, v)
+	}
+	if len(der) == 0 {
+		return "", errors.New("error validating extension value: value is empty")
+	}
+
+	var raw asn1.RawValue
+	rest, err := asn1.Unmarshal(der, &raw)
+	if err == nil && len(rest) > 0 {
+		err = fmt.Errorf("%d bytes of trailing data after the value", len(rest))
+	}
+	if err == nil && raw.IsCompound {
+		err = checkDER(raw.Bytes)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error validating extension value: invalid DER: %w", err)
+	}
+	return `"` + base64.StdEncoding.EncodeToString(der) + `"`, nil
+}
+
+// checkDER returns an error if the contents of a constructed value, der, are
+// not a sequence of well-formed DER values.
+func checkDER(der []byte) error {
+	for len(der) > 0 {
+		var raw asn1.RawValue
+		rest, err := asn1.Unmarshal(der, &raw)
+		if err != nil {
+			return err
+		}
+		if raw.IsCompound {
+			if err := checkDER(raw.Bytes); err != nil {
+				return err
+			}
+		}
+		der = rest
+	}
+	return nil
+}
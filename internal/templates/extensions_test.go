@@ -0,0 +1,63 @@
+package templates
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_extensionValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       interface{}
+		want    string
+		wantErr string
+	}{
+		{"ok/sequence", "MAMBAf8=", `"MAMBAf8="`, ""},
+		{"ok/spaces", " MAMBAf8=\n", `"MAMBAf8="`, ""},
+		{"ok/empty-sequence", "MAA=", `"MAA="`, ""},
+		{"ok/octet-string", "BAIBAg==", `"BAIBAg=="`, ""},
+		{"ok/tagged", "oAUwAwEBAA==", `"oAUwAwEBAA=="`, ""},
+		{"ok/der", []byte{0x30, 0x03, 0x01, 0x01, 0xff}, `"MAMBAf8="`, ""},
+		{"fail/truncated", "MAMBAQ==", "", "error validating extension value: invalid DER: asn1: syntax error: data truncated"},
+		{"fail/truncated-inner", "MAIwBQ==", "", "error validating extension value: invalid DER: asn1: syntax error: data truncated"},
+		{"fail/trailing-data", "MAAA", "", "error validating extension value: invalid DER: 1 bytes of trailing data after the value"},
+		{"fail/non-minimal-length", "MIECAQE=", "", "error validating extension value: invalid DER: asn1: structure error: non-minimal length"},
+		{"fail/base64", "not base64!", "", "error validating extension value: value is not base64: illegal base64 data at input byte 3"},
+		{"fail/base64url", "MAMBAf8_", "", "error validating extension value: value is not base64: illegal base64 data at input byte 7"},
+		{"fail/empty", "", "", "error validating extension value: value is empty"},
+		{"fail/empty-der", []byte{}, "", "error validating extension value: value is empty"},
+		{"fail/nil", nil, "", "error validating extension value: value is missing"},
+		{"fail/type", 1, "", "error validating extension value: unsupported value 1 of type int"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := extensionValue(tt.v)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestTemplate_extensionValue(t *testing.T) {
+	text := []byte(`{"extensions": [{"id": "1.2.3.4", "critical": false, "value": {{ extensionValue .Raw }}}]}`)
+	tmpl, err := ParseTemplate(text)
+	require.NoError(t, err)
+	out, err := tmpl.Render([]byte(`{"Raw": "MAMBAf8="}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"extensions": [{"id": "1.2.3.4", "critical": false, "value": "MAMBAf8="}]}`, string(out))
+
+	err = tmpl.Validate([]byte(`{"Raw": "MAMBAQ=="}`))
+	assert.EqualError(t, err, "error executing template: error validating extension value: invalid DER: asn1: syntax error: data truncated")
+	err = tmpl.Validate([]byte(`{"Raw": "%%%"}`))
+	assert.EqualError(t, err, "error executing template: error validating extension value: value is not base64: illegal base64 data at input byte 0")
+
+	lints, err := LintTemplate(text)
+	require.NoError(t, err)
+	assert.Empty(t, lints)
+}
@@ -0,0 +1,74 @@
+package templates
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// contextLines is the number of lines before the error shown by FormatError.
+const contextLines = 2
+
+// FormatError returns the message of err followed by the lines of source
+// around the position of the error and a caret pointing at the column, like:
+//
+//	error validating json template data: invalid JSON at template line 3, column 2: ...
+//	  2 | 	"subject": {{ toJson .Subject }}
+//	  3 | 	"sans": {{ toJson .SANs }}
+//	    | 	^
+//
+// The source must be the template data for errors in the data, and the
+// template text for any other error. If err is not a TemplateError with a
+// position, only the message is returned.
+func FormatError(err error, source []byte) string {
+	if err == nil {
+		return ""
+	}
+
+	var te *TemplateError
+	if !errors.As(err, &te) || te.Line < 1 || te.Column < 1 {
+		return err.Error()
+	}
+
+	lines := bytes.Split(source, []byte("\n"))
+	if te.Line > len(lines) {
+		return err.Error()
+	}
+
+	first := te.Line - contextLines
+	if first < 1 {
+		first = 1
+	}
+	width := len(fmt.Sprint(te.Line))
+
+	var sb strings.Builder
+	sb.WriteString(err.Error())
+	for i := first; i <= te.Line; i++ {
+		fmt.Fprintf(&sb, "\n%*d | %s", width, i, strings.TrimRight(string(lines[i-1]), "\r"))
+	}
+	fmt.Fprintf(&sb, "\n%*s | %s^", width, "", caretPadding(lines[te.Line-1], te.Column))
+	return sb.String()
+}
+
+// caretPadding returns the padding used to put a caret under the given 1-based
+// byte column in line. Tabs are kept so the caret is aligned with the line,
+// and multi-byte characters use a single space.
+func caretPadding(line []byte, column int) string {
+	if column-1 < len(line) {
+		line = line[:column-1]
+	}
+
+	var sb strings.Builder
+	for len(line) > 0 {
+		r, size := utf8.DecodeRune(line)
+		if r == '\t' {
+			sb.WriteByte('\t')
+		} else {
+			sb.WriteByte(' ')
+		}
+		line = line[size:]
+	}
+	return sb.String()
+}
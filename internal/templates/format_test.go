@@ -0,0 +1,75 @@
+package templates
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatError(t *testing.T) {
+	text := []byte("{\n\t\"subject\": {{ toJson .Subject }}\n\t\"sans\": {{ toJson .SANs }}\n}")
+	data := []byte("{\n  \"Subject\": {\"commonName\": \"ñandú\" \"foo\"}\n}")
+
+	tests := []struct {
+		name   string
+		err    error
+		source []byte
+		want   string
+	}{
+		{"output", ValidateTemplateWithData(text, []byte(`{"Subject": {}, "SANs": []}`)), text,
+			"error validating json template data: invalid JSON at template line 3, column 2: invalid character '\"' after object key:value pair\n" +
+				"1 | {\n" +
+				"2 | \t\"subject\": {{ toJson .Subject }}\n" +
+				"3 | \t\"sans\": {{ toJson .SANs }}\n" +
+				"  | \t^"},
+		{"data", ValidateTemplateData(data), data,
+			"error validating json template data: invalid JSON at Subject.commonName (line 2, column 39): invalid character '\"' after object key:value pair\n" +
+				"1 | {\n" +
+				"2 |   \"Subject\": {\"commonName\": \"ñandú\" \"foo\"}\n" +
+				"  |                                     ^"},
+		{"first-line", ValidateTemplateData([]byte(`{"a" 1}`)), []byte(`{"a" 1}`),
+			"error validating json template data: invalid JSON at a (line 1, column 6): invalid character '1' after object key\n" +
+				"1 | {\"a\" 1}\n" +
+				"  |      ^"},
+		{"duplicate-key", ValidateTemplateData([]byte("{\n\"a\": 1,\n\"a\": 2}"), WithRejectDuplicateKeys(true)), []byte("{\n\"a\": 1,\n\"a\": 2}"),
+			"error validating json template data: duplicate key \"a\" at line 3, column 1\n" +
+				"1 | {\n" +
+				"2 | \"a\": 1,\n" +
+				"3 | \"a\": 2}\n" +
+				"  | ^"},
+		{"no-position", ValidateTemplateWithData([]byte(`{{ fail "failed" }}`), nil), nil, "error executing template: failed"},
+		{"not-a-template-error", errors.New("an error"), text, "an error"},
+		{"line-out-of-range", &TemplateError{Line: 10, Column: 1, msg: "an error"}, text, "an error"},
+		{"nil", nil, text, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, FormatError(tt.err, tt.source))
+		})
+	}
+}
+
+func TestTemplateError_position(t *testing.T) {
+	text := []byte("{\n\t\"subject\": {{ toJson .Subject }}\n\t\"sans\": {{ toJson .SANs }}\n}")
+	tests := []struct {
+		name      string
+		err       error
+		line, col int
+	}{
+		{"output", ValidateTemplateWithData(text, []byte(`{"Subject": {}, "SANs": []}`)), 3, 2},
+		{"output-near", ValidateTemplateWithData([]byte(`{"a": {{ .a }}}`), []byte(`{"a": "foo"}`)), 1, 10},
+		{"data", ValidateTemplateData([]byte("{\n  \"a\": }")), 2, 8},
+		{"duplicate-key-output", ValidateTemplateWithData([]byte(`{"a": 1, {{ "\"a\"" }}: 2}`), nil, WithRejectDuplicateKeys(true)), 1, 13},
+		{"no-position", ValidateTemplateWithData([]byte(`{{ fail "failed" }}`), nil), 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var te *TemplateError
+			if assert.True(t, errors.As(tt.err, &te)) {
+				assert.Equal(t, tt.line, te.Line)
+				assert.Equal(t, tt.col, te.Column)
+			}
+		})
+	}
+}
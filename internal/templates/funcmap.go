@@ -1,8 +1,18 @@
 package templates
 
 import (
+	"crypto/rand"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
 	"text/template"
+	"time"
 
 	"github.com/Masterminds/sprig/v3"
 )
@@ -10,17 +20,1230 @@ import (
 // GetFuncMap returns the list of functions provided by sprig. It changes the
 // function "fail" to set the given string, this way we can report template
 // errors directly to the template without having the wrapper that text/template
-// adds.
+// adds. The function "fail" can also be called with a code and a message, like
+// {{ fail "E_NO_SAN" "at least one SAN is required" }}, and the validation
+// functions report it as a FailError with both. GetFuncMap only sets the
+// message, use NewFuncs to get the code.
 //
 // sprig "env" and "expandenv" functions are removed to avoid the leak of
-// information.
+// information. They are replaced by an "env" function that only returns the
+// environment variables allowed with WithAllowedEnv, and fails for any other
+// variable. With GetFuncMap no variable is allowed.
+//
+// The function "toJson" marshals a value to compact JSON, escaping quotes,
+// control characters and HTML characters, so it can be used to write any part
+// of the template data. The function "mustToJson" does the same, but values
+// that cannot be marshaled, like channels or functions, make the template fail
+// like "fail" does.
+//
+// The function "jsonQuote", used like {"cn": {{ jsonQuote .CommonName }}},
+// returns a JSON string with the given value, escaping quotes, backslashes and
+// control characters, unlike the sprig function "quote", that uses Go escaping
+// and skips nil values. The function "jsonSquote" does the same using single
+// quotes.
+//
+// The function "printf", predefined by text/template, formats its arguments
+// like fmt.Sprintf, so a value is composed from several pieces without
+// concatenating them, but its output is not escaped, and it must be quoted to
+// be a JSON string, like {"cn": {{ printf "%s-%v" .Name .ID | jsonQuote }}}. The
+// function "jsonPrintf", used like {"cn": {{ jsonPrintf "%s-%v" .Name .ID }}},
+// does both, and returns the formatted string as a JSON string, escaped like
+// "jsonQuote" does. The numbers of the template data are float64, so they are
+// formatted with %v instead of %d.
+//
+// The function "fallback", used like {{ fallback "RSA" .KeyType }}, returns the
+// fallback value if the given one is nil, an empty string, an empty slice or
+// an empty map. Unlike the sprig function "default", false and zero numbers
+// are not considered empty, because they are usually meaningful values in
+// JSON. The function "firstNonEmpty", used like
+// {{ firstNonEmpty .Preferred .Fallback "static" }}, returns the first
+// argument that is not empty using the same rules, or an empty string if all
+// of them are empty, unlike the sprig function "coalesce", that uses the rules
+// of "default" and returns nil. The function "ifElse", used like
+// {"isCA": {{ ifElse .IsCA "true" "false" }}}, returns the second argument if
+// the condition is true, and the third one otherwise. The condition is false
+// if it's the boolean false or empty with the rules of "fallback", so unlike
+// the condition of the sprig function "ternary", used like
+// {{ ternary "true" "false" .IsCA }}, that is the last argument, it can be any
+// value. The function "ternary" is the sprig one.
+//
+// The functions "b64encBytes" and "b64decStrict" encode and decode strings or
+// byte slices using the standard base64 encoding, and "b64urlenc" and
+// "b64urldec" using the URL-safe one. The decoders make the template fail like
+// "fail" does if the input is not valid base64, unlike the sprig function
+// "b64dec", that returns the error as the decoded string.
+//
+// The function "joinParts", used like {{ joinParts "," .Domains }}, returns
+// the elements of a list separated by the given string, formatting the
+// elements that are not strings with fmt, and using strings and byte slices
+// as they are, unlike the sprig function "join". The function "splitParts",
+// used like {{ splitParts "," .Domains }}, returns a list with the parts of a
+// string, or an empty list for an empty string. Unlike the sprig function
+// "split", that returns a map, the result can be used with range and toJson,
+// and unlike "splitList", an empty string has no parts.
+//
+// The functions "firstElem" and "lastElem", used like
+// {{ firstElem .SANs | toJson }}, return the first and the last element of a
+// list, or nil if it's empty, and "restElems" returns a list without the
+// first element. The function "sliceElems", used like
+// {{ sliceElems .SANs 1 3 }} or {{ .SANs | sliceElems 1 3 }}, returns the
+// elements from the first index to the second one, not included, or to the
+// end of the list without the second one, so the list can be the first or the
+// last argument. A nil list is an empty list, and a value that is not a list,
+// or an index that is negative or out of range, makes the template fail like
+// "fail" does, instead of failing with the panic of the sprig functions
+// "first", "last" and "rest", and of the function "slice" predefined by
+// text/template.
+//
+// The function "regexMatchStrict", used like
+// {{ if regexMatchStrict "^[a-z0-9.-]+$" .CommonName }}, reports whether a
+// string contains a match of a regular expression, and "regexReplace", used
+// like {{ regexReplace "^(.*)@(.*)$" .Email "$1" }}, replaces the matches,
+// with $1 or ${name} expanded to the submatches. Invalid patterns make the
+// template fail like "fail" does, unlike the sprig function "regexMatch", that
+// reports no match, and each pattern is compiled only once per execution.
+//
+// The function "now" returns the current time, from the clock set with
+// WithClock if any, and "dateAdd", used like {{ now | dateAdd "720h" }},
+// adds a duration to a time.Time or an RFC 3339 string, and returns the result
+// as an RFC 3339 string in UTC, ready to be used in fields like "notAfter".
+// The function "addDuration", used like {{ addDuration .NotBefore "2160h" }},
+// does the same with the time first, and keeps the offset of the time in the
+// result, with leap seconds read as the first second of the next minute.
+// The function "formatTime", used like {{ now | formatTime "utctime" }},
+// formats a time.Time or an RFC 3339 string in UTC with a layout of the time
+// package, like "2006-01-02", or a named format, "rfc3339", "rfc3339nano",
+// "utctime" or "generalizedtime", the last two as encoded in certificates.
+// The function "parseTime", used like
+// {{ parseTime "utctime" .NotAfter | formatTime "rfc3339" }}, parses a
+// string with a layout or a named format and returns the time.Time. Invalid
+// durations, times or formats, and years outside of 1950 to 2049 in
+// "utctime", make the template fail like "fail" does.
+//
+// The function "validity", used like {{ validity .Duration }} or
+// {{ validity .NotBefore .NotAfter }}, returns the lifetime of a certificate,
+// given as a duration or as the notBefore and notAfter times, as a duration
+// like "2160h0m0s", so it can be used with "addDuration". A lifetime that is
+// not positive, or longer than the maximum set with WithMaxValidity, makes the
+// template fail like "fail" does, with an error like "requested 397d exceeds
+// max 90d". Without a maximum, like with GetFuncMap, any positive lifetime is
+// valid. A template that sets both times can check that notBefore is strictly
+// before notAfter with {{ $_ := validity .NotBefore .NotAfter }}.
+//
+// The function "randHex", used like {{ randHex 16 }}, returns a string with
+// the given number of random hexadecimal characters, and "randAlnum" with
+// random letters and digits. The characters are generated using crypto/rand,
+// or the source set with WithRandReader, so, on purpose, every render of a
+// template using them is different. Unlike the sprig function "randAlphaNum",
+// that always uses crypto/rand and only takes an int, the length can come from
+// the template data, and negative lengths, or lengths greater than 1024, make
+// the template fail like "fail" does.
+//
+// The function "uuidV5", used like {{ uuidV5 "dns" .CommonName | toJson }},
+// returns the version 5 UUID of RFC 4122 of a name in a name space, a UUID or
+// one of "dns", "url", "oid" and "x500", so the same name always has the same
+// UUID, like in a reproducible fixture. An invalid name space makes the
+// template fail like "fail" does. The function "uuidV4", used like
+// {{ uuidV4 | toJson }}, returns a random UUID using the source of "randHex".
+//
+// The function "include", used like {{ include "common/org.tmpl" .Subject }},
+// renders a file from the file system set with WithIncludeFS, with the given
+// value, or nil, as dot. The file uses the same functions and options, and can
+// include other files, up to 10 levels and without cycles. Any error in the
+// file makes the template fail with the name of the file. Without a file
+// system, like with GetFuncMap, "include" always fails.
+//
+// The functions "addInt", "subInt", "mulInt", "divInt" and "modInt", used like
+// {{ addInt .Index 1 }}, do integer arithmetic. Numbers without a fractional
+// part are integers, like the numbers in the template data, that are decoded
+// as floating point numbers. Unlike the sprig functions "add", "sub", "mul",
+// "div" and "mod", that truncate them, numbers with a fractional part make the
+// template fail like "fail" does, and so do overflows and divisions by zero,
+// with the name of the function in the error. The sprig functions "addf",
+// "subf", "mulf" and "divf" can be used with decimal numbers.
+//
+// The function "sans", used like {"sans": {{ sans .SANs }}}, returns the JSON
+// array of subject alternative names for a list of maps or structs with a type
+// and a value. The types "dns", "email", "ip" and "uri" are supported, and an
+// unknown type, or an invalid IP address, URI or wildcard DNS name, makes the
+// template fail like "fail" does.
+//
+// The functions "upperCase", "lowerCase" and "titleCase", used like
+// {{ .Country | upperCase }}, change the case of a string using the Unicode
+// rules of no particular language, so the result doesn't depend on a locale,
+// "ß" is "SS" in upper case, and the dotted "İ" is not the Turkish "i" in
+// lower case. Unlike the sprig function "title", "titleCase" also puts the
+// rest of each word in lower case, so "ACME CORP." is "Acme Corp.".
+//
+// The functions "isDNSName", "isIP", "isEmail" and "isURI", used like
+// {{ if isDNSName .Host }}, report whether a string is a valid identifier of
+// that kind, using the same rules as "sans" and x509util: DNS names can have
+// a "*." wildcard prefix and internationalized labels, which are checked in
+// their punycode form, and URIs must be absolute. Following RFC 6125, the
+// wildcard must be the whole leftmost label and cannot cover a top-level
+// domain, so "a*.example.com", "*.*.example.com" and "*.com" are not valid,
+// and with WithRejectWildcards no wildcard is valid. The functions
+// "assertDNSName", "assertIP", "assertEmail" and "assertURI", used like
+// {{ .Host | assertDNSName | toJson }}, return the string if it's valid and
+// make the template fail like "fail" does otherwise. The function "email",
+// used like {{ email .Contact | toJson }}, parses an email address with
+// net/mail and returns it normalized for an rfc822Name SAN, with the domain
+// in lower case punycode. Display names, comments and angle brackets, like in
+// "Jane <jane@example.com>", and local parts that are not ASCII, make the
+// template fail like "fail" does. The function "ip", used like
+// {{ ip .Addr | toJson }}, returns the canonical form of an IPv4 or IPv6
+// address, like "2001:db8::1" for "2001:0db8:0000::0001", with IPv4-mapped
+// addresses as IPv4. Invalid addresses, IPv4 addresses with leading zeros,
+// CIDR prefixes and IPv6 zones, like "fe80::1%eth0", make the template fail
+// like "fail" does. The function "uri", used like {{ uri .SPIFFEID | toJson }},
+// returns the canonical form of an absolute URI for a
+// uniformResourceIdentifier SAN, with the scheme and the host in lower case,
+// like "spiffe://example.org/ns/default/sa/web". Relative URIs, without a
+// scheme, and URIs that cannot be parsed make the template fail like "fail"
+// does.
+//
+// The functions "sha256" and "sha1", used like {{ sha256 .CommonName }},
+// return the hex encoded digest of a string or byte slice, or of the string
+// representation of any other value, and nothing for nil. They can be used to
+// derive deterministic values, like a serial number or a key identifier. The
+// function "fingerprint", used like {{ .Key | fingerprint "colon" }}, returns
+// the SHA-256 digest in the encodings of the fingerprint package, "hex",
+// "base64", "base64url", "base64raw", "base64rawurl" or "emoji", or in "colon",
+// the hex encoding with the bytes separated by colons. An unknown encoding
+// makes the template fail like "fail" does.
+//
+// The function "keyFingerprint", used like {{ keyFingerprint "issuer" }},
+// returns the fingerprint of the bytes of the key with the given name, read
+// with the resolver set with WithKeyResolver, in "hex" or in the encoding given
+// as a second argument, like {{ keyFingerprint "issuer" "colon" }}. Without a
+// resolver, a name that cannot be resolved, or an unknown encoding make the
+// template fail like "fail" does, so templates don't have access to any key by
+// default.
+//
+// The function "hexGroup", used like {{ hexGroup .KeyID }}, returns a key
+// identifier, given as a byte slice or as a hex string, in upper case hex
+// with the bytes separated by colons, like "1A:2B:3C", and "base32" returns
+// it in the standard base32 encoding. Hex strings can already be separated by
+// colons. Odd-length or invalid hex, and empty identifiers or identifiers
+// longer than 64 bytes, make the template fail like "fail" does.
+//
+// The function "pem", used like {"root": {{ pem .Root | toJson }}}, checks that
+// a string has one or more PEM blocks of type "CERTIFICATE", "PUBLIC KEY" or
+// "PRIVATE KEY", with contents that can be parsed, and returns them encoded
+// in the standard format. White space inside the blocks is ignored, so a PEM
+// with the new lines replaced by spaces is fixed. The function "deriveKeyID",
+// used like {"subjectKeyId": {{ deriveKeyID .Key | toJson }}}, returns the
+// identifier of the public key in the first block, the SHA-1 hash of the key
+// bits from RFC 5280, in base64. Any other block, or invalid contents, make
+// the template fail like "fail" does. The function "subjectKeyId", used like
+// {"subjectKeyId": {{ subjectKeyId .PublicKey | toJson }}}, does the same
+// with a key in PEM or in DER, a certificate, a PKIX public key or a PKCS #8
+// private key given as a byte slice or in base64, and "keySubjectKeyId", used
+// like {"authorityKeyId": {{ keySubjectKeyId "issuer" | toJson }}}, with the
+// key of the given name read with the resolver set with WithKeyResolver, like
+// "keyFingerprint". The function "authorityKeyId", used like
+// {"authorityKeyId": {{ authorityKeyId | toJson }}}, returns the identifier of
+// the issuer set with WithIssuer: the subject key identifier of an issuer
+// certificate, or the one derived from its key if it doesn't have one or the
+// issuer is a key. Keys that cannot be parsed or resolved, and a call to
+// "authorityKeyId" without an issuer, make the template fail like "fail" does.
+//
+// The function "extensionValue", used like
+// {"value": {{ extensionValue .Raw }}}, returns the JSON string with the value
+// of a custom extension, given in base64 or as DER bytes, after checking that
+// it's a well-formed DER value, of any type. Values that are not base64, or
+// that are truncated or not valid DER, make the template fail like "fail"
+// does, instead of failing when the certificate is created.
+//
+// The function "canonicalJSON", used like
+// {"claims": {{ canonicalJSON .Claims }}}, returns the canonical form of
+// RFC 8785 of a JSON document, given as a string or as bytes, or of any other
+// value encoded as JSON, with the keys sorted and without white space, so the
+// same data always has the same bytes, like when they are signed. Invalid
+// JSON, duplicate keys, strings that are not valid Unicode and numbers that
+// are not finite doubles make the template fail like "fail" does.
+//
+// The function "oid", used like {"id": {{ oid "subjectAltName" | jsonQuote }}},
+// returns the object identifier of a common PKIX extension, extended key
+// usage, policy or attribute by name, and object identifiers in dotted-decimal
+// notation as they are, without leading zeros. Unknown names and
+// malformed object identifiers make the template fail like "fail" does.
+//
+// The function "dn", used like {{ dn .Issuer | jsonQuote }}, parses a
+// distinguished name in the format of RFC 4514, like "CN=foo,O=Acme\, Inc.",
+// and returns its canonical form, with short attribute types in uppercase, the
+// values of multi-valued RDNs sorted, and the minimum escaping. The function
+// "dnObject", used like {"subject": {{ dnObject .DN }}}, returns the
+// distinguished name as the JSON object of a subject, with the attributes that
+// don't have a field in "extraNames". Malformed names, like values with
+// unescaped special characters, make the template fail like "fail" does. The
+// function "commonName", used like {{ .Name | commonName | toJson }}, trims
+// the white space of a common name and makes the template fail like "fail"
+// does if it's longer than the 64 characters allowed by X.520, counted in
+// code points, or cuts it to 64 characters with {{ commonName .Name true }}.
+//
+// The functions "locality" and "province" do the same with the limit of 128
+// characters of the locality and state or province names. The function
+// "country", used like {"country": {{ country .C | toJson }}}, returns the
+// given ISO 3166-1 alpha-2 country code in uppercase, and makes the template
+// fail like "fail" does if it's not an assigned code, like "USA" or "XX".
+//
+// The function "null", used like {"a": {{ null }}}, renders the JSON null. The
+// function "object", used like {"subject": {{ object "cn" .CN "o" .Org }}},
+// returns a JSON object with the given key and value pairs, omitting the pairs
+// whose value is empty with the rules of "fallback", so optional keys don't
+// need conditional blocks that can leave dangling commas. The results of
+// "object" and "null" can be used as values: nested empty objects are omitted,
+// and {{ object "a" null }} sets the key to null explicitly. An odd number of
+// arguments, keys that are not strings, and duplicate keys make the template
+// fail like "fail" does. The function "jsonKey", used like
+// {"claims": { {{ jsonKey .Name }}: {{ toJson .Value }} }}, returns a key of
+// an object written in the template, taken from the template data, as a JSON
+// string escaped like "jsonQuote" does, so quotes, backslashes and control
+// characters in the key don't break the output. A missing or empty key makes
+// the template fail like "fail" does.
+//
+// The function "keyUsage", used like
+// {"keyUsage": {{ keyUsage .KeyUsage | toJson }}}, validates a key usage, or a
+// list of them, and returns them with the names used in certificate
+// templates, like "digitalSignature" for "DigitalSignature" or
+// "digital_signature", and "extKeyUsage" does the same with the extended key
+// usages, like "serverAuth". A string returns a string, and a list a list. An
+// unknown name, like "serverAth", makes the template fail like "fail" does,
+// with the list of valid names.
+//
+// The function "keyType", used like
+// {"keyType": {{ keyType .KeyType | jsonQuote }}}, returns a key algorithm
+// supported by keyutil with its canonical name,
+// "RSA-2048", "RSA-3072", "RSA-4096", "EC-P256", "EC-P384", "EC-P521" or
+// "Ed25519". The case and the separators are ignored, and aliases like "ECDSA",
+// "P-384", "secp521r1", "ecdsa-sha2-nistp256" or "ssh-ed25519" are accepted,
+// with "RSA" and "EC" being the default size and curve, 2048 bits and P-256.
+// Unsupported algorithms, sizes or curves, like "RSA-1024" or "EC-P224", make
+// the template fail like "fail" does, with the list of valid names.
+//
+// The function "signatureAlgorithm", used like
+// {"signatureAlgorithm": {{ signatureAlgorithm .Alg .KeyType | jsonQuote }}},
+// returns a signature algorithm with the name used by x509util, like
+// "SHA256-RSAPSS" or "ECDSA-SHA384", case insensitive, and checks that it can
+// be used with a key of the type given as a second argument, with the names
+// of "keyType", or set with WithKeyType, so an ECDSA key is not signed with an
+// RSA algorithm. An unknown algorithm or a key type that doesn't match makes
+// the template fail like "fail" does. The empty string, the default algorithm
+// of the signer, is always valid.
+//
+// The function "serial", used like
+// {"serialNumber": {{ .Serial | serial "hex" | jsonQuote }}}, returns a serial
+// number in "decimal", or in "hex" with the "0x" prefix and zero-padded to
+// whole bytes, like "0x0a1b". The serial number can be an integer or a string
+// with a decimal or "0x" hex integer, which is required for the numbers too
+// large to be exact in JSON. Serial numbers that are zero or negative, or that
+// need more than 20 bytes in DER, make the template fail like "fail" does, so
+// they are not rejected when the certificate is issued.
+//
+// The function "basicConstraints", used like
+// {"basicConstraints": {{ basicConstraints true .PathLen }}}, returns the
+// basic constraints of a CA, with a maximum path length, or of a leaf
+// certificate if the first argument is false. The path length is optional,
+// and a nil one is the same as not giving it: a CA without it gets a
+// "maxPathLen" of -1, so the certificate doesn't limit the path length,
+// unlike an object without "maxPathLen", which means a path length of 0, so
+// no intermediate CA can follow. A path length on a leaf certificate, or a
+// negative one, makes the template fail like "fail" does.
+//
+// The function "number", used like {"pathLen": {{ number .PathLen }}}, renders
+// a number, or a string with a JSON number, unquoted, so a number that comes
+// as a string in the data doesn't need to be written in the template without
+// the quotes, which breaks the JSON if the value is empty. Strings that are
+// not JSON numbers, like "", "007" or "1e", and NaN and infinite numbers make
+// the template fail like "fail" does.
+//
+// The function "profile" returns the name of the profile set with
+// WithProfile, like "leaf" or "sshHost", and "isCA", used like
+// {{ if isCA }}...{{ end }}, reports whether it's ProfileCA, so a template can
+// be shared by different kinds of certificates without a flag in the template
+// data. Without a profile, like in ValidateTemplate, "profile" returns an
+// empty string and "isCA" returns false.
+//
+// The function "lookup", used like
+// {{ lookup "/subject/names/0/value" . | default "" | toJson }}, returns the
+// value at a JSON pointer from RFC 6901, with "~1" for "/" and "~0" for "~" in
+// the keys, or nil if any key or index in the path is missing, so nested
+// values can be read without failing on missing intermediate values. Pointers
+// that are not empty and don't start with "/", or with invalid escapes, make
+// the template fail like "fail" does.
+//
+// The function "indentLines", used like
+// {{ include "ext.tmpl" . | indentLines 2 }}, adds the given number of spaces
+// at the beginning of each line of a string, and "nindentLines", used like
+// {{ toPrettyJson .Extensions | nindentLines 4 }}, does the same after adding
+// a newline. Unlike the sprig functions "indent" and "nindent", that only take
+// an int, the number of spaces can come from the template data, and a negative
+// or fractional number makes the template fail like "fail" does.
+//
+// The function "hasElem", used like {{ if hasElem "serverAuth" .ExtKeyUsage }},
+// reports whether a value is in a list, and "hasMapKey", used like
+// {{ if hasMapKey .Extensions "permit-pty" }}, whether a map has a key. Nil
+// collections have no elements, and scalars are compared by their string
+// representation, so the number 1 matches the JSON number 1 or the string "1",
+// unlike the sprig functions "has" and "hasKey", that compare them strictly.
+//
+// The function "deepMerge", used like {{ deepMerge .Base .Override | toJson }},
+// returns the deep merge of two or more objects, with the values of the last
+// ones taking precedence. Nested objects are merged, and any other value,
+// including an array, replaces the previous one, so arrays are not
+// concatenated. Unlike the sprig functions "merge", where the first object
+// takes precedence, and "mergeOverwrite", the arguments are not modified, and
+// an argument that is not an object or nil makes the template fail like "fail"
+// does.
+//
+// The functions registered with RegisterFunc are included too.
+//
+// The returned map writes to failMessage without synchronization, use NewFuncs
+// if the same functions can be called from concurrent executions.
 func GetFuncMap(failMessage *string) template.FuncMap {
+	return newFuncMap(func(code, msg string) {
+		*failMessage = msg
+	}, newOptions(nil))
+}
+
+// newFuncMap returns the functions of GetFuncMap. The functions that fail call
+// setFailure with the message, and the code given to "fail", if any.
+func newFuncMap(setFailure func(code, msg string), o *options) template.FuncMap {
 	m := sprig.TxtFuncMap()
 	delete(m, "env")
 	delete(m, "expandenv")
-	m["fail"] = func(msg string) (string, error) {
-		*failMessage = msg
-		return "", errors.New(msg)
+	fail := func(msg string) error {
+		setFailure("", msg)
+		return errors.New(msg)
+	}
+	m["fail"] = func(s string, msg ...string) (string, error) {
+		switch len(msg) {
+		case 0:
+			return "", fail(s)
+		case 1:
+			setFailure(s, msg[0])
+			return "", errors.New(msg[0])
+		default:
+			return "", fail(fmt.Sprintf("fail takes a message, or a code and a message, not %d arguments", len(msg)+1))
+		}
+	}
+	m["mustToJson"] = func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", fail("error marshaling json: " + err.Error())
+		}
+		return string(b), nil
+	}
+	m["env"] = func(name string) (string, error) {
+		if _, ok := o.allowedEnv[name]; !ok {
+			return "", fail(fmt.Sprintf("environment variable %q is not allowed", name))
+		}
+		lookup := o.lookupEnv
+		if lookup == nil {
+			lookup = os.LookupEnv
+		}
+		v, _ := lookup(name)
+		return v, nil
+	}
+	m["fallback"] = defaultValue
+	m["firstNonEmpty"] = firstNonEmpty
+	m["ifElse"] = ifElse
+	m["jsonQuote"] = jsonQuote
+	m["jsonSquote"] = jsonSquote
+	m["jsonPrintf"] = jsonPrintf
+	m["joinParts"] = joinParts
+	m["splitParts"] = splitParts
+	m["firstElem"] = func(list interface{}) (interface{}, error) {
+		v, err := firstElem(list)
+		if err != nil {
+			return nil, fail(err.Error())
+		}
+		return v, nil
+	}
+	m["lastElem"] = func(list interface{}) (interface{}, error) {
+		v, err := lastElem(list)
+		if err != nil {
+			return nil, fail(err.Error())
+		}
+		return v, nil
+	}
+	m["restElems"] = func(list interface{}) ([]interface{}, error) {
+		v, err := restElems(list)
+		if err != nil {
+			return nil, fail(err.Error())
+		}
+		return v, nil
+	}
+	m["sliceElems"] = func(args ...interface{}) ([]interface{}, error) {
+		v, err := sliceElems(args...)
+		if err != nil {
+			return nil, fail(err.Error())
+		}
+		return v, nil
+	}
+	regexps := new(regexpCache)
+	m["regexMatchStrict"] = func(pattern, s string) (bool, error) {
+		ok, err := regexps.regexMatch(pattern, s)
+		if err != nil {
+			return false, fail(err.Error())
+		}
+		return ok, nil
+	}
+	m["regexReplace"] = func(pattern, s, repl string) (string, error) {
+		r, err := regexps.regexReplace(pattern, s, repl)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return r, nil
+	}
+	now := o.now
+	if now == nil {
+		now = time.Now
+	}
+	m["now"] = func() time.Time {
+		return now()
+	}
+	m["dateAdd"] = func(d string, t interface{}) (string, error) {
+		s, err := dateAdd(d, t)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return s, nil
+	}
+	m["validity"] = func(args ...interface{}) (string, error) {
+		d, err := validity(o.maxValidity, args...)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return d, nil
+	}
+	m["addDuration"] = func(t interface{}, d string) (string, error) {
+		s, err := addDuration(t, d)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return s, nil
+	}
+	m["formatTime"] = func(format string, t interface{}) (string, error) {
+		s, err := formatTime(format, t)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return s, nil
+	}
+	m["parseTime"] = func(format, s string) (time.Time, error) {
+		t, err := parseTime(format, s)
+		if err != nil {
+			return time.Time{}, fail(err.Error())
+		}
+		return t, nil
+	}
+	m["include"] = (&includer{o: o, setFailure: setFailure}).include
+	random := o.rand
+	if random == nil {
+		random = rand.Reader
+	}
+	for name, chars := range map[string]string{
+		"randHex": hexChars, "randAlnum": alphaNumChars,
+	} {
+		chars := chars
+		m[name] = func(n interface{}) (string, error) {
+			s, err := randString(random, n, chars)
+			if err != nil {
+				return "", fail(err.Error())
+			}
+			return s, nil
+		}
+	}
+	m["uuidV4"] = func() (string, error) {
+		s, err := uuidV4(random)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return s, nil
+	}
+	m["uuidV5"] = func(namespace string, name interface{}) (string, error) {
+		s, err := uuidV5(namespace, name)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return s, nil
+	}
+	for name, fn := range map[string]func(a, b interface{}) (int64, error){
+		"subInt": subInt, "divInt": divInt, "modInt": modInt,
+	} {
+		name, fn := name, fn
+		m[name] = func(a, b interface{}) (int64, error) {
+			n, err := fn(a, b)
+			if err != nil {
+				return 0, fail(name + ": " + err.Error())
+			}
+			return n, nil
+		}
+	}
+	m["addInt"] = func(values ...interface{}) (int64, error) {
+		n, err := addInt(values...)
+		if err != nil {
+			return 0, fail("addInt: " + err.Error())
+		}
+		return n, nil
+	}
+	m["mulInt"] = func(a interface{}, values ...interface{}) (int64, error) {
+		n, err := mulInt(a, values...)
+		if err != nil {
+			return 0, fail("mulInt: " + err.Error())
+		}
+		return n, nil
+	}
+	// DNS names are checked with the wildcards allowed by the options.
+	isValidDNSName := func(s string) bool {
+		return validDNSName(s, !o.rejectWildcards)
+	}
+	m["sans"] = func(v interface{}) (string, error) {
+		s, err := sans(v, !o.rejectWildcards)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return s, nil
+	}
+	for name, fn := range map[string]func(string) (string, error){
+		"assertDNSName": identifierAssertion("dns name", isValidDNSName),
+		"assertIP":      identifierAssertion("ip address", isIP),
+		"assertEmail":   identifierAssertion("email address", isEmail),
+		"assertURI":     identifierAssertion("uri", isURI),
+	} {
+		fn := fn
+		m[name] = func(s string) (string, error) {
+			v, err := fn(s)
+			if err != nil {
+				return "", fail(err.Error())
+			}
+			return v, nil
+		}
+	}
+	m["isDNSName"] = isValidDNSName
+	m["isIP"] = isIP
+	m["isEmail"] = isEmail
+	m["email"] = func(s string) (string, error) {
+		v, err := email(s)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return v, nil
+	}
+	m["ip"] = func(s string) (string, error) {
+		v, err := ip(s)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return v, nil
+	}
+	m["isURI"] = isURI
+	m["uri"] = func(s string) (string, error) {
+		v, err := uri(s)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return v, nil
+	}
+	m["sha256"] = sha256Sum
+	m["sha1"] = sha1Sum
+	m["fingerprint"] = func(encoding string, v interface{}) (string, error) {
+		fp, err := fingerprintSum(encoding, v)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return fp, nil
+	}
+	m["keyFingerprint"] = func(name string, encoding ...string) (string, error) {
+		fp, err := keyFingerprint(o.keyResolver, name, encoding...)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return fp, nil
+	}
+	m["hexGroup"] = func(v interface{}) (string, error) {
+		s, err := hexGroup(v)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return s, nil
+	}
+	m["base32"] = func(v interface{}) (string, error) {
+		s, err := base32Encode(v)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return s, nil
+	}
+	m["pem"] = func(s string) (string, error) {
+		v, err := normalizePEM(s)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return v, nil
+	}
+	m["deriveKeyID"] = func(s string) (string, error) {
+		v, err := deriveKeyID(s)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return v, nil
+	}
+	m["subjectKeyId"] = func(v interface{}) (string, error) {
+		id, err := subjectKeyID(v)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return id, nil
+	}
+	m["keySubjectKeyId"] = func(name string) (string, error) {
+		id, err := keySubjectKeyID(o.keyResolver, name)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return id, nil
+	}
+	m["authorityKeyId"] = func() (string, error) {
+		id, err := authorityKeyID(o.issuer)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return id, nil
+	}
+	m["extensionValue"] = func(v interface{}) (string, error) {
+		s, err := extensionValue(v)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return s, nil
+	}
+	m["canonicalJSON"] = func(v interface{}) (string, error) {
+		s, err := canonicalJSONValue(v)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return s, nil
+	}
+	m["null"] = null
+	m["oid"] = func(s string) (string, error) {
+		v, err := oid(s)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return v, nil
+	}
+	m["dn"] = func(s string) (string, error) {
+		v, err := dn(s)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return v, nil
+	}
+	m["dnObject"] = func(s string) (rawJSON, error) {
+		obj, err := dnObject(s)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return obj, nil
+	}
+	m["commonName"] = func(s string, truncate ...bool) (string, error) {
+		cn, err := commonName(s, truncate...)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return cn, nil
+	}
+	m["locality"] = func(s string, truncate ...bool) (string, error) {
+		v, err := locality(s, truncate...)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return v, nil
+	}
+	m["province"] = func(s string, truncate ...bool) (string, error) {
+		v, err := province(s, truncate...)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return v, nil
+	}
+	m["country"] = func(s string) (string, error) {
+		c, err := country(s)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return c, nil
+	}
+	m["keyType"] = func(s string) (string, error) {
+		kt, err := keyType(s)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return kt, nil
+	}
+	m["signatureAlgorithm"] = func(s string, kt ...string) (string, error) {
+		alg, err := signatureAlgorithm(o.keyType, s, kt...)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return alg, nil
+	}
+	for name, fn := range map[string]func(interface{}) (interface{}, error){
+		"keyUsage": keyUsage, "extKeyUsage": extKeyUsage,
+	} {
+		fn := fn
+		m[name] = func(v interface{}) (interface{}, error) {
+			u, err := fn(v)
+			if err != nil {
+				return nil, fail(err.Error())
+			}
+			return u, nil
+		}
+	}
+	m["serial"] = func(format string, v interface{}) (string, error) {
+		s, err := serialNumber(format, v)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return s, nil
+	}
+	m["basicConstraints"] = func(isCA interface{}, pathLen ...interface{}) (rawJSON, error) {
+		v, err := basicConstraints(isCA, pathLen...)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return v, nil
+	}
+	m["number"] = func(v interface{}) (rawJSON, error) {
+		n, err := number(v)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return n, nil
+	}
+	m["profile"] = func() string {
+		if o.profile == 0 {
+			return ""
+		}
+		return o.profile.String()
+	}
+	m["isCA"] = func() bool {
+		return o.profile == ProfileCA
+	}
+	m["lookup"] = func(pointer string, data interface{}) (interface{}, error) {
+		v, err := lookup(pointer, data)
+		if err != nil {
+			return nil, fail(err.Error())
+		}
+		return v, nil
+	}
+	m["jsonKey"] = func(v interface{}) (string, error) {
+		k, err := jsonKey(v)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return k, nil
+	}
+	m["object"] = func(pairs ...interface{}) (rawJSON, error) {
+		obj, err := object(pairs...)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return obj, nil
+	}
+	for name, fn := range map[string]func(interface{}, string) (string, error){
+		"indentLines": indentLines, "nindentLines": nindentLines,
+	} {
+		fn := fn
+		m[name] = func(spaces interface{}, s string) (string, error) {
+			v, err := fn(spaces, s)
+			if err != nil {
+				return "", fail(err.Error())
+			}
+			return v, nil
+		}
+	}
+	m["upperCase"] = upperCase
+	m["lowerCase"] = lowerCase
+	m["titleCase"] = titleCase
+	m["hasElem"] = hasElem
+	m["hasMapKey"] = hasMapKey
+	m["deepMerge"] = func(base interface{}, overrides ...interface{}) (map[string]interface{}, error) {
+		v, err := merge(base, overrides...)
+		if err != nil {
+			return nil, fail(err.Error())
+		}
+		return v, nil
+	}
+	m["b64encBytes"] = b64encBytes
+	m["b64urlenc"] = b64urlenc
+	m["b64decStrict"] = func(v interface{}) (string, error) {
+		s, err := b64decStrict(v)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return s, nil
+	}
+	m["b64urldec"] = func(v interface{}) (string, error) {
+		s, err := b64urldec(v)
+		if err != nil {
+			return "", fail(err.Error())
+		}
+		return s, nil
+	}
+
+	// The functions registered with RegisterFunc, and the ones added with
+	// WithFuncs, never replace a built-in one.
+	addRegisteredFuncs(m)
+	for name, fn := range o.funcs {
+		if _, ok := m[name]; !ok && !builtinFuncs[name] {
+			m[name] = fn
+		}
 	}
 	return m
 }
+
+// funcNameRegexp matches the names that can be used to call a function in a
+// template.
+var funcNameRegexp = regexp.MustCompile(`^[\pL_][\pL\pN_]*$`)
+
+// checkFuncs returns an error for the first function, by name, added with
+// WithFuncs that has the name of a built-in function, or that cannot be used
+// in a template because of its name or its return values, and for a snapshot
+// given with WithFuncMapSnapshot whose functions are not all defined.
+func checkFuncs(o *options) error {
+	if len(o.funcs) == 0 {
+		return checkSnapshot(o)
+	}
+	builtins := newFuncMap(func(string, string) {}, new(options))
+	names := make([]string, 0, len(o.funcs))
+	for name := range o.funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := checkFunc(name, o.funcs[name], builtins); err != nil {
+			return err
+		}
+	}
+	return checkSnapshot(o)
+}
+
+// checkFunc returns an error if the function fn has the name of one in
+// builtins or predefined by text/template, or if it cannot be used in a
+// template because of its name or its return values.
+func checkFunc(name string, fn interface{}, builtins template.FuncMap) error {
+	if _, ok := builtins[name]; ok || builtinFuncs[name] {
+		return fmt.Errorf("function %q cannot be redefined", name)
+	}
+	if !funcNameRegexp.MatchString(name) {
+		return fmt.Errorf("function name %q is not valid", name)
+	}
+	t := reflect.TypeOf(fn)
+	if t == nil || t.Kind() != reflect.Func {
+		return fmt.Errorf("function %q is a %T, not a function", name, fn)
+	}
+	if n := t.NumOut(); n != 1 && (n != 2 || t.Out(1) != errorType) {
+		return fmt.Errorf("function %q must return a value, or a value and an error", name)
+	}
+	return nil
+}
+
+// defaultValue returns d if given is empty, or the given value otherwise.
+func defaultValue(d interface{}, given ...interface{}) interface{} {
+	if len(given) == 0 || isEmpty(given[0]) {
+		return d
+	}
+	return given[0]
+}
+
+// firstNonEmpty returns the first value that is not empty, or an empty string
+// if all of them are empty.
+func firstNonEmpty(values ...interface{}) interface{} {
+	for _, v := range values {
+		if !isEmpty(v) {
+			return v
+		}
+	}
+	return ""
+}
+
+// ifElse returns vt if cond is true, and vf otherwise. cond is false if it's
+// false or empty.
+func ifElse(cond, vt, vf interface{}) interface{} {
+	if b, ok := cond.(bool); ok {
+		if b {
+			return vt
+		}
+		return vf
+	}
+	if isEmpty(cond) {
+		return vf
+	}
+	return vt
+}
+
+// isEmpty returns true if v is nil, a nil pointer or interface, or a string,
+// slice, array or map of length zero.
+func isEmpty(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return true
+	}
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return rv.Len() == 0
+	case reflect.Ptr, reflect.Interface, reflect.Chan, reflect.Func:
+		return rv.IsNil()
+	default:
+		return false
+	}
+}
+
+// Funcs bundles the functions returned by GetFuncMap with the message of the
+// "fail" function. Each execution of a template should use its own Funcs, so
+// concurrent executions don't overwrite each other's failures.
+type Funcs struct {
+	funcMap template.FuncMap
+	mu      sync.Mutex
+	code    string
+	message string
+	failed  bool
+}
+
+// NewFuncs returns a new Funcs ready to be used in a template execution. The
+// options WithAllowedEnv and WithEnvLookup configure the "env" function,
+// WithRandReader the source of "randHex" and "randAlnum", WithKeyResolver
+// the keys of "keyFingerprint", and WithFuncs
+// adds more functions, ignoring the ones with the name of a built-in one.
+func NewFuncs(opts ...Option) *Funcs {
+	return newFuncs(newOptions(opts))
+}
+
+// BuildFuncMap returns the functions of GetFuncMap, configured with the options
+// like NewFuncs does, so the functions added with WithFuncs are included. It
+// returns an error if any of them has the name of a built-in function, or
+// cannot be used in a template. Like in GetFuncMap, "fail" writes to
+// failMessage without synchronization.
+func BuildFuncMap(failMessage *string, opts ...Option) (template.FuncMap, error) {
+	o := newOptions(opts)
+	if err := checkFuncs(o); err != nil {
+		return nil, err
+	}
+	return newFuncMap(func(code, msg string) {
+		*failMessage = msg
+	}, o), nil
+}
+
+func newFuncs(o *options) *Funcs {
+	f := new(Funcs)
+	f.funcMap = newFuncMap(func(code, msg string) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if !f.failed {
+			f.code, f.message, f.failed = code, msg, true
+		}
+	}, o)
+	return f
+}
+
+// FuncMap returns the functions to pass to template.Funcs.
+func (f *Funcs) FuncMap() template.FuncMap {
+	return f.funcMap
+}
+
+// Failure returns the message given to the "fail" function and whether the
+// function has been called. If it has been called more than once, the first
+// message is returned.
+func (f *Funcs) Failure() (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.message, f.failed
+}
+
+// FailureCode returns the code given to the "fail" function in its first
+// failure, like "E_NO_SAN" in {{ fail "E_NO_SAN" "at least one SAN is
+// required" }}, or an empty string if it was called only with a message, or
+// not called at all.
+func (f *Funcs) FailureCode() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.code
+}
+
+// funcMapVersion is the version of the functions returned by GetFuncMap. It
+// must be increased every time a function is added or its behavior changes:
+//   - 1: sprig functions without "env" and "expandenv", and "fail".
+//   - 2: "mustToJson", "default", "coalesce", "has", "hasKey", the base64
+//     functions, and "env" with an allowlist.
+//   - 3: "quote" and "squote" with JSON escaping.
+//   - 4: "join", and "split" returning a slice.
+//   - 5: "regexMatch" failing on invalid patterns, and "regexReplace".
+//   - 6: "now" using the clock set with WithClock, and "dateAdd".
+//   - 7: "include".
+//   - 8: "add", "sub", "mul", "div" and "mod" on integers only.
+//   - 9: "sans".
+//   - 10: "trim", "trimPrefix", "trimSuffix", and "upper", "lower" and
+//     "title" with Unicode casing.
+//   - 11: "isDNSName", "isIP", "isEmail" and "isURI", and their failing
+//     "assert" variants.
+//   - 12: "null" and "object".
+//   - 13: "sha256", "sha1" and "fingerprint".
+//   - 14: "indent" and "nindent" accept numbers from the template data, and
+//     fail with negative numbers.
+//   - 15: "pem" and "deriveKeyID".
+//   - 16: "ternary" taking the condition first.
+//   - 17: "lookup".
+//   - 18: "randHex", and "randAlphaNum" using a configurable source.
+//   - 19: "dn" and "dnObject".
+//   - 20: "oid".
+//   - 21: "hexGroup" and "base32".
+//   - 22: "fail" with a code and a message.
+//   - 23: "merge" with the last object taking precedence.
+//   - 24: "formatTime" and "parseTime".
+//   - 25: "email".
+//   - 26: "basicConstraints".
+//   - 27: "serial".
+//   - 28: "keyUsage" and "extKeyUsage".
+//   - 29: "addDuration".
+//   - 30: "commonName".
+//   - 31: "profile" and "isCA".
+//   - 32: "ip".
+//   - 33: "number".
+//   - 34: "jsonPrintf".
+//   - 35: "first", "last", "rest" and "slice" with bounds checking.
+//   - 36: "country", "locality" and "province".
+//   - 37: "keyFingerprint".
+//   - 38: "keyType".
+//   - 39: "validity".
+//   - 40: "subjectKeyId" and "keySubjectKeyId".
+//   - 41: "jsonKey".
+//   - 42: "signatureAlgorithm".
+//   - 43: "uri".
+//   - 44: "authorityKeyId".
+//   - 45: "isDNSName", "assertDNSName" and "sans" with the wildcard rules of
+//     RFC 6125.
+//   - 46: "uuidV5" and "uuidV4".
+//   - 47: "extensionValue".
+//   - 48: "canonicalJSON".
+//   - 49: "ternary" with the arguments of sprig again, the condition last,
+//     and "ifElse" taking the condition first.
+//   - 50: "merge" of sprig again, with the first object taking precedence,
+//     and "deepMerge" with the last one taking precedence.
+//   - 51: "add", "sub", "mul", "div" and "mod" with the name of the function
+//     in the errors; the numbers of the template data without a fractional
+//     part are integers.
+//   - 52: "split" of sprig again, returning a map, and "splitParts" returning
+//     a slice.
+//   - 53: "default" of sprig again, with false and zero numbers empty, and
+//     "fallback" with the previous rules.
+//   - 54: "coalesce" of sprig again, and "firstNonEmpty" with the rules of
+//     "fallback".
+//   - 55: "quote" and "squote" of sprig again, and "jsonQuote" and
+//     "jsonSquote" with JSON escaping.
+//   - 56: "add", "sub", "mul", "div" and "mod" of sprig again, and "addInt",
+//     "subInt", "mulInt", "divInt" and "modInt" on integers only.
+//   - 57: "has" and "hasKey" of sprig again, and "hasElem" and "hasMapKey"
+//     comparing scalars by their string representation.
+//   - 58: "trim", "trimPrefix", "trimSuffix", "upper", "lower" and "title" of
+//     sprig again, and "upperCase", "lowerCase" and "titleCase" with Unicode
+//     casing.
+//   - 59: "first", "last" and "rest" of sprig, and "slice" of text/template,
+//     again, and "firstElem", "lastElem", "restElems" and "sliceElems" with
+//     bounds checking.
+//   - 60: "b64enc" and "b64dec" of sprig again, and "b64encBytes" and
+//     "b64decStrict" failing with invalid base64.
+//   - 61: "regexMatch" of sprig again, and "regexMatchStrict" failing with
+//     invalid patterns.
+//   - 62: "join" of sprig again, and "joinParts" with the previous behavior.
+//   - 63: "indent" and "nindent" of sprig again, and "indentLines" and
+//     "nindentLines" with the previous behavior.
+//   - 64: "randAlphaNum" of sprig again, and "randAlnum" with the previous
+//     behavior.
+const funcMapVersion = 64
+
+// FuncMapVersion returns the version of the functions returned by GetFuncMap.
+// Templates can require a minimum version with a comment like:
+//
+//	{{/* requires funcmap >= 2 */}}
+func FuncMapVersion() int {
+	return funcMapVersion
+}
+
+var requiresRegexp = requiresPattern("{{", "}}")
+
+// requiresPattern returns the regular expression that matches the comment
+// with the required version of the functions using the given delimiters.
+func requiresPattern(left, right string) *regexp.Regexp {
+	return regexp.MustCompile(regexp.QuoteMeta(left) + `-?\s*/\*\s*requires\s+funcmap\s*>=\s*([0-9]+)\s*\*/\s*-?` + regexp.QuoteMeta(right))
+}
+
+// checkFuncMapVersion returns an error if the template text requires a newer
+// version of the functions than the one available. The comment with the
+// requirement must use the delimiters of the template.
+func checkFuncMapVersion(text []byte, left, right string) error {
+	re := requiresRegexp
+	if left != "{{" || right != "}}" {
+		re = requiresPattern(left, right)
+	}
+	for _, m := range re.FindAllSubmatchIndex(text, -1) {
+		v, err := strconv.Atoi(string(text[m[2]:m[3]]))
+		if err != nil || v > funcMapVersion {
+			err := fmt.Errorf("template requires newer func map: version %s required, have %d", text[m[2]:m[3]], funcMapVersion)
+			te := newTemplateError(ParseError, err, "error parsing template: "+err.Error())
+			te.setPosition(m[0], text, nil)
+			return te
+		}
+	}
+	return nil
+}
+
+// FuncInfo describes a function available to templates.
+type FuncInfo struct {
+	// Name is the name used to call the function in a template.
+	Name string `json:"name"`
+	// NumArgs is the number of arguments of the function, if the function is
+	// variadic the last argument can be repeated zero or more times.
+	NumArgs  int  `json:"numArgs"`
+	Variadic bool `json:"variadic"`
+	// CanFail is true if the function can return an error, aborting the
+	// execution of the template, like the "fail" function does.
+	CanFail bool `json:"canFail"`
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// FuncInfos returns the description of all the functions returned by
+// GetFuncMap sorted by name.
+func FuncInfos() []FuncInfo {
+	m := NewFuncs().FuncMap()
+
+	infos := make([]FuncInfo, 0, len(m))
+	for name, fn := range m {
+		t := reflect.TypeOf(fn)
+		infos = append(infos, FuncInfo{
+			Name:     name,
+			NumArgs:  t.NumIn(),
+			Variadic: t.IsVariadic(),
+			CanFail:  t.NumOut() == 2 && t.Out(1) == errorType,
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// FuncNames returns the names of all the functions returned by GetFuncMap
+// sorted alphabetically.
+func FuncNames() []string {
+	infos := FuncInfos()
+	names := make([]string, len(infos))
+	for i, info := range infos {
+		names[i] = info.Name
+	}
+	return names
+}
@@ -1,14 +1,20 @@
 package templates
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"sort"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_GetFuncMap_fail(t *testing.T) {
 	var failMesage string
 	fns := GetFuncMap(&failMesage)
-	fail := fns["fail"].(func(s string) (string, error))
+	fail := fns["fail"].(func(string, ...string) (string, error))
 	s, err := fail("the fail message")
 	if err == nil {
 		t.Errorf("fail() error = %v, wantErr %v", err, errors.New("the fail message"))
@@ -20,3 +26,454 @@ func Test_GetFuncMap_fail(t *testing.T) {
 		t.Errorf("fail() message = \"%s\", want \"the fail message\"", failMesage)
 	}
 }
+
+func TestFuncNames(t *testing.T) {
+	var failMessage string
+	m := GetFuncMap(&failMessage)
+
+	names := FuncNames()
+	assert.Len(t, names, len(m))
+	assert.True(t, sort.StringsAreSorted(names))
+	for _, name := range names {
+		assert.Contains(t, m, name)
+	}
+	assert.Contains(t, names, "fail")
+	assert.Contains(t, names, "toJson")
+	assert.Contains(t, names, "env")
+	assert.NotContains(t, names, "expandenv")
+}
+
+func TestFuncInfos(t *testing.T) {
+	infos := FuncInfos()
+	assert.True(t, sort.SliceIsSorted(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	}))
+
+	find := func(name string) FuncInfo {
+		for _, info := range infos {
+			if info.Name == name {
+				return info
+			}
+		}
+		t.Fatalf("function %s not found", name)
+		return FuncInfo{}
+	}
+	assert.Equal(t, FuncInfo{Name: "fail", NumArgs: 2, Variadic: true, CanFail: true}, find("fail"))
+	assert.Equal(t, FuncInfo{Name: "toJson", NumArgs: 1}, find("toJson"))
+	assert.Equal(t, FuncInfo{Name: "mustToJson", NumArgs: 1, CanFail: true}, find("mustToJson"))
+	assert.Equal(t, FuncInfo{Name: "coalesce", NumArgs: 1, Variadic: true}, find("coalesce"))
+}
+
+func TestNewFuncs(t *testing.T) {
+	funcs := NewFuncs()
+	msg, ok := funcs.Failure()
+	assert.False(t, ok)
+	assert.Empty(t, msg)
+
+	fail := funcs.FuncMap()["fail"].(func(string, ...string) (string, error))
+	s, err := fail("the fail message")
+	assert.EqualError(t, err, "the fail message")
+	assert.Empty(t, s)
+	_, err = fail("another message")
+	assert.EqualError(t, err, "another message")
+
+	msg, ok = funcs.Failure()
+	assert.True(t, ok)
+	assert.Equal(t, "the fail message", msg)
+	assert.Empty(t, funcs.FailureCode())
+
+	// The code is optional.
+	funcs = NewFuncs()
+	fail = funcs.FuncMap()["fail"].(func(string, ...string) (string, error))
+	_, err = fail("E_NO_SAN", "at least one SAN is required")
+	assert.EqualError(t, err, "at least one SAN is required")
+	msg, ok = funcs.Failure()
+	assert.True(t, ok)
+	assert.Equal(t, "at least one SAN is required", msg)
+	assert.Equal(t, "E_NO_SAN", funcs.FailureCode())
+
+	funcs = NewFuncs()
+	fail = funcs.FuncMap()["fail"].(func(string, ...string) (string, error))
+	_, err = fail("E_NO_SAN", "at least one SAN is required", "extra")
+	assert.EqualError(t, err, "fail takes a message, or a code and a message, not 3 arguments")
+	assert.Empty(t, funcs.FailureCode())
+
+	// Each Funcs has its own failure.
+	msg, ok = NewFuncs().Failure()
+	assert.False(t, ok)
+	assert.Empty(t, msg)
+}
+
+func TestBuildFuncMap(t *testing.T) {
+	tenant := func(s string) string { return "tenant-" + s }
+	var failMessage string
+	fns, err := BuildFuncMap(&failMessage, WithFuncs(map[string]interface{}{"tenant": tenant}))
+	require.NoError(t, err)
+	assert.Contains(t, fns, "tenant")
+	assert.Contains(t, fns, "toJson")
+	fns["fail"].(func(string, ...string) (string, error))("fail message")
+	assert.Equal(t, "fail message", failMessage)
+
+	tests := []struct {
+		name    string
+		funcs   map[string]interface{}
+		wantErr string
+	}{
+		{"fail", map[string]interface{}{"fail": tenant}, `function "fail" cannot be redefined`},
+		{"sprig", map[string]interface{}{"toJson": tenant}, `function "toJson" cannot be redefined`},
+		{"builtin", map[string]interface{}{"eq": tenant}, `function "eq" cannot be redefined`},
+		{"name", map[string]interface{}{"ten-ant": tenant}, `function name "ten-ant" is not valid`},
+		{"notFunc", map[string]interface{}{"tenant": "foo"}, `function "tenant" is a string, not a function`},
+		{"results", map[string]interface{}{"tenant": func() (string, string) { return "", "" }}, `function "tenant" must return a value, or a value and an error`},
+		{"noResults", map[string]interface{}{"tenant": func() {}}, `function "tenant" must return a value, or a value and an error`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := BuildFuncMap(&failMessage, WithFuncs(tt.funcs))
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+
+	// NewFuncs keeps the built-in functions.
+	fns = NewFuncs(WithFuncs(map[string]interface{}{"toJson": tenant, "tenant": tenant})).FuncMap()
+	assert.Contains(t, fns, "tenant")
+	assert.IsType(t, func(interface{}) string { return "" }, fns["toJson"])
+}
+
+func TestNewFuncs_parallel(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		i := i
+		t.Run(fmt.Sprintf("validation-%d", i), func(t *testing.T) {
+			t.Parallel()
+			text := []byte(`{{ if .fail }}{{ fail .message }}{{ end }}{}`)
+			data := []byte(fmt.Sprintf(`{"fail": %v, "message": "message %d"}`, i%2 == 0, i))
+			err := ValidateTemplateWithData(text, data)
+			if i%2 == 0 {
+				assert.EqualError(t, err, fmt.Sprintf("error executing template: message %d", i))
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func Test_GetFuncMap_toJson(t *testing.T) {
+	var failMessage string
+	fns := GetFuncMap(&failMessage)
+	toJSON := fns["toJson"].(func(v interface{}) string)
+	mustToJSON := fns["mustToJson"].(func(v interface{}) (string, error))
+
+	tests := []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{"nil", nil, `null`},
+		{"string", "foo", `"foo"`},
+		{"quotes", `a "quoted" \ string`, `"a \"quoted\" \\ string"`},
+		{"newlines", "line1\nline2\r\t", `"line1\nline2\r\t"`},
+		{"unicode", "ñandú ☃ \u2028", `"ñandú ☃ \u2028"`},
+		{"html", "<a&b>", `"\u003ca\u0026b\u003e"`},
+		{"number", 123, `123`},
+		{"slice", []string{"a", "b"}, `["a","b"]`},
+		{"map", map[string]interface{}{"b": []int{1}, "a": map[string]string{"c": "d"}}, `{"a":{"c":"d"},"b":[1]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := toJSON(tt.v)
+			assert.Equal(t, tt.want, got)
+			assert.True(t, json.Valid([]byte(got)))
+
+			got, err := mustToJSON(tt.v)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+	assert.Empty(t, failMessage)
+}
+
+func Test_GetFuncMap_mustToJson_fail(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{"chan", make(chan int), "error marshaling json: json: unsupported type: chan int"},
+		{"func", func() {}, "error marshaling json: json: unsupported type: func()"},
+		{"map", map[string]interface{}{"a": make(chan int)}, "error marshaling json: json: unsupported type: chan int"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var failMessage string
+			fns := GetFuncMap(&failMessage)
+			mustToJSON := fns["mustToJson"].(func(v interface{}) (string, error))
+			got, err := mustToJSON(tt.v)
+			assert.EqualError(t, err, tt.want)
+			assert.Empty(t, got)
+			assert.Equal(t, tt.want, failMessage)
+		})
+	}
+}
+
+func Test_GetFuncMap_fallback(t *testing.T) {
+	var failMessage string
+	fns := GetFuncMap(&failMessage)
+	fallback := fns["fallback"].(func(d interface{}, given ...interface{}) interface{})
+
+	var nilPtr *string
+	foo := "foo"
+	tests := []struct {
+		name  string
+		given []interface{}
+		want  interface{}
+	}{
+		{"no-value", nil, "RSA"},
+		{"nil", []interface{}{nil}, "RSA"},
+		{"nil-pointer", []interface{}{nilPtr}, "RSA"},
+		{"empty-string", []interface{}{""}, "RSA"},
+		{"empty-slice", []interface{}{[]interface{}{}}, "RSA"},
+		{"nil-slice", []interface{}{[]string(nil)}, "RSA"},
+		{"empty-map", []interface{}{map[string]interface{}{}}, "RSA"},
+		{"string", []interface{}{"EC"}, "EC"},
+		{"pointer", []interface{}{&foo}, &foo},
+		{"slice", []interface{}{[]interface{}{"a"}}, []interface{}{"a"}},
+		{"map", []interface{}{map[string]interface{}{"a": 1}}, map[string]interface{}{"a": 1}},
+		{"false", []interface{}{false}, false},
+		{"zero", []interface{}{0}, 0},
+		{"zero-float", []interface{}{0.0}, 0.0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, fallback("RSA", tt.given...))
+		})
+	}
+}
+
+func Test_GetFuncMap_b64decStrict_fail(t *testing.T) {
+	for _, name := range []string{"b64decStrict", "b64urldec"} {
+		t.Run(name, func(t *testing.T) {
+			var failMessage string
+			fns := GetFuncMap(&failMessage)
+			fn := fns[name].(func(v interface{}) (string, error))
+			got, err := fn("not base64!")
+			assert.Error(t, err)
+			assert.Empty(t, got)
+			assert.Equal(t, err.Error(), failMessage)
+		})
+	}
+}
+
+func TestNewFuncs_env(t *testing.T) {
+	lookup := func(name string) (string, bool) {
+		switch name {
+		case "REGION":
+			return "us-east-1", true
+		case "SECRET":
+			return "secret", true
+		default:
+			return "", false
+		}
+	}
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		env     string
+		want    string
+		wantErr string
+	}{
+		{"ok", []Option{WithAllowedEnv("REGION", "CLUSTER"), WithEnvLookup(lookup)}, "REGION", "us-east-1", ""},
+		{"ok/unset", []Option{WithAllowedEnv("REGION", "CLUSTER"), WithEnvLookup(lookup)}, "CLUSTER", "", ""},
+		{"fail/not-allowed", []Option{WithAllowedEnv("REGION", "CLUSTER"), WithEnvLookup(lookup)}, "SECRET", "", `environment variable "SECRET" is not allowed`},
+		{"fail/empty-allowlist", []Option{WithAllowedEnv(), WithEnvLookup(lookup)}, "REGION", "", `environment variable "REGION" is not allowed`},
+		{"fail/default", nil, "HOME", "", `environment variable "HOME" is not allowed`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			funcs := NewFuncs(tt.opts...)
+			env := funcs.FuncMap()["env"].(func(string) (string, error))
+			got, err := env(tt.env)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				msg, ok := funcs.Failure()
+				assert.True(t, ok)
+				assert.Equal(t, tt.wantErr, msg)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewFuncs_env_osLookup(t *testing.T) {
+	t.Setenv("TEMPLATES_TEST_REGION", "eu-west-1")
+	env := NewFuncs(WithAllowedEnv("TEMPLATES_TEST_REGION")).FuncMap()["env"].(func(string) (string, error))
+	got, err := env("TEMPLATES_TEST_REGION")
+	assert.NoError(t, err)
+	assert.Equal(t, "eu-west-1", got)
+}
+
+func Test_GetFuncMap_firstNonEmpty(t *testing.T) {
+	var failMessage string
+	fns := GetFuncMap(&failMessage)
+	firstNonEmpty := fns["firstNonEmpty"].(func(values ...interface{}) interface{})
+
+	tests := []struct {
+		name   string
+		values []interface{}
+		want   interface{}
+	}{
+		{"first", []interface{}{"preferred", "fallback", "static"}, "preferred"},
+		{"second", []interface{}{nil, "fallback", "static"}, "fallback"},
+		{"last", []interface{}{"", []interface{}{}, "static"}, "static"},
+		{"skip-empty-collections", []interface{}{map[string]interface{}{}, []string{"a"}}, []string{"a"}},
+		{"false", []interface{}{nil, false, true}, false},
+		{"zero", []interface{}{"", 0, 1}, 0},
+		{"all-empty", []interface{}{nil, "", []interface{}{}, map[string]interface{}{}}, ""},
+		{"no-arguments", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := firstNonEmpty(tt.values...)
+			assert.Equal(t, tt.want, got)
+
+			// firstNonEmpty and fallback agree on what is empty.
+			if len(tt.values) == 2 {
+				fallback := fns["fallback"].(func(d interface{}, given ...interface{}) interface{})
+				assert.Equal(t, got, fallback(tt.values[1], tt.values[0]))
+			}
+		})
+	}
+}
+
+func Test_GetFuncMap_ifElse(t *testing.T) {
+	var failMessage string
+	fns := GetFuncMap(&failMessage)
+	ifElse := fns["ifElse"].(func(cond, vt, vf interface{}) interface{})
+
+	var nilPtr *string
+	foo := "foo"
+	tests := []struct {
+		name string
+		cond interface{}
+		want interface{}
+	}{
+		{"nil", nil, "no"},
+		{"nil-pointer", nilPtr, "no"},
+		{"empty-string", "", "no"},
+		{"empty-slice", []interface{}{}, "no"},
+		{"empty-map", map[string]interface{}{}, "no"},
+		{"false", false, "no"},
+		{"true", true, "yes"},
+		{"string", "false", "yes"},
+		{"pointer", &foo, "yes"},
+		{"slice", []interface{}{"a"}, "yes"},
+		{"map", map[string]interface{}{"a": 1}, "yes"},
+		{"zero", 0, "yes"},
+		{"zero-float", 0.0, "yes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ifElse(tt.cond, "yes", "no"))
+		})
+	}
+}
+
+func TestTemplate_ifElse(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"isCA": {{ ifElse .IsCA "true" "false" }}, "cn": {{ ifElse .Subject.CommonName .Subject.CommonName "default" | toJson }}}`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"empty", ``, `{"isCA": false, "cn": "default"}`},
+		{"null", `{"IsCA": null, "Subject": {"CommonName": null}}`, `{"isCA": false, "cn": "default"}`},
+		{"false", `{"IsCA": false, "Subject": {"CommonName": ""}}`, `{"isCA": false, "cn": "default"}`},
+		{"true", `{"IsCA": true, "Subject": {"CommonName": "foo"}}`, `{"isCA": true, "cn": "foo"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, tmpl.Validate([]byte(tt.data)))
+			out, err := tmpl.Render([]byte(tt.data))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(out))
+		})
+	}
+}
+
+func TestTemplate_ternary(t *testing.T) {
+	// "ternary" is the sprig function, with the condition last.
+	tests := []struct {
+		name    string
+		text    string
+		data    string
+		want    string
+		wantErr bool
+	}{
+		{"true", `{{ ternary "yes" "no" true }}`, ``, `yes`, false},
+		{"false", `{{ ternary "yes" "no" false }}`, ``, `no`, false},
+		{"data", `{{ ternary .A .B .IsCA }}`, `{"A": "a", "B": "b", "IsCA": true}`, `a`, false},
+		{"data-false", `{{ ternary .A .B .IsCA }}`, `{"A": "a", "B": "b", "IsCA": false}`, `b`, false},
+		{"not-bool", `{{ ternary "yes" "no" "true" }}`, ``, ``, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseTemplate([]byte(tt.text))
+			require.NoError(t, err)
+			out, err := tmpl.Render([]byte(tt.data), WithRenderMode(RenderRaw))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(out))
+		})
+	}
+}
+
+func TestFuncMapVersion(t *testing.T) {
+	assert.Equal(t, funcMapVersion, FuncMapVersion())
+	assert.GreaterOrEqual(t, FuncMapVersion(), 1)
+}
+
+func Test_checkFuncMapVersion(t *testing.T) {
+	next := FuncMapVersion() + 1
+	tests := []struct {
+		name    string
+		text    string
+		wantErr string
+		line    int
+		column  int
+	}{
+		{"ok/no-requirement", `{"a": 1}`, "", 0, 0},
+		{"ok/same", fmt.Sprintf(`{{/* requires funcmap >= %d */}}{}`, FuncMapVersion()), "", 0, 0},
+		{"ok/older", `{{/* requires funcmap >= 1 */}}{}`, "", 0, 0},
+		{"ok/other-comment", fmt.Sprintf(`{{/* this requires funcmap >= %d? */}}{}`, next), "", 0, 0},
+		{"fail/newer", fmt.Sprintf("{\n{{/* requires funcmap >= %d */}}\n}", next), fmt.Sprintf("error parsing template: template requires newer func map: version %d required, have %d", next, FuncMapVersion()), 2, 1},
+		{"fail/trim-markers", fmt.Sprintf(`{{- /*requires funcmap>=%d*/ -}}{}`, next), fmt.Sprintf("error parsing template: template requires newer func map: version %d required, have %d", next, FuncMapVersion()), 1, 1},
+		{"fail/huge", `{{/* requires funcmap >= 99999999999999999999 */}}{}`, fmt.Sprintf("error parsing template: template requires newer func map: version 99999999999999999999 required, have %d", FuncMapVersion()), 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateTemplate([]byte(tt.text))
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.wantErr)
+			var te *TemplateError
+			if assert.True(t, errors.As(err, &te)) {
+				assert.Equal(t, ParseError, te.Kind)
+				assert.Equal(t, tt.line, te.Line)
+				assert.Equal(t, tt.column, te.Column)
+			}
+		})
+	}
+
+	// The requirement takes precedence over unknown functions.
+	err := ValidateTemplate([]byte(fmt.Sprintf(`{{/* requires funcmap >= %d */}}{{ newFunction }}`, next)))
+	assert.EqualError(t, err, fmt.Sprintf("error parsing template: template requires newer func map: version %d required, have %d", next, FuncMapVersion()))
+}
@@ -0,0 +1,1245 @@
+package templates
+
+import (
+	"bytes"
+	"crypto/sha1" //nolint:gosec // SHA-1 is only used to derive values
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"go.step.sm/crypto/fingerprint"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+// toBytes returns the bytes of a string or byte slice, or the string
+// representation of any other value.
+func toBytes(v interface{}) []byte {
+	switch t := v.(type) {
+	case []byte:
+		return t
+	case string:
+		return []byte(t)
+	default:
+		return []byte(fmt.Sprint(v))
+	}
+}
+
+// b64encBytes encodes v using the standard base64 encoding with padding.
+func b64encBytes(v interface{}) string {
+	return base64.StdEncoding.EncodeToString(toBytes(v))
+}
+
+// b64decStrict decodes v using the standard base64 encoding. The padding is
+// required, and any character outside the alphabet, except for line breaks,
+// is an error.
+func b64decStrict(v interface{}) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(string(toBytes(v)))
+	if err != nil {
+		return "", fmt.Errorf("error decoding base64: %w", err)
+	}
+	return string(b), nil
+}
+
+// b64urlenc encodes v using the URL-safe base64 encoding without padding, the
+// form used in JWTs and most URLs.
+func b64urlenc(v interface{}) string {
+	return base64.RawURLEncoding.EncodeToString(toBytes(v))
+}
+
+// b64urldec decodes v using the URL-safe base64 encoding. Both padded and
+// unpadded inputs are accepted.
+func b64urldec(v interface{}) (string, error) {
+	s := string(toBytes(v))
+	enc := base64.RawURLEncoding
+	if strings.HasSuffix(s, "=") {
+		enc = base64.URLEncoding
+	}
+	b, err := enc.DecodeString(s)
+	if err != nil {
+		return "", fmt.Errorf("error decoding base64url: %w", err)
+	}
+	return string(b), nil
+}
+
+// hashBytes returns the data hashed by the hash functions, the bytes of v, or
+// nothing if v is nil.
+func hashBytes(v interface{}) []byte {
+	if v == nil {
+		return nil
+	}
+	return toBytes(v)
+}
+
+// sha256Sum returns the hex encoded SHA-256 digest of v.
+func sha256Sum(v interface{}) string {
+	sum := sha256.Sum256(hashBytes(v))
+	return hex.EncodeToString(sum[:])
+}
+
+// sha1Sum returns the hex encoded SHA-1 digest of v.
+func sha1Sum(v interface{}) string {
+	sum := sha1.Sum(hashBytes(v))
+	return hex.EncodeToString(sum[:])
+}
+
+// fingerprintEncodings are the encodings supported by fingerprintSum, except
+// "colon", which is the hex encoding with the bytes separated by colons.
+var fingerprintEncodings = map[string]fingerprint.Encoding{
+	"hex":          fingerprint.HexFingerprint,
+	"base64":       fingerprint.Base64Fingerprint,
+	"base64url":    fingerprint.Base64URLFingerprint,
+	"base64raw":    fingerprint.Base64RawFingerprint,
+	"base64rawurl": fingerprint.Base64RawURLFingerprint,
+	"emoji":        fingerprint.EmojiFingerprint,
+}
+
+// fingerprintSum returns the SHA-256 digest of v in the given encoding, one of
+// the fingerprintEncodings or "colon", like "1a:2b:...". The encodings are the
+// ones used by the fingerprint package.
+func fingerprintSum(encoding string, v interface{}) (string, error) {
+	sum := sha256.Sum256(hashBytes(v))
+	if encoding == "colon" {
+		parts := make([]string, len(sum))
+		for i, b := range sum {
+			parts[i] = hex.EncodeToString([]byte{b})
+		}
+		return strings.Join(parts, ":"), nil
+	}
+	enc, ok := fingerprintEncodings[encoding]
+	if !ok {
+		return "", fmt.Errorf("error creating fingerprint: unsupported encoding %q", encoding)
+	}
+	return fingerprint.Fingerprint(sum[:], enc), nil
+}
+
+// keyFingerprint returns the fingerprint of the key name, read with resolve,
+// in "hex" or in the given encoding, like fingerprintSum.
+func keyFingerprint(resolve func(string) ([]byte, error), name string, encoding ...string) (string, error) {
+	if len(encoding) > 1 {
+		return "", fmt.Errorf("error creating fingerprint of key %q: expected a name and an optional encoding, not %d arguments", name, len(encoding)+1)
+	}
+	b, err := resolveKey("creating fingerprint of key", resolve, name)
+	if err != nil {
+		return "", err
+	}
+	enc := "hex"
+	if len(encoding) == 1 {
+		enc = encoding[0]
+	}
+	return fingerprintSum(enc, b)
+}
+
+// resolveKey returns the bytes of the key name read with resolve. The error of
+// a missing resolver starts with "error " and op.
+func resolveKey(op string, resolve func(string) ([]byte, error), name string) ([]byte, error) {
+	if resolve == nil {
+		return nil, fmt.Errorf("error %s %q: keys cannot be resolved without WithKeyResolver", op, name)
+	}
+	b, err := resolve(name)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving key %q: %w", name, err)
+	}
+	if len(b) == 0 {
+		return nil, fmt.Errorf("error resolving key %q: key is empty", name)
+	}
+	return b, nil
+}
+
+// maxKeyIDLength is the maximum length in bytes of the key identifiers
+// formatted by hexGroup and base32Encode, the size of a SHA-512 digest.
+const maxKeyIDLength = 64
+
+// keyIDBytes returns the bytes of a key identifier given as a byte slice, or
+// as a string with the bytes hex encoded, like "1a2b3c", optionally separated
+// by colons, like "1A:2B:3C". The identifier must have between 1 and
+// maxKeyIDLength bytes.
+func keyIDBytes(v interface{}) ([]byte, error) {
+	var b []byte
+	switch t := v.(type) {
+	case []byte:
+		b = t
+	case string:
+		h := t
+		if strings.Contains(t, ":") {
+			parts := strings.Split(t, ":")
+			for _, p := range parts {
+				if len(p) != 2 {
+					return nil, fmt.Errorf("error decoding key id: %q has groups that are not a single byte", t)
+				}
+			}
+			h = strings.Join(parts, "")
+		}
+		if len(h)%2 != 0 {
+			return nil, fmt.Errorf("error decoding key id: %q has an odd number of hex digits", t)
+		}
+		var err error
+		if b, err = hex.DecodeString(h); err != nil {
+			return nil, fmt.Errorf("error decoding key id: %q is not hex encoded", t)
+		}
+	default:
+		return nil, fmt.Errorf("error decoding key id: unsupported type %T", v)
+	}
+
+	switch {
+	case len(b) == 0:
+		return nil, fmt.Errorf("error decoding key id: key id is empty")
+	case len(b) > maxKeyIDLength:
+		return nil, fmt.Errorf("error decoding key id: %d bytes exceeds the maximum of %d", len(b), maxKeyIDLength)
+	}
+	return b, nil
+}
+
+// hexGroup returns the key identifier v, see keyIDBytes, as upper case hex
+// with the bytes separated by colons, like "1A:2B:3C".
+func hexGroup(v interface{}) (string, error) {
+	b, err := keyIDBytes(v)
+	if err != nil {
+		return "", err
+	}
+	parts := make([]string, len(b))
+	for i, c := range b {
+		parts[i] = fmt.Sprintf("%02X", c)
+	}
+	return strings.Join(parts, ":"), nil
+}
+
+// base32Encode returns the key identifier v, see keyIDBytes, encoded using
+// the standard base32 encoding with padding.
+func base32Encode(v interface{}) (string, error) {
+	b, err := keyIDBytes(v)
+	if err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.EncodeToString(b), nil
+}
+
+// maxSerialNumberLength is the maximum length in bytes of the DER encoding of
+// a serial number, see RFC 5280, section 4.1.2.2.
+const maxSerialNumberLength = 20
+
+// maxExactFloat is the largest integer such that all the integers up to it can
+// be represented exactly as a float64, like the numbers in the template data.
+const maxExactFloat = 1 << 53
+
+// serialNumber returns the serial number v in the given format, "decimal" like
+// "1311768467294899695", or "hex" like "0x1234567890abcdef", zero-padded to a
+// whole number of bytes. The serial number can be an integer, a *big.Int, or a
+// string with an integer in decimal, or in hex with the "0x" prefix like the
+// ones accepted in a certificate template. It must be positive and its DER
+// encoding cannot have more than maxSerialNumberLength bytes. Numbers too
+// large to be exact in the template data must be strings.
+func serialNumber(format string, v interface{}) (string, error) {
+	var n *big.Int
+	switch t := v.(type) {
+	case *big.Int:
+		if t == nil {
+			return "", fmt.Errorf("error formatting serial number: serial number is empty")
+		}
+		n = t
+	case string:
+		var ok bool
+		if n, ok = new(big.Int).SetString(t, 0); !ok || strings.HasPrefix(t, "+") {
+			return "", fmt.Errorf("error formatting serial number: %q is not a decimal or hex integer", t)
+		}
+	default:
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Float64 && math.Abs(rv.Float()) > maxExactFloat {
+			return "", fmt.Errorf("error formatting serial number: %v cannot be represented exactly as a number, use a string", v)
+		}
+		i, err := toInt64(v)
+		if err != nil {
+			return "", fmt.Errorf("error formatting serial number: %w", err)
+		}
+		n = big.NewInt(i)
+	}
+
+	// A positive INTEGER needs a leading zero byte if its highest bit is set.
+	switch {
+	case n.Sign() <= 0:
+		return "", fmt.Errorf("error formatting serial number: %s is not positive", n)
+	case n.BitLen()/8+1 > maxSerialNumberLength:
+		return "", fmt.Errorf("error formatting serial number: %s is longer than %d bytes", n, maxSerialNumberLength)
+	}
+
+	switch strings.ToLower(format) {
+	case "decimal":
+		return n.String(), nil
+	case "hex":
+		return "0x" + hex.EncodeToString(n.Bytes()), nil
+	default:
+		return "", fmt.Errorf("error formatting serial number: unknown format %q, use decimal or hex", format)
+	}
+}
+
+// jsonQuote returns each value as a JSON string, escaping quotes, backslashes
+// and control characters, so {{ jsonQuote .CommonName }} is always a valid
+// JSON value.
+// Nil values are quoted as empty strings, and multiple values are separated by
+// spaces like in the sprig function.
+func jsonQuote(values ...interface{}) string {
+	return quoteValues('"', values)
+}
+
+// jsonSquote is like jsonQuote, but the strings are surrounded by single
+// quotes, and single quotes are escaped instead of double quotes.
+func jsonSquote(values ...interface{}) string {
+	return quoteValues('\'', values)
+}
+
+// jsonPrintf formats the arguments like fmt.Sprintf and returns the result as
+// a JSON string, like jsonQuote does.
+func jsonPrintf(format string, args ...interface{}) string {
+	return quoteString(fmt.Sprintf(format, args...), '"')
+}
+
+// jsonKey returns the string representation of v as a JSON string, escaped
+// like jsonQuote does, to be used as the key of an object. Keys must not be empty.
+func jsonKey(v interface{}) (string, error) {
+	if v == nil {
+		return "", fmt.Errorf("error creating json key: key is missing")
+	}
+	s := string(toBytes(v))
+	if s == "" {
+		return "", fmt.Errorf("error creating json key: key is empty")
+	}
+	return quoteString(s, '"'), nil
+}
+
+func quoteValues(q byte, values []interface{}) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		var s string
+		if v != nil {
+			s = string(toBytes(v))
+		}
+		quoted[i] = quoteString(s, q)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// quoteString returns s surrounded by q using the escape sequences of JSON.
+// Invalid UTF-8 is replaced by U+FFFD, and U+2028 and U+2029, valid in JSON
+// but not in JavaScript, are escaped too.
+func quoteString(s string, q byte) string {
+	var sb strings.Builder
+	sb.Grow(len(s) + 2)
+	sb.WriteByte(q)
+	for _, r := range s {
+		switch {
+		case r == rune(q) || r == '\\':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		case r == '\n':
+			sb.WriteString(`\n`)
+		case r == '\r':
+			sb.WriteString(`\r`)
+		case r == '\t':
+			sb.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f || r == '\u2028' || r == '\u2029':
+			fmt.Fprintf(&sb, `\u%04x`, r)
+		case r == utf8.RuneError:
+			sb.WriteString(`\ufffd`)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteByte(q)
+	return sb.String()
+}
+
+// joinParts returns the elements of the slice or array v separated by sep.
+// Strings and byte slices are used as they are, nil elements are skipped, and
+// any other element is formatted with fmt. If v is not a slice or an array,
+// its string representation is returned, and an empty string if it's nil.
+func joinParts(sep string, v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return string(toBytes(v))
+	}
+	elems := make([]string, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		if e := rv.Index(i).Interface(); e != nil {
+			elems = append(elems, string(toBytes(e)))
+		}
+	}
+	return strings.Join(elems, sep)
+}
+
+// splitParts returns the substrings of s separated by sep. Unlike
+// strings.Split, an empty s returns an empty slice.
+func splitParts(sep, s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, sep)
+}
+
+// listElems returns the elements of the slice or array list for the function
+// fn, or no elements if list is nil.
+func listElems(fn string, list interface{}) ([]interface{}, error) {
+	if list == nil {
+		return []interface{}{}, nil
+	}
+	if l, ok := list.([]interface{}); ok {
+		return l, nil
+	}
+	rv := reflect.ValueOf(list)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("error calling %s: %v of type %T is not a list", fn, list, list)
+	}
+	elems := make([]interface{}, rv.Len())
+	for i := range elems {
+		elems[i] = rv.Index(i).Interface()
+	}
+	return elems, nil
+}
+
+// firstElem returns the first element of list, or nil if it's empty.
+func firstElem(list interface{}) (interface{}, error) {
+	elems, err := listElems("firstElem", list)
+	if err != nil || len(elems) == 0 {
+		return nil, err
+	}
+	return elems[0], nil
+}
+
+// lastElem returns the last element of list, or nil if it's empty.
+func lastElem(list interface{}) (interface{}, error) {
+	elems, err := listElems("lastElem", list)
+	if err != nil || len(elems) == 0 {
+		return nil, err
+	}
+	return elems[len(elems)-1], nil
+}
+
+// restElems returns the elements of list but the first one, or an empty list if
+// it's empty.
+func restElems(list interface{}) ([]interface{}, error) {
+	elems, err := listElems("restElems", list)
+	if err != nil || len(elems) == 0 {
+		return []interface{}{}, err
+	}
+	return elems[1:], nil
+}
+
+// sliceElems returns the elements of a list from a start index to an end
+// index, not included. The list comes first, like in sliceElems .SANs 1 3, or
+// last, like in .SANs | sliceElems 1 3. The end index is optional, and defaults to the length
+// of the list. Negative indices, indices out of range and a start index
+// greater than the end index are an error.
+func sliceElems(args ...interface{}) ([]interface{}, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, fmt.Errorf("error calling sliceElems: expected a list and one or two indices, not %d arguments", len(args))
+	}
+	list, indices := args[0], args[1:]
+	if isList(args[len(args)-1]) && !isList(args[0]) {
+		list, indices = args[len(args)-1], args[:len(args)-1]
+	}
+	elems, err := listElems("sliceElems", list)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := []int{0, len(elems)}
+	for i, v := range indices {
+		n, err := toInt64(v)
+		if err != nil {
+			return nil, fmt.Errorf("error calling sliceElems: invalid index: %w", err)
+		}
+		if n < 0 || n > int64(len(elems)) {
+			return nil, fmt.Errorf("error calling sliceElems: index %d out of range for a list of %d elements", n, len(elems))
+		}
+		bounds[i] = int(n)
+	}
+	if bounds[0] > bounds[1] {
+		return nil, fmt.Errorf("error calling sliceElems: start index %d is greater than end index %d", bounds[0], bounds[1])
+	}
+	return elems[bounds[0]:bounds[1]], nil
+}
+
+// isList reports whether v is a slice or an array, other than a byte slice.
+func isList(v interface{}) bool {
+	if _, ok := v.([]byte); ok {
+		return false
+	}
+	k := reflect.ValueOf(v).Kind()
+	return k == reflect.Slice || k == reflect.Array
+}
+
+// regexpCache keeps the regular expressions compiled by the template
+// functions, so a pattern used in a range loop is only compiled once.
+type regexpCache struct {
+	mu       sync.Mutex
+	patterns map[string]*regexp.Regexp
+}
+
+// compile returns the compiled regular expression for pattern.
+func (c *regexpCache) compile(pattern string) (*regexp.Regexp, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if re, ok := c.patterns[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("error compiling regexp %q: %w", pattern, err)
+	}
+	if c.patterns == nil {
+		c.patterns = make(map[string]*regexp.Regexp)
+	}
+	c.patterns[pattern] = re
+	return re, nil
+}
+
+// regexMatch reports whether s contains a match of the regular expression
+// pattern.
+func (c *regexpCache) regexMatch(pattern, s string) (bool, error) {
+	re, err := c.compile(pattern)
+	if err != nil {
+		return false, err
+	}
+	return re.MatchString(s), nil
+}
+
+// regexReplace replaces the matches of the regular expression pattern in s
+// with repl. Inside repl, $1 or ${name} are replaced by the submatches.
+func (c *regexpCache) regexReplace(pattern, s, repl string) (string, error) {
+	re, err := c.compile(pattern)
+	if err != nil {
+		return "", err
+	}
+	return re.ReplaceAllString(s, repl), nil
+}
+
+// dateAdd adds the duration d, in the format accepted by time.ParseDuration,
+// like "720h" or "-5m", to t and returns the result in UTC in the RFC 3339
+// format. The time t can be a time.Time or a string in the RFC 3339 format.
+func dateAdd(d string, t interface{}) (string, error) {
+	duration, err := time.ParseDuration(d)
+	if err != nil {
+		return "", fmt.Errorf("error parsing duration: %w", err)
+	}
+	tt, err := toTime("adding duration", t)
+	if err != nil {
+		return "", err
+	}
+	return tt.Add(duration).UTC().Format(time.RFC3339), nil
+}
+
+// addDuration adds the duration d, in the format accepted by
+// time.ParseDuration, like "2160h", to t and returns the result in the RFC 3339
+// format, with the offset of t, so "2024-01-01T00:00:00+01:00" plus "24h" is
+// "2024-01-02T00:00:00+01:00". The time t can be a time.Time or a string in
+// the RFC 3339 format. A leap second, like "2016-12-31T23:59:60Z", is read as
+// the first second of the next minute, because the time package doesn't
+// support them.
+func addDuration(t interface{}, d string) (string, error) {
+	duration, err := time.ParseDuration(d)
+	if err != nil {
+		return "", fmt.Errorf("error parsing duration: %w", err)
+	}
+	if s, ok := t.(string); ok && leapSecondRegexp.MatchString(s) {
+		t = leapSecondRegexp.ReplaceAllString(s, "${1}59$2")
+		duration += time.Second
+	}
+	tt, err := toTime("adding duration", t)
+	if err != nil {
+		return "", err
+	}
+	return tt.Add(duration).Format(time.RFC3339), nil
+}
+
+// validity returns the lifetime of a certificate as a duration in the format of
+// time.Duration, like "2160h0m0s", and fails if it's not positive or if it's
+// longer than max, unless max is 0 or less. The lifetime is given as a
+// duration, a string in the format accepted by time.ParseDuration or a
+// time.Duration, or as the notBefore and notAfter times, time.Time values or
+// strings in the RFC 3339 format. A lifetime equal to max is valid.
+func validity(max time.Duration, args ...interface{}) (string, error) {
+	var lifetime time.Duration
+	switch len(args) {
+	case 1:
+		switch v := args[0].(type) {
+		case string:
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return "", fmt.Errorf("error parsing duration: %w", err)
+			}
+			lifetime = d
+		case time.Duration:
+			lifetime = v
+		default:
+			return "", fmt.Errorf("error validating validity: unsupported duration %v of type %T", v, v)
+		}
+	case 2:
+		notBefore, err := toTime("validating validity", args[0])
+		if err != nil {
+			return "", err
+		}
+		notAfter, err := toTime("validating validity", args[1])
+		if err != nil {
+			return "", err
+		}
+		if notAfter.Before(notBefore) {
+			return "", fmt.Errorf("error validating validity: notAfter %s is before notBefore %s",
+				notAfter.Format(time.RFC3339), notBefore.Format(time.RFC3339))
+		}
+		lifetime = notAfter.Sub(notBefore)
+	default:
+		return "", fmt.Errorf("error validating validity: expected a duration or a notBefore and a notAfter time, not %d arguments", len(args))
+	}
+
+	switch {
+	case lifetime <= 0:
+		return "", fmt.Errorf("error validating validity: requested %s is not positive", formatLifetime(lifetime))
+	case max > 0 && lifetime > max:
+		return "", fmt.Errorf("error validating validity: requested %s exceeds max %s", formatLifetime(lifetime), formatLifetime(max))
+	}
+	return lifetime.String(), nil
+}
+
+// formatLifetime returns d in days, like "90d", if it's a whole number of
+// days, and in the format of time.Duration otherwise.
+func formatLifetime(d time.Duration) string {
+	const day = 24 * time.Hour
+	if d != 0 && d%day == 0 {
+		return strconv.FormatInt(int64(d/day), 10) + "d"
+	}
+	return d.String()
+}
+
+// leapSecondRegexp matches the seconds of an RFC 3339 time with a leap second.
+var leapSecondRegexp = regexp.MustCompile(`^([0-9]{4}-[0-9]{2}-[0-9]{2}[Tt][0-9]{2}:[0-9]{2}:)60((?:\.[0-9]+)?(?:[Zz]|[+-][0-9]{2}:[0-9]{2}))$`)
+
+// toTime returns t, a time.Time or a string in the RFC 3339 format, as a
+// time.Time. The errors that are not about parsing the string start with
+// "error " and op.
+func toTime(op string, t interface{}) (time.Time, error) {
+	switch v := t.(type) {
+	case time.Time:
+		return v, nil
+	case *time.Time:
+		if v == nil {
+			return time.Time{}, fmt.Errorf("error %s: time is nil", op)
+		}
+		return *v, nil
+	case string:
+		tt, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("error parsing time: %w", err)
+		}
+		return tt, nil
+	default:
+		return time.Time{}, fmt.Errorf("error %s: unsupported time %v of type %T", op, t, t)
+	}
+}
+
+// The time formats with a name, besides the layouts of the time package. The
+// formats "utctime" and "generalizedtime" are the DER encodings of the ASN.1
+// UTCTime and GeneralizedTime types, always in UTC and without fractional
+// seconds, the ones used for the validity of X.509 certificates.
+const (
+	utcTimeLayout         = "060102150405Z0700"
+	generalizedTimeLayout = "20060102150405Z0700"
+)
+
+var timeFormats = map[string]string{
+	"rfc3339":         time.RFC3339,
+	"rfc3339nano":     time.RFC3339Nano,
+	"utctime":         utcTimeLayout,
+	"generalizedtime": generalizedTimeLayout,
+}
+
+// timeLayout returns the layout of the named time format, case insensitive,
+// or format itself if it's a layout of the time package. A format without any
+// element of a layout, like a misspelled name, is an error.
+func timeLayout(format string) (string, error) {
+	if layout, ok := timeFormats[strings.ToLower(format)]; ok {
+		return layout, nil
+	}
+	if time.Unix(0, 0).UTC().Format(format) == time.Unix(86400*400+3661, 0).UTC().Format(format) {
+		return "", fmt.Errorf("unknown time format %q", format)
+	}
+	return format, nil
+}
+
+// formatTime returns t, a time.Time or a string in the RFC 3339 format, in
+// UTC with the given format, one of the timeFormats or a layout of the time
+// package, like "2006-01-02". UTCTime can only represent the years from 1950
+// to 2049, so other years are an error with "utctime".
+func formatTime(format string, t interface{}) (string, error) {
+	layout, err := timeLayout(format)
+	if err != nil {
+		return "", fmt.Errorf("error formatting time: %w", err)
+	}
+	tt, err := toTime("formatting time", t)
+	if err != nil {
+		return "", err
+	}
+	tt = tt.UTC()
+	if layout == utcTimeLayout && (tt.Year() < 1950 || tt.Year() > 2049) {
+		return "", fmt.Errorf("error formatting time: year %d cannot be represented as utctime, it must be between 1950 and 2049", tt.Year())
+	}
+	return tt.Format(layout), nil
+}
+
+// parseTime parses s with the given format, like formatTime does, and returns
+// the time. Two-digit years in "utctime" are in the range from 1950 to 2049,
+// as in X.509 certificates.
+func parseTime(format, s string) (time.Time, error) {
+	layout, err := timeLayout(format)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error parsing time: %w", err)
+	}
+	t, err := time.Parse(layout, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error parsing time: %w", err)
+	}
+	if layout == utcTimeLayout && t.Year() >= 2050 {
+		t = t.AddDate(-100, 0, 0)
+	}
+	return t, nil
+}
+
+// maxRandLength is the maximum number of characters of a random string.
+const maxRandLength = 1024
+
+const (
+	hexChars      = "0123456789abcdef"
+	alphaNumChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+)
+
+// randString returns a string with n characters chosen uniformly at random
+// from chars, using the random bytes read from r. The number of characters n
+// can be any number accepted by toInt64, up to maxRandLength.
+func randString(r io.Reader, n interface{}, chars string) (string, error) {
+	length, err := toInt64(n)
+	if err != nil {
+		return "", fmt.Errorf("error generating random string: %w", err)
+	}
+	switch {
+	case length < 0:
+		return "", fmt.Errorf("error generating random string: %d characters is negative", length)
+	case length > maxRandLength:
+		return "", fmt.Errorf("error generating random string: %d characters exceeds the maximum of %d", length, maxRandLength)
+	}
+
+	// Bytes greater or equal than limit are discarded, so all the characters
+	// have the same probability.
+	limit := 256 - 256%len(chars)
+	b := make([]byte, 0, length)
+	buf := make([]byte, length)
+	for int64(len(b)) < length {
+		p := buf[:length-int64(len(b))]
+		if _, err := io.ReadFull(r, p); err != nil {
+			return "", fmt.Errorf("error generating random string: %w", err)
+		}
+		for _, c := range p {
+			if int(c) < limit {
+				b = append(b, chars[int(c)%len(chars)])
+			}
+		}
+	}
+	return string(b), nil
+}
+
+// toInt64 returns v as an int64. Integers and floating point numbers without a
+// fractional part, like the numbers in the template data, are accepted if they
+// are in range. Any other value is an error.
+func toInt64(v interface{}) (int64, error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if rv.Uint() > math.MaxInt64 {
+			return 0, fmt.Errorf("integer overflow: %v", v)
+		}
+		return int64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if f != math.Trunc(f) {
+			return 0, fmt.Errorf("%v is not an integer", v)
+		}
+		// float64(math.MaxInt64) is 2^63, that is out of range.
+		if f < math.MinInt64 || f >= math.MaxInt64 {
+			return 0, fmt.Errorf("integer overflow: %v", v)
+		}
+		return int64(f), nil
+	default:
+		return 0, fmt.Errorf("%v of type %T is not an integer", v, v)
+	}
+}
+
+// addInt returns the sum of the integers in values, or an error if the result
+// overflows.
+func addInt(values ...interface{}) (int64, error) {
+	var sum int64
+	for _, v := range values {
+		n, err := toInt64(v)
+		if err != nil {
+			return 0, err
+		}
+		if (n > 0 && sum > math.MaxInt64-n) || (n < 0 && sum < math.MinInt64-n) {
+			return 0, fmt.Errorf("integer overflow: %d + %d", sum, n)
+		}
+		sum += n
+	}
+	return sum, nil
+}
+
+// subInt returns a - b, or an error if the result overflows.
+func subInt(a, b interface{}) (int64, error) {
+	x, y, err := toInt64Pair(a, b)
+	if err != nil {
+		return 0, err
+	}
+	if (y < 0 && x > math.MaxInt64+y) || (y > 0 && x < math.MinInt64+y) {
+		return 0, fmt.Errorf("integer overflow: %d - %d", x, y)
+	}
+	return x - y, nil
+}
+
+// mulInt returns the product of a and the integers in values, or an error if
+// the result overflows.
+func mulInt(a interface{}, values ...interface{}) (int64, error) {
+	product, err := toInt64(a)
+	if err != nil {
+		return 0, err
+	}
+	for _, v := range values {
+		n, err := toInt64(v)
+		if err != nil {
+			return 0, err
+		}
+		r := product * n
+		if product != 0 && (r/product != n || (product == -1 && n == math.MinInt64) || (n == -1 && product == math.MinInt64)) {
+			return 0, fmt.Errorf("integer overflow: %d * %d", product, n)
+		}
+		product = r
+	}
+	return product, nil
+}
+
+// divInt returns a / b truncated towards zero, or an error if b is zero or the
+// result overflows.
+func divInt(a, b interface{}) (int64, error) {
+	x, y, err := toInt64Pair(a, b)
+	switch {
+	case err != nil:
+		return 0, err
+	case y == 0:
+		return 0, fmt.Errorf("integer division by zero: %d / 0", x)
+	case x == math.MinInt64 && y == -1:
+		return 0, fmt.Errorf("integer overflow: %d / %d", x, y)
+	}
+	return x / y, nil
+}
+
+// modInt returns the remainder of a / b, with the sign of a, or an error if b
+// is zero.
+func modInt(a, b interface{}) (int64, error) {
+	x, y, err := toInt64Pair(a, b)
+	switch {
+	case err != nil:
+		return 0, err
+	case y == 0:
+		return 0, fmt.Errorf("integer division by zero: %d mod 0", x)
+	}
+	return x % y, nil
+}
+
+func toInt64Pair(a, b interface{}) (int64, int64, error) {
+	x, err := toInt64(a)
+	if err != nil {
+		return 0, 0, err
+	}
+	y, err := toInt64(b)
+	if err != nil {
+		return 0, 0, err
+	}
+	return x, y, nil
+}
+
+// indentLines returns s with spaces added at the beginning of each line, like
+// the sprig and Helm function indent, so a line ending in a newline is followed by a line
+// with only spaces, and an empty string is only the spaces. These spaces are
+// white space, valid anywhere between JSON tokens. The number of spaces can be
+// any integer, like a number in the template data, but not a negative one.
+func indentLines(spaces interface{}, s string) (string, error) {
+	n, err := toInt64(spaces)
+	if err != nil {
+		return "", fmt.Errorf("error indenting: %w", err)
+	}
+	if n < 0 {
+		return "", fmt.Errorf("error indenting: %d spaces is negative", n)
+	}
+	pad := strings.Repeat(" ", int(n))
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad), nil
+}
+
+// nindentLines is like indentLines, but it adds a newline before the indented
+// string, so it can be used like
+// {"extensions": {{ toPrettyJson .Ext | nindentLines 4 }}}.
+func nindentLines(spaces interface{}, s string) (string, error) {
+	v, err := indentLines(spaces, s)
+	if err != nil {
+		return "", err
+	}
+	return "\n" + v, nil
+}
+
+// upperCase returns s in upper case using the Unicode rules that don't depend
+// on the language, so "ß" is "SS".
+func upperCase(s string) string {
+	return cases.Upper(language.Und).String(s)
+}
+
+// lowerCase returns s in lower case using the Unicode rules that don't depend
+// on the language, so "İ" is "i̇" and not the Turkish "i".
+func lowerCase(s string) string {
+	return cases.Lower(language.Und).String(s)
+}
+
+// titleCase returns s with the first letter of each word in upper case and the
+// rest in lower case, using the Unicode rules that don't depend on the
+// language, so "ACME CORP." is "Acme Corp.".
+func titleCase(s string) string {
+	return cases.Title(language.Und).String(s)
+}
+
+// hasElem reports whether needle is an element of the slice or array
+// haystack. A nil haystack, or one that is not a slice or an array, contains
+// nothing. Elements are compared with equalValues.
+func hasElem(needle, haystack interface{}) bool {
+	v := reflect.ValueOf(haystack)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return false
+	}
+	for i := 0; i < v.Len(); i++ {
+		if equalValues(needle, v.Index(i).Interface()) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasMapKey reports whether the map m has the given key. A nil map, or a value
+// that is not a map, has no keys. Keys are compared with equalValues.
+func hasMapKey(m, key interface{}) bool {
+	v := reflect.ValueOf(m)
+	if v.Kind() != reflect.Map {
+		return false
+	}
+	iter := v.MapRange()
+	for iter.Next() {
+		if equalValues(key, iter.Key().Interface()) {
+			return true
+		}
+	}
+	return false
+}
+
+// merge returns the deep merge of the objects base and overrides, applied in
+// order. Objects present in both are merged recursively, and any other value
+// in an override, including arrays and null, replaces the one before it, even
+// if it's an object replaced by a scalar or the other way around. Arrays are
+// not concatenated. The arguments must be objects, or nil for an empty one,
+// and they are not modified.
+func merge(base interface{}, overrides ...interface{}) (map[string]interface{}, error) {
+	dst, err := mergeObject(0, base)
+	if err != nil {
+		return nil, err
+	}
+	dst = mergeMaps(make(map[string]interface{}, len(dst)), dst)
+	for i, v := range overrides {
+		src, err := mergeObject(i+1, v)
+		if err != nil {
+			return nil, err
+		}
+		dst = mergeMaps(dst, src)
+	}
+	return dst, nil
+}
+
+// mergeObject returns the argument i of merge as an object.
+func mergeObject(i int, v interface{}) (map[string]interface{}, error) {
+	switch t := v.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		return t, nil
+	default:
+		return nil, fmt.Errorf("error merging: argument %d of type %T is not an object", i+1, v)
+	}
+}
+
+// mergeMaps merges src into dst, which must not be shared, and returns it.
+// The objects in dst merged with src are copied first.
+func mergeMaps(dst, src map[string]interface{}) map[string]interface{} {
+	for k, v := range src {
+		sm, ok := v.(map[string]interface{})
+		if !ok {
+			dst[k] = v
+			continue
+		}
+		dm, _ := dst[k].(map[string]interface{})
+		dst[k] = mergeMaps(mergeMaps(make(map[string]interface{}, len(dm)+len(sm)), dm), sm)
+	}
+	return dst
+}
+
+// equalValues compares two values used in templates. Scalars, strings,
+// booleans and numbers, are equal if their string representations are equal,
+// so the number 1 in a template is equal to the 1 in the template data,
+// decoded as a float64, and to the string "1". Other values are compared with
+// reflect.DeepEqual.
+func equalValues(a, b interface{}) bool {
+	if isScalar(a) && isScalar(b) {
+		return fmt.Sprint(a) == fmt.Sprint(b)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func isScalar(v interface{}) bool {
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
+
+// rawJSON is a string with a JSON value that is rendered as it is, and that is
+// embedded as a value, not as a string, when it's marshaled.
+type rawJSON string
+
+// MarshalJSON implements the json.Marshaler interface.
+func (r rawJSON) MarshalJSON() ([]byte, error) {
+	return []byte(r), nil
+}
+
+// null returns the JSON null, so {"a": {{ null }}} and {{ object "a" null }}
+// set a key to null explicitly.
+func null() rawJSON {
+	return "null"
+}
+
+// object returns a JSON object with the given key and value pairs, in the same
+// order, omitting the pairs with an empty value, like in defaultValue. The
+// results of object and null can be used as values, and empty objects are
+// omitted too, so nested objects don't need conditional blocks. Keys must be
+// strings and unique.
+func object(pairs ...interface{}) (rawJSON, error) {
+	if len(pairs)%2 != 0 {
+		return "", fmt.Errorf("error creating object: odd number of arguments")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	seen := make(map[string]bool, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return "", fmt.Errorf("error creating object: key %v of type %T is not a string", pairs[i], pairs[i])
+		}
+		if seen[key] {
+			return "", fmt.Errorf("error creating object: duplicate key %q", key)
+		}
+		seen[key] = true
+
+		value := pairs[i+1]
+		if isEmpty(value) || value == rawJSON("{}") {
+			continue
+		}
+		b, err := json.Marshal(value)
+		if err != nil {
+			return "", fmt.Errorf("error creating object: key %q: %w", key, err)
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(b)
+	}
+	buf.WriteByte('}')
+	return rawJSON(buf.String()), nil
+}
+
+// noPathLen is the maxPathLen of a CA certificate template without a limit in
+// the path length. A maxPathLen of 0 means that no intermediate CAs can follow.
+const noPathLen = -1
+
+// basicConstraints returns the basicConstraints of a certificate template for
+// a CA if isCA is true, like {"isCA":true,"maxPathLen":1}, or for a leaf
+// certificate otherwise. The pathLen is optional, and a nil one is the same as
+// not giving it: a CA without it gets a maxPathLen of -1, so the path length is
+// omitted from the certificate and not limited, instead of the 0 that a
+// missing "maxPathLen" means. Setting the pathLen of a leaf certificate, or a
+// negative one, is an error.
+func basicConstraints(isCA interface{}, pathLen ...interface{}) (rawJSON, error) {
+	ca, ok := isCA.(bool)
+	if !ok {
+		return "", fmt.Errorf("error creating basicConstraints: isCA %v of type %T is not a boolean", isCA, isCA)
+	}
+	if len(pathLen) > 1 {
+		return "", fmt.Errorf("error creating basicConstraints: expected isCA and an optional pathLen, not %d arguments", len(pathLen)+1)
+	}
+	if !ca {
+		if len(pathLen) == 1 && pathLen[0] != nil {
+			return "", fmt.Errorf("error creating basicConstraints: pathLen cannot be set if isCA is false")
+		}
+		return `{"isCA":false}`, nil
+	}
+
+	n := int64(noPathLen)
+	if len(pathLen) == 1 && pathLen[0] != nil {
+		v, err := toInt64(pathLen[0])
+		if err != nil {
+			return "", fmt.Errorf("error creating basicConstraints: invalid pathLen: %w", err)
+		}
+		// The path length is an INTEGER (0..MAX), but larger values than the
+		// ones x509.Certificate supports make no sense.
+		if v < 0 || v > math.MaxInt32 {
+			return "", fmt.Errorf("error creating basicConstraints: pathLen %d must be between 0 and %d", v, math.MaxInt32)
+		}
+		n = v
+	}
+	return rawJSON(fmt.Sprintf(`{"isCA":true,"maxPathLen":%d}`, n)), nil
+}
+
+// lookup returns the value in data at the JSON pointer from RFC 6901, like
+// "/subject/names/0/value", where "~1" is a "/" and "~0" is a "~" in a key.
+// The empty pointer returns data. If a key is not in a map, or an index is not
+// in a list, or the value is not a collection, the result is nil. Only
+// invalid pointers return an error.
+func lookup(pointer string, data interface{}) (interface{}, error) {
+	if pointer == "" {
+		return data, nil
+	}
+	if pointer[0] != '/' {
+		return nil, fmt.Errorf("error looking up %q: pointer must be empty or start with '/'", pointer)
+	}
+
+	v := data
+	for _, token := range strings.Split(pointer[1:], "/") {
+		if strings.Contains(token, "~") {
+			if !validPointerEscapes(token) {
+				return nil, fmt.Errorf("error looking up %q: invalid escape in %q", pointer, token)
+			}
+			token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		}
+
+		rv := reflect.ValueOf(v)
+		switch rv.Kind() {
+		case reflect.Map:
+			if rv.Type().Key().Kind() != reflect.String {
+				return nil, nil
+			}
+			e := rv.MapIndex(reflect.ValueOf(token).Convert(rv.Type().Key()))
+			if !e.IsValid() {
+				return nil, nil
+			}
+			v = e.Interface()
+		case reflect.Slice, reflect.Array:
+			i, ok := pointerIndex(token)
+			if !ok || i >= rv.Len() {
+				return nil, nil
+			}
+			v = rv.Index(i).Interface()
+		default:
+			return nil, nil
+		}
+	}
+	return v, nil
+}
+
+// validPointerEscapes reports whether every "~" in the token of a JSON
+// pointer is followed by "0" or "1".
+func validPointerEscapes(token string) bool {
+	for i := 0; i < len(token); i++ {
+		if token[i] == '~' && (i+1 == len(token) || (token[i+1] != '0' && token[i+1] != '1')) {
+			return false
+		}
+	}
+	return true
+}
+
+// pointerIndex returns the array index in the token of a JSON pointer. Indexes
+// are decimal numbers without leading zeros, so "-", "01" or "+1" are not.
+func pointerIndex(token string) (int, bool) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, false
+	}
+	for _, c := range token {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+	}
+	i, err := strconv.Atoi(token)
+	return i, err == nil
+}
+
+// jsonNumberRegexp matches a number in the JSON grammar of RFC 8259.
+var jsonNumberRegexp = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// number returns v as a JSON number, to be rendered as it is. The value can be
+// a number, or a string with a number in the JSON grammar, like "42" or
+// "1.5e3", that is returned without changes, so large integers are exact.
+// Empty strings, strings with white space or leading zeros, like "007", and
+// NaN and infinite numbers are an error.
+func number(v interface{}) (rawJSON, error) {
+	switch n := v.(type) {
+	case nil:
+		return "", fmt.Errorf("error creating number: value is missing")
+	case string:
+		if !jsonNumberRegexp.MatchString(n) {
+			if d := strings.TrimPrefix(n, "-"); len(d) > 1 && d[0] == '0' && d[1] >= '0' && d[1] <= '9' {
+				return "", fmt.Errorf("error creating number: %q has leading zeros", n)
+			}
+			return "", fmt.Errorf("error creating number: %q is not a JSON number", n)
+		}
+		return rawJSON(n), nil
+	case json.Number:
+		return number(string(n))
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rawJSON(strconv.FormatInt(rv.Int(), 10)), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return rawJSON(strconv.FormatUint(rv.Uint(), 10)), nil
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return "", fmt.Errorf("error creating number: %v is not a JSON number", v)
+		}
+		return rawJSON(strconv.FormatFloat(f, 'g', -1, rv.Type().Bits())), nil
+	default:
+		return "", fmt.Errorf("error creating number: %v of type %T is not a number", v, v)
+	}
+}
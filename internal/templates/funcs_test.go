@@ -0,0 +1,1202 @@
+package templates
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_b64encBytes(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{"string", "hello world", "aGVsbG8gd29ybGQ="},
+		{"bytes", []byte{0x30, 0x03, 0x01, 0x01, 0xff}, "MAMBAf8="},
+		{"empty", "", ""},
+		{"urlsafe-chars", []byte{0xfb, 0xff}, "+/8="},
+		{"other", 123, "MTIz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, b64encBytes(tt.v))
+		})
+	}
+}
+
+func Test_b64urlenc(t *testing.T) {
+	assert.Equal(t, "aGVsbG8gd29ybGQ", b64urlenc("hello world"))
+	assert.Equal(t, "-_8", b64urlenc([]byte{0xfb, 0xff}))
+	assert.Equal(t, "", b64urlenc(""))
+}
+
+func Test_b64decStrict(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       interface{}
+		want    string
+		wantErr string
+	}{
+		{"ok", "aGVsbG8gd29ybGQ=", "hello world", ""},
+		{"ok/bytes", []byte("MAMBAf8="), "0\x03\x01\x01\xff", ""},
+		{"ok/empty", "", "", ""},
+		{"ok/line-breaks", "aGVsbG8g\nd29ybGQ=", "hello world", ""},
+		{"fail/invalid-char", "aGVs*G8gd29ybGQ=", "", "error decoding base64: illegal base64 data at input byte 4"},
+		{"fail/truncated", "aGVsbG8gd29ybGQ", "", "error decoding base64: illegal base64 data at input byte 12"},
+		{"fail/urlsafe-chars", "-_8=", "", "error decoding base64: illegal base64 data at input byte 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := b64decStrict(tt.v)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_b64urldec(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       interface{}
+		want    string
+		wantErr string
+	}{
+		{"ok/unpadded", "aGVsbG8gd29ybGQ", "hello world", ""},
+		{"ok/padded", "aGVsbG8gd29ybGQ=", "hello world", ""},
+		{"ok/urlsafe-chars", "-_8", "\xfb\xff", ""},
+		{"ok/urlsafe-chars-padded", "-_8=", "\xfb\xff", ""},
+		{"ok/empty", "", "", ""},
+		{"fail/invalid-char", "aGVs*G8gd29ybGQ", "", "error decoding base64url: illegal base64 data at input byte 4"},
+		{"fail/std-chars", "+/8", "", "error decoding base64url: illegal base64 data at input byte 0"},
+		{"fail/bad-padding", "aGVsbG8gd29ybGQ==", "", "error decoding base64url: illegal base64 data at input byte 16"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := b64urldec(tt.v)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_jsonQuote(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []interface{}
+		want   string
+		squote string
+	}{
+		{"string", []interface{}{"foo"}, `"foo"`, `'foo'`},
+		{"empty", []interface{}{""}, `""`, `''`},
+		{"nil", []interface{}{nil}, `""`, `''`},
+		{"quotes", []interface{}{`a "b" 'c'`}, `"a \"b\" 'c'"`, `'a "b" \'c\''`},
+		{"backslashes", []interface{}{`C:\dir\`}, `"C:\\dir\\"`, `'C:\\dir\\'`},
+		{"control", []interface{}{"a\nb\r\tc\x00\x1f\x7f"}, `"a\nb\r\tc\u0000\u001f\u007f"`, `'a\nb\r\tc\u0000\u001f\u007f'`},
+		{"unicode", []interface{}{"héllo 世界 \u2028\u2029"}, `"héllo 世界 \u2028\u2029"`, `'héllo 世界 \u2028\u2029'`},
+		{"invalid-utf8", []interface{}{"a\xffb"}, `"a\ufffdb"`, `'a\ufffdb'`},
+		{"html", []interface{}{"<a&b>"}, `"<a&b>"`, `'<a&b>'`},
+		{"other", []interface{}{123, true, []byte("bytes")}, `"123" "true" "bytes"`, `'123' 'true' 'bytes'`},
+		{"none", nil, ``, ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := jsonQuote(tt.values...)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.squote, jsonSquote(tt.values...))
+			if len(tt.values) == 1 {
+				var v string
+				assert.NoError(t, json.Unmarshal([]byte(got), &v))
+			}
+		})
+	}
+}
+
+func Test_jsonPrintf(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		args   []interface{}
+		want   string
+	}{
+		{"string", "%s.%s", []interface{}{"foo", "example.com"}, `"foo.example.com"`},
+		{"int", "node-%d", []interface{}{42}, `"node-42"`},
+		{"value", "%v/%v/%v", []interface{}{1.5, true, nil}, `"1.5/true/<nil>"`},
+		{"quotes", "%s said %q", []interface{}{`a "b"`, "c"}, `"a \"b\" said \"c\""`},
+		{"control", "%s", []interface{}{"a\nb\\"}, `"a\nb\\"`},
+		{"no-args", "100%%", nil, `"100%"`},
+		{"bad-verb", "%d", []interface{}{"a"}, `"%!d(string=a)"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := jsonPrintf(tt.format, tt.args...)
+			assert.Equal(t, tt.want, got)
+			var v string
+			assert.NoError(t, json.Unmarshal([]byte(got), &v))
+		})
+	}
+}
+
+func Test_jsonKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       interface{}
+		want    string
+		wantErr string
+	}{
+		{"oid", "1.3.6.1.4.1.37476.9000.64.1", `"1.3.6.1.4.1.37476.9000.64.1"`, ""},
+		{"dots", "a.b.c", `"a.b.c"`, ""},
+		{"quotes", `say "hi"`, `"say \"hi\""`, ""},
+		{"backslash", `C:\keys`, `"C:\\keys"`, ""},
+		{"control", "a\tb\nc\x00", `"a\tb\nc\u0000"`, ""},
+		{"unicode", "clé-日本", `"clé-日本"`, ""},
+		{"separators", "a\u2028b", `"a\u2028b"`, ""},
+		{"invalid-utf8", "a\xffb", `"a\ufffdb"`, ""},
+		{"html", "<a&b>", `"<a&b>"`, ""},
+		{"bytes", []byte("foo"), `"foo"`, ""},
+		{"number", 1.5, `"1.5"`, ""},
+		{"fail/empty", "", "", "error creating json key: key is empty"},
+		{"fail/empty-bytes", []byte{}, "", "error creating json key: key is empty"},
+		{"fail/nil", nil, "", "error creating json key: key is missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := jsonKey(tt.v)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			var m map[string]bool
+			assert.NoError(t, json.Unmarshal([]byte("{"+got+": true}"), &m))
+			assert.Len(t, m, 1)
+		})
+	}
+}
+
+func Test_joinParts(t *testing.T) {
+	tests := []struct {
+		name string
+		sep  string
+		v    interface{}
+		want string
+	}{
+		{"strings", ",", []string{"foo.com", "bar.com"}, "foo.com,bar.com"},
+		{"interfaces", ", ", []interface{}{"a", 1.5, true, nil, []byte("b")}, "a, 1.5, true, b"},
+		{"ints", "-", [3]int{1, 2, 3}, "1-2-3"},
+		{"single", ",", []string{"foo"}, "foo"},
+		{"empty", ",", []string{}, ""},
+		{"nil", ",", nil, ""},
+		{"string", ",", "foo", "foo"},
+		{"bytes", ",", []byte("foo"), "foo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, joinParts(tt.sep, tt.v))
+		})
+	}
+}
+
+func Test_splitParts(t *testing.T) {
+	assert.Equal(t, []string{"foo.com", "bar.com"}, splitParts(",", "foo.com,bar.com"))
+	assert.Equal(t, []string{"a", "", "b"}, splitParts(",", "a,,b"))
+	assert.Equal(t, []string{"foo"}, splitParts(",", "foo"))
+	assert.Equal(t, []string{"", ""}, splitParts(",", ","))
+	assert.Equal(t, []string{}, splitParts(",", ""))
+	assert.Equal(t, []string{"a", "b"}, splitParts("", "ab"))
+}
+
+func Test_firstLastRestElems(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    interface{}
+		first   interface{}
+		last    interface{}
+		rest    []interface{}
+		wantErr string
+	}{
+		{"ok", []interface{}{"a", "b", "c"}, "a", "c", []interface{}{"b", "c"}, ""},
+		{"ok/one", []interface{}{"a"}, "a", "a", []interface{}{}, ""},
+		{"ok/strings", []string{"a", "b"}, "a", "b", []interface{}{"b"}, ""},
+		{"ok/array", [2]int{1, 2}, 1, 2, []interface{}{2}, ""},
+		{"ok/empty", []interface{}{}, nil, nil, []interface{}{}, ""},
+		{"ok/nil", nil, nil, nil, []interface{}{}, ""},
+		{"fail/string", "abc", nil, nil, nil, "abc of type string is not a list"},
+		{"fail/map", map[string]interface{}{}, nil, nil, nil, "map[] of type map[string]interface {} is not a list"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := firstElem(tt.list)
+			l, lastErr := lastElem(tt.list)
+			r, restErr := restElems(tt.list)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, "error calling firstElem: "+tt.wantErr)
+				assert.EqualError(t, lastErr, "error calling lastElem: "+tt.wantErr)
+				assert.EqualError(t, restErr, "error calling restElems: "+tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, lastErr)
+			assert.NoError(t, restErr)
+			assert.Equal(t, tt.first, f)
+			assert.Equal(t, tt.last, l)
+			assert.Equal(t, tt.rest, r)
+		})
+	}
+}
+
+func Test_sliceElems(t *testing.T) {
+	list := []interface{}{"a", "b", "c"}
+	tests := []struct {
+		name    string
+		args    []interface{}
+		want    []interface{}
+		wantErr string
+	}{
+		{"ok", []interface{}{list, 1, 3}, []interface{}{"b", "c"}, ""},
+		{"ok/list-last", []interface{}{0, 2, list}, []interface{}{"a", "b"}, ""},
+		{"ok/start", []interface{}{list, 1}, []interface{}{"b", "c"}, ""},
+		{"ok/start-list-last", []interface{}{2, list}, []interface{}{"c"}, ""},
+		{"ok/float", []interface{}{list, 0.0, 1.0}, []interface{}{"a"}, ""},
+		{"ok/all", []interface{}{list, 0, 3}, []interface{}{"a", "b", "c"}, ""},
+		{"ok/none", []interface{}{list, 3}, []interface{}{}, ""},
+		{"ok/strings", []interface{}{[]string{"a", "b"}, 1, 2}, []interface{}{"b"}, ""},
+		{"ok/empty", []interface{}{[]interface{}{}, 0}, []interface{}{}, ""},
+		{"ok/nil", []interface{}{nil, 0, 0}, []interface{}{}, ""},
+		{"fail/empty", []interface{}{[]interface{}{}, 0, 1}, nil, "error calling sliceElems: index 1 out of range for a list of 0 elements"},
+		{"fail/negative", []interface{}{list, -1}, nil, "error calling sliceElems: index -1 out of range for a list of 3 elements"},
+		{"fail/negative-end", []interface{}{0, -1, list}, nil, "error calling sliceElems: index -1 out of range for a list of 3 elements"},
+		{"fail/out-of-range", []interface{}{list, 1, 4}, nil, "error calling sliceElems: index 4 out of range for a list of 3 elements"},
+		{"fail/start-end", []interface{}{list, 2, 1}, nil, "error calling sliceElems: start index 2 is greater than end index 1"},
+		{"fail/index", []interface{}{list, "1"}, nil, "error calling sliceElems: invalid index: 1 of type string is not an integer"},
+		{"fail/fraction", []interface{}{list, 0.5}, nil, "error calling sliceElems: invalid index: 0.5 is not an integer"},
+		{"fail/not-list", []interface{}{"abc", 1}, nil, "error calling sliceElems: abc of type string is not a list"},
+		{"fail/no-indices", []interface{}{list}, nil, "error calling sliceElems: expected a list and one or two indices, not 1 arguments"},
+		{"fail/too-many", []interface{}{list, 0, 1, 2}, nil, "error calling sliceElems: expected a list and one or two indices, not 4 arguments"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sliceElems(tt.args...)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_regexpCache(t *testing.T) {
+	c := new(regexpCache)
+
+	ok, err := c.regexMatch(`^[a-z0-9-]+(\.[a-z0-9-]+)+$`, "foo.example.com")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = c.regexMatch(`^[a-z0-9-]+(\.[a-z0-9-]+)+$`, "Foo Bar")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	tests := []struct {
+		name    string
+		pattern string
+		s       string
+		repl    string
+		want    string
+		wantErr string
+	}{
+		{"ok", `\.`, "foo.example.com", "-", "foo-example-com", ""},
+		{"ok/backreference", `^(\w+)@(.+)$`, "jane@example.com", "$2/$1", "example.com/jane", ""},
+		{"ok/named", `^(?P<user>\w+)@.+$`, "jane@example.com", "${user}", "jane", ""},
+		{"ok/no-match", `^x`, "foo", "y", "foo", ""},
+		{"fail/pattern", `(foo`, "foo", "", "", "error compiling regexp \"(foo\": error parsing regexp: missing closing ): `(foo`"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.regexReplace(tt.pattern, tt.s, tt.repl)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				_, err = c.regexMatch(tt.pattern, tt.s)
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	// Compiled patterns are reused, and invalid ones are not cached.
+	re, err := c.compile(`\.`)
+	assert.NoError(t, err)
+	assert.Same(t, c.patterns[`\.`], re)
+	assert.NotContains(t, c.patterns, `(foo`)
+}
+
+func Test_dateAdd(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 6, time.FixedZone("CET", 3600))
+	tests := []struct {
+		name    string
+		d       string
+		t       interface{}
+		want    string
+		wantErr string
+	}{
+		{"ok", "720h", now, "2026-02-01T02:04:05Z", ""},
+		{"ok/negative", "-5m", now, "2026-01-02T01:59:05Z", ""},
+		{"ok/zero", "0s", now, "2026-01-02T02:04:05Z", ""},
+		{"ok/pointer", "1h30m", &now, "2026-01-02T03:34:05Z", ""},
+		{"ok/string", "24h", "2026-01-02T03:04:05+01:00", "2026-01-03T02:04:05Z", ""},
+		{"fail/duration", "30d", now, "", `error parsing duration: time: unknown unit "d" in duration "30d"`},
+		{"fail/empty-duration", "", now, "", `error parsing duration: time: invalid duration ""`},
+		{"fail/string", "1h", "2026-01-02", "", `error parsing time: parsing time "2026-01-02" as "2006-01-02T15:04:05Z07:00": cannot parse "" as "T"`},
+		{"fail/nil-pointer", "1h", (*time.Time)(nil), "", "error adding duration: time is nil"},
+		{"fail/type", "1h", 123, "", "error adding duration: unsupported time 123 of type int"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := dateAdd(tt.d, tt.t)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_addDuration(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 6, time.FixedZone("CET", 3600))
+	tests := []struct {
+		name    string
+		t       interface{}
+		d       string
+		want    string
+		wantErr string
+	}{
+		{"ok", now, "2160h", "2026-04-02T03:04:05+01:00", ""},
+		{"ok/negative", now, "-5m", "2026-01-02T02:59:05+01:00", ""},
+		{"ok/pointer", &now, "1h30m", "2026-01-02T04:34:05+01:00", ""},
+		{"ok/string", "2026-01-02T03:04:05Z", "24h", "2026-01-03T03:04:05Z", ""},
+		{"ok/string-offset", "2026-01-02T23:30:00-08:00", "1h", "2026-01-03T00:30:00-08:00", ""},
+		{"ok/fraction", "2026-01-02T03:04:05.999Z", "1s", "2026-01-02T03:04:06Z", ""},
+		{"ok/leap-second", "2016-12-31T23:59:60Z", "0s", "2017-01-01T00:00:00Z", ""},
+		{"ok/leap-second-offset", "2016-12-31T18:59:60.5-05:00", "2160h", "2017-03-31T19:00:00-05:00", ""},
+		{"fail/duration", now, "90d", "", `error parsing duration: time: unknown unit "d" in duration "90d"`},
+		{"fail/string", "2026-01-02", "1h", "", `error parsing time: parsing time "2026-01-02" as "2006-01-02T15:04:05Z07:00": cannot parse "" as "T"`},
+		{"fail/second", "2016-12-31T23:59:61Z", "1h", "", `error parsing time: parsing time "2016-12-31T23:59:61Z": second out of range`},
+		{"fail/nil-pointer", (*time.Time)(nil), "1h", "", "error adding duration: time is nil"},
+		{"fail/type", 123, "1h", "", "error adding duration: unsupported time 123 of type int"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := addDuration(tt.t, tt.d)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_validity(t *testing.T) {
+	const day = 24 * time.Hour
+	notBefore := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name    string
+		max     time.Duration
+		args    []interface{}
+		want    string
+		wantErr string
+	}{
+		{"ok/duration", 90 * day, []interface{}{"2160h"}, "2160h0m0s", ""},
+		{"ok/duration-below", 90 * day, []interface{}{"2159h59m59s"}, "2159h59m59s", ""},
+		{"ok/time.Duration", 90 * day, []interface{}{24 * time.Hour}, "24h0m0s", ""},
+		{"ok/times", 90 * day, []interface{}{notBefore, notBefore.Add(90 * day)}, "2160h0m0s", ""},
+		{"ok/strings", 90 * day, []interface{}{"2026-01-02T03:04:05Z", "2026-04-02T03:04:05Z"}, "2160h0m0s", ""},
+		{"ok/offsets", time.Hour, []interface{}{"2026-01-02T03:00:00+01:00", "2026-01-02T02:30:00Z"}, "30m0s", ""},
+		{"ok/no-max", 0, []interface{}{"87600h"}, "87600h0m0s", ""},
+		{"fail/duration-max", 90 * day, []interface{}{"2160h1s"}, "", "error validating validity: requested 2160h0m1s exceeds max 90d"},
+		{"fail/days", 90 * day, []interface{}{"9528h"}, "", "error validating validity: requested 397d exceeds max 90d"},
+		{"fail/times-max", 90 * day, []interface{}{notBefore, notBefore.Add(90*day + time.Second)}, "", "error validating validity: requested 2160h0m1s exceeds max 90d"},
+		{"fail/strings-max", 24 * time.Hour, []interface{}{"2026-01-02T00:00:00Z", "2026-01-04T00:00:00Z"}, "", "error validating validity: requested 2d exceeds max 1d"},
+		{"fail/max-hours", 90 * time.Minute, []interface{}{"2h"}, "", "error validating validity: requested 2h0m0s exceeds max 1h30m0s"},
+		{"fail/zero", 0, []interface{}{"0s"}, "", "error validating validity: requested 0s is not positive"},
+		{"fail/negative", 0, []interface{}{"-48h"}, "", "error validating validity: requested -2d is not positive"},
+		{"fail/equal-times", 0, []interface{}{notBefore, notBefore}, "", "error validating validity: requested 0s is not positive"},
+		{"fail/reversed", 0, []interface{}{"2026-01-02T00:00:00Z", "2026-01-01T00:00:00Z"}, "", "error validating validity: notAfter 2026-01-01T00:00:00Z is before notBefore 2026-01-02T00:00:00Z"},
+		{"fail/parse-duration", 0, []interface{}{"90d"}, "", `error parsing duration: time: unknown unit "d" in duration "90d"`},
+		{"fail/parse-time", 0, []interface{}{"2026-01-02", notBefore}, "", `error parsing time: parsing time "2026-01-02" as "2006-01-02T15:04:05Z07:00": cannot parse "" as "T"`},
+		{"fail/type", 0, []interface{}{2160.0}, "", "error validating validity: unsupported duration 2160 of type float64"},
+		{"fail/time-type", 0, []interface{}{notBefore, 1}, "", "error validating validity: unsupported time 1 of type int"},
+		{"fail/no-args", 0, nil, "", "error validating validity: expected a duration or a notBefore and a notAfter time, not 0 arguments"},
+		{"fail/args", 0, []interface{}{"a", "b", "c"}, "", "error validating validity: expected a duration or a notBefore and a notAfter time, not 3 arguments"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validity(tt.max, tt.args...)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestTemplate_validity(t *testing.T) {
+	text := []byte(`{"notBefore": {{ toJson .NotBefore }}, "notAfter": {{ addDuration .NotBefore (validity .Duration) | toJson }}}`)
+	tmpl, err := ParseTemplate(text, WithMaxValidity(90*24*time.Hour))
+	require.NoError(t, err)
+	out, err := tmpl.Render([]byte(`{"NotBefore": "2026-01-02T00:00:00Z", "Duration": "2160h"}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"notBefore": "2026-01-02T00:00:00Z", "notAfter": "2026-04-02T00:00:00Z"}`, string(out))
+
+	err = tmpl.Validate([]byte(`{"NotBefore": "2026-01-02T00:00:00Z", "Duration": "9528h"}`))
+	assert.EqualError(t, err, "error executing template: error validating validity: requested 397d exceeds max 90d")
+
+	// Without a maximum any positive lifetime is valid.
+	tmpl, err = ParseTemplate(text)
+	require.NoError(t, err)
+	assert.NoError(t, tmpl.Validate([]byte(`{"NotBefore": "2026-01-02T00:00:00Z", "Duration": "9528h"}`)))
+
+	// The order of times set independently.
+	tmpl, err = ParseTemplate([]byte(`{{ $_ := validity .NotBefore .NotAfter }}{"notBefore": {{ toJson .NotBefore }}, "notAfter": {{ toJson .NotAfter }}}`))
+	require.NoError(t, err)
+	assert.NoError(t, tmpl.Validate([]byte(`{"NotBefore": "2026-01-02T00:00:00Z", "NotAfter": "2026-01-02T00:00:01Z"}`)))
+	err = tmpl.Validate([]byte(`{"NotBefore": "2026-01-02T00:00:00-05:00", "NotAfter": "2026-01-02T05:00:00Z"}`))
+	assert.EqualError(t, err, "error executing template: error validating validity: requested 0s is not positive")
+	err = tmpl.Validate([]byte(`{"NotBefore": "2026-04-02T00:00:00Z", "NotAfter": "2026-01-02T00:00:00Z"}`))
+	assert.EqualError(t, err, "error executing template: error validating validity: notAfter 2026-01-02T00:00:00Z is before notBefore 2026-04-02T00:00:00Z")
+}
+
+func Test_formatTime(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 6, time.FixedZone("CET", 3600))
+	tests := []struct {
+		name    string
+		format  string
+		t       interface{}
+		want    string
+		wantErr string
+	}{
+		{"rfc3339", "rfc3339", now, "2026-01-02T02:04:05Z", ""},
+		{"rfc3339nano", "rfc3339nano", now, "2026-01-02T02:04:05.000000006Z", ""},
+		{"utctime", "utctime", now, "260102020405Z", ""},
+		{"utctime/case", "UTCTime", now, "260102020405Z", ""},
+		{"utctime/1950", "utctime", time.Date(1950, 1, 1, 0, 0, 0, 0, time.UTC), "500101000000Z", ""},
+		{"generalizedtime", "generalizedtime", now, "20260102020405Z", ""},
+		{"generalizedtime/9999", "GeneralizedTime", time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC), "99991231235959Z", ""},
+		{"layout", "2006-01-02 15:04", now, "2026-01-02 02:04", ""},
+		{"pointer", "utctime", &now, "260102020405Z", ""},
+		{"string", "generalizedtime", "2026-01-02T03:04:05+01:00", "20260102020405Z", ""},
+		{"fail/utctime-2050", "utctime", time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC), "", "error formatting time: year 2050 cannot be represented as utctime, it must be between 1950 and 2049"},
+		{"fail/utctime-1949", "utctime", time.Date(1949, 12, 31, 23, 59, 59, 0, time.UTC), "", "error formatting time: year 1949 cannot be represented as utctime, it must be between 1950 and 2049"},
+		{"fail/format", "utc-time", now, "", `error formatting time: unknown time format "utc-time"`},
+		{"fail/empty-format", "", now, "", `error formatting time: unknown time format ""`},
+		{"fail/string", "utctime", "2026-01-02", "", `error parsing time: parsing time "2026-01-02" as "2006-01-02T15:04:05Z07:00": cannot parse "" as "T"`},
+		{"fail/nil-pointer", "utctime", (*time.Time)(nil), "", "error formatting time: time is nil"},
+		{"fail/type", "utctime", 123, "", "error formatting time: unsupported time 123 of type int"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := formatTime(tt.format, tt.t)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_parseTime(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		s       string
+		want    time.Time
+		wantErr string
+	}{
+		{"rfc3339", "rfc3339", "2026-01-02T03:04:05+01:00", time.Date(2026, 1, 2, 2, 4, 5, 0, time.UTC), ""},
+		{"utctime", "utctime", "260102030405Z", time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), ""},
+		{"utctime/2049", "utctime", "491231235959Z", time.Date(2049, 12, 31, 23, 59, 59, 0, time.UTC), ""},
+		{"utctime/1950", "utctime", "500101000000Z", time.Date(1950, 1, 1, 0, 0, 0, 0, time.UTC), ""},
+		{"utctime/1999", "utctime", "991231235959Z", time.Date(1999, 12, 31, 23, 59, 59, 0, time.UTC), ""},
+		{"utctime/offset", "utctime", "260102030405+0100", time.Date(2026, 1, 2, 2, 4, 5, 0, time.UTC), ""},
+		{"generalizedtime", "generalizedtime", "20260102030405Z", time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), ""},
+		{"layout", "2006-01-02", "2026-01-02", time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC), ""},
+		{"fail/utctime", "utctime", "2026-01-02T03:04:05Z", time.Time{}, `error parsing time: parsing time "2026-01-02T03:04:05Z": month out of range`},
+		{"fail/format", "iso", "2026", time.Time{}, `error parsing time: unknown time format "iso"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTime(tt.format, tt.s)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, tt.want.Equal(got), "want %s, got %s", tt.want, got)
+		})
+	}
+}
+
+func Test_toInt64(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       interface{}
+		want    int64
+		wantErr string
+	}{
+		{"int", 42, 42, ""},
+		{"negative", int8(-3), -3, ""},
+		{"uint", uint32(7), 7, ""},
+		{"float", 30.0, 30, ""},
+		{"negative-float", -2.0, -2, ""},
+		{"min-float", float64(math.MinInt64), math.MinInt64, ""},
+		{"fail/fraction", 1.5, 0, "1.5 is not an integer"},
+		{"fail/uint-overflow", uint64(math.MaxUint64), 0, "integer overflow: 18446744073709551615"},
+		{"fail/float-overflow", 1e19, 0, "integer overflow: 1e+19"},
+		{"fail/nan", math.NaN(), 0, "NaN is not an integer"},
+		{"fail/string", "1", 0, "1 of type string is not an integer"},
+		{"fail/nil", nil, 0, "<nil> of type <nil> is not an integer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toInt64(tt.v)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_arithmetic(t *testing.T) {
+	type result struct {
+		n   int64
+		err error
+	}
+	call := func(n int64, err error) result {
+		return result{n, err}
+	}
+	ok := func(n int64) result {
+		return result{n: n}
+	}
+	fail := func(msg string) result {
+		return result{err: errors.New(msg)}
+	}
+
+	tests := []struct {
+		name string
+		got  result
+		want result
+	}{
+		{"add", call(addInt(1, 2.0, -4)), ok(-1)},
+		{"add/none", call(addInt()), ok(0)},
+		{"add/overflow", call(addInt(int64(math.MaxInt64), 1)), fail("integer overflow: 9223372036854775807 + 1")},
+		{"add/underflow", call(addInt(int64(math.MinInt64), -1)), fail("integer overflow: -9223372036854775808 + -1")},
+		{"add/fraction", call(addInt(1, 0.5)), fail("0.5 is not an integer")},
+		{"sub", call(subInt(-3, 4)), ok(-7)},
+		{"sub/negative", call(subInt(-3, -4)), ok(1)},
+		{"sub/overflow", call(subInt(int64(math.MaxInt64), -1)), fail("integer overflow: 9223372036854775807 - -1")},
+		{"sub/underflow", call(subInt(int64(math.MinInt64), 1)), fail("integer overflow: -9223372036854775808 - 1")},
+		{"mul", call(mulInt(-3, 4, 2.0)), ok(-24)},
+		{"mul/zero", call(mulInt(0, int64(math.MaxInt64), 2)), ok(0)},
+		{"mul/overflow", call(mulInt(int64(math.MaxInt64), 2)), fail("integer overflow: 9223372036854775807 * 2")},
+		{"mul/min", call(mulInt(-1, int64(math.MinInt64))), fail("integer overflow: -1 * -9223372036854775808")},
+		{"div", call(divInt(-7, 2)), ok(-3)},
+		{"div/zero", call(divInt(7, 0)), fail("integer division by zero: 7 / 0")},
+		{"div/overflow", call(divInt(int64(math.MinInt64), -1)), fail("integer overflow: -9223372036854775808 / -1")},
+		{"mod", call(modInt(7, 3)), ok(1)},
+		{"mod/negative", call(modInt(-7, 3)), ok(-1)},
+		{"mod/negative-divisor", call(modInt(7, -3)), ok(1)},
+		{"mod/zero", call(modInt(-7, 0.0)), fail("integer division by zero: -7 mod 0")},
+		{"mod/string", call(modInt("7", 2)), fail("7 of type string is not an integer")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.want.err != nil {
+				assert.EqualError(t, tt.got.err, tt.want.err.Error())
+				return
+			}
+			assert.NoError(t, tt.got.err)
+			assert.Equal(t, tt.want.n, tt.got.n)
+		})
+	}
+}
+
+func Test_stringFuncs(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(string) string
+		s    string
+		want string
+	}{
+		{"upper", upperCase, "us", "US"},
+		{"upper/multibyte", upperCase, "straße ñandú", "STRASSE ÑANDÚ"},
+		{"upper/dotless", upperCase, "ıi", "II"},
+		{"upper/empty", upperCase, "", ""},
+		{"lower", lowerCase, "Foo.COM", "foo.com"},
+		{"lower/multibyte", lowerCase, "ÑANDÚ ΣΊΣΥΦΟΣ", "ñandú σίσυφος"},
+		{"lower/dotted", lowerCase, "İ", "i\u0307"},
+		{"lower/empty", lowerCase, "", ""},
+		{"title", titleCase, "acme corp.", "Acme Corp."},
+		{"title/upper", titleCase, "ACME CORP.", "Acme Corp."},
+		{"title/multibyte", titleCase, "ñandú élan", "Ñandú Élan"},
+		{"title/apostrophe", titleCase, "o'neil", "O'neil"},
+		{"title/empty", titleCase, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.fn(tt.s))
+		})
+	}
+}
+
+func Test_hasElem(t *testing.T) {
+	tests := []struct {
+		name     string
+		needle   interface{}
+		haystack interface{}
+		want     bool
+	}{
+		{"string", "serverAuth", []interface{}{"clientAuth", "serverAuth"}, true},
+		{"string-slice", "serverAuth", []string{"serverAuth"}, true},
+		{"array", 2, [2]int{1, 2}, true},
+		{"not-found", "codeSigning", []interface{}{"clientAuth", "serverAuth"}, false},
+		{"case-sensitive", "serverauth", []interface{}{"serverAuth"}, false},
+		{"int-float", 1, []interface{}{float64(1), float64(2)}, true},
+		{"float-string", float64(1), []interface{}{"1"}, true},
+		{"bool", true, []interface{}{"a", true}, true},
+		{"mixed", "a", []interface{}{1, nil, map[string]interface{}{}, "a"}, true},
+		{"nil-element", nil, []interface{}{"a", nil}, true},
+		{"nil-not-found", nil, []interface{}{"a", ""}, false},
+		{"map-element", map[string]interface{}{"a": "b"}, []interface{}{map[string]interface{}{"a": "b"}}, true},
+		{"nil-haystack", "a", nil, false},
+		{"nil-slice", "a", []string(nil), false},
+		{"not-a-list", "a", "abc", false},
+		{"map-haystack", "a", map[string]interface{}{"a": 1}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, hasElem(tt.needle, tt.haystack))
+		})
+	}
+}
+
+func Test_hasMapKey(t *testing.T) {
+	tests := []struct {
+		name string
+		m    interface{}
+		key  interface{}
+		want bool
+	}{
+		{"ok", map[string]interface{}{"permit-pty": ""}, "permit-pty", true},
+		{"string-map", map[string]string{"a": "b"}, "a", true},
+		{"not-found", map[string]interface{}{"permit-pty": ""}, "permit-X11-forwarding", false},
+		{"nil-value", map[string]interface{}{"a": nil}, "a", true},
+		{"int-key", map[int]bool{1: true}, "1", true},
+		{"nil-map", map[string]interface{}(nil), "a", false},
+		{"nil", nil, "a", false},
+		{"not-a-map", []interface{}{"a"}, "a", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, hasMapKey(tt.m, tt.key))
+		})
+	}
+}
+
+func Test_merge(t *testing.T) {
+	type obj = map[string]interface{}
+	tests := []struct {
+		name      string
+		base      interface{}
+		overrides []interface{}
+		want      obj
+		wantErr   string
+	}{
+		{"ok", obj{"a": 1.0, "b": 2.0}, []interface{}{obj{"b": 3.0, "c": 4.0}}, obj{"a": 1.0, "b": 3.0, "c": 4.0}, ""},
+		{"ok/nested", obj{"subject": obj{"commonName": "foo", "organization": "Acme", "extra": obj{"a": 1.0}}, "isCA": false},
+			[]interface{}{obj{"subject": obj{"organization": "Smallstep", "extra": obj{"b": 2.0}}}},
+			obj{"subject": obj{"commonName": "foo", "organization": "Smallstep", "extra": obj{"a": 1.0, "b": 2.0}}, "isCA": false}, ""},
+		{"ok/arrays-replaced", obj{"keyUsage": []interface{}{"digitalSignature", "keyEncipherment"}}, []interface{}{obj{"keyUsage": []interface{}{"certSign"}}}, obj{"keyUsage": []interface{}{"certSign"}}, ""},
+		{"ok/object-replaced", obj{"subject": obj{"commonName": "foo"}}, []interface{}{obj{"subject": "foo"}}, obj{"subject": "foo"}, ""},
+		{"ok/scalar-replaced", obj{"subject": "foo"}, []interface{}{obj{"subject": obj{"commonName": "foo"}}}, obj{"subject": obj{"commonName": "foo"}}, ""},
+		{"ok/null", obj{"a": 1.0, "b": obj{"c": 2.0}}, []interface{}{obj{"a": nil, "b": nil}}, obj{"a": nil, "b": nil}, ""},
+		{"ok/many", obj{"a": 1.0}, []interface{}{obj{"a": 2.0, "b": 2.0}, nil, obj{"b": 3.0}}, obj{"a": 2.0, "b": 3.0}, ""},
+		{"ok/nil-base", nil, []interface{}{obj{"a": 1.0}}, obj{"a": 1.0}, ""},
+		{"ok/no-overrides", obj{"a": obj{"b": 1.0}}, nil, obj{"a": obj{"b": 1.0}}, ""},
+		{"ok/nil", nil, nil, obj{}, ""},
+		{"fail/base", []interface{}{1.0}, []interface{}{obj{}}, nil, "error merging: argument 1 of type []interface {} is not an object"},
+		{"fail/override", obj{}, []interface{}{obj{}, "foo"}, nil, "error merging: argument 3 of type string is not an object"},
+		{"fail/string-map", obj{}, []interface{}{map[string]string{"a": "b"}}, nil, "error merging: argument 2 of type map[string]string is not an object"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := merge(tt.base, tt.overrides...)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	// The arguments are not modified.
+	base := obj{"subject": obj{"commonName": "foo", "extra": obj{"a": 1.0}}}
+	override := obj{"subject": obj{"extra": obj{"b": 2.0}}}
+	got, err := merge(base, override)
+	require.NoError(t, err)
+	got["subject"].(obj)["extra"].(obj)["c"] = 3.0
+	assert.Equal(t, obj{"subject": obj{"commonName": "foo", "extra": obj{"a": 1.0}}}, base)
+	assert.Equal(t, obj{"subject": obj{"extra": obj{"b": 2.0}}}, override)
+}
+
+func Test_object(t *testing.T) {
+	nested, err := object("cn", "foo", "o", "")
+	assert.NoError(t, err)
+	empty, err := object("cn", "")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		pairs   []interface{}
+		want    rawJSON
+		wantErr string
+	}{
+		{"ok", []interface{}{"cn", "foo", "org", "Acme"}, `{"cn":"foo","org":"Acme"}`, ""},
+		{"ok/order", []interface{}{"z", 1, "a", 2}, `{"z":1,"a":2}`, ""},
+		{"ok/omit", []interface{}{"cn", "", "sans", []interface{}{}, "ext", map[string]interface{}{}, "o", nil, "c", "US"}, `{"c":"US"}`, ""},
+		{"ok/keep", []interface{}{"isCA", false, "maxPathLen", 0}, `{"isCA":false,"maxPathLen":0}`, ""},
+		{"ok/null", []interface{}{"a", null()}, `{"a":null}`, ""},
+		{"ok/nested", []interface{}{"subject", nested, "issuer", empty}, `{"subject":{"cn":"foo"}}`, ""},
+		{"ok/escape", []interface{}{"a\"b", "<x>\n"}, `{"a\"b":"\u003cx\u003e\n"}`, ""},
+		{"ok/empty", nil, `{}`, ""},
+		{"fail/odd", []interface{}{"cn"}, "", "error creating object: odd number of arguments"},
+		{"fail/key", []interface{}{1, "foo"}, "", "error creating object: key 1 of type int is not a string"},
+		{"fail/duplicate", []interface{}{"cn", "foo", "cn", "bar"}, "", `error creating object: duplicate key "cn"`},
+		{"fail/marshal", []interface{}{"ch", make(chan int)}, "", `error creating object: key "ch": json: unsupported type: chan int`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := object(tt.pairs...)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.True(t, json.Valid([]byte(got)))
+		})
+	}
+}
+
+func Test_lookup(t *testing.T) {
+	data := map[string]interface{}{
+		"subject": map[string]interface{}{
+			"names": []interface{}{
+				map[string]interface{}{"type": "2.5.4.3", "value": "foo"},
+			},
+		},
+		"a/b":   "slash",
+		"m~n":   "tilde",
+		"~1":    "escaped",
+		"":      "empty",
+		"isCA":  false,
+		"typed": map[string]string{"k": "v"},
+		"array": [2]int{1, 2},
+	}
+	tests := []struct {
+		name    string
+		pointer string
+		want    interface{}
+		wantErr string
+	}{
+		{"ok", "/subject/names/0/value", "foo", ""},
+		{"ok/root", "", data, ""},
+		{"ok/slash", "/a~1b", "slash", ""},
+		{"ok/tilde", "/m~0n", "tilde", ""},
+		{"ok/escaped-escape", "/~01", "escaped", ""},
+		{"ok/empty-key", "/", "empty", ""},
+		{"ok/false", "/isCA", false, ""},
+		{"ok/typed-map", "/typed/k", "v", ""},
+		{"ok/array", "/array/1", 2, ""},
+		{"missing/key", "/issuer", nil, ""},
+		{"missing/intermediate", "/issuer/names/0/value", nil, ""},
+		{"missing/index", "/subject/names/1/value", nil, ""},
+		{"missing/dash", "/subject/names/-", nil, ""},
+		{"missing/leading-zero", "/subject/names/00", nil, ""},
+		{"missing/not-index", "/subject/names/value", nil, ""},
+		{"missing/scalar", "/isCA/value", nil, ""},
+		{"missing/unescaped", "/a/b", nil, ""},
+		{"fail/relative", "subject", nil, `error looking up "subject": pointer must be empty or start with '/'`},
+		{"fail/escape", "/m~2n", nil, `error looking up "/m~2n": invalid escape in "m~2n"`},
+		{"fail/trailing-tilde", "/subject~", nil, `error looking up "/subject~": invalid escape in "subject~"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := lookup(tt.pointer, data)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	got, err := lookup("/a", nil)
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func Test_randString(t *testing.T) {
+	// 0xf8 to 0xff are discarded with 62 characters.
+	seq := bytes.Repeat([]byte{0, 1, 61, 62, 0xf7, 0xf8, 0xff}, 2)
+	tests := []struct {
+		name    string
+		r       io.Reader
+		n       interface{}
+		chars   string
+		want    string
+		wantErr string
+	}{
+		{"hex", bytes.NewReader([]byte{0, 1, 15, 16, 255}), 5, hexChars, "01f0f", ""},
+		{"alphanum", bytes.NewReader(seq), 8, alphaNumChars, "AB9A9AB9", ""},
+		{"float", bytes.NewReader([]byte{10}), 1.0, hexChars, "a", ""},
+		{"zero", bytes.NewReader(nil), 0, hexChars, "", ""},
+		{"max", rand.Reader, maxRandLength, hexChars, "", ""},
+		{"fail/negative", rand.Reader, -1, hexChars, "", "error generating random string: -1 characters is negative"},
+		{"fail/too-large", rand.Reader, maxRandLength + 1, hexChars, "", "error generating random string: 1025 characters exceeds the maximum of 1024"},
+		{"fail/fraction", rand.Reader, 1.5, hexChars, "", "error generating random string: 1.5 is not an integer"},
+		{"fail/read", bytes.NewReader([]byte{1}), 2, hexChars, "", "error generating random string: unexpected EOF"},
+		{"fail/discarded", bytes.NewReader([]byte{0xff, 0xff}), 2, alphaNumChars, "", "error generating random string: EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := randString(tt.r, tt.n, tt.chars)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			if tt.want == "" {
+				n, _ := toInt64(tt.n)
+				assert.Len(t, got, int(n))
+				assert.Regexp(t, "^[0-9a-f]*$", got)
+				return
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_hashFuncs(t *testing.T) {
+	const abc256 = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	assert.Equal(t, abc256, sha256Sum("abc"))
+	assert.Equal(t, abc256, sha256Sum([]byte("abc")))
+	assert.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", sha256Sum(nil))
+	assert.Equal(t, sha256Sum("123"), sha256Sum(123))
+	assert.Equal(t, "a9993e364706816aba3e25717850c26c9cd0d89d", sha1Sum("abc"))
+	assert.Equal(t, "da39a3ee5e6b4b0d3255bfef95601890afd80709", sha1Sum(nil))
+}
+
+func Test_keyFingerprint(t *testing.T) {
+	errNotFound := errors.New("key not found")
+	resolve := func(name string) ([]byte, error) {
+		switch name {
+		case "issuer":
+			return []byte("abc"), nil
+		case "empty":
+			return nil, nil
+		default:
+			return nil, errNotFound
+		}
+	}
+	tests := []struct {
+		name     string
+		resolve  func(string) ([]byte, error)
+		key      string
+		encoding []string
+		want     string
+		wantErr  string
+	}{
+		{"ok", resolve, "issuer", nil, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", ""},
+		{"ok/encoding", resolve, "issuer", []string{"base64"}, "ungWv48Bz+pBQUDeXa4iI7ADYaOWF3qctBD/YfIAFa0=", ""},
+		{"fail/unknown", resolve, "other", nil, "", `error resolving key "other": key not found`},
+		{"fail/empty", resolve, "empty", nil, "", `error resolving key "empty": key is empty`},
+		{"fail/no-resolver", nil, "issuer", nil, "", `error creating fingerprint of key "issuer": keys cannot be resolved without WithKeyResolver`},
+		{"fail/encoding", resolve, "issuer", []string{"sha512"}, "", `error creating fingerprint: unsupported encoding "sha512"`},
+		{"fail/args", resolve, "issuer", []string{"hex", "hex"}, "", `error creating fingerprint of key "issuer": expected a name and an optional encoding, not 3 arguments`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := keyFingerprint(tt.resolve, tt.key, tt.encoding...)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := keyFingerprint(resolve, "other")
+	assert.ErrorIs(t, err, errNotFound)
+}
+
+func Test_fingerprintSum(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding string
+		v        interface{}
+		want     string
+		wantErr  string
+	}{
+		{"hex", "hex", "abc", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", ""},
+		{"colon", "colon", "abc", "ba:78:16:bf:8f:01:cf:ea:41:41:40:de:5d:ae:22:23:b0:03:61:a3:96:17:7a:9c:b4:10:ff:61:f2:00:15:ad", ""},
+		{"base64", "base64", "abc", "ungWv48Bz+pBQUDeXa4iI7ADYaOWF3qctBD/YfIAFa0=", ""},
+		{"base64url", "base64url", "abc", "ungWv48Bz-pBQUDeXa4iI7ADYaOWF3qctBD_YfIAFa0=", ""},
+		{"base64raw", "base64raw", "abc", "ungWv48Bz+pBQUDeXa4iI7ADYaOWF3qctBD/YfIAFa0", ""},
+		{"base64rawurl", "base64rawurl", []byte("abc"), "ungWv48Bz-pBQUDeXa4iI7ADYaOWF3qctBD_YfIAFa0", ""},
+		{"fail/encoding", "HEX", "abc", "", `error creating fingerprint: unsupported encoding "HEX"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := fingerprintSum(tt.encoding, tt.v)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	emoji, err := fingerprintSum("emoji", "abc")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, emoji)
+}
+
+func Test_keyIDFuncs(t *testing.T) {
+	tests := []struct {
+		name       string
+		v          interface{}
+		want       string
+		wantBase32 string
+		wantErr    string
+	}{
+		{"ok/bytes", []byte{0x1a, 0x2b, 0x3c}, "1A:2B:3C", "DIVTY===", ""},
+		{"ok/hex", "1a2b3c", "1A:2B:3C", "DIVTY===", ""},
+		{"ok/grouped", "1a:2B:3c", "1A:2B:3C", "DIVTY===", ""},
+		{"ok/one-byte", "00", "00", "AA======", ""},
+		{"ok/sha1", sha1Sum("abc"), "A9:99:3E:36:47:06:81:6A:BA:3E:25:71:78:50:C2:6C:9C:D0:D8:9D", "VGMT4NSHA2AWVOR6EVYXQUGCNSONBWE5", ""},
+		{"ok/max", strings.Repeat("ff", maxKeyIDLength), strings.TrimSuffix(strings.Repeat("FF:", maxKeyIDLength), ":"), strings.Repeat("7", 102) + "Y=", ""},
+		{"fail/odd", "1a2b3", "", "", `error decoding key id: "1a2b3" has an odd number of hex digits`},
+		{"fail/hex", "1a2g", "", "", `error decoding key id: "1a2g" is not hex encoded`},
+		{"fail/groups", "1a:2b3c", "", "", `error decoding key id: "1a:2b3c" has groups that are not a single byte`},
+		{"fail/trailing-colon", "1a:", "", "", `error decoding key id: "1a:" has groups that are not a single byte`},
+		{"fail/empty", "", "", "", "error decoding key id: key id is empty"},
+		{"fail/empty-bytes", []byte{}, "", "", "error decoding key id: key id is empty"},
+		{"fail/too-long", strings.Repeat("ff", maxKeyIDLength+1), "", "", "error decoding key id: 65 bytes exceeds the maximum of 64"},
+		{"fail/type", 123, "", "", "error decoding key id: unsupported type int"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := hexGroup(tt.v)
+			got32, err32 := base32Encode(tt.v)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				assert.EqualError(t, err32, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.NoError(t, err32)
+			assert.Equal(t, tt.wantBase32, got32)
+		})
+	}
+}
+
+func Test_indentLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		spaces  interface{}
+		s       string
+		want    string
+		wantErr string
+	}{
+		{"ok", 2, "a\nb", "  a\n  b", ""},
+		{"ok/zero", 0, "a\nb", "a\nb", ""},
+		{"ok/float", float64(4), "a", "    a", ""},
+		{"ok/trailing-newline", 2, "a\n", "  a\n  ", ""},
+		{"ok/empty-line", 2, "a\n\nb", "  a\n  \n  b", ""},
+		{"ok/empty", 3, "", "   ", ""},
+		{"fail/negative", -1, "a", "", "error indenting: -1 spaces is negative"},
+		{"fail/fraction", 1.5, "a", "", "error indenting: 1.5 is not an integer"},
+		{"fail/string", "2", "a", "", "error indenting: 2 of type string is not an integer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := indentLines(tt.spaces, tt.s)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				_, err = nindentLines(tt.spaces, tt.s)
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			got, err = nindentLines(tt.spaces, tt.s)
+			assert.NoError(t, err)
+			assert.Equal(t, "\n"+tt.want, got)
+		})
+	}
+}
+
+func Test_basicConstraints(t *testing.T) {
+	tests := []struct {
+		name    string
+		isCA    interface{}
+		pathLen []interface{}
+		want    rawJSON
+		wantErr string
+	}{
+		{"ok/ca", true, nil, `{"isCA":true,"maxPathLen":-1}`, ""},
+		{"ok/ca-nil", true, []interface{}{nil}, `{"isCA":true,"maxPathLen":-1}`, ""},
+		{"ok/ca-zero", true, []interface{}{0}, `{"isCA":true,"maxPathLen":0}`, ""},
+		{"ok/ca-float", true, []interface{}{1.0}, `{"isCA":true,"maxPathLen":1}`, ""},
+		{"ok/leaf", false, nil, `{"isCA":false}`, ""},
+		{"ok/leaf-nil", false, []interface{}{nil}, `{"isCA":false}`, ""},
+		{"fail/leaf-pathLen", false, []interface{}{0}, "", "error creating basicConstraints: pathLen cannot be set if isCA is false"},
+		{"fail/negative", true, []interface{}{-1}, "", "error creating basicConstraints: pathLen -1 must be between 0 and 2147483647"},
+		{"fail/large", true, []interface{}{int64(1) << 40}, "", "error creating basicConstraints: pathLen 1099511627776 must be between 0 and 2147483647"},
+		{"fail/fraction", true, []interface{}{1.5}, "", "error creating basicConstraints: invalid pathLen: 1.5 is not an integer"},
+		{"fail/string", true, []interface{}{"1"}, "", "error creating basicConstraints: invalid pathLen: 1 of type string is not an integer"},
+		{"fail/isCA", "true", nil, "", "error creating basicConstraints: isCA true of type string is not a boolean"},
+		{"fail/args", true, []interface{}{1, 2}, "", "error creating basicConstraints: expected isCA and an optional pathLen, not 3 arguments"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := basicConstraints(tt.isCA, tt.pathLen...)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_number(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       interface{}
+		want    rawJSON
+		wantErr string
+	}{
+		{"ok/string", "42", "42", ""},
+		{"ok/zero", "0", "0", ""},
+		{"ok/negative", "-1.5", "-1.5", ""},
+		{"ok/exponent", "1.5E+3", "1.5E+3", ""},
+		{"ok/large", "18446744073709551617", "18446744073709551617", ""},
+		{"ok/json.Number", json.Number("0.25"), "0.25", ""},
+		{"ok/int", 7, "7", ""},
+		{"ok/uint64", uint64(math.MaxUint64), "18446744073709551615", ""},
+		{"ok/float", 2.0, "2", ""},
+		{"ok/float-large", 1e21, "1e+21", ""},
+		{"ok/float32", float32(0.1), "0.1", ""},
+		{"fail/empty", "", "", `error creating number: "" is not a JSON number`},
+		{"fail/leading-zeros", "007", "", `error creating number: "007" has leading zeros`},
+		{"fail/negative-leading-zeros", "-00.5", "", `error creating number: "-00.5" has leading zeros`},
+		{"fail/space", " 1", "", `error creating number: " 1" is not a JSON number`},
+		{"fail/fraction", ".5", "", `error creating number: ".5" is not a JSON number`},
+		{"fail/exponent", "1e", "", `error creating number: "1e" is not a JSON number`},
+		{"fail/hex", "0x10", "", `error creating number: "0x10" is not a JSON number`},
+		{"fail/NaN", "NaN", "", `error creating number: "NaN" is not a JSON number`},
+		{"fail/NaN-float", math.NaN(), "", "error creating number: NaN is not a JSON number"},
+		{"fail/Inf", math.Inf(-1), "", "error creating number: -Inf is not a JSON number"},
+		{"fail/nil", nil, "", "error creating number: value is missing"},
+		{"fail/bool", true, "", "error creating number: true of type bool is not a number"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := number(tt.v)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_serialNumber(t *testing.T) {
+	max := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 159), big.NewInt(1))
+	tests := []struct {
+		name    string
+		format  string
+		v       interface{}
+		want    string
+		wantErr string
+	}{
+		{"ok/decimal", "decimal", 1234, "1234", ""},
+		{"ok/hex", "hex", 10, "0x0a", ""},
+		{"ok/hex-padded", "HEX", "0xabc", "0x0abc", ""},
+		{"ok/float", "decimal", 1234.0, "1234", ""},
+		{"ok/string", "hex", "1311768467294899695", "0x1234567890abcdef", ""},
+		{"ok/big", "decimal", big.NewInt(42), "42", ""},
+		{"ok/max", "hex", max, "0x7fffffffffffffffffffffffffffffffffffffff", ""},
+		{"fail/zero", "decimal", 0, "", "error formatting serial number: 0 is not positive"},
+		{"fail/negative", "hex", "-10", "", "error formatting serial number: -10 is not positive"},
+		{"fail/too-long", "hex", new(big.Int).Lsh(big.NewInt(1), 159), "", "error formatting serial number: 730750818665451459101842416358141509827966271488 is longer than 20 bytes"},
+		{"fail/inexact", "decimal", 1e20, "", "error formatting serial number: 1e+20 cannot be represented exactly as a number, use a string"},
+		{"fail/fraction", "decimal", 1.5, "", "error formatting serial number: 1.5 is not an integer"},
+		{"fail/string", "decimal", "0xfoo", "", `error formatting serial number: "0xfoo" is not a decimal or hex integer`},
+		{"fail/plus", "decimal", "+1", "", `error formatting serial number: "+1" is not a decimal or hex integer`},
+		{"fail/nil", "decimal", nil, "", "error formatting serial number: <nil> of type <nil> is not an integer"},
+		{"fail/nil-big", "decimal", (*big.Int)(nil), "", "error formatting serial number: serial number is empty"},
+		{"fail/format", "base64", 1, "", `error formatting serial number: unknown format "base64", use decimal or hex`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := serialNumber(tt.format, tt.v)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package templates
+
+import (
+	"errors"
+	htmltemplate "html/template"
+	"io"
+	"text/template"
+)
+
+// htmlExcludedFuncs are the functions of GetFuncMap that are not available to
+// HTML templates. They render JSON fragments that are embedded as they are in
+// the output of a certificate template, and "include" renders files that are
+// JSON templates, so html/template would escape their output as text.
+var htmlExcludedFuncs = map[string]bool{
+	"include": true, "null": true, "object": true, "dnObject": true,
+	"basicConstraints": true,
+}
+
+// ValidateHTMLTemplate validates that a template written for html/template,
+// like a page showing the details of a certificate, can be parsed and
+// contextually escaped. The output is not validated, so unlike
+// ValidateTemplate the template doesn't need to render JSON.
+//
+// The template can use the functions returned by GetFuncMap, configured with
+// the options like in ParseTemplate, except the ones that render JSON
+// fragments, like "object", and "include". The use of an unknown function, a
+// template with the name of a function, a template that cannot be escaped,
+// like one with an {{ if }} whose branches end in different contexts, and the
+// errors reported by ParseTemplate for the options WithDelims,
+// WithDeniedFuncs and WithFuncs, are returned as a ParseError with the line
+// and column of the error, if they are known.
+func ValidateHTMLTemplate(text []byte, opts ...Option) error {
+	if len(text) == 0 {
+		return nil
+	}
+
+	o := newOptions(opts)
+	if err := checkFuncs(o); err != nil {
+		return newTemplateError(ParseError, err, "error parsing template: "+err.Error())
+	}
+	left, right := o.delims()
+	if err := checkFuncMapVersion(text, left, right); err != nil {
+		return err
+	}
+
+	funcs := newFuncs(o).FuncMap()
+	for name := range htmlExcludedFuncs {
+		delete(funcs, name)
+	}
+	tmpl, err := htmltemplate.New("template").Delims(left, right).Funcs(htmltemplate.FuncMap(funcs)).Parse(string(text))
+	if err != nil {
+		return newParseError(err, text, left)
+	}
+
+	// html/template uses the same parse trees, so they are checked like the
+	// ones of a JSON template.
+	set := template.New(tmpl.Name())
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			if _, err := set.AddParseTree(t.Name(), t.Tree); err != nil {
+				return newTemplateError(ParseError, err, "error parsing template: "+err.Error())
+			}
+		}
+	}
+	if err := checkDeniedFuncs(set, text, o); err != nil {
+		return err
+	}
+	if err := checkReservedNames(set, []string{tmpl.Name()}, map[string][]byte{tmpl.Name(): text}, funcs, left); err != nil {
+		return err
+	}
+
+	// Templates are escaped before their first execution. The errors of the
+	// execution itself depend on the data and are ignored.
+	if tmpl.Tree == nil {
+		return nil
+	}
+	err = tmpl.Execute(io.Discard, nil)
+	var escapeErr *htmltemplate.Error
+	if !errors.As(err, &escapeErr) {
+		return nil
+	}
+	te := newTemplateError(ParseError, err, "error parsing template: "+err.Error())
+	if escapeErr.Node != nil {
+		te.setPosition(int(escapeErr.Node.Position()), text, nil)
+	} else if escapeErr.Line > 0 {
+		te.Line = escapeErr.Line
+	}
+	return te
+}
@@ -0,0 +1,55 @@
+package templates
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateHTMLTemplate(t *testing.T) {
+	tests := []struct {
+		name       string
+		text       string
+		opts       []Option
+		wantErr    string
+		wantLine   int
+		wantColumn int
+	}{
+		{"ok", `<p>{{ .CommonName | upper }}</p><script>var sans = {{ .SANs }}</script>`, nil, "", 0, 0},
+		{"ok/functions", `<dl><dt>Serial</dt><dd>{{ hexGroup .SerialNumber }}</dd><dd>{{ toJson . }}</dd></dl>`, nil, "", 0, 0},
+		{"ok/define", `{{ define "row" }}<tr><td>{{ . }}</td></tr>{{ end }}<table>{{ range .SANs }}{{ template "row" . }}{{ end }}</table>`, nil, "", 0, 0},
+		{"ok/exec-error", `<p>{{ fail "not executed" }}</p>`, nil, "", 0, 0},
+		{"ok/delims", `<p>[[ .CommonName ]]</p>`, []Option{WithDelims("[[", "]]")}, "", 0, 0},
+		{"ok/empty", ``, nil, "", 0, 0},
+		{"fail/parse", "<p>\n{{ if }}</p>", nil, "error parsing template: template: template:2: missing value for if", 2, 1},
+		{"fail/unknown-function", "<p>\n{{ foo .CommonName }}</p>", nil, `error parsing template: template: template:2: function "foo" not defined`, 2, 4},
+		{"fail/json-function", `<p>{{ object "cn" .CommonName }}</p>`, nil, `error parsing template: template: template:1: function "object" not defined`, 1, 7},
+		{"fail/include", `<p>{{ include "org.tmpl" . }}</p>`, nil, `error parsing template: template: template:1: function "include" not defined`, 1, 7},
+		{"fail/escape", "<p>\n{{ if .URL }}<a href=\"{{ end }}</p>", nil, "error parsing template: html/template:template:2:6: {{if}} branches end in different contexts", 2, 7},
+		{"fail/denied", `<p>{{ env "HOME" }}</p>`, []Option{WithDeniedFuncs("env")}, `error parsing template: template: template:1:7: function "env" is denied`, 1, 7},
+		{"fail/reserved", `{{ define "upper" }}{{ . }}{{ end }}<p>{{ template "upper" . }}</p>`, nil, `error parsing template: template: template:1: template "upper" has the name of a function`, 1, 1},
+		{"fail/requires", `{{/* requires funcmap >= 1000 */}}<p></p>`, nil, fmt.Sprintf("error parsing template: template requires newer func map: version 1000 required, have %d", FuncMapVersion()), 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateHTMLTemplate([]byte(tt.text), tt.opts...)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			// The messages of html/template end with its internal state.
+			if assert.Error(t, err) {
+				assert.True(t, strings.HasPrefix(err.Error(), tt.wantErr), err.Error())
+			}
+			var te *TemplateError
+			if assert.True(t, errors.As(err, &te)) {
+				assert.Equal(t, ParseError, te.Kind)
+				assert.Equal(t, tt.wantLine, te.Line)
+				assert.Equal(t, tt.wantColumn, te.Column)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package templates
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// maxDNSNameLength and maxDNSLabelLength are the maximum lengths in bytes of
+// the ASCII form of a DNS name and of each of its labels.
+const (
+	maxDNSNameLength  = 253
+	maxDNSLabelLength = 63
+)
+
+// isDNSName reports whether s is a valid DNS name, optionally with a "*."
+// wildcard prefix. Internationalized names are converted to their ASCII form
+// with the same profile used by x509util.SanitizeName, so "bücher.example" and
+// "xn--bcher-kva.example" are both valid. IP addresses are not DNS names.
+func isDNSName(s string) bool {
+	return validDNSName(s, true)
+}
+
+// validDNSName reports whether s is a valid DNS name like isDNSName, and, if
+// allowWildcard is false, rejects the names with a wildcard. Wildcards follow
+// the rules of RFC 6125, section 6.4.3: the wildcard must be the whole
+// leftmost label, so "a*.example.com" and "*.*.example.com" are not valid, and
+// it cannot cover a top-level domain, like "*.com", or an IP address.
+func validDNSName(s string, allowWildcard bool) bool {
+	if s == "" || net.ParseIP(s) != nil {
+		return false
+	}
+	name := s
+	if strings.HasPrefix(s, "*.") {
+		name = s[2:]
+		if !allowWildcard || !strings.Contains(name, ".") || net.ParseIP(name) != nil {
+			return false
+		}
+	}
+	if strings.Contains(name, "*") {
+		return false
+	}
+	name, err := idna.Lookup.ToASCII(name)
+	if err != nil || name == "" || len(name) > maxDNSNameLength {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > maxDNSLabelLength {
+			return false
+		}
+	}
+	return true
+}
+
+// isIP reports whether s is an IPv4 or IPv6 address.
+func isIP(s string) bool {
+	return parseIP(s) != nil
+}
+
+// isEmail reports whether s is an email address with a non-empty local part
+// and a domain that is a valid DNS name.
+func isEmail(s string) bool {
+	i := strings.LastIndexByte(s, '@')
+	if i <= 0 {
+		return false
+	}
+	domain := s[i+1:]
+	return !strings.HasPrefix(domain, "*.") && isDNSName(domain)
+}
+
+// dotAtomRegexp matches a local part of an email address that doesn't need to
+// be quoted, the dot-atom of RFC 5322.
+var dotAtomRegexp = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+/=?^_`{|}~-]+(\\.[A-Za-z0-9!#$%&'*+/=?^_`{|}~-]+)*$")
+
+// email parses the email address s with net/mail and returns it normalized to
+// be used in an rfc822Name: with the domain in lower case and in its ASCII
+// form, and with the local part quoted only if it's needed. Addresses with a
+// display name, a comment or angle brackets, like "Jane <jane@example.com>",
+// are not allowed, and neither are local parts that are not ASCII, because an
+// rfc822Name is an IA5String.
+func email(s string) (string, error) {
+	trimmed := strings.TrimSpace(s)
+	addr, err := mail.ParseAddress(trimmed)
+	if err != nil {
+		return "", fmt.Errorf("error parsing email %q: %w", s, err)
+	}
+	if addr.Name != "" || strings.ContainsAny(trimmed[:1], "<(") || strings.ContainsAny(trimmed[len(trimmed)-1:], ">)") {
+		return "", fmt.Errorf("error parsing email %q: display names, comments and angle brackets are not allowed", s)
+	}
+
+	i := strings.LastIndexByte(addr.Address, '@')
+	local, domain := addr.Address[:i], addr.Address[i+1:]
+	for _, r := range local {
+		if r >= utf8.RuneSelf {
+			return "", fmt.Errorf("error parsing email %q: internationalized local parts cannot be used in an rfc822Name", s)
+		}
+	}
+	if strings.HasPrefix(domain, "*.") || !isDNSName(domain) {
+		return "", fmt.Errorf("error parsing email %q: invalid domain %q", s, domain)
+	}
+	domain, _ = idna.Lookup.ToASCII(domain)
+
+	if !dotAtomRegexp.MatchString(local) {
+		local = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(local) + `"`
+	}
+	return local + "@" + strings.ToLower(domain), nil
+}
+
+// ip parses the IPv4 or IPv6 address s with net/netip and returns it in its
+// canonical form to be used in an iPAddress SAN, like "2001:db8::1" for
+// "2001:0DB8:0:0::1". IPv4-mapped IPv6 addresses are returned as IPv4
+// addresses, like they are encoded in a certificate. IPv4 addresses with
+// leading zeros, CIDR prefixes and zone identifiers are not allowed.
+func ip(s string) (string, error) {
+	trimmed := strings.TrimSpace(s)
+	if strings.Contains(trimmed, "/") {
+		return "", fmt.Errorf("error parsing ip %q: CIDR notation is not allowed", s)
+	}
+	addr, err := netip.ParseAddr(trimmed)
+	if err != nil {
+		return "", fmt.Errorf("error parsing ip %q: %w", s, err)
+	}
+	if addr.Zone() != "" {
+		return "", fmt.Errorf("error parsing ip %q: zone identifiers cannot be used in an iPAddress", s)
+	}
+	return addr.Unmap().String(), nil
+}
+
+// uri parses the URI s with net/url and returns it in its canonical form to be
+// used in a uniformResourceIdentifier SAN, like
+// "spiffe://example.org/ns/default" for "SPIFFE://Example.org/ns/default",
+// with the scheme and the host in lower case and the characters that need it
+// percent-encoded. The URI must be absolute, with a scheme, like the URIs
+// accepted by the "sans" function.
+func uri(s string) (string, error) {
+	trimmed := strings.TrimSpace(s)
+	u, err := url.Parse(trimmed)
+	if err != nil {
+		return "", fmt.Errorf("error parsing uri %q: %w", s, err)
+	}
+	if !u.IsAbs() {
+		return "", fmt.Errorf("error parsing uri %q: uri is not absolute, it has no scheme", s)
+	}
+	u.Host = strings.ToLower(u.Host)
+	return u.String(), nil
+}
+
+// isURI reports whether s is an absolute URI, the same URIs accepted by the
+// "sans" function.
+func isURI(s string) bool {
+	return parseURI(s) != nil
+}
+
+// parseIP returns the IP address in s, or nil if it's not valid.
+func parseIP(s string) net.IP {
+	return net.ParseIP(s)
+}
+
+// parseURI returns the absolute URI in s, or nil if it's not valid.
+func parseURI(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil || !u.IsAbs() {
+		return nil
+	}
+	return u
+}
+
+// identifierAssertion returns a function that returns its argument if it's
+// valid according to valid, or an error with the given description of the
+// identifier otherwise.
+func identifierAssertion(kind string, valid func(string) bool) func(s string) (string, error) {
+	return func(s string) (string, error) {
+		if !valid(s) {
+			return "", fmt.Errorf("invalid %s %q", kind, s)
+		}
+		return s, nil
+	}
+}
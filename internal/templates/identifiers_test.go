@@ -0,0 +1,308 @@
+package templates
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_isDNSName(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want bool
+	}{
+		{"ok", "example.com", true},
+		{"ok/single-label", "localhost", true},
+		{"ok/upper", "EXAMPLE.COM", true},
+		{"ok/wildcard", "*.example.com", true},
+		{"ok/wildcard-subdomain", "*.api.example.com", true},
+		{"ok/wildcard-idn", "*.bücher.example", true},
+		{"ok/wildcard-punycode", "*.xn--bcher-kva.example", true},
+		{"ok/idn", "bücher.example", true},
+		{"ok/idn-greek", "ΣΊΣΥΦΟΣ.gr", true},
+		{"ok/punycode", "xn--bcher-kva.example", true},
+		{"ok/max-label", strings.Repeat("a", 63) + ".com", true},
+		{"fail/empty", "", false},
+		{"fail/dot", ".", false},
+		{"fail/trailing-dot", "example.com.", false},
+		{"fail/empty-label", "a..example.com", false},
+		{"fail/inner-wildcard", "a.*.example.com", false},
+		{"fail/double-wildcard", "*.*.example.com", false},
+		{"fail/wildcard-tld", "*.*.com", false},
+		{"fail/partial-wildcard", "a*.com", false},
+		{"fail/partial-wildcard-prefix", "*a.example.com", false},
+		{"fail/partial-wildcard-middle", "f*o.example.com", false},
+		{"fail/wildcard-only", "*", false},
+		{"fail/wildcard-dot", "*.", false},
+		{"fail/wildcard-over-tld", "*.com", false},
+		{"fail/wildcard-trailing-dot", "*.example.com.", false},
+		{"fail/wildcard-empty-label", "*..example.com", false},
+		{"fail/wildcard-last", "example.*", false},
+		{"fail/wildcard-ip", "*.10.0.0.1", false},
+		{"fail/underscore", "a_b.example.com", false},
+		{"fail/leading-hyphen", "-a.example.com", false},
+		{"fail/invalid-punycode", "xn--a.example", false},
+		{"fail/empty-punycode", "xn--.com", false},
+		{"fail/zero-width-joiner", "a‍b.com", false},
+		{"fail/long-label", strings.Repeat("a", 64) + ".com", false},
+		{"fail/long-name", strings.Repeat(strings.Repeat("a", 63)+".", 4) + "com", false},
+		{"fail/ipv4", "127.0.0.1", false},
+		{"fail/ipv6", "::1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isDNSName(tt.s))
+		})
+	}
+}
+
+func Test_validDNSName(t *testing.T) {
+	tests := []struct {
+		s                        string
+		allowWildcard, rejectAll bool
+	}{
+		{"example.com", true, true},
+		{"*.example.com", true, false},
+		{"*.api.example.com", true, false},
+		{"*.*.example.com", false, false},
+		{"a*.example.com", false, false},
+		{"*.com", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			assert.Equal(t, tt.allowWildcard, validDNSName(tt.s, true))
+			assert.Equal(t, tt.rejectAll, validDNSName(tt.s, false))
+		})
+	}
+}
+
+func TestTemplate_isDNSName_wildcards(t *testing.T) {
+	text := []byte(`{"dnsNames": [{{ assertDNSName .Name | toJson }}], "wildcard": {{ isDNSName "*.example.com" }}}`)
+	tmpl, err := ParseTemplate(text)
+	require.NoError(t, err)
+	out, err := tmpl.Render([]byte(`{"Name": "*.example.com"}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"dnsNames": ["*.example.com"], "wildcard": true}`, string(out))
+	_, err = tmpl.Render([]byte(`{"Name": "*.*.example.com"}`))
+	assert.EqualError(t, err, `error executing template: invalid dns name "*.*.example.com"`)
+
+	tmpl, err = ParseTemplate(text, WithRejectWildcards(true))
+	require.NoError(t, err)
+	out, err = tmpl.Render([]byte(`{"Name": "www.example.com"}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"dnsNames": ["www.example.com"], "wildcard": false}`, string(out))
+	_, err = tmpl.Render([]byte(`{"Name": "*.example.com"}`))
+	assert.EqualError(t, err, `error executing template: invalid dns name "*.example.com"`)
+}
+
+func Test_isIP(t *testing.T) {
+	assert.True(t, isIP("127.0.0.1"))
+	assert.True(t, isIP("2001:db8::1"))
+	assert.True(t, isIP("::ffff:10.0.0.1"))
+	assert.False(t, isIP(""))
+	assert.False(t, isIP("10.0.0.256"))
+	assert.False(t, isIP("10.0.0.1/8"))
+	assert.False(t, isIP("example.com"))
+}
+
+func Test_isEmail(t *testing.T) {
+	assert.True(t, isEmail("jane@example.com"))
+	assert.True(t, isEmail("jane+certs@bücher.example"))
+	assert.True(t, isEmail("jane@xn--bcher-kva.example"))
+	assert.True(t, isEmail("\"jane@doe\"@example.com"))
+	assert.False(t, isEmail(""))
+	assert.False(t, isEmail("jane"))
+	assert.False(t, isEmail("@example.com"))
+	assert.False(t, isEmail("jane@"))
+	assert.False(t, isEmail("jane@*.example.com"))
+	assert.False(t, isEmail("jane@xn--a.example"))
+	assert.False(t, isEmail("jane@10.0.0.1"))
+}
+
+func Test_email(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    string
+		wantErr string
+	}{
+		{"ok", "jane@example.com", "jane@example.com", ""},
+		{"ok/domain-case", "Jane.Doe@Example.COM", "Jane.Doe@example.com", ""},
+		{"ok/spaces", " jane+certs@example.com\n", "jane+certs@example.com", ""},
+		{"ok/idn", "jane@Bücher.example", "jane@xn--bcher-kva.example", ""},
+		{"ok/quoted", `"jane doe"@example.com`, `"jane doe"@example.com`, ""},
+		{"ok/quoted-escapes", `"jane\"doe"@example.com`, `"jane\"doe"@example.com`, ""},
+		{"ok/unneeded-quotes", `"jane"@example.com`, "jane@example.com", ""},
+		{"fail/display-name", "Jane <jane@example.com>", "", `error parsing email "Jane <jane@example.com>": display names, comments and angle brackets are not allowed`},
+		{"fail/angle-brackets", "<jane@example.com>", "", `error parsing email "<jane@example.com>": display names, comments and angle brackets are not allowed`},
+		{"fail/comment", "jane@example.com (Jane)", "", `error parsing email "jane@example.com (Jane)": display names, comments and angle brackets are not allowed`},
+		{"fail/idn-local", "jöhn@example.com", "", `error parsing email "jöhn@example.com": internationalized local parts cannot be used in an rfc822Name`},
+		{"fail/ip-literal", "jane@[10.0.0.1]", "", `error parsing email "jane@[10.0.0.1]": invalid domain "[10.0.0.1]"`},
+		{"fail/wildcard", "jane@*.example.com", "", `error parsing email "jane@*.example.com": invalid domain "*.example.com"`},
+		{"fail/domain", "jane@bad_host.example.com", "", `error parsing email "jane@bad_host.example.com": invalid domain "bad_host.example.com"`},
+		{"fail/no-at", "jane", "", `error parsing email "jane": mail: missing '@' or angle-addr`},
+		{"fail/empty", "", "", `error parsing email "": mail: no address`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := email(tt.s)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.True(t, isEmail(got))
+		})
+	}
+}
+
+func Test_ip(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    string
+		wantErr string
+	}{
+		{"ok/ipv4", "10.0.0.1", "10.0.0.1", ""},
+		{"ok/trim", " 192.168.1.10\n", "192.168.1.10", ""},
+		{"ok/ipv6", "2001:db8::1", "2001:db8::1", ""},
+		{"ok/ipv6-zeros", "2001:0db8:0000:0000:0000:0000:0000:0001", "2001:db8::1", ""},
+		{"ok/ipv6-upper", "2001:DB8:0:0:1:0:0:1", "2001:db8::1:0:0:1", ""},
+		{"ok/ipv6-longest-zeros", "2001:0:0:1:0:0:0:1", "2001:0:0:1::1", ""},
+		{"ok/ipv6-single-zero", "2001:db8:0:1:1:1:1:1", "2001:db8:0:1:1:1:1:1", ""},
+		{"ok/ipv6-loopback", "0:0:0:0:0:0:0:1", "::1", ""},
+		{"ok/ipv4-mapped", "::ffff:10.0.0.1", "10.0.0.1", ""},
+		{"ok/ipv4-mapped-hex", "::FFFF:0A00:0001", "10.0.0.1", ""},
+		{"fail/ipv4-range", "10.0.0.256", "", `error parsing ip "10.0.0.256": ParseAddr("10.0.0.256"): IPv4 field has value >255`},
+		{"fail/ipv4-leading-zero", "10.0.0.01", "", `error parsing ip "10.0.0.01": ParseAddr("10.0.0.01"): IPv4 field has octet with leading zero`},
+		{"fail/ipv4-short", "10.1", "", `error parsing ip "10.1": ParseAddr("10.1"): IPv4 address too short`},
+		{"fail/cidr", "10.0.0.0/8", "", `error parsing ip "10.0.0.0/8": CIDR notation is not allowed`},
+		{"fail/cidr-ipv6", "2001:db8::/32", "", `error parsing ip "2001:db8::/32": CIDR notation is not allowed`},
+		{"fail/zone", "fe80::1%eth0", "", `error parsing ip "fe80::1%eth0": zone identifiers cannot be used in an iPAddress`},
+		{"fail/dns", "example.com", "", `error parsing ip "example.com": ParseAddr("example.com"): unexpected character (at "example.com")`},
+		{"fail/empty", "", "", `error parsing ip "": ParseAddr(""): unable to parse IP`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ip(tt.s)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.True(t, isIP(got))
+		})
+	}
+}
+
+func Test_isURI(t *testing.T) {
+	assert.True(t, isURI("https://example.com/path"))
+	assert.True(t, isURI("spiffe://example.org/workload"))
+	assert.True(t, isURI("urn:uuid:f81d4fae-7dec-11d0-a765-00a0c91e6bf6"))
+	assert.False(t, isURI(""))
+	assert.False(t, isURI("example.com/path"))
+	assert.False(t, isURI("/path"))
+	assert.False(t, isURI("https://exa mple.com"))
+}
+
+func Test_identifierAssertion(t *testing.T) {
+	assertDNSName := identifierAssertion("dns name", isDNSName)
+	got, err := assertDNSName("bücher.example")
+	assert.NoError(t, err)
+	assert.Equal(t, "bücher.example", got)
+
+	got, err = assertDNSName("a_b.example.com")
+	assert.EqualError(t, err, `invalid dns name "a_b.example.com"`)
+	assert.Empty(t, got)
+}
+
+func TestTemplate_identifierFuncs(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"sans": [{{ range $i, $h := .Hosts }}{{ if $i }}, {{ end }}{"type": {{ if isIP $h }}"ip"{{ else if isEmail $h }}"email"{{ else if isURI $h }}"uri"{{ else }}"dns"{{ end }}, "value": {{ if isIP $h }}{{ toJson $h }}{{ else if isEmail $h }}{{ assertEmail $h | toJson }}{{ else if isURI $h }}{{ assertURI $h | toJson }}{{ else }}{{ assertDNSName $h | toJson }}{{ end }}}{{ end }}]}`))
+	require.NoError(t, err)
+
+	out, err := tmpl.Render([]byte(`{"Hosts": ["bücher.example", "10.0.0.1", "jane@example.com", "spiffe://example.org/w"]}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"sans": [{"type": "dns", "value": "bücher.example"}, {"type": "ip", "value": "10.0.0.1"}, {"type": "email", "value": "jane@example.com"}, {"type": "uri", "value": "spiffe://example.org/w"}]}`, string(out))
+
+	_, err = tmpl.Render([]byte(`{"Hosts": ["example.com", "bad_host.example.com"]}`))
+	assert.EqualError(t, err, `error executing template: invalid dns name "bad_host.example.com"`)
+
+	tmpl, err = ParseTemplate([]byte(`{"ip": {{ .IP | assertIP | toJson }}}`))
+	require.NoError(t, err)
+	_, err = tmpl.Render([]byte(`{"IP": "10.0.0.300"}`))
+	assert.EqualError(t, err, `error executing template: invalid ip address "10.0.0.300"`)
+}
+
+func TestTemplate_email(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"emailAddresses": [{{ email .Contact | toJson }}]}`))
+	require.NoError(t, err)
+	out, err := tmpl.Render([]byte(`{"Contact": "Jane@Bücher.Example"}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"emailAddresses": ["Jane@xn--bcher-kva.example"]}`, string(out))
+
+	err = tmpl.Validate([]byte(`{"Contact": "Jane Doe <jane@example.com>"}`))
+	assert.EqualError(t, err, `error executing template: error parsing email "Jane Doe <jane@example.com>": display names, comments and angle brackets are not allowed`)
+}
+
+func TestTemplate_ip(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"ipAddresses": [{{ ip .Addr | toJson }}]}`))
+	require.NoError(t, err)
+	out, err := tmpl.Render([]byte(`{"Addr": "2001:0DB8::0001"}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"ipAddresses": ["2001:db8::1"]}`, string(out))
+
+	err = tmpl.Validate([]byte(`{"Addr": "10.0.0.0/24"}`))
+	assert.EqualError(t, err, `error executing template: error parsing ip "10.0.0.0/24": CIDR notation is not allowed`)
+}
+
+func Test_uri(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    string
+		wantErr string
+	}{
+		{"ok/spiffe", "spiffe://example.org/ns/default/sa/web", "spiffe://example.org/ns/default/sa/web", ""},
+		{"ok/spiffe-case", "SPIFFE://Example.ORG/ns/Default", "spiffe://example.org/ns/Default", ""},
+		{"ok/trim", " spiffe://example.org/web\n", "spiffe://example.org/web", ""},
+		{"ok/https", "https://ca.example.com:9000/acme/directory", "https://ca.example.com:9000/acme/directory", ""},
+		{"ok/escape", "https://example.com/a b", "https://example.com/a%20b", ""},
+		{"ok/file", "file:///etc/ssl/certs/root.pem", "file:///etc/ssl/certs/root.pem", ""},
+		{"ok/file-host", "file://Host/share/root.pem", "file://host/share/root.pem", ""},
+		{"ok/urn", "urn:uuid:f81d4fae-7dec-11d0-a765-00a0c91e6bf6", "urn:uuid:f81d4fae-7dec-11d0-a765-00a0c91e6bf6", ""},
+		{"fail/no-scheme", "example.org/ns/default", "", `error parsing uri "example.org/ns/default": uri is not absolute, it has no scheme`},
+		{"fail/relative", "//example.org/ns/default", "", `error parsing uri "//example.org/ns/default": uri is not absolute, it has no scheme`},
+		{"fail/path", "/etc/ssl/certs/root.pem", "", `error parsing uri "/etc/ssl/certs/root.pem": uri is not absolute, it has no scheme`},
+		{"fail/empty", "", "", `error parsing uri "": uri is not absolute, it has no scheme`},
+		{"fail/parse", "spiffe://example.org/%zz", "", `error parsing uri "spiffe://example.org/%zz": parse "spiffe://example.org/%zz": invalid URL escape "%zz"`},
+		{"fail/scheme", "1spiffe://example.org", "", `error parsing uri "1spiffe://example.org": parse "1spiffe://example.org": first path segment in URL cannot contain colon`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := uri(tt.s)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.True(t, isURI(got))
+		})
+	}
+}
+
+func TestTemplate_uri(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"uris": [{{ uri .SPIFFEID | toJson }}]}`))
+	require.NoError(t, err)
+	out, err := tmpl.Render([]byte(`{"SPIFFEID": "spiffe://Example.org/ns/default/sa/web"}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"uris": ["spiffe://example.org/ns/default/sa/web"]}`, string(out))
+
+	err = tmpl.Validate([]byte(`{"SPIFFEID": "example.org/ns/default/sa/web"}`))
+	assert.EqualError(t, err, `error executing template: error parsing uri "example.org/ns/default/sa/web": uri is not absolute, it has no scheme`)
+}
@@ -0,0 +1,91 @@
+package templates
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"text/template"
+)
+
+// maxIncludeDepth is the maximum number of nested includes.
+const maxIncludeDepth = 10
+
+// includer implements the template function "include" for the template, or the
+// included file, at the end of stack.
+type includer struct {
+	o          *options
+	setFailure func(code, msg string)
+	stack      []string
+}
+
+func (in *includer) fail(msg string) error {
+	in.setFailure("", msg)
+	return errors.New(msg)
+}
+
+// include renders the file name in the file system set with WithIncludeFS
+// using data as dot, or nil if no data is given. The file is parsed with the
+// same functions and options as the template that includes it.
+func (in *includer) include(name string, data ...interface{}) (string, error) {
+	if in.o.includeFS == nil {
+		return "", in.fail(fmt.Sprintf("error including %q: include is disabled", name))
+	}
+	if len(data) > 1 {
+		return "", in.fail(fmt.Sprintf("error including %q: too many arguments", name))
+	}
+	if !fs.ValidPath(name) {
+		return "", in.fail(fmt.Sprintf("error including %q: invalid file name", name))
+	}
+	for _, s := range in.stack {
+		if s == name {
+			return "", in.fail(fmt.Sprintf("error including %q: include cycle %s -> %s", name, strings.Join(in.stack, " -> "), name))
+		}
+	}
+	if len(in.stack) >= maxIncludeDepth {
+		return "", in.fail(fmt.Sprintf("error including %q: too many nested includes, the limit is %d", name, maxIncludeDepth))
+	}
+
+	text, err := fs.ReadFile(in.o.includeFS, name)
+	if err != nil {
+		return "", in.fail(fmt.Sprintf("error including %q: %v", name, err))
+	}
+
+	// The failures in the included file are reported with the name of the
+	// file, and its includes are resolved relative to it.
+	child := &includer{
+		o: in.o,
+		setFailure: func(code, msg string) {
+			in.setFailure(code, fmt.Sprintf("error including %q: %s", name, msg))
+		},
+		stack: append(append([]string(nil), in.stack...), name),
+	}
+	funcs := newFuncMap(child.setFailure, in.o)
+	funcs["include"] = child.include
+
+	left, right := in.o.delims()
+	if err := checkFuncMapVersion(text, left, right); err != nil {
+		return "", in.fail(fmt.Sprintf("error including %q: %v", name, errors.Unwrap(err)))
+	}
+	tmpl := template.New(name).Delims(left, right).Funcs(funcs)
+	if in.o.strict {
+		tmpl = tmpl.Option("missingkey=error")
+	}
+	if tmpl, err = tmpl.Parse(string(text)); err != nil {
+		return "", in.fail(fmt.Sprintf("error including %q: %v", name, err))
+	}
+	if err := checkDeniedFuncs(tmpl, text, in.o); err != nil {
+		return "", in.fail(fmt.Sprintf("error including %q: %v", name, errors.Unwrap(err)))
+	}
+
+	var dot interface{}
+	if len(data) == 1 {
+		dot = data[0]
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, dot); err != nil {
+		return "", in.fail(fmt.Sprintf("error including %q: %v", name, err))
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,96 @@
+package templates
+
+import (
+	"fmt"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_includer_include(t *testing.T) {
+	fsys := fstest.MapFS{
+		"common/org.tmpl":      {Data: []byte(`{"organization": {{ toJson .Organization }}, "country": {{ toJson .Country }}}`)},
+		"common/usages.tmpl":   {Data: []byte(`"keyUsage": ["digitalSignature"], "extKeyUsage": ["serverAuth"]`)},
+		"common/subject.tmpl":  {Data: []byte(`{"commonName": {{ toJson .CommonName }}, "org": {{ include "common/org.tmpl" . }}}`)},
+		"common/fail.tmpl":     {Data: []byte(`{{ if not .CommonName }}{{ fail "commonName is required" }}{{ end }}{}`)},
+		"common/nested.tmpl":   {Data: []byte(`{{ include "common/fail.tmpl" . }}`)},
+		"common/invalid.tmpl":  {Data: []byte(`{{ .CommonName `)},
+		"common/exec.tmpl":     {Data: []byte(`{{ .CommonName.Foo }}`)},
+		"common/strict.tmpl":   {Data: []byte(`{{ toJson .Missing }}`)},
+		"common/unknown.tmpl":  {Data: []byte(`{{ unknownFunction }}`)},
+		"common/version.tmpl":  {Data: []byte(`{{/* requires funcmap >= 999 */}}{}`)},
+		"cycle/a.tmpl":         {Data: []byte(`{{ include "cycle/b.tmpl" }}`)},
+		"cycle/b.tmpl":         {Data: []byte(`{{ include "cycle/a.tmpl" }}`)},
+		"deep/0.tmpl":          {Data: []byte(`{{ include "deep/1.tmpl" }}`)},
+		"deep/1.tmpl":          {Data: []byte(`{{ include "deep/2.tmpl" }}`)},
+		"deep/2.tmpl":          {Data: []byte(`{{ include "deep/3.tmpl" }}`)},
+		"deep/3.tmpl":          {Data: []byte(`{{ include "deep/4.tmpl" }}`)},
+		"deep/4.tmpl":          {Data: []byte(`{{ include "deep/5.tmpl" }}`)},
+		"deep/5.tmpl":          {Data: []byte(`{{ include "deep/6.tmpl" }}`)},
+		"deep/6.tmpl":          {Data: []byte(`{{ include "deep/7.tmpl" }}`)},
+		"deep/7.tmpl":          {Data: []byte(`{{ include "deep/8.tmpl" }}`)},
+		"deep/8.tmpl":          {Data: []byte(`{{ include "deep/9.tmpl" }}`)},
+		"deep/9.tmpl":          {Data: []byte(`{{ include "deep/10.tmpl" }}`)},
+		"deep/10.tmpl":         {Data: []byte(`{}`)},
+		"deep/dir/ignored.txt": {Data: []byte(`{}`)},
+	}
+	data := []byte(`{"Subject": {"CommonName": "foo", "Organization": "Smallstep", "Country": "US"}}`)
+
+	tests := []struct {
+		name    string
+		text    string
+		opts    []Option
+		want    string
+		wantErr string
+	}{
+		{"ok", `{"subject": {{ include "common/subject.tmpl" .Subject }}, {{ include "common/usages.tmpl" }}}`, nil,
+			`{"subject": {"commonName": "foo", "org": {"organization": "Smallstep", "country": "US"}}, "keyUsage": ["digitalSignature"], "extKeyUsage": ["serverAuth"]}`, ""},
+		{"ok/nested-fail-not-called", `{{ include "common/nested.tmpl" .Subject }}`, nil, `{}`, ""},
+		{"fail/disabled", `{{ include "common/usages.tmpl" }}`, []Option{WithIncludeFS(nil)},
+			"", `error executing template: error including "common/usages.tmpl": include is disabled`},
+		{"fail/not-found", `{{ include "common/missing.tmpl" }}`, nil,
+			"", `error executing template: error including "common/missing.tmpl": open common/missing.tmpl: file does not exist`},
+		{"fail/invalid-name", `{{ include "../secret" }}`, nil,
+			"", `error executing template: error including "../secret": invalid file name`},
+		{"fail/arguments", `{{ include "common/org.tmpl" . . }}`, nil,
+			"", `error executing template: error including "common/org.tmpl": too many arguments`},
+		{"fail/fail", `{{ include "common/fail.tmpl" .Missing }}`, nil,
+			"", `error executing template: error including "common/fail.tmpl": commonName is required`},
+		{"fail/nested-fail", `{{ include "common/nested.tmpl" }}`, nil,
+			"", `error executing template: error including "common/nested.tmpl": error including "common/fail.tmpl": commonName is required`},
+		{"fail/parse", `{{ include "common/invalid.tmpl" }}`, nil,
+			"", `error executing template: error including "common/invalid.tmpl": template: common/invalid.tmpl:1: unclosed action`},
+		{"fail/unknown-function", `{{ include "common/unknown.tmpl" }}`, nil,
+			"", `error executing template: error including "common/unknown.tmpl": template: common/unknown.tmpl:1: function "unknownFunction" not defined`},
+		{"fail/version", `{{ include "common/version.tmpl" }}`, nil,
+			"", fmt.Sprintf(`error executing template: error including "common/version.tmpl": template requires newer func map: version 999 required, have %d`, FuncMapVersion())},
+		{"fail/execute", `{{ include "common/exec.tmpl" .Subject }}`, nil,
+			"", `error executing template: error including "common/exec.tmpl": template: common/exec.tmpl:1:14: executing "common/exec.tmpl" at <.CommonName.Foo>: can't evaluate field Foo in type interface {}`},
+		{"fail/strict", `{{ include "common/strict.tmpl" .Subject }}`, []Option{WithStrict(true)},
+			"", `error executing template: error including "common/strict.tmpl": template: common/strict.tmpl:1:10: executing "common/strict.tmpl" at <.Missing>: map has no entry for key "Missing"`},
+		{"fail/cycle", `{{ include "cycle/a.tmpl" }}`, nil,
+			"", `error executing template: error including "cycle/a.tmpl": error including "cycle/b.tmpl": error including "cycle/a.tmpl": include cycle cycle/a.tmpl -> cycle/b.tmpl -> cycle/a.tmpl`},
+		{"fail/depth", `{{ include "deep/0.tmpl" }}`, nil,
+			"", `error executing template: error including "deep/0.tmpl": error including "deep/1.tmpl": error including "deep/2.tmpl": error including "deep/3.tmpl": error including "deep/4.tmpl": error including "deep/5.tmpl": error including "deep/6.tmpl": error including "deep/7.tmpl": error including "deep/8.tmpl": error including "deep/9.tmpl": error including "deep/10.tmpl": too many nested includes, the limit is 10`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseTemplate([]byte(tt.text), append([]Option{WithIncludeFS(fsys)}, tt.opts...)...)
+			require.NoError(t, err)
+			got, err := tmpl.Render(data)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				assert.EqualError(t, tmpl.Validate(data), tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+			assert.NoError(t, tmpl.Validate(data))
+		})
+	}
+
+	// Without a file system "include" fails.
+	assert.EqualError(t, ValidateTemplateWithData([]byte(`{{ include "common/usages.tmpl" }}`), nil), `error executing template: error including "common/usages.tmpl": include is disabled`)
+}
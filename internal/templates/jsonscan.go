@@ -0,0 +1,327 @@
+package templates
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// jsonScanError is an error found by scanJSON at the given offset.
+type jsonScanError struct {
+	msg    string
+	offset int64
+}
+
+func (e *jsonScanError) Error() string {
+	return e.msg
+}
+
+// jsonFrame is the state of an object or array being scanned.
+type jsonFrame struct {
+	object bool
+	keys   map[string]struct{}
+	// expectKey is true if the next token in an object is a key.
+	expectKey bool
+}
+
+// scanJSON reads a JSON document token by token and performs the checks that
+// json.Valid doesn't do. It assumes the document is syntactically valid JSON.
+func scanJSON(r io.Reader, o *options) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	var stack []*jsonFrame
+	for {
+		before := dec.InputOffset()
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var top *jsonFrame
+		if len(stack) > 0 {
+			top = stack[len(stack)-1]
+		}
+
+		// Keys are always strings, check them before anything else.
+		if top != nil && top.object && top.expectKey {
+			if d, ok := tok.(json.Delim); ok && d == '}' {
+				stack = stack[:len(stack)-1]
+				markValue(stack)
+				continue
+			}
+			key := tok.(string)
+			top.expectKey = false
+			if o.rejectDuplicateKeys {
+				if _, ok := top.keys[key]; ok {
+					return &jsonScanError{
+						msg:    fmt.Sprintf("duplicate key %q", key),
+						offset: keyOffset(before, dec.InputOffset(), key),
+					}
+				}
+				top.keys[key] = struct{}{}
+			}
+			continue
+		}
+
+		switch tok {
+		case json.Delim('{'):
+			stack = append(stack, &jsonFrame{
+				object:    true,
+				keys:      make(map[string]struct{}),
+				expectKey: true,
+			})
+		case json.Delim('['):
+			stack = append(stack, &jsonFrame{})
+		case json.Delim(']'):
+			stack = stack[:len(stack)-1]
+			markValue(stack)
+		default:
+			markValue(stack)
+		}
+	}
+}
+
+// markValue marks that a value has been read in the innermost object, so the
+// next token is a key.
+func markValue(stack []*jsonFrame) {
+	if len(stack) > 0 && stack[len(stack)-1].object {
+		stack[len(stack)-1].expectKey = true
+	}
+}
+
+// keyOffset returns the offset where a key token starts. The decoder only
+// reports the offsets between tokens, so the start is computed from the
+// length of the encoded key, falling back to the end of the previous token.
+func keyOffset(before, after int64, key string) int64 {
+	b, err := json.Marshal(key)
+	if err != nil || after-int64(len(b)) < before {
+		return before
+	}
+	return after - int64(len(b))
+}
+
+// jsonPathFrame is the state of an object or array while looking for the path
+// of a syntax error.
+type jsonPathFrame struct {
+	object    bool
+	path      string
+	key       string
+	index     int
+	expectKey bool
+}
+
+// current returns the path of the value being read in the frame.
+func (f *jsonPathFrame) current() string {
+	if f.object {
+		if f.key == "" && f.expectKey {
+			return f.path
+		}
+		return joinPath(f.path, f.key)
+	}
+	return indexPath(f.path, f.index)
+}
+
+// jsonErrorPath returns the path, like "subject.names[2].type", of the value
+// that was being read when the first error in data was found. The empty path
+// is the root document.
+func jsonErrorPath(data []byte) string {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var stack []*jsonPathFrame
+	current := func() string {
+		if len(stack) == 0 {
+			return ""
+		}
+		return stack[len(stack)-1].current()
+	}
+	// next marks that a complete value has been read in the innermost frame.
+	next := func() {
+		if len(stack) == 0 {
+			return
+		}
+		if top := stack[len(stack)-1]; top.object {
+			top.expectKey = true
+		} else {
+			top.index++
+		}
+	}
+
+	for {
+		path := current()
+		tok, err := dec.Token()
+		if err != nil {
+			return path
+		}
+
+		if len(stack) > 0 {
+			if top := stack[len(stack)-1]; top.object && top.expectKey {
+				if key, ok := tok.(string); ok {
+					top.key, top.expectKey = key, false
+					continue
+				}
+			}
+		}
+
+		switch tok {
+		case json.Delim('{'):
+			stack = append(stack, &jsonPathFrame{object: true, path: path, expectKey: true})
+		case json.Delim('['):
+			stack = append(stack, &jsonPathFrame{path: path})
+		case json.Delim('}'), json.Delim(']'):
+			stack = stack[:len(stack)-1]
+			next()
+		default:
+			next()
+		}
+	}
+}
+
+// maxDataErrors is the maximum number of syntax errors reported with the
+// WithAllErrors option.
+const maxDataErrors = 10
+
+// recoverJSON returns a copy of data where the value or object member that
+// contains the syntax error found at offset is skipped, so the validation can
+// continue and find the next error. Values are replaced with a 0 and members
+// are blanked, keeping the offsets of the rest of the document. It returns
+// false if the error cannot be skipped.
+func recoverJSON(data []byte, offset int) ([]byte, bool) {
+	if offset < 0 || offset >= len(data) {
+		return nil, false
+	}
+
+	// Find the delimiter before the invalid value and its container. If the
+	// error is inside a string, the value starts at the quote.
+	var stack []byte
+	delim, start := -1, -1
+	for i := 0; i < offset; i++ {
+		switch c := data[i]; c {
+		case '"':
+			end := skipJSONString(data, i)
+			if end >= offset {
+				start = i
+				i = offset
+				continue
+			}
+			i = end
+		case '{', '[':
+			stack = append(stack, c)
+			delim = i
+		case '}', ']':
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case ':', ',':
+			delim = i
+		}
+	}
+	if delim < 0 || len(stack) == 0 {
+		return nil, false
+	}
+	if start < 0 {
+		start = delim + 1
+	}
+
+	// Find the end of the invalid value, the next comma or closing bracket in
+	// the same container.
+	end, depth := -1, 0
+	for i := start; i < len(data) && end < 0; i++ {
+		switch data[i] {
+		case '"':
+			i = skipJSONString(data, i)
+		case '{', '[':
+			depth++
+		case '}', ']', ',':
+			if depth == 0 {
+				end = i
+			} else if data[i] != ',' {
+				depth--
+			}
+		}
+	}
+	if end < 0 {
+		return nil, false
+	}
+
+	b := append([]byte(nil), data...)
+	blank := func(from, to int) {
+		for i := from; i < to; i++ {
+			if !isJSONSpace(b[i]) {
+				b[i] = ' '
+			}
+		}
+	}
+	member := stack[len(stack)-1] == '{' && data[delim] != ':'
+	switch {
+	case member:
+		// Remove the member and one of the commas around it.
+		blank(start, end)
+		if data[delim] == ',' {
+			b[delim] = ' '
+		} else if data[end] == ',' {
+			b[end] = ' '
+		}
+	case start < end:
+		blank(start, end)
+		b[start] = '0'
+	case data[end] == ',':
+		// An extra comma, like in [1,,2].
+		b[end] = ' '
+	case data[delim] == ',':
+		// A trailing comma, like in [1,].
+		b[delim] = ' '
+	default:
+		return nil, false
+	}
+	return b, true
+}
+
+// DefaultMaxDepth is the maximum nesting depth of the objects and arrays in
+// the template data and in the output of a template, unless a different one is
+// set with WithMaxDepth.
+const DefaultMaxDepth = 100
+
+// exceedsDepth returns the offset of the first object or array in data nested
+// more than max levels, or -1 if there's none. It assumes data is valid JSON.
+func exceedsDepth(data []byte, max int) int {
+	depth := 0
+	for i := 0; i < len(data); i++ {
+		switch data[i] {
+		case '"':
+			i = skipJSONString(data, i)
+		case '{', '[':
+			if depth++; depth > max {
+				return i
+			}
+		case '}', ']':
+			depth--
+		}
+	}
+	return -1
+}
+
+// nonFiniteToken returns the NaN or infinity token, as written by some JSON
+// encoders, found at the offset where a syntax error was found, or an empty
+// string if there's none.
+func nonFiniteToken(data []byte, offset int) string {
+	if offset < 0 || offset >= len(data) {
+		return ""
+	}
+	start := offset
+	if start > 0 && (data[start-1] == '-' || data[start-1] == '+') {
+		start--
+	}
+	for _, tok := range []string{"NaN", "Infinity", "Inf"} {
+		if bytes.HasPrefix(data[offset:], []byte(tok)) {
+			return string(data[start:offset]) + tok
+		}
+	}
+	return ""
+}
@@ -0,0 +1,45 @@
+package templates
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_scanJSON_duplicateKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		err    error
+		offset int64
+	}{
+		{"ok", `{"a": 1, "b": {"a": 2}, "c": [{"a": 1}, {"a": 2}]}`, nil, 0},
+		{"ok/scalar", `"a"`, nil, 0},
+		{"ok/empty-object", `{"a": {}, "b": {}}`, nil, 0},
+		{"ok/same-key-in-sibling-objects", `[{"a": 1, "b": 2}, {"a": 1, "b": 2}]`, nil, 0},
+		{"fail/top-level", `{"a": 1, "a": 2}`, errors.New(`duplicate key "a"`), 9},
+		{"fail/nested", `{"a": {"b": [1, 2], "b": null}}`, errors.New(`duplicate key "b"`), 20},
+		{"fail/in-array", `[{"x": 1}, {"y": {"z": 1}, "y": 2}]`, errors.New(`duplicate key "y"`), 27},
+		{"fail/after-nested-object", `{"a": {"b": 1}, "a": 2}`, errors.New(`duplicate key "a"`), 16},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := scanJSON(strings.NewReader(tt.data), &options{rejectDuplicateKeys: true})
+			if tt.err != nil {
+				assert.EqualError(t, err, tt.err.Error())
+				var scanError *jsonScanError
+				if assert.True(t, errors.As(err, &scanError)) {
+					assert.Equal(t, tt.offset, scanError.offset)
+				}
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		assert.NoError(t, scanJSON(strings.NewReader(`{"a": 1, "a": 2}`), &options{}))
+	})
+}
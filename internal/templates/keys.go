@@ -0,0 +1,98 @@
+package templates
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// checkTopLevelKeys returns a SchemaError for the first key of the JSON
+// object data that is not in the sorted list allowed. The position of the
+// error is reported using src and m like in locate. Values that are not
+// objects are not checked.
+func checkTopLevelKeys(data, src []byte, m *sourceMap, allowed []string) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil
+	}
+	for dec.More() {
+		before := dec.InputOffset()
+		tok, err := dec.Token()
+		if err != nil {
+			return nil
+		}
+		key, _ := tok.(string)
+		if i := sort.SearchStrings(allowed, key); i == len(allowed) || allowed[i] != key {
+			// The offset before the key includes the comma and the white space
+			// before it.
+			offset := int(before) + bytes.IndexByte(data[before:], '"')
+			msg := fmt.Sprintf("unknown top-level key %q at %s", key, locate(offset, src, m))
+			if s := suggestKey(key, allowed); s != "" {
+				msg += fmt.Sprintf(", did you mean %q?", s)
+			}
+			err := errors.New(msg)
+			te := newTemplateError(SchemaError, err, "error validating json template data: "+msg)
+			te.Path = key
+			te.setPosition(offset, src, m)
+			return te
+		}
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			return nil
+		}
+	}
+	return nil
+}
+
+// suggestKey returns the key in candidates closest to key by edit distance,
+// or an empty string if none is close enough to be a typo: at most a third of
+// the length of the key, and at least one edit. In a tie, the first candidate
+// is returned.
+func suggestKey(key string, candidates []string) string {
+	limit := len([]rune(key)) / 3
+	if limit < 1 {
+		limit = 1
+	}
+	best, bestDistance := "", limit+1
+	for _, c := range candidates {
+		if d := editDistance(key, c); d < bestDistance {
+			best, bestDistance = c, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b, the number
+// of runes that must be inserted, deleted or replaced to turn a into b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func minInt(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,93 @@
+package templates
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_editDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"subject", "subject", 0},
+		{"subjekt", "subject", 1},
+		{"", "sans", 4},
+		{"keyUsage", "keyUsages", 1},
+		{"kyeUsage", "keyUsage", 2},
+		{"extensions", "extnesions", 2},
+		{"día", "dia", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+"/"+tt.b, func(t *testing.T) {
+			assert.Equal(t, tt.want, editDistance(tt.a, tt.b))
+			assert.Equal(t, tt.want, editDistance(tt.b, tt.a))
+		})
+	}
+}
+
+func Test_suggestKey(t *testing.T) {
+	allowed := []string{"extKeyUsage", "extensions", "keyUsage", "sans", "subject"}
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"subjekt", "subject"},
+		{"Subject", "subject"},
+		{"san", "sans"},
+		{"keyUsages", "keyUsage"},
+		{"extKeyUsages", "extKeyUsage"},
+		{"extnesions", "extensions"},
+		{"issuer", ""},
+		{"a", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			assert.Equal(t, tt.want, suggestKey(tt.key, allowed))
+		})
+	}
+}
+
+func TestValidateTemplateWithData_allowedTopLevelKeys(t *testing.T) {
+	opt := WithAllowedTopLevelKeys("subject", "sans", "keyUsage", "extKeyUsage", "extensions")
+	tests := []struct {
+		name     string
+		text     string
+		wantErr  string
+		wantPath string
+		wantLine int
+		wantCol  int
+	}{
+		{"ok", `{"subject": {"commonName": "foo"}, "sans": [], "keyUsage": ["digitalSignature"]}`, "", "", 0, 0},
+		{"ok/nested", `{"subject": {"subjekt": 1}}`, "", "", 0, 0},
+		{"ok/not-object", `[{"subjekt": 1}]`, "", "", 0, 0},
+		{"ok/empty", `{}`, "", "", 0, 0},
+		{"fail/typo", "{\n  \"subjekt\": {{ toJson .Subject }},\n  \"sans\": []\n}", `error validating json template data: unknown top-level key "subjekt" at template line 2, column 3, did you mean "subject"?`, "subjekt", 2, 3},
+		{"fail/second", `{"sans": [],   "keyUsages": []}`, `error validating json template data: unknown top-level key "keyUsages" at template line 1, column 16, did you mean "keyUsage"?`, "keyUsages", 1, 16},
+		{"fail/unknown", `{"issuer": {}}`, `error validating json template data: unknown top-level key "issuer" at template line 1, column 2`, "issuer", 1, 2},
+		{"fail/rendered", `{ {{- toJson "notBefore" }}: "" }`, `error validating json template data: unknown top-level key "notBefore" at offset 1, near template line 1, column 7`, "notBefore", 1, 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateTemplateWithData([]byte(tt.text), nil, opt)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.wantErr)
+			var te *TemplateError
+			if assert.True(t, errors.As(err, &te)) {
+				assert.Equal(t, SchemaError, te.Kind)
+				assert.Equal(t, tt.wantPath, te.Path)
+				assert.Equal(t, tt.wantLine, te.Line)
+				assert.Equal(t, tt.wantCol, te.Column)
+			}
+		})
+	}
+
+	// Without the option any key is allowed.
+	assert.NoError(t, ValidateTemplateWithData([]byte(`{"subjekt": 1}`), nil))
+}
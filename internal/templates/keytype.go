@@ -0,0 +1,152 @@
+package templates
+
+import (
+	"fmt"
+	"strings"
+)
+
+// keyTypeNames are the key types supported by keyutil, with the RSA sizes
+// and the elliptic curves allowed, in the order used in the errors.
+var keyTypeNames = []string{
+	"RSA-2048", "RSA-3072", "RSA-4096", "EC-P256", "EC-P384", "EC-P521",
+	"Ed25519",
+}
+
+// keyTypeAliases are the other names of the key types, in lower case and
+// without separators. "RSA" and "EC" are the default size and curve of
+// keyutil, and the curves have their SEC 2, ANSI X9.62 and SSH names.
+var keyTypeAliases = map[string]string{
+	"rsa":               "RSA-2048",
+	"ec":                "EC-P256",
+	"ecdsa":             "EC-P256",
+	"ec256":             "EC-P256",
+	"ec384":             "EC-P384",
+	"ec521":             "EC-P521",
+	"ecdsap256":         "EC-P256",
+	"ecdsap384":         "EC-P384",
+	"ecdsap521":         "EC-P521",
+	"p256":              "EC-P256",
+	"p384":              "EC-P384",
+	"p521":              "EC-P521",
+	"secp256r1":         "EC-P256",
+	"secp384r1":         "EC-P384",
+	"secp521r1":         "EC-P521",
+	"prime256v1":        "EC-P256",
+	"ecdsasha2nistp256": "EC-P256",
+	"ecdsasha2nistp384": "EC-P384",
+	"ecdsasha2nistp521": "EC-P521",
+	"okp":               "Ed25519",
+	"eddsa":             "Ed25519",
+	"okped25519":        "Ed25519",
+	"sshed25519":        "Ed25519",
+}
+
+// keyTypeKey returns s in lower case without white space, hyphens and
+// underscores, so "EC-P256", "ec_p256" and "ECP256" are the same.
+func keyTypeKey(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '-', '_', ' ', '\t':
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(s)))
+}
+
+// keyType returns the key type s with its name in keyTypeNames, like
+// "EC-P256" for "ECDSA", "P-256" or "ecdsa-sha2-nistp256", and fails with the
+// valid names if it's not supported, like "RSA-1024" or "EC-P224".
+func keyType(s string) (string, error) {
+	key := keyTypeKey(s)
+	if key == "" {
+		return "", fmt.Errorf("error validating keyType: key type is empty, valid values are %s", strings.Join(keyTypeNames, ", "))
+	}
+	if name, ok := keyTypeAliases[key]; ok {
+		return name, nil
+	}
+	for _, name := range keyTypeNames {
+		if keyTypeKey(name) == key {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("error validating keyType: unsupported key type %q, valid values are %s", s, strings.Join(keyTypeNames, ", "))
+}
+
+// signatureAlgorithms are the signature algorithms supported by x509util, with
+// the family of the keys that can use them, in the order used in the errors.
+var signatureAlgorithms = []struct {
+	name   string
+	family string
+}{
+	{"MD2-RSA", "RSA"},
+	{"MD5-RSA", "RSA"},
+	{"SHA1-RSA", "RSA"},
+	{"SHA256-RSA", "RSA"},
+	{"SHA384-RSA", "RSA"},
+	{"SHA512-RSA", "RSA"},
+	{"DSA-SHA1", "DSA"},
+	{"DSA-SHA256", "DSA"},
+	{"ECDSA-SHA1", "EC"},
+	{"ECDSA-SHA256", "EC"},
+	{"ECDSA-SHA384", "EC"},
+	{"ECDSA-SHA512", "EC"},
+	{"SHA256-RSAPSS", "RSA"},
+	{"SHA384-RSAPSS", "RSA"},
+	{"SHA512-RSAPSS", "RSA"},
+	{"Ed25519", "Ed25519"},
+}
+
+// keyTypeFamily returns the family of a key type in keyTypeNames, "RSA", "EC"
+// or "Ed25519".
+func keyTypeFamily(name string) string {
+	if i := strings.IndexByte(name, '-'); i >= 0 {
+		return name[:i]
+	}
+	return name
+}
+
+// signatureAlgorithm returns the signature algorithm s with the name used by
+// x509util, like "ECDSA-SHA256" for "ecdsa-sha256", and fails if it's not
+// supported. If a key type is given, or set with WithKeyType, it fails too if
+// the algorithm cannot be used with that key, like "SHA256-RSA" with an
+// "EC-P256" key. An empty algorithm is the default of the signer and it's
+// always valid.
+func signatureAlgorithm(defaultKeyType, s string, kt ...string) (string, error) {
+	if len(kt) > 1 {
+		return "", fmt.Errorf("error validating signatureAlgorithm: expected an algorithm and an optional key type, not %d arguments", len(kt)+1)
+	}
+	if s == "" {
+		return "", nil
+	}
+
+	name, family := "", ""
+	for _, alg := range signatureAlgorithms {
+		if strings.EqualFold(strings.TrimSpace(s), alg.name) {
+			name, family = alg.name, alg.family
+			break
+		}
+	}
+	if name == "" {
+		names := make([]string, len(signatureAlgorithms))
+		for i, alg := range signatureAlgorithms {
+			names[i] = alg.name
+		}
+		return "", fmt.Errorf("error validating signatureAlgorithm: unsupported signatureAlgorithm %q, valid values are %s", s, strings.Join(names, ", "))
+	}
+
+	keyTypeName := defaultKeyType
+	if len(kt) == 1 {
+		keyTypeName = kt[0]
+	}
+	if keyTypeName == "" {
+		return name, nil
+	}
+	k, err := keyType(keyTypeName)
+	if err != nil {
+		return "", err
+	}
+	if keyTypeFamily(k) != family {
+		return "", fmt.Errorf("error validating signatureAlgorithm: %s cannot be used with a key of type %s", name, k)
+	}
+	return name, nil
+}
@@ -0,0 +1,141 @@
+package templates
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_keyType(t *testing.T) {
+	valid := strings.Join(keyTypeNames, ", ")
+	tests := []struct {
+		name    string
+		s       string
+		want    string
+		wantErr string
+	}{
+		{"ok/rsa", "RSA", "RSA-2048", ""},
+		{"ok/rsa2048", "rsa-2048", "RSA-2048", ""},
+		{"ok/rsa3072", "RSA3072", "RSA-3072", ""},
+		{"ok/rsa4096", "rsa_4096", "RSA-4096", ""},
+		{"ok/ec", "EC", "EC-P256", ""},
+		{"ok/ecdsa", "ECDSA", "EC-P256", ""},
+		{"ok/ec256", "EC256", "EC-P256", ""},
+		{"ok/p256", "P-256", "EC-P256", ""},
+		{"ok/prime256v1", "prime256v1", "EC-P256", ""},
+		{"ok/ssh-p256", "ecdsa-sha2-nistp256", "EC-P256", ""},
+		{"ok/ec-p384", "ec-p384", "EC-P384", ""},
+		{"ok/secp384r1", "secp384r1", "EC-P384", ""},
+		{"ok/ecdsa-p521", "ECDSA-P521", "EC-P521", ""},
+		{"ok/ssh-p521", "ecdsa-sha2-nistp521", "EC-P521", ""},
+		{"ok/ed25519", "ed25519", "Ed25519", ""},
+		{"ok/eddsa", "EdDSA", "Ed25519", ""},
+		{"ok/okp", "OKP", "Ed25519", ""},
+		{"ok/ssh-ed25519", "ssh-ed25519", "Ed25519", ""},
+		{"ok/space", " EC P256 ", "EC-P256", ""},
+		{"fail/rsa1024", "RSA-1024", "", `error validating keyType: unsupported key type "RSA-1024", valid values are ` + valid},
+		{"fail/rsa8192", "RSA8192", "", `error validating keyType: unsupported key type "RSA8192", valid values are ` + valid},
+		{"fail/p224", "EC-P224", "", `error validating keyType: unsupported key type "EC-P224", valid values are ` + valid},
+		{"fail/x25519", "X25519", "", `error validating keyType: unsupported key type "X25519", valid values are ` + valid},
+		{"fail/typo", "ECSDA", "", `error validating keyType: unsupported key type "ECSDA", valid values are ` + valid},
+		{"fail/empty", " ", "", "error validating keyType: key type is empty, valid values are " + valid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := keyType(tt.s)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestTemplate_keyType(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"keyType": {{ keyType .KeyType | jsonQuote }}}`))
+	require.NoError(t, err)
+	out, err := tmpl.Render([]byte(`{"KeyType": "ECDSA"}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"keyType": "EC-P256"}`, string(out))
+
+	err = tmpl.Validate([]byte(`{"KeyType": "RSA-1024"}`))
+	assert.EqualError(t, err, `error executing template: error validating keyType: unsupported key type "RSA-1024", valid values are `+strings.Join(keyTypeNames, ", "))
+}
+
+func Test_signatureAlgorithm(t *testing.T) {
+	names := make([]string, len(signatureAlgorithms))
+	for i, alg := range signatureAlgorithms {
+		names[i] = alg.name
+	}
+	valid := strings.Join(names, ", ")
+
+	tests := []struct {
+		name           string
+		defaultKeyType string
+		s              string
+		kt             []string
+		want           string
+		wantErr        string
+	}{
+		{"ok", "", "SHA256-RSA", nil, "SHA256-RSA", ""},
+		{"ok/case", "", "ecdsa-sha384", nil, "ECDSA-SHA384", ""},
+		{"ok/ed25519", "", "ED25519", nil, "Ed25519", ""},
+		{"ok/dsa", "", "DSA-SHA256", nil, "DSA-SHA256", ""},
+		{"ok/empty", "", "", nil, "", ""},
+		{"ok/empty-key", "", "", []string{"RSA"}, "", ""},
+		{"ok/rsa-key", "", "SHA256-RSA", []string{"RSA-4096"}, "SHA256-RSA", ""},
+		{"ok/rsapss-key", "", "sha512-rsapss", []string{"rsa"}, "SHA512-RSAPSS", ""},
+		{"ok/ec-key", "", "ECDSA-SHA256", []string{"P-384"}, "ECDSA-SHA256", ""},
+		{"ok/ed25519-key", "", "Ed25519", []string{"ssh-ed25519"}, "Ed25519", ""},
+		{"ok/default-key", "EC", "ECDSA-SHA256", nil, "ECDSA-SHA256", ""},
+		{"ok/key-over-default", "EC", "SHA256-RSA", []string{"RSA-2048"}, "SHA256-RSA", ""},
+		{"fail/unknown", "", "SHA256-ECDSA", nil, "", `error validating signatureAlgorithm: unsupported signatureAlgorithm "SHA256-ECDSA", valid values are ` + valid},
+		{"fail/ec-rsa", "", "SHA256-RSA", []string{"EC-P256"}, "", "error validating signatureAlgorithm: SHA256-RSA cannot be used with a key of type EC-P256"},
+		{"fail/rsa-ecdsa", "", "ECDSA-SHA256", []string{"RSA-2048"}, "", "error validating signatureAlgorithm: ECDSA-SHA256 cannot be used with a key of type RSA-2048"},
+		{"fail/ed25519-ecdsa", "", "ECDSA-SHA512", []string{"Ed25519"}, "", "error validating signatureAlgorithm: ECDSA-SHA512 cannot be used with a key of type Ed25519"},
+		{"fail/rsa-ed25519", "", "Ed25519", []string{"RSA-3072"}, "", "error validating signatureAlgorithm: Ed25519 cannot be used with a key of type RSA-3072"},
+		{"fail/dsa", "", "DSA-SHA1", []string{"RSA"}, "", "error validating signatureAlgorithm: DSA-SHA1 cannot be used with a key of type RSA-2048"},
+		{"fail/default-key", "Ed25519", "SHA256-RSAPSS", nil, "", "error validating signatureAlgorithm: SHA256-RSAPSS cannot be used with a key of type Ed25519"},
+		{"fail/key-type", "", "SHA256-RSA", []string{"RSA-1024"}, "", `error validating keyType: unsupported key type "RSA-1024", valid values are ` + strings.Join(keyTypeNames, ", ")},
+		{"fail/args", "", "SHA256-RSA", []string{"RSA", "EC"}, "", "error validating signatureAlgorithm: expected an algorithm and an optional key type, not 3 arguments"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := signatureAlgorithm(tt.defaultKeyType, tt.s, tt.kt...)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestTemplate_signatureAlgorithm(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"signatureAlgorithm": {{ signatureAlgorithm .Alg .KeyType | jsonQuote }}}`))
+	require.NoError(t, err)
+	out, err := tmpl.Render([]byte(`{"Alg": "ecdsa-sha256", "KeyType": "ECDSA"}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"signatureAlgorithm": "ECDSA-SHA256"}`, string(out))
+
+	err = tmpl.Validate([]byte(`{"Alg": "SHA256-RSA", "KeyType": "EC-P384"}`))
+	assert.EqualError(t, err, "error executing template: error validating signatureAlgorithm: SHA256-RSA cannot be used with a key of type EC-P384")
+
+	// The key type of the options is used without the second argument.
+	text := []byte(`{"signatureAlgorithm": {{ signatureAlgorithm .Alg | jsonQuote }}}`)
+	data := []byte(`{"Alg": "SHA256-RSA"}`)
+	assert.NoError(t, ValidateTemplateWithData(text, data))
+	assert.NoError(t, ValidateTemplateWithData(text, data, WithKeyType("RSA-2048")))
+	err = ValidateTemplateWithData(text, data, WithKeyType("Ed25519"))
+	assert.EqualError(t, err, "error executing template: error validating signatureAlgorithm: SHA256-RSA cannot be used with a key of type Ed25519")
+
+	tmpl, err = ParseTemplate(text)
+	require.NoError(t, err)
+	_, err = tmpl.Render(data, WithKeyType("EC"))
+	assert.EqualError(t, err, "error executing template: error validating signatureAlgorithm: SHA256-RSA cannot be used with a key of type EC-P256")
+}
@@ -0,0 +1,86 @@
+package templates
+
+import "bytes"
+
+// stripJSONExtensions removes the // and /* */ comments and the trailing
+// commas in objects and arrays from data. The removed bytes are replaced with
+// spaces and new lines are kept, so the offsets, lines and columns in the
+// returned document are the same as in data. Anything else, including
+// unterminated comments and commas that don't follow a value, is kept as it
+// is, so invalid JSON is still invalid after stripping it.
+func stripJSONExtensions(data []byte) []byte {
+	b := append([]byte(nil), data...)
+	blank := func(from, to int) {
+		for i := from; i < to; i++ {
+			if b[i] != '\n' && b[i] != '\r' {
+				b[i] = ' '
+			}
+		}
+	}
+
+	// Remove the comments.
+	for i := 0; i < len(b); i++ {
+		switch {
+		case b[i] == '"':
+			i = skipJSONString(b, i)
+		case b[i] == '/' && i+1 < len(b) && b[i+1] == '/':
+			end := bytes.IndexByte(b[i:], '\n')
+			if end < 0 {
+				end = len(b) - i
+			}
+			blank(i, i+end)
+			i += end
+		case b[i] == '/' && i+1 < len(b) && b[i+1] == '*':
+			end := bytes.Index(b[i+2:], []byte("*/"))
+			if end < 0 {
+				return b
+			}
+			blank(i, i+end+4)
+			i += end + 3
+		}
+	}
+
+	// Remove the trailing commas. A comma is only removed if it follows a
+	// value, so [,] or [1,,] are still invalid.
+	var last byte
+	for i := 0; i < len(b); i++ {
+		switch c := b[i]; c {
+		case ' ', '\t', '\n', '\r':
+			continue
+		case '"':
+			i = skipJSONString(b, i)
+		case ',':
+			if last != 0 && last != ',' && last != '[' && last != '{' && last != ':' {
+				j := i + 1
+				for j < len(b) && isJSONSpace(b[j]) {
+					j++
+				}
+				if j < len(b) && (b[j] == ']' || b[j] == '}') {
+					b[i] = ' '
+					continue
+				}
+			}
+		}
+		last = b[i]
+	}
+
+	return b
+}
+
+// skipJSONString returns the offset of the quote that closes the string that
+// starts at offset i, or the last offset if the string is not closed.
+func skipJSONString(b []byte, i int) int {
+	for i++; i < len(b); i++ {
+		switch b[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return len(b) - 1
+}
+
+func isJSONSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
@@ -0,0 +1,61 @@
+package templates
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_stripJSONExtensions(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"no-extensions", `{"a": [1, 2], "b": "c"}`, `{"a": [1, 2], "b": "c"}`},
+		{"line-comment", "{\n  // comment\n  \"a\": 1 // another\n}", "{\n            \n  \"a\": 1           \n}"},
+		{"line-comment-eof", `{"a": 1} // comment`, `{"a": 1}           `},
+		{"block-comment", "{/* a\nb */\"a\": 1}", "{    \n    \"a\": 1}"},
+		{"unterminated-block-comment", `{"a": 1} /* comment`, `{"a": 1} /* comment`},
+		{"trailing-commas", "{\"a\": [1, 2,], \"b\": {\"c\": 1,},\n}", "{\"a\": [1, 2 ], \"b\": {\"c\": 1 } \n}"},
+		{"trailing-comma-and-comment", "[1, // comment\n]", "[1            \n]"},
+		{"strings", `{"a": "// not a comment", "b": "/* nor this */", "c": ",]", "d": "\",]"}`, `{"a": "// not a comment", "b": "/* nor this */", "c": ",]", "d": "\",]"}`},
+		{"empty-array-comma", `[,]`, `[,]`},
+		{"double-comma", `[1,,]`, `[1,,]`},
+		{"empty-object-comma", `{,}`, `{,}`},
+		{"missing-value", `{"a":,}`, `{"a":,}`},
+		{"unicode-comment", "[1 /* ñ */]", "[1         ]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := stripJSONExtensions([]byte(tt.data))
+			assert.Equal(t, tt.want, string(got))
+			assert.Len(t, got, len(tt.data))
+		})
+	}
+}
+
+func TestValidateTemplateData_lenient(t *testing.T) {
+	data := []byte(`{
+		// The subject of the certificate.
+		"Subject": {"CommonName": "foo"},
+		/* The SANs, the first one is the common name. */
+		"SANs": ["foo", "bar",],
+	}`)
+	assert.Error(t, ValidateTemplateData(data))
+	assert.NoError(t, ValidateTemplateData(data, WithLenientJSON(true)))
+	assert.NoError(t, ValidateTemplateWithData([]byte(`{"sans": {{ toJson .SANs }}}`), data, WithLenientJSON(true)))
+
+	// Errors report the position in the original data.
+	data = []byte(`{
+		// A comment
+		"Subject": {"CommonName": "foo"},
+		"SANs": ["foo" "bar"],
+	}`)
+	assert.EqualError(t, ValidateTemplateData(data, WithLenientJSON(true)), `error validating json template data: invalid JSON at SANs[1] (line 4, column 18): invalid character '"' after array element`)
+
+	// Other extensions are not allowed.
+	for _, s := range []string{`{'a': 1}`, `{a: 1}`, `[1,,]`, `[,]`, `{"a": 1} /* unterminated`, `[0x10]`} {
+		assert.Error(t, ValidateTemplateData([]byte(s), WithLenientJSON(true)), s)
+	}
+}
@@ -0,0 +1,439 @@
+package templates
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template/parse"
+)
+
+// Severity is the severity of a Lint.
+type Severity string
+
+const (
+	// SeverityError is used for problems that make the template fail.
+	SeverityError Severity = "error"
+	// SeverityWarning is used for constructs that are probably wrong.
+	SeverityWarning Severity = "warning"
+	// SeverityInfo is used for informational results, like the defaults
+	// applied to the output, that don't need any change.
+	SeverityInfo Severity = "info"
+)
+
+// Lint is a problem found in a template by LintTemplate.
+type Lint struct {
+	Severity Severity `json:"severity"`
+	// Code is a short identifier of the kind of problem.
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Offset is the position in the template, in bytes, of the construct
+	// that caused the problem. Line and Column are 1-based.
+	Offset int `json:"offset"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// String returns a human readable version of the lint.
+func (l Lint) String() string {
+	return fmt.Sprintf("%d:%d: %s: %s", l.Line, l.Column, l.Severity, l.Message)
+}
+
+// Codes used in lints.
+const (
+	LintUnknownFunction = "unknown-function"
+	LintRawOutput       = "raw-output"
+	LintDeprecatedField = "deprecated-field"
+	LintAlwaysEmpty     = "always-empty"
+	LintUnescapedString = "unescaped-string"
+	LintUnusedKey       = "unused-key"
+	LintWhitespaceTrim  = "whitespace-trim"
+	LintHardcodedValue  = "hardcoded-value"
+)
+
+// builtinFuncs are the functions predefined by text/template.
+var builtinFuncs = map[string]bool{
+	"and": true, "call": true, "html": true, "index": true, "slice": true,
+	"js": true, "len": true, "not": true, "or": true, "print": true,
+	"printf": true, "println": true, "urlquery": true, "eq": true, "ge": true,
+	"gt": true, "le": true, "lt": true, "ne": true,
+}
+
+// jsonSafeFuncs are the functions that always render valid JSON, or nothing
+// at all. The output of "include" is also a part of the template, and it's
+// validated with it.
+var jsonSafeFuncs = map[string]bool{
+	"toJson": true, "toRawJson": true, "toPrettyJson": true,
+	"mustToJson": true, "mustToRawJson": true, "mustToPrettyJson": true,
+	"jsonQuote": true, "sans": true, "fail": true, "include": true,
+	"null": true, "object": true, "dnObject": true, "basicConstraints": true,
+	"isCA": true, "number": true, "jsonPrintf": true, "jsonKey": true,
+	"extensionValue": true, "canonicalJSON": true,
+}
+
+// jsonWhitespaceFuncs are the functions that only add or remove whitespace
+// around the lines of their input, so they keep a JSON value valid.
+var jsonWhitespaceFuncs = map[string]bool{
+	"indent": true, "nindent": true, "indentLines": true, "nindentLines": true,
+	"trim": true,
+}
+
+// stringSafeFuncs are the functions whose output never needs to be escaped in
+// a JSON string, like base64 or hexadecimal values.
+var stringSafeFuncs = map[string]bool{
+	"b64enc": true, "b64encBytes": true, "b64urlenc": true, "sha256": true, "sha1": true,
+	"fingerprint": true, "deriveKeyID": true, "randHex": true, "randAlnum": true,
+	"randAlphaNum": true, "oid": true, "hexGroup": true, "base32": true,
+	"serial": true, "profile": true, "ip": true, "country": true, "keyFingerprint": true,
+	"keyType": true, "validity": true, "subjectKeyId": true,
+	"keySubjectKeyId": true, "signatureAlgorithm": true, "authorityKeyId": true,
+	"uuidV5": true, "uuidV4": true,
+}
+
+// LintTemplate looks for suspicious constructs in a template without executing
+// it. The lints found are sorted by position. Function names are not resolved
+// while parsing, so a template using an unknown function is reported as a lint
+// instead of an error; an error is only returned if the template cannot be
+// parsed.
+//
+// The following problems are reported:
+//   - the use of functions that are not available to templates.
+//   - actions whose output is not JSON encoded, for example {{ .Name }}
+//     instead of {{ toJson .Name }}. The functions that only change the
+//     whitespace, like in {{ toJson .SANs | indent 2 }}, keep it encoded.
+//   - actions inside a JSON string in the template text, for example
+//     "cn": "{{ .Name }}", that render invalid JSON if the value has a quote,
+//     instead of "cn": {{ jsonQuote .Name }}.
+//   - references to fields marked as deprecated with WithDeprecatedFields.
+//   - blocks and actions that always render empty.
+//   - trim markers, like in {{ .Port -}} 1, that join the output of an action
+//     to a value of the template text or to the output of another action.
+//   - literal strings in the template text that look like an identifier of a
+//     specific certificate, like "commonName": "www.example.com", instead of
+//     a value of the template data. The kinds of values reported can be set
+//     with WithLiteralKinds, and some values allowed with
+//     WithAllowedLiterals.
+func LintTemplate(data []byte, opts ...Option) ([]Lint, error) {
+	l, err := lintTemplate(data, newOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+	return l.lints, nil
+}
+
+// lintTemplate returns the linter with the lints of LintTemplate, sorted by
+// position, and the fixes suggested for them.
+func lintTemplate(data []byte, o *options) (*linter, error) {
+	trees, err := parseTrees(data, o)
+	if err != nil {
+		return nil, err
+	}
+
+	funcs := newFuncs(o).FuncMap()
+
+	l := &linter{src: data}
+	var outputs []*parse.ActionNode
+	for _, tree := range trees {
+		inString := stringActions(tree)
+		l.checkLiterals(tree, o)
+		walkTree(tree.Root, func(node parse.Node) bool {
+			switch n := node.(type) {
+			case *parse.IdentifierNode:
+				if _, ok := funcs[n.Ident]; !ok && !builtinFuncs[n.Ident] {
+					l.add(n, SeverityError, LintUnknownFunction, "function %q not defined", n.Ident)
+					if name := closestFunc(n.Ident, funcs); name != "" {
+						l.suggest("use %s instead of %s", name, n.Ident)
+					}
+				}
+			case *parse.FieldNode:
+				l.checkDeprecated(n, "."+n.Ident[0], "."+strings.Join(n.Ident, "."), o.deprecatedFields)
+			case *parse.VariableNode:
+				if len(n.Ident) > 1 && n.Ident[0] == "$" {
+					l.checkDeprecated(n, "$", "."+strings.Join(n.Ident[1:], "."), o.deprecatedFields)
+				}
+			case *parse.ActionNode:
+				l.checkAction(n, inString)
+				if len(n.Pipe.Decl) == 0 {
+					outputs = append(outputs, n)
+				}
+			case *parse.IfNode:
+				l.checkBranch(n, &n.BranchNode, "if")
+			case *parse.WithNode:
+				l.checkBranch(n, &n.BranchNode, "with")
+			}
+			return true
+		})
+	}
+	left, right := o.delims()
+	l.checkTrimMarkers(left, right, outputs)
+
+	l.sort()
+	return l, nil
+}
+
+// parseTrees parses a template without resolving the function names.
+func parseTrees(data []byte, o *options) (map[string]*parse.Tree, error) {
+	trees := make(map[string]*parse.Tree)
+	t := parse.New("template")
+	t.Mode = parse.SkipFuncCheck
+	left, right := o.delims()
+	if _, err := t.Parse(string(data), left, right, trees); err != nil {
+		return nil, newParseError(err, data, left)
+	}
+	return trees, nil
+}
+
+type linter struct {
+	src   []byte
+	lints []Lint
+	// fixes are the fixes suggested for the lints, or empty strings.
+	fixes []string
+}
+
+func (l *linter) add(node parse.Node, severity Severity, code, format string, args ...interface{}) {
+	l.addAt(int(node.Position()), severity, code, format, args...)
+}
+
+func (l *linter) addAt(pos int, severity Severity, code, format string, args ...interface{}) {
+	line, col := position(l.src, pos)
+	l.lints = append(l.lints, Lint{
+		Severity: severity,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+		Offset:   pos,
+		Line:     line,
+		Column:   col,
+	})
+	l.fixes = append(l.fixes, "")
+}
+
+// suggest sets the fix suggested for the last lint added.
+func (l *linter) suggest(format string, args ...interface{}) {
+	l.fixes[len(l.fixes)-1] = fmt.Sprintf(format, args...)
+}
+
+// sort sorts the lints, and their fixes, by position.
+func (l *linter) sort() {
+	sort.Stable((*lintsByOffset)(l))
+}
+
+type lintsByOffset linter
+
+func (l *lintsByOffset) Len() int           { return len(l.lints) }
+func (l *lintsByOffset) Less(i, j int) bool { return l.lints[i].Offset < l.lints[j].Offset }
+func (l *lintsByOffset) Swap(i, j int) {
+	l.lints[i], l.lints[j] = l.lints[j], l.lints[i]
+	l.fixes[i], l.fixes[j] = l.fixes[j], l.fixes[i]
+}
+
+// checkDeprecated reports the use of a deprecated field. The parser sets the
+// position of a field with more than one identifier to one of the last ones,
+// so the start of the field is looked up in the source using its first
+// element.
+func (l *linter) checkDeprecated(node parse.Node, first, field string, deprecated map[string]string) {
+	for name, msg := range deprecated {
+		if field != name && !strings.HasPrefix(field, name+".") {
+			continue
+		}
+		pos := int(node.Position())
+		if end := pos + len(first); end <= len(l.src) {
+			if i := strings.LastIndex(string(l.src[:end]), first); i >= 0 {
+				pos = i
+			}
+		}
+		if msg == "" {
+			l.addAt(pos, SeverityWarning, LintDeprecatedField, "field %s is deprecated", name)
+		} else {
+			l.addAt(pos, SeverityWarning, LintDeprecatedField, "field %s is deprecated: %s", name, msg)
+			l.suggest("%s", msg)
+		}
+	}
+}
+
+// checkAction reports the actions whose output is not valid JSON. inString
+// has the actions that render inside a JSON string, see stringActions.
+func (l *linter) checkAction(n *parse.ActionNode, inString map[*parse.ActionNode]bool) {
+	// Variable declarations don't render anything.
+	if len(n.Pipe.Decl) > 0 || len(n.Pipe.Cmds) == 0 {
+		return
+	}
+
+	cmd := n.Pipe.Cmds[len(n.Pipe.Cmds)-1]
+	if whole, ok := inString[n]; ok {
+		l.checkStringAction(n, cmd, whole)
+		return
+	}
+	switch arg := jsonCommand(n.Pipe).Args[0].(type) {
+	case *parse.IdentifierNode:
+		if jsonSafeFuncs[arg.Ident] {
+			return
+		}
+	case *parse.BoolNode, *parse.NumberNode, *parse.NilNode:
+		return
+	case *parse.StringNode:
+		if len(n.Pipe.Cmds) == 1 && arg.Text == "" {
+			l.add(n, SeverityWarning, LintAlwaysEmpty, "action %s always renders empty", n)
+			l.suggest("remove %s", n)
+			return
+		}
+	}
+	l.add(n, SeverityWarning, LintRawOutput, "output of %s is not JSON encoded, consider using toJson", n)
+	if _, ok := cmd.Args[0].(*parse.IdentifierNode); !ok && len(n.Pipe.Cmds) == 1 {
+		l.suggest("use {{ toJson %s }} instead of %s", n.Pipe, n)
+	} else {
+		l.suggest("use {{ %s | toJson }} instead of %s", n.Pipe, n)
+	}
+}
+
+// jsonCommand returns the command that produces the JSON value of pipe,
+// skipping the last commands that only change its whitespace, like "indent"
+// in {{ toJson .SANs | indent 2 }}.
+func jsonCommand(pipe *parse.PipeNode) *parse.CommandNode {
+	cmds := pipe.Cmds
+	for len(cmds) > 1 {
+		id, ok := cmds[len(cmds)-1].Args[0].(*parse.IdentifierNode)
+		if !ok || !jsonWhitespaceFuncs[id.Ident] {
+			break
+		}
+		cmds = cmds[:len(cmds)-1]
+	}
+	return cmds[len(cmds)-1]
+}
+
+// checkStringAction reports an action rendered inside a JSON string, unless
+// its output never needs to be escaped. If the action is the whole string,
+// the lint suggests the replacement.
+func (l *linter) checkStringAction(n *parse.ActionNode, cmd *parse.CommandNode, whole bool) {
+	switch arg := cmd.Args[0].(type) {
+	case *parse.IdentifierNode:
+		if stringSafeFuncs[arg.Ident] {
+			return
+		}
+		if jsonSafeFuncs[arg.Ident] && whole {
+			l.add(n, SeverityWarning, LintUnescapedString, "output of %s is already JSON, remove the quotes around it", n)
+			l.suggest("use %s instead of \"%s\"", n, n)
+			return
+		}
+	case *parse.BoolNode, *parse.NumberNode, *parse.NilNode:
+		return
+	case *parse.StringNode:
+		if len(n.Pipe.Cmds) == 1 && !strings.ContainsAny(arg.Text, "\"\\") {
+			return
+		}
+	}
+
+	if !whole {
+		l.add(n, SeverityWarning, LintUnescapedString, "output of %s is not escaped inside a JSON string, build the whole string and use jsonQuote", n)
+		return
+	}
+	fix := "{{ " + n.Pipe.String() + " | jsonQuote }}"
+	if len(n.Pipe.Cmds) == 1 {
+		fix = "{{ jsonQuote " + n.Pipe.String() + " }}"
+	}
+	l.add(n, SeverityWarning, LintUnescapedString, "output of %s is not escaped inside a JSON string, use %s instead of \"%s\"", n, fix, n)
+	l.suggest("use %s instead of \"%s\"", fix, n)
+}
+
+func (l *linter) checkBranch(node parse.Node, n *parse.BranchNode, name string) {
+	if n.ElseList != nil || len(n.Pipe.Decl) > 0 || len(n.Pipe.Cmds) != 1 || len(n.Pipe.Cmds[0].Args) != 1 {
+		return
+	}
+	if isFalseConstant(n.Pipe.Cmds[0].Args[0]) {
+		l.add(node, SeverityWarning, LintAlwaysEmpty, "condition of {{%s %s}} is always false, the block never renders", name, n.Pipe)
+		l.suggest("remove the {{%s %s}} block", name, n.Pipe)
+	}
+}
+
+// isFalseConstant reports whether node is a constant with a false truth value.
+func isFalseConstant(node parse.Node) bool {
+	switch n := node.(type) {
+	case *parse.BoolNode:
+		return !n.True
+	case *parse.StringNode:
+		return n.Text == ""
+	case *parse.NumberNode:
+		return n.Text == "0"
+	case *parse.NilNode:
+		return true
+	default:
+		return false
+	}
+}
+
+// stringActions returns the actions in tree that render inside a JSON string
+// of the template text, like {{ .Name }} in "cn": "{{ .Name }}". The value is
+// true if the action is the whole content of the string. The text and the
+// actions are read in the order of the source, so the strings opened in a
+// branch are considered open in the next one.
+func stringActions(tree *parse.Tree) map[*parse.ActionNode]bool {
+	var nodes []parse.Node
+	walkTree(tree.Root, func(node parse.Node) bool {
+		switch n := node.(type) {
+		case *parse.TextNode:
+			nodes = append(nodes, n)
+		case *parse.ActionNode:
+			if len(n.Pipe.Decl) == 0 {
+				nodes = append(nodes, n)
+			}
+		}
+		return true
+	})
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].Position() < nodes[j].Position()
+	})
+
+	actions := make(map[*parse.ActionNode]bool)
+	// only is the action in the string, if nothing else has been rendered in
+	// it.
+	var only *parse.ActionNode
+	var inString, empty, escaped bool
+	for _, node := range nodes {
+		switch n := node.(type) {
+		case *parse.ActionNode:
+			if !inString {
+				continue
+			}
+			actions[n] = false
+			if empty {
+				only = n
+			} else {
+				only = nil
+			}
+			empty = false
+		case *parse.TextNode:
+			for _, c := range n.Text {
+				switch {
+				case !inString:
+					if c == '"' {
+						inString, empty, only = true, true, nil
+					}
+				case escaped:
+					escaped = false
+				case c == '"':
+					if only != nil {
+						actions[only] = true
+					}
+					inString = false
+				default:
+					escaped = c == '\\'
+					empty, only = false, nil
+				}
+			}
+		}
+	}
+	return actions
+}
+
+// closestFunc returns the name of the function in funcs, or predefined by
+// text/template, that name is probably a typo of, like "toJson" for "tojson",
+// or an empty string if there's none. See suggestKey.
+func closestFunc(name string, funcs map[string]interface{}) string {
+	names := make([]string, 0, len(funcs)+len(builtinFuncs))
+	for candidate := range funcs {
+		names = append(names, candidate)
+	}
+	for candidate := range builtinFuncs {
+		names = append(names, candidate)
+	}
+	sort.Strings(names)
+	return suggestKey(name, names)
+}
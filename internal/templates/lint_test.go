@@ -0,0 +1,115 @@
+package templates
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLintTemplate(t *testing.T) {
+	deprecated := WithDeprecatedFields(map[string]string{
+		".Insecure.CR": "use .Insecure.User instead",
+		".Token":       "",
+	})
+
+	type args struct {
+		data []byte
+		opts []Option
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []Lint
+		wantErr bool
+	}{
+		{"ok", args{[]byte(`{"subject": {{ toJson .Subject }}, "sans": {{ toJson .SANs }}}`), nil}, nil, false},
+		{"ok/literals", args{[]byte(`{"version": {{ 3 }}, "isCA": {{ true }}}{{ $a := .A }}`), nil}, nil, false},
+		{"ok/fail", args{[]byte(`{{ if not .Name }}{{ fail "name is required" }}{{ end }}{}`), nil}, nil, false},
+		{"ok/empty", args{[]byte(``), nil}, nil, false},
+		{"unknown-function", args{[]byte("{\n  \"a\": {{ toJson (foo .A) }}\n}"), nil}, []Lint{
+			{Severity: SeverityError, Code: LintUnknownFunction, Message: `function "foo" not defined`, Offset: 20, Line: 2, Column: 19},
+		}, false},
+		{"unknown-builtin-expandenv", args{[]byte(`{"home": {{ expandenv "$HOME" | toJson }}}`), nil}, []Lint{
+			{Severity: SeverityError, Code: LintUnknownFunction, Message: `function "expandenv" not defined`, Offset: 12, Line: 1, Column: 13},
+		}, false},
+		{"unescaped-string", args{[]byte(`{"commonName": "{{ .Subject.CommonName }}"}`), nil}, []Lint{
+			{Severity: SeverityWarning, Code: LintUnescapedString, Message: `output of {{.Subject.CommonName}} is not escaped inside a JSON string, use {{ jsonQuote .Subject.CommonName }} instead of "{{.Subject.CommonName}}"`, Offset: 19, Line: 1, Column: 20},
+		}, false},
+		{"unescaped-string/pipeline", args{[]byte(`{"cn": "{{ .CN | lower }}", "o": "{{ toJson .O }}"}`), nil}, []Lint{
+			{Severity: SeverityWarning, Code: LintUnescapedString, Message: `output of {{.CN | lower}} is not escaped inside a JSON string, use {{ .CN | lower | jsonQuote }} instead of "{{.CN | lower}}"`, Offset: 11, Line: 1, Column: 12},
+			{Severity: SeverityWarning, Code: LintUnescapedString, Message: `output of {{toJson .O}} is already JSON, remove the quotes around it`, Offset: 37, Line: 1, Column: 38},
+		}, false},
+		{"unescaped-string/partial", args{[]byte("{\n  \"uri\": \"spiffe://{{ .Domain }}/{{ .Name }}\",\n  \"a\": \"\\\"{{ .A }}\"\n}"), nil}, []Lint{
+			{Severity: SeverityWarning, Code: LintUnescapedString, Message: `output of {{.Domain}} is not escaped inside a JSON string, build the whole string and use jsonQuote`, Offset: 24, Line: 2, Column: 23},
+			{Severity: SeverityWarning, Code: LintUnescapedString, Message: `output of {{.Name}} is not escaped inside a JSON string, build the whole string and use jsonQuote`, Offset: 38, Line: 2, Column: 37},
+			{Severity: SeverityWarning, Code: LintUnescapedString, Message: `output of {{.A}} is not escaped inside a JSON string, build the whole string and use jsonQuote`, Offset: 62, Line: 3, Column: 14},
+		}, false},
+		{"unescaped-string/branch", args{[]byte(`{"cn": "{{ if .A }}{{ .A }}{{ else }}none{{ end }}"}`), nil}, []Lint{
+			{Severity: SeverityWarning, Code: LintUnescapedString, Message: `output of {{.A}} is not escaped inside a JSON string, build the whole string and use jsonQuote`, Offset: 22, Line: 1, Column: 23},
+		}, false},
+		{"ok/string-safe", args{[]byte(`{"id": "{{ sha256 .CN }}", "v": "v{{ 1 }}", "b": "{{ b64enc .B }}", "c": "{{ "x" }}"}`), nil}, nil, false},
+		{"ok/escaped-quote", args{[]byte(`{"a": "\"", "b": {{ toJson .B }}, "c": "\\"}{{ $x := "" }}`), nil}, nil, false},
+		{"ok/quote", args{[]byte(`{"commonName": {{ jsonQuote .Subject.CommonName }}, "o": {{ .Subject.Organization | jsonQuote }}}`), nil}, nil, false},
+		{"raw-output/pipeline", args{[]byte(`{"a": {{ toJson .A | upper }}}`), nil}, []Lint{
+			{Severity: SeverityWarning, Code: LintRawOutput, Message: `output of {{toJson .A | upper}} is not JSON encoded, consider using toJson`, Offset: 9, Line: 1, Column: 10},
+		}, false},
+		{"ok/whitespace", args{[]byte("{\n  \"sans\": {{ toJson .SANs | indent 2 }},\n  \"o\": {{ toPrettyJson .O | nindent 4 | trim }}\n}"), nil}, nil, false},
+		{"raw-output/whitespace", args{[]byte(`{"a": {{ .A | indent 2 }}, "b": {{ toJson .B | upper | indent 2 }}}`), nil}, []Lint{
+			{Severity: SeverityWarning, Code: LintRawOutput, Message: `output of {{.A | indent 2}} is not JSON encoded, consider using toJson`, Offset: 9, Line: 1, Column: 10},
+			{Severity: SeverityWarning, Code: LintRawOutput, Message: `output of {{toJson .B | upper | indent 2}} is not JSON encoded, consider using toJson`, Offset: 35, Line: 1, Column: 36},
+		}, false},
+		{"deprecated", args{[]byte(`{"cr": {{ toJson .Insecure.CR.Subject }}, "token": {{ toJson $.Token }}}`), []Option{deprecated}}, []Lint{
+			{Severity: SeverityWarning, Code: LintDeprecatedField, Message: `field .Insecure.CR is deprecated: use .Insecure.User instead`, Offset: 17, Line: 1, Column: 18},
+			{Severity: SeverityWarning, Code: LintDeprecatedField, Message: `field .Token is deprecated`, Offset: 61, Line: 1, Column: 62},
+		}, false},
+		{"deprecated/not-enabled", args{[]byte(`{"cr": {{ toJson .Insecure.CR }}}`), nil}, nil, false},
+		{"deprecated/prefix", args{[]byte(`{"cr": {{ toJson .Insecure.CRL }}}`), []Option{deprecated}}, nil, false},
+		{"always-empty/if", args{[]byte(`{}{{ if false }}{{ fail "never" }}{{ end }}`), nil}, []Lint{
+			{Severity: SeverityWarning, Code: LintAlwaysEmpty, Message: `condition of {{if false}} is always false, the block never renders`, Offset: 8, Line: 1, Column: 9},
+		}, false},
+		{"always-empty/with", args{[]byte(`{}{{ with "" }}{{ fail "never" }}{{ end }}`), nil}, []Lint{
+			{Severity: SeverityWarning, Code: LintAlwaysEmpty, Message: `condition of {{with ""}} is always false, the block never renders`, Offset: 10, Line: 1, Column: 11},
+		}, false},
+		{"always-empty/action", args{[]byte(`{}{{ "" }}`), nil}, []Lint{
+			{Severity: SeverityWarning, Code: LintAlwaysEmpty, Message: `action {{""}} always renders empty`, Offset: 5, Line: 1, Column: 6},
+		}, false},
+		{"ok/if-else", args{[]byte(`{{ if false }}{}{{ else }}[]{{ end }}`), nil}, nil, false},
+		{"sorted", args{[]byte(`{"a": "{{ .A }}", "b": {{ toJson (foo .B) }}}`), nil}, []Lint{
+			{Severity: SeverityWarning, Code: LintUnescapedString, Message: `output of {{.A}} is not escaped inside a JSON string, use {{ jsonQuote .A }} instead of "{{.A}}"`, Offset: 10, Line: 1, Column: 11},
+			{Severity: SeverityError, Code: LintUnknownFunction, Message: `function "foo" not defined`, Offset: 34, Line: 1, Column: 35},
+		}, false},
+		{"whitespace-trim", args{[]byte("{\"port\": {{ toJson .Port -}} 0,\n  \"n\": 1\n  {{- toJson .N }}}"), nil}, []Lint{
+			{Severity: SeverityWarning, Code: LintWhitespaceTrim, Message: `trim marker of {{toJson .Port}} joins its output to "0", which can change or break the JSON depending on the data`, Offset: 12, Line: 1, Column: 13},
+			{Severity: SeverityWarning, Code: LintWhitespaceTrim, Message: `trim marker of {{toJson .N}} joins its output to "1", which can change or break the JSON depending on the data`, Offset: 47, Line: 3, Column: 7},
+		}, false},
+		{"whitespace-trim/actions", args{[]byte(`{"a": {{ toJson .A -}} {{- toJson .B }}, "b": "x {{- jsonQuote .C }}"}`), nil}, []Lint{
+			{Severity: SeverityWarning, Code: LintWhitespaceTrim, Message: `trim marker of {{toJson .A}} joins its output to the output of {{toJson .B}} at line 1, column 28, which can change or break the JSON depending on the data`, Offset: 9, Line: 1, Column: 10},
+			{Severity: SeverityWarning, Code: LintUnescapedString, Message: `output of {{jsonQuote .C}} is not escaped inside a JSON string, build the whole string and use jsonQuote`, Offset: 53, Line: 1, Column: 54},
+			{Severity: SeverityWarning, Code: LintWhitespaceTrim, Message: `trim marker of {{jsonQuote .C}} joins its output to "x", which can change or break the JSON depending on the data`, Offset: 53, Line: 1, Column: 54},
+		}, false},
+		{"ok/whitespace-trim", args{[]byte("{\n  \"a\": {{- toJson .A -}} ,\n  \"b\": [ {{- toJson .B -}} ]\n  {{- if .C }}, \"c\": 1{{ end -}}\n  {{- /* \" -}} 1 */ -}}\n}"), nil}, nil, false},
+		{"ok/whitespace-trim-delims", args{[]byte(`{"a": [[ toJson .A ]], "b": [[ toJson "-]]" -]] ]}`), []Option{WithDelims("[[", "]]")}}, nil, false},
+		{"fail/parse", args{[]byte(`{{ if }}`), nil}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LintTemplate(tt.args.data, tt.args.opts...)
+			if tt.wantErr {
+				var te *TemplateError
+				if assert.True(t, errors.As(err, &te)) {
+					assert.Equal(t, ParseError, te.Kind)
+				}
+				assert.Nil(t, got)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLint_String(t *testing.T) {
+	l := Lint{Severity: SeverityWarning, Code: LintRawOutput, Message: "a message", Line: 2, Column: 10}
+	assert.Equal(t, "2:10: warning: a message", l.String())
+}
@@ -0,0 +1,186 @@
+package templates
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template/parse"
+)
+
+// LiteralKind is a kind of value that LintTemplate reports when it's written
+// as a literal string in the template text instead of taken from the template
+// data.
+type LiteralKind string
+
+const (
+	// LiteralDNSName is a DNS name with at least two labels, like
+	// "www.example.com". Names with a numeric last label, like object
+	// identifiers or versions, are not reported.
+	LiteralDNSName LiteralKind = "dnsName"
+	// LiteralEmail is an email address, like "jane@example.com".
+	LiteralEmail LiteralKind = "email"
+	// LiteralIP is an IPv4 or IPv6 address.
+	LiteralIP LiteralKind = "ip"
+	// LiteralDN is a distinguished name or one of its components, like
+	// "CN=Jane Doe,O=Acme".
+	LiteralDN LiteralKind = "dn"
+	// LiteralCommonName is any other value of a "commonName" key.
+	LiteralCommonName LiteralKind = "commonName"
+)
+
+// literalKindNames are the descriptions of the kinds used in the lints.
+var literalKindNames = map[LiteralKind]string{
+	LiteralDNSName:    "DNS name",
+	LiteralEmail:      "email address",
+	LiteralIP:         "IP address",
+	LiteralDN:         "distinguished name",
+	LiteralCommonName: "common name",
+}
+
+// dnComponentRegexp matches a value that starts like a component of a
+// distinguished name, like "CN=" or "ou =".
+var dnComponentRegexp = regexp.MustCompile(`^(?i)\s*(CN|O|OU|C|L|ST|DC|E|UID|STREET|POSTALCODE|SERIALNUMBER)\s*=`)
+
+// oidKeys are the keys of the object identifiers in the certificate
+// templates of x509util, whose values, like "2.5.4.3", can look like an IP
+// address.
+var oidKeys = map[string]bool{
+	"id": true, "type": true, "assigner": true,
+}
+
+// literalKind returns the kind of the literal string s, the value of key, or
+// an empty string if it doesn't look like an identifier.
+func literalKind(key, s string) LiteralKind {
+	switch {
+	case s == "" || oidKeys[key]:
+		return ""
+	case strings.Contains(s, "@") && isEmail(s):
+		return LiteralEmail
+	case isIP(s):
+		return LiteralIP
+	case dnComponentRegexp.MatchString(s):
+		return LiteralDN
+	case isHostname(s):
+		return LiteralDNSName
+	case key == "commonName":
+		return LiteralCommonName
+	default:
+		return ""
+	}
+}
+
+// isHostname reports whether s is a DNS name with at least two labels and a
+// last label that is not a number, so "1.2.840.10045" is not a hostname.
+func isHostname(s string) bool {
+	i := strings.LastIndexByte(s, '.')
+	if i < 0 || !isDNSName(s) {
+		return false
+	}
+	for _, c := range s[i+1:] {
+		if c < '0' || c > '9' {
+			return true
+		}
+	}
+	return false
+}
+
+// WithLiteralKinds is an option that sets the kinds of literal values that
+// LintTemplate reports as hardcoded. By default all of them are, and without
+// kinds none of them is.
+func WithLiteralKinds(kinds ...LiteralKind) Option {
+	return func(o *options) {
+		o.literalKinds = make(map[LiteralKind]bool, len(kinds))
+		for _, k := range kinds {
+			o.literalKinds[k] = true
+		}
+	}
+}
+
+// WithAllowedLiterals is an option that makes LintTemplate accept the given
+// values as literals in the template text, like the name of a CA that is the
+// same in every certificate. The values are compared without case.
+func WithAllowedLiterals(values ...string) Option {
+	return func(o *options) {
+		o.allowedLiterals = make(map[string]bool, len(values))
+		for _, v := range values {
+			o.allowedLiterals[strings.ToLower(v)] = true
+		}
+	}
+}
+
+// checkLiterals reports the strings of the template text of tree that are
+// values, not keys, and look like an identifier of a certificate, like a
+// hostname, that is probably copied from a specific certificate and should be
+// taken from the template data. Only the strings that start and end in the
+// same text are literals, the ones with an action inside are not, and the
+// arguments of the actions are not checked.
+func (l *linter) checkLiterals(tree *parse.Tree, o *options) {
+	if o.literalKinds != nil && len(o.literalKinds) == 0 {
+		return
+	}
+	var texts []*parse.TextNode
+	walkTree(tree.Root, func(node parse.Node) bool {
+		if n, ok := node.(*parse.TextNode); ok {
+			texts = append(texts, n)
+		}
+		return true
+	})
+	sort.SliceStable(texts, func(i, j int) bool {
+		return texts[i].Pos < texts[j].Pos
+	})
+
+	// The strings opened in a text are read in the order of the source, like
+	// in stringActions, so the end of a string with an action is skipped.
+	var inString, escaped bool
+	for _, n := range texts {
+		text := n.Text
+		// start is the offset of the quote of a string opened in this text,
+		// and key is the key of the next value, while it can be read.
+		start, key := -1, ""
+		for i := 0; i < len(text); i++ {
+			c := text[i]
+			switch {
+			case escaped:
+				escaped = false
+			case inString && c == '\\':
+				escaped = true
+			case inString && c == '"':
+				inString = false
+				if start < 0 {
+					break
+				}
+				var value string
+				if err := json.Unmarshal(text[start:i+1], &value); err != nil {
+					start, key = -1, ""
+					break
+				}
+				j := i + 1
+				for j < len(text) && isTrimSpace(text[j]) {
+					j++
+				}
+				if j < len(text) && text[j] == ':' {
+					start, key, i = -1, value, j
+					break
+				}
+				l.checkLiteral(int(n.Pos)+start, key, value, o)
+				start, key = -1, ""
+			case inString:
+			case c == '"':
+				inString, start = true, i
+			case !isTrimSpace(c):
+				key = ""
+			}
+		}
+	}
+}
+
+// checkLiteral reports the literal value of key at offset pos if it looks
+// like an identifier of a kind enabled in o, and it's not allowed.
+func (l *linter) checkLiteral(pos int, key, value string, o *options) {
+	kind := literalKind(key, value)
+	if kind == "" || (o.literalKinds != nil && !o.literalKinds[kind]) || o.allowedLiterals[strings.ToLower(value)] {
+		return
+	}
+	l.addAt(pos, SeverityWarning, LintHardcodedValue, "value %q looks like a hardcoded %s, consider taking it from the template data", value, literalKindNames[kind])
+}
@@ -0,0 +1,90 @@
+package templates
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLintTemplate_literals(t *testing.T) {
+	lint := func(offset, col int, value, kind string) Lint {
+		return Lint{
+			Severity: SeverityWarning,
+			Code:     LintHardcodedValue,
+			Message:  `value "` + value + `" looks like a hardcoded ` + kind + `, consider taking it from the template data`,
+			Offset:   offset, Line: 1, Column: col,
+		}
+	}
+	tests := []struct {
+		name string
+		text string
+		opts []Option
+		want []Lint
+	}{
+		{"ok/data", `{"subject": {"commonName": {{ toJson .CN }}}, "dnsNames": {{ toJson .SANs }}}`, nil, nil},
+		{"ok/not-identifiers", `{"keyUsage": ["digitalSignature"], "signatureAlgorithm": "SHA256-RSA", "policies": ["2.23.140.1.2.1"], "version": "v1.2"}`, nil, nil},
+		{"ok/oids", `{"extensions": [{"id": "2.5.29.17", "critical": false}], "subject": {"extraNames": [{"type": "2.5.4.3", "value": {{ toJson .CN }}}]}}`, nil, nil},
+		{"ok/keys", `{"www.example.com": {{ toJson .A }}, "jane@example.com" : {{ toJson .B }}}`, nil, nil},
+		{"ok/action-in-string", `{"dnsNames": ["{{ .Name }}.example.com", "www.{{ .Domain }}"]}`, nil, nil},
+		{"ok/action-arguments", `{"dnsNames": [{{ "www.example.com" | toJson }}]}`, nil, nil},
+		{"ok/empty-common-name", `{"subject": {"commonName": ""}}`, nil, nil},
+		{"common-name", `{"subject": {"commonName": "Jane Doe"}}`, nil, []Lint{
+			lint(27, 28, "Jane Doe", "common name"),
+		}},
+		{"dns-name", `{"subject": {"commonName": "www.example.com"}, "dnsNames": ["www.example.com", "*.example.com"]}`, nil, []Lint{
+			lint(27, 28, "www.example.com", "DNS name"),
+			lint(60, 61, "www.example.com", "DNS name"),
+			lint(79, 80, "*.example.com", "DNS name"),
+		}},
+		{"email", `{"emailAddresses": ["jane@example.com"]}`, nil, []Lint{
+			lint(20, 21, "jane@example.com", "email address"),
+		}},
+		{"ip", `{"ipAddresses": ["10.0.0.1", "2001:db8::1"]}`, nil, []Lint{
+			lint(17, 18, "10.0.0.1", "IP address"),
+			lint(29, 30, "2001:db8::1", "IP address"),
+		}},
+		{"dn", `{"issuer": {"extraNames": [{"type": "2.5.4.3", "value": "CN=Acme Root,O=Acme"}]}}`, nil, []Lint{
+			lint(56, 57, "CN=Acme Root,O=Acme", "distinguished name"),
+		}},
+		{"escaped", `{"subject": {"commonName": "Jane \"JD\" Doe"}}`, nil, []Lint{
+			lint(27, 28, `Jane \"JD\" Doe`, "common name"),
+		}},
+		{"after-action", `{"cn": "{{ .CN }}", "dnsNames": ["www.example.com"]}`, nil, []Lint{
+			lint(33, 34, "www.example.com", "DNS name"),
+		}},
+		{"kinds", `{"subject": {"commonName": "Jane Doe"}, "dnsNames": ["www.example.com"], "ipAddresses": ["10.0.0.1"]}`, []Option{WithLiteralKinds(LiteralIP, LiteralDNSName)}, []Lint{
+			lint(53, 54, "www.example.com", "DNS name"),
+			lint(89, 90, "10.0.0.1", "IP address"),
+		}},
+		{"kinds/none", `{"subject": {"commonName": "Jane Doe"}, "dnsNames": ["www.example.com"]}`, []Option{WithLiteralKinds()}, nil},
+		{"allowed", `{"subject": {"commonName": "Jane Doe"}, "dnsNames": ["ca.internal", "www.example.com"]}`, []Option{WithAllowedLiterals("CA.Internal", "jane doe")}, []Lint{
+			lint(68, 69, "www.example.com", "DNS name"),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lints, err := LintTemplate([]byte(tt.text), tt.opts...)
+			require.NoError(t, err)
+			var got []Lint
+			for _, l := range lints {
+				if l.Code == LintHardcodedValue {
+					got = append(got, l)
+				}
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLintTemplate_literals_definitions(t *testing.T) {
+	text := "{{ define \"subject\" }}{\"commonName\": \"jane@example.com\"}{{ end }}\n{\"subject\": {{ template \"subject\" }}}"
+	got, err := LintTemplate([]byte(text))
+	require.NoError(t, err)
+	assert.Equal(t, []Lint{{
+		Severity: SeverityWarning,
+		Code:     LintHardcodedValue,
+		Message:  `value "jane@example.com" looks like a hardcoded email address, consider taking it from the template data`,
+		Offset:   37, Line: 1, Column: 38,
+	}}, got)
+}
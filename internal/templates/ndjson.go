@@ -0,0 +1,61 @@
+package templates
+
+import (
+	"bytes"
+	"errors"
+)
+
+// ValidateTemplateDataNDJSON validates newline-delimited JSON, a sequence of
+// JSON documents with one document per line, like the output of a template
+// that ranges over a list of certificate definitions, where
+// ValidateTemplateData would fail after the first document. Each line is
+// validated as an independent document like ValidateTemplateData does, with
+// the same options, and the errors have the line and column of the whole
+// data. Blank lines, including a trailing new line, are skipped, and a
+// carriage return before the new line is allowed.
+//
+// The first error is returned, or with the WithAllErrors option, the errors of
+// all the lines, up to 10, in an Errors.
+func ValidateTemplateDataNDJSON(data []byte, opts ...Option) error {
+	o := newOptions(opts)
+	var errs Errors
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if err := validateNDJSONLine(line, o); err != nil {
+			// Validate the line again with the new lines before it, so the
+			// positions in the error are the ones in data.
+			err = validateNDJSONLine(append(bytes.Repeat([]byte("\n"), i), line...), o)
+			if !o.allErrors {
+				return err
+			}
+			var lineErrs Errors
+			if errors.As(err, &lineErrs) {
+				errs = append(errs, lineErrs...)
+			} else {
+				errs = append(errs, err)
+			}
+			if len(errs) >= maxDataErrors {
+				errs = errs[:maxDataErrors]
+				break
+			}
+		}
+	}
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return errs
+	}
+}
+
+// validateNDJSONLine validates a line of newline-delimited JSON.
+func validateNDJSONLine(line []byte, o *options) error {
+	if o.lenientJSON {
+		line = stripJSONExtensions(line)
+	}
+	return validateData(line, o)
+}
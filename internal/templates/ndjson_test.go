@@ -0,0 +1,70 @@
+package templates
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateTemplateDataNDJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		opts     []Option
+		wantErr  string
+		wantLine int
+	}{
+		{"ok/empty", "", nil, "", 0},
+		{"ok/one", `{"subject": {"commonName": "foo"}}`, nil, "", 0},
+		{"ok/lines", "{\"cn\": \"a\"}\n{\"cn\": \"b\"}\n[1, 2]\n", nil, "", 0},
+		{"ok/blank-lines", "\n{\"cn\": \"a\"}\n\n  \n{\"cn\": \"b\"}\n\n", nil, "", 0},
+		{"ok/crlf", "{\"cn\": \"a\"}\r\n{\"cn\": \"b\"}\r\n", nil, "", 0},
+		{"ok/lenient", "{\"cn\": \"a\",} // first\n{\"cn\": \"b\"}", []Option{WithLenientJSON(true)}, "", 0},
+		{"fail/line", "{\"cn\": \"a\"}\n{\"cn\": \"b\",}\n{\"cn\": \"c\"}", nil,
+			"error validating json template data: invalid JSON at cn (line 2, column 12): invalid character '}' looking for beginning of object key string", 2},
+		{"fail/column", "{\"a\": 1}\n\n  {\"sans\": [\"a\" \"b\"]}\n", nil,
+			"error validating json template data: invalid JSON at sans[1] (line 3, column 17): invalid character '\"' after array element", 3},
+		{"fail/two-documents", "{\"cn\": \"a\"} {\"cn\": \"b\"}", nil,
+			"error validating json template data: invalid JSON at (root) (line 1, column 13): invalid character '{' after top-level value", 1},
+		{"fail/duplicate", "{\"cn\": \"a\"}\n{\"cn\": \"a\", \"cn\": \"b\"}", []Option{WithRejectDuplicateKeys(true)},
+			"error validating json template data: duplicate key \"cn\" at line 2, column 13", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateTemplateDataNDJSON([]byte(tt.data), tt.opts...)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.wantErr)
+			var te *TemplateError
+			if assert.True(t, errors.As(err, &te)) {
+				assert.Equal(t, JSONError, te.Kind)
+				assert.Equal(t, tt.wantLine, te.Line)
+			}
+		})
+	}
+}
+
+func TestValidateTemplateDataNDJSON_allErrors(t *testing.T) {
+	data := []byte("{\"a\": 1}\n{\"a\": }\n{\"a\": 2}\n{\"a\": 3,}\n")
+	err := ValidateTemplateDataNDJSON(data, WithAllErrors(true))
+	var errs Errors
+	require.True(t, errors.As(err, &errs))
+	require.Len(t, errs, 2)
+	var te *TemplateError
+	require.True(t, errors.As(errs[0], &te))
+	assert.Equal(t, 2, te.Line)
+	require.True(t, errors.As(errs[1], &te))
+	assert.Equal(t, 4, te.Line)
+
+	var many []byte
+	for i := 0; i < 20; i++ {
+		many = append(many, "{,}\n"...)
+	}
+	err = ValidateTemplateDataNDJSON(many, WithAllErrors(true))
+	require.True(t, errors.As(err, &errs))
+	assert.Len(t, errs, maxDataErrors)
+}
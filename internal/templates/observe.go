@@ -0,0 +1,70 @@
+package templates
+
+import (
+	"errors"
+	"time"
+)
+
+// Observer receives the stages of the validations set with WithObserver, to
+// record metrics like the duration of each stage and the number of errors of
+// each kind. It only observes the validation, which is the same with or
+// without it. The methods are called synchronously from the validation, so
+// they should be fast, and they must be safe for concurrent use if the same
+// options are used concurrently, like in BatchValidate.
+type Observer interface {
+	// StageStart is called when a stage starts.
+	StageStart(stage Stage)
+	// StageEnd is called when a stage ends, with the time it took and its
+	// error, nil if it passed.
+	StageEnd(stage Stage, elapsed time.Duration, err error)
+	// CountError is called after StageEnd once for each error of the stage,
+	// one for each error in an Errors, with the kind of the TemplateError, or
+	// 0 if the error is not a TemplateError.
+	CountError(stage Stage, kind ErrorKind)
+}
+
+// WithObserver is an option that reports the stages of the validation to the
+// observer: StageTemplate and StageLint in Validate and ValidateWithData,
+// StageRender in Template.Validate, used by ValidateTemplateWithData and
+// BatchValidate too, and all the stages in ValidateAll, each one reported
+// once. Other functions, like Template.Render, are not observed. By default,
+// there's no observer, and the validation doesn't measure anything.
+func WithObserver(obs Observer) Option {
+	return func(o *options) {
+		o.observer = obs
+	}
+}
+
+// stageStart calls the StageStart of the observer of o, if any, and returns
+// the time the stage starts, or the zero time without an observer.
+func (o *options) stageStart(stage Stage) time.Time {
+	if o.observer == nil {
+		return time.Time{}
+	}
+	o.observer.StageStart(stage)
+	return time.Now()
+}
+
+// stageEnd calls the StageEnd of the observer of o, if any, for a stage that
+// started at start, and CountError for each error in err.
+func (o *options) stageEnd(stage Stage, start time.Time, err error) {
+	if o.observer == nil {
+		return
+	}
+	o.observer.StageEnd(stage, time.Since(start), err)
+	if err == nil {
+		return
+	}
+	var list Errors
+	if !errors.As(err, &list) {
+		list = Errors{err}
+	}
+	for _, err := range list {
+		var kind ErrorKind
+		var te *TemplateError
+		if errors.As(err, &te) {
+			kind = te.Kind
+		}
+		o.observer.CountError(stage, kind)
+	}
+}
@@ -0,0 +1,127 @@
+package templates
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingObserver records the calls to an Observer.
+type recordingObserver struct {
+	mu     sync.Mutex
+	events []string
+	counts map[ErrorKind]int
+}
+
+func (r *recordingObserver) StageStart(stage Stage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, "start "+string(stage))
+}
+
+func (r *recordingObserver) StageEnd(stage Stage, elapsed time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if elapsed < 0 {
+		panic("negative duration")
+	}
+	r.events = append(r.events, fmt.Sprintf("end %s: %v", stage, err != nil))
+}
+
+func (r *recordingObserver) CountError(stage Stage, kind ErrorKind) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.counts == nil {
+		r.counts = make(map[ErrorKind]int)
+	}
+	r.counts[kind]++
+	r.events = append(r.events, fmt.Sprintf("error %s: %s", stage, kind))
+}
+
+func TestWithObserver_ValidateAll(t *testing.T) {
+	text := []byte(`{"subject": {"commonName": {{ toJson .CN }}}, "dnsNames": {{ toJson .DNSNames }}, "basicConstraints": {"isCA": {{ .IsCA }}}}`)
+
+	obs := new(recordingObserver)
+	res, err := ValidateAll(text, []byte(`{"CN": "foo", "DNSNames": ["foo.example.com"], "IsCA": false}`), ProfileLeaf, WithObserver(obs))
+	require.NoError(t, err)
+	assert.True(t, res.IsValid)
+	assert.Equal(t, []string{
+		"start template", "end template: false",
+		"start lint", "end lint: false",
+		"start data", "end data: false",
+		"start render", "end render: false",
+		"start profile", "end profile: false",
+	}, obs.events)
+	assert.Empty(t, obs.counts)
+
+	// The errors are counted by kind.
+	obs = new(recordingObserver)
+	_, err = ValidateAll(text, []byte(`{"CN": "foo", "IsCA": true}`), ProfileLeaf, WithObserver(obs))
+	assert.Error(t, err)
+	assert.Equal(t, []string{
+		"start template", "end template: false",
+		"start lint", "end lint: false",
+		"start data", "end data: false",
+		"start render", "end render: false",
+		"start profile", "end profile: true",
+		"error profile: SchemaError", "error profile: SchemaError",
+	}, obs.events)
+	assert.Equal(t, map[ErrorKind]int{SchemaError: 2}, obs.counts)
+
+	obs = new(recordingObserver)
+	_, err = ValidateAll([]byte(`{"cn": {{ toJson .CN }`), []byte(`{"CN": }`), ProfileLeaf, WithObserver(obs))
+	assert.Error(t, err)
+	assert.Equal(t, []string{
+		"start template", "end template: true", "error template: ParseError",
+		"start lint", "end lint: true", "error lint: ParseError",
+		"start data", "end data: true", "error data: JSONError",
+	}, obs.events)
+}
+
+func TestWithObserver_Template(t *testing.T) {
+	obs := new(recordingObserver)
+	tmpl, err := ParseTemplate([]byte(`{{ if .Fail }}{{ fail "no" }}{{ end }}{"subject": {{ toJson .Subject }}}`), WithObserver(obs))
+	require.NoError(t, err)
+	assert.Empty(t, obs.events)
+
+	assert.NoError(t, tmpl.Validate([]byte(`{"Subject": "foo"}`)))
+	assert.Error(t, tmpl.Validate([]byte(`{"Fail": true}`)))
+	_, err = tmpl.Render([]byte(`{"Subject": "foo"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"start render", "end render: false",
+		"start render", "end render: true", "error render: ExecError",
+	}, obs.events)
+
+	// The validations of a batch are observed concurrently.
+	obs = new(recordingObserver)
+	errs := BatchValidate(tmpl.text, [][]byte{[]byte(`{}`), []byte(`{"Fail": true}`), []byte(`{"Fail": true}`)}, WithObserver(obs), WithWorkers(3))
+	assert.Len(t, errs, 3)
+	assert.Len(t, obs.events, 8)
+	assert.Equal(t, map[ErrorKind]int{ExecError: 2}, obs.counts)
+
+	// With a result.
+	obs = new(recordingObserver)
+	res, err := ValidateWithData(tmpl.text, []byte(`{"Subject": "foo"}`), WithObserver(obs))
+	require.NoError(t, err)
+	assert.True(t, res.IsValid)
+	assert.Equal(t, []string{
+		"start template", "end template: false",
+		"start lint", "end lint: false",
+		"start render", "end render: false",
+	}, obs.events)
+}
+
+func TestWithObserver_noObserver(t *testing.T) {
+	text := []byte(`{"subject": {{ toJson .Subject }}}`)
+	data := []byte(`{"Subject": "foo"}`)
+	want, wantErr := ValidateAll(text, data, ProfileLeaf)
+	got, err := ValidateAll(text, data, ProfileLeaf, WithObserver(new(recordingObserver)))
+	assert.Equal(t, wantErr, err)
+	got.FuncMap, want.FuncMap = nil, nil
+	assert.Equal(t, want, got)
+}
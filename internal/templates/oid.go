@@ -0,0 +1,104 @@
+package templates
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// oidNames are the object identifiers returned by the "oid" function for the
+// names of the common PKIX extensions, extended key usages and attributes.
+var oidNames = map[string]string{
+	// Extensions from RFC 5280.
+	"subjectKeyIdentifier":   "2.5.29.14",
+	"keyUsage":               "2.5.29.15",
+	"subjectAltName":         "2.5.29.17",
+	"issuerAltName":          "2.5.29.18",
+	"basicConstraints":       "2.5.29.19",
+	"cRLNumber":              "2.5.29.20",
+	"nameConstraints":        "2.5.29.30",
+	"cRLDistributionPoints":  "2.5.29.31",
+	"certificatePolicies":    "2.5.29.32",
+	"policyMappings":         "2.5.29.33",
+	"authorityKeyIdentifier": "2.5.29.35",
+	"policyConstraints":      "2.5.29.36",
+	"extKeyUsage":            "2.5.29.37",
+	"freshestCRL":            "2.5.29.46",
+	"inhibitAnyPolicy":       "2.5.29.54",
+	"authorityInfoAccess":    "1.3.6.1.5.5.7.1.1",
+	"subjectInfoAccess":      "1.3.6.1.5.5.7.1.11",
+	"tlsFeature":             "1.3.6.1.5.5.7.1.24",
+	"ocspNoCheck":            "1.3.6.1.5.5.7.48.1.5",
+	"ctPrecertificatePoison": "1.3.6.1.4.1.11129.2.4.3",
+	"ctSCTList":              "1.3.6.1.4.1.11129.2.4.2",
+	"stepProvisioner":        "1.3.6.1.4.1.37476.9000.64.1",
+	// Certificate policies.
+	"anyPolicy": "2.5.29.32.0",
+	// Extended key usages.
+	"anyExtendedKeyUsage": "2.5.29.37.0",
+	"serverAuth":          "1.3.6.1.5.5.7.3.1",
+	"clientAuth":          "1.3.6.1.5.5.7.3.2",
+	"codeSigning":         "1.3.6.1.5.5.7.3.3",
+	"emailProtection":     "1.3.6.1.5.5.7.3.4",
+	"timeStamping":        "1.3.6.1.5.5.7.3.8",
+	"ocspSigning":         "1.3.6.1.5.5.7.3.9",
+	// Access methods.
+	"ocsp":      "1.3.6.1.5.5.7.48.1",
+	"caIssuers": "1.3.6.1.5.5.7.48.2",
+	// Other names.
+	"permanentIdentifier": "1.3.6.1.5.5.7.8.3",
+	"hardwareModuleName":  "1.3.6.1.5.5.7.8.4",
+	"userPrincipalName":   "1.3.6.1.4.1.311.20.2.3",
+	"emailAddress":        "1.2.840.113549.1.9.1",
+	"commonName":          "2.5.4.3",
+	"serialNumber":        "2.5.4.5",
+	"country":             "2.5.4.6",
+	"locality":            "2.5.4.7",
+	"province":            "2.5.4.8",
+	"streetAddress":       "2.5.4.9",
+	"organization":        "2.5.4.10",
+	"organizationalUnit":  "2.5.4.11",
+	"postalCode":          "2.5.4.17",
+	"domainComponent":     "0.9.2342.19200300.100.1.25",
+	"userID":              "0.9.2342.19200300.100.1.1",
+}
+
+// oid returns the object identifier with the given name, like
+// "subjectAltName", or the object identifier s in dotted-decimal notation, with
+// the leading zeros removed. Names are case insensitive. The first arc must be
+// 0, 1 or 2, the second one less than 40 unless the first one is 2, and all of
+// them must fit in an int, like x509util requires.
+func oid(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if v, ok := oidNames[s]; ok {
+		return v, nil
+	}
+	for name, v := range oidNames {
+		if strings.EqualFold(name, s) {
+			return v, nil
+		}
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 {
+		return "", fmt.Errorf("error parsing oid: %q is not a known name or a dotted-decimal object identifier", s)
+	}
+	arcs := make([]string, len(parts))
+	for i, p := range parts {
+		if p == "" || strings.Trim(p, "0123456789") != "" {
+			return "", fmt.Errorf("error parsing oid: %q is not a known name or a dotted-decimal object identifier", s)
+		}
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return "", fmt.Errorf("error parsing oid %q: arc %s is too large", s, p)
+		}
+		switch {
+		case i == 0 && n > 2:
+			return "", fmt.Errorf("error parsing oid %q: first arc must be 0, 1 or 2", s)
+		case i == 1 && n >= 40 && arcs[0] != "2":
+			return "", fmt.Errorf("error parsing oid %q: second arc must be less than 40", s)
+		}
+		arcs[i] = strconv.Itoa(n)
+	}
+	return strings.Join(arcs, "."), nil
+}
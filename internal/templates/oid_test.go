@@ -0,0 +1,77 @@
+package templates
+
+import (
+	"encoding/asn1"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_oid(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    string
+		wantErr string
+	}{
+		{"name", "subjectAltName", "2.5.29.17", ""},
+		{"name/case", "BasicConstraints", "2.5.29.19", ""},
+		{"name/spaces", " serverAuth ", "1.3.6.1.5.5.7.3.1", ""},
+		{"dotted", "1.3.6.1.4.1.37476.9000.64.1", "1.3.6.1.4.1.37476.9000.64.1", ""},
+		{"dotted/zeros", "1.03.006.1", "1.3.6.1", ""},
+		{"dotted/two-arcs", "2.999", "2.999", ""},
+		{"dotted/zero-arcs", "0.0", "0.0", ""},
+		{"fail/unknown", "subjectAlternativeName", "", `error parsing oid: "subjectAlternativeName" is not a known name or a dotted-decimal object identifier`},
+		{"fail/empty", "", "", `error parsing oid: "" is not a known name or a dotted-decimal object identifier`},
+		{"fail/one-arc", "1", "", `error parsing oid: "1" is not a known name or a dotted-decimal object identifier`},
+		{"fail/empty-arc", "1..2", "", `error parsing oid: "1..2" is not a known name or a dotted-decimal object identifier`},
+		{"fail/trailing-dot", "1.2.", "", `error parsing oid: "1.2." is not a known name or a dotted-decimal object identifier`},
+		{"fail/negative", "1.-2", "", `error parsing oid: "1.-2" is not a known name or a dotted-decimal object identifier`},
+		{"fail/first-arc", "3.1", "", `error parsing oid "3.1": first arc must be 0, 1 or 2`},
+		{"fail/second-arc", "1.40", "", `error parsing oid "1.40": second arc must be less than 40`},
+		{"fail/too-large", "1.2.99999999999999999999", "", `error parsing oid "1.2.99999999999999999999": arc 99999999999999999999 is too large`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := oid(tt.s)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_oidNames(t *testing.T) {
+	for name, s := range oidNames {
+		got, err := oid(s)
+		require.NoError(t, err, name)
+		assert.Equal(t, s, got, name)
+
+		// The identifiers can be encoded in a certificate.
+		var id asn1.ObjectIdentifier
+		for _, arc := range strings.Split(s, ".") {
+			n, err := strconv.Atoi(arc)
+			require.NoError(t, err, name)
+			id = append(id, n)
+		}
+		_, err = asn1.Marshal(id)
+		assert.NoError(t, err, name)
+	}
+}
+
+func TestTemplate_oid(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"extensions": [{"id": {{ oid "stepProvisioner" | jsonQuote }}, "value": ""}], "extKeyUsage": [{{ oid .EKU | jsonQuote }}]}`))
+	require.NoError(t, err)
+	out, err := tmpl.Render([]byte(`{"EKU": "1.3.6.1.5.5.7.3.01"}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"extensions": [{"id": "1.3.6.1.4.1.37476.9000.64.1", "value": ""}], "extKeyUsage": ["1.3.6.1.5.5.7.3.1"]}`, string(out))
+
+	_, err = tmpl.Render([]byte(`{"EKU": "serverauth.1"}`))
+	assert.EqualError(t, err, `error executing template: error parsing oid: "serverauth.1" is not a known name or a dotted-decimal object identifier`)
+}
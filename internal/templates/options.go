@@ -0,0 +1,485 @@
+package templates
+
+import (
+	"io"
+	"io/fs"
+	"math/big"
+	"sort"
+	"text/template"
+	"time"
+)
+
+// options are the options used to validate templates.
+type options struct {
+	strict               bool
+	rejectDuplicateKeys  bool
+	deprecatedFields     map[string]string
+	lenientJSON          bool
+	allowedEnv           map[string]struct{}
+	lookupEnv            func(string) (string, bool)
+	maxOutputBytes       int64
+	leftDelim            string
+	rightDelim           string
+	allErrors            bool
+	now                  func() time.Time
+	rejectEmptyOutput    bool
+	rejectNoValue        bool
+	rejectInvalidUTF8    bool
+	includeFS            fs.FS
+	maxDepth             int
+	timeout              time.Duration
+	deniedFuncs          map[string]struct{}
+	allowedKeys          []string
+	rand                 io.Reader
+	ranges               map[string]rangeCheck
+	renderMode           RenderMode
+	funcs                template.FuncMap
+	profile              Profile
+	workers              int
+	snapshot             *funcMapSnapshot
+	outputValidators     []func([]byte) error
+	keyResolver          func(string) ([]byte, error)
+	maxValidity          time.Duration
+	keyType              string
+	issuer               []byte
+	rejectWildcards      bool
+	literalKinds         map[LiteralKind]bool
+	allowedLiterals      map[string]bool
+	applyProfileDefaults bool
+	allowCommonNameOnly  bool
+	observer             Observer
+	validateDefinitions  bool
+	profileDefaults      map[Profile]map[string]interface{}
+}
+
+// Option is the type used to pass custom attributes to the validation
+// functions.
+type Option func(o *options)
+
+func newOptions(opts []Option) *options {
+	o := new(options)
+	for _, fn := range opts {
+		fn(o)
+	}
+	return o
+}
+
+// WithStrict is an option that makes the execution of a template fail if it
+// references a key that is not present in the template data. By default, a
+// missing key is silently rendered as "<no value>".
+func WithStrict(strict bool) Option {
+	return func(o *options) {
+		o.strict = strict
+	}
+}
+
+// WithRejectDuplicateKeys is an option that makes the validation of JSON fail
+// if an object contains the same key more than once. By default, duplicate
+// keys are allowed, and when the JSON is unmarshaled the last one wins. The
+// check applies to the template data and to the rendered output of a
+// template.
+func WithRejectDuplicateKeys(reject bool) Option {
+	return func(o *options) {
+		o.rejectDuplicateKeys = reject
+	}
+}
+
+// WithValidateDefinitions is an option that makes ValidateTemplate execute each
+// template defined with {{ define }} with empty template data, and fail if any
+// of them fails or doesn't render a complete JSON document. It's meant for
+// files of templates where each definition is a whole certificate, like one
+// for X.509 and one for SSH. By default, the definitions are only parsed,
+// because partials usually render fragments of JSON, like
+// "keyUsage": ["digitalSignature"], or read fields that the empty template
+// data doesn't have.
+func WithValidateDefinitions(validate bool) Option {
+	return func(o *options) {
+		o.validateDefinitions = validate
+	}
+}
+
+// WithDeprecatedFields is an option that makes LintTemplate report the use of
+// the given template data fields. The keys of the map are the fields as they
+// are written in a template, for example ".Insecure.CR", and the values are an
+// optional message, like the field to use instead.
+func WithDeprecatedFields(fields map[string]string) Option {
+	return func(o *options) {
+		o.deprecatedFields = fields
+	}
+}
+
+// WithLenientJSON is an option that allows // and /* */ comments and trailing
+// commas in objects and arrays in the template data. Comments and trailing
+// commas are removed before validating the data, keeping the positions of the
+// remaining characters, so errors report the lines and columns of the original
+// data. Any other deviation from JSON is still an error.
+func WithLenientJSON(lenient bool) Option {
+	return func(o *options) {
+		o.lenientJSON = lenient
+	}
+}
+
+// WithAllowedEnv is an option that allows the template function "env" to read
+// the given environment variables. By default, no variable is allowed and any
+// use of "env" makes the template fail, this way a validation without this
+// option rejects templates that depend on the environment.
+func WithAllowedEnv(names ...string) Option {
+	return func(o *options) {
+		o.allowedEnv = make(map[string]struct{}, len(names))
+		for _, name := range names {
+			o.allowedEnv[name] = struct{}{}
+		}
+	}
+}
+
+// WithEnvLookup is an option that replaces the function used by the template
+// function "env" to read the environment variables, by default os.LookupEnv.
+func WithEnvLookup(fn func(name string) (string, bool)) Option {
+	return func(o *options) {
+		o.lookupEnv = fn
+	}
+}
+
+// WithKeyResolver is an option that sets the function used by the template
+// functions "keyFingerprint" and "keySubjectKeyId" to read the bytes of a key
+// by its name, like a key in a keystore of the caller. The function should
+// return an error for an unknown name. By default, there's no resolver and
+// both functions fail, so templates cannot access any key.
+func WithKeyResolver(fn func(name string) ([]byte, error)) Option {
+	return func(o *options) {
+		o.keyResolver = fn
+	}
+}
+
+// WithIssuer is an option that sets the certificate or the key of the issuer
+// of the certificates rendered by a template, in PEM or DER, used by the
+// template function "authorityKeyId". By default, there's no issuer and the
+// function fails, so a template that uses it cannot be validated without
+// data, or rendered, with a wrong identifier.
+func WithIssuer(issuer []byte) Option {
+	return func(o *options) {
+		o.issuer = issuer
+	}
+}
+
+// WithMaxValidity is an option that sets the maximum lifetime of a
+// certificate accepted by the template function "validity", like the maximum
+// enforced by the CA, so templates requesting a longer one fail at validation.
+// By default, or if d is 0 or less, the lifetime is not limited.
+func WithMaxValidity(d time.Duration) Option {
+	return func(o *options) {
+		o.maxValidity = d
+	}
+}
+
+// WithKeyType is an option that sets the type of the key of the certificate,
+// like "EC-P256" or "RSA-2048", or any alias accepted by the template function
+// "keyType", so the template function "signatureAlgorithm" checks that the
+// algorithm can be used with the key without giving the key type to it. By
+// default, the key type is not known and only the algorithm is validated.
+func WithKeyType(kt string) Option {
+	return func(o *options) {
+		o.keyType = kt
+	}
+}
+
+// WithMaxOutputBytes is an option that aborts the execution of a template as
+// soon as its output is larger than the given number of bytes. By default, or
+// if n is 0 or less, the size of the output is not limited.
+func WithMaxOutputBytes(n int64) Option {
+	return func(o *options) {
+		o.maxOutputBytes = n
+	}
+}
+
+// WithDelims is an option that sets the action delimiters of the templates to
+// the given strings, by default "{{" and "}}". Other delimiters are useful when
+// the literal text of a template contains "{{", for example a description with
+// a snippet of another template. An empty delimiter uses the default one.
+func WithDelims(left, right string) Option {
+	return func(o *options) {
+		o.leftDelim = left
+		o.rightDelim = right
+	}
+}
+
+// delims returns the left and right delimiters, using the defaults if they are
+// not set.
+func (o *options) delims() (string, string) {
+	left, right := o.leftDelim, o.rightDelim
+	if left == "" {
+		left = "{{"
+	}
+	if right == "" {
+		right = "}}"
+	}
+	return left, right
+}
+
+// WithAllErrors is an option that makes the validation of the template data
+// report all the syntax errors it can find, instead of only the first one.
+// After an error, the invalid value is skipped and the validation continues
+// with the next one, so a document with several mistyped values is fixed in a
+// single pass. Errors that cannot be skipped, like a missing closing bracket,
+// end the validation. If there's more than one error, the returned error is an
+// Errors.
+func WithAllErrors(all bool) Option {
+	return func(o *options) {
+		o.allErrors = all
+	}
+}
+
+// WithClock is an option that replaces the function used by the template
+// functions "now" and "dateAdd" to get the current time, by default time.Now.
+// It allows validations that use the current time to be deterministic.
+func WithClock(now func() time.Time) Option {
+	return func(o *options) {
+		o.now = now
+	}
+}
+
+// WithRandReader is an option that replaces the source of the random bytes
+// used by the template functions "randHex", "randAlnum" and "uuidV4", by
+// default crypto/rand.Reader. It allows validations and tests of templates
+// using random values to be deterministic.
+func WithRandReader(r io.Reader) Option {
+	return func(o *options) {
+		o.rand = r
+	}
+}
+
+// WithRejectEmptyOutput is an option that makes the validation of a template
+// with data fail if the output is empty or only contains white space, like the
+// output of a template with everything inside an if that is always false. An
+// empty template is still valid.
+func WithRejectEmptyOutput(reject bool) Option {
+	return func(o *options) {
+		o.rejectEmptyOutput = reject
+	}
+}
+
+// WithRejectWildcards is an option that makes the template functions
+// "isDNSName", "assertDNSName" and "sans" reject DNS names with a wildcard,
+// like "*.example.com", for profiles that don't allow wildcard certificates.
+// By default, a wildcard is allowed in the leftmost label.
+func WithRejectWildcards(reject bool) Option {
+	return func(o *options) {
+		o.rejectWildcards = reject
+	}
+}
+
+// WithRejectNoValue is an option that makes the validation of a template with
+// data fail if the output contains "<no value>", the text rendered by
+// text/template for a missing key, even inside a JSON string. Each
+// occurrence, up to 10, is reported with the position in the template of the
+// action that rendered it. Unlike WithStrict, the template is executed as it
+// is, so a missing key used in a condition or with "default" is not an error.
+func WithRejectNoValue(reject bool) Option {
+	return func(o *options) {
+		o.rejectNoValue = reject
+	}
+}
+
+// WithRejectInvalidUTF8 is an option that makes the validation of a template
+// with data fail if the output is not valid UTF-8, like when the template
+// writes raw bytes of the template data. JSON must be UTF-8, but json.Valid
+// and some decoders accept invalid sequences inside strings. The first invalid
+// sequence is reported with the position in the template of the text or the
+// action that rendered it.
+func WithRejectInvalidUTF8(reject bool) Option {
+	return func(o *options) {
+		o.rejectInvalidUTF8 = reject
+	}
+}
+
+// WithIncludeFS is an option that enables the template function "include",
+// used like {{ include "common/org.tmpl" }}, to render the files in fsys. By
+// default, "include" fails, so templates cannot access any file.
+func WithIncludeFS(fsys fs.FS) Option {
+	return func(o *options) {
+		o.includeFS = fsys
+	}
+}
+
+// WithMaxDepth is an option that sets the maximum nesting depth of the objects
+// and arrays in the template data and in the output of a template. By default,
+// or if n is 0 or less, the maximum depth is DefaultMaxDepth.
+func WithMaxDepth(n int) Option {
+	return func(o *options) {
+		o.maxDepth = n
+	}
+}
+
+// WithTimeout is an option that aborts the execution of a template if it takes
+// longer than the given duration, so a server can bound the time spent
+// validating untrusted templates. The validation returns an ExecError as soon
+// as the timeout expires, and the execution, that cannot be interrupted, stops
+// the next time the template writes to its output or calls a function. A
+// template that does neither, like nested range actions without output, keeps
+// running in the background until it finishes. By default, or if d is 0 or
+// less, there's no timeout.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+// WithDeniedFuncs is an option that makes the parsing of a template fail if it
+// uses any of the given functions, so untrusted templates can be validated
+// without, for example, "env" or "include", while trusted ones keep them. The
+// functions are still defined, so the error says that the function is denied
+// instead of not defined, and includes its position. Included files are
+// checked too.
+func WithDeniedFuncs(names ...string) Option {
+	return func(o *options) {
+		o.deniedFuncs = make(map[string]struct{}, len(names))
+		for _, name := range names {
+			o.deniedFuncs[name] = struct{}{}
+		}
+	}
+}
+
+// WithFuncs is an option that adds the given functions to the ones available
+// to templates, like helpers specific to a deployment. Calling it more than
+// once adds all the functions. The functions cannot have the name of one
+// returned by GetFuncMap, or of one predefined by text/template: ParseTemplate
+// and BuildFuncMap fail if they do, and anywhere else the built-in function is
+// kept, so "fail" and the rest always work as documented. Included files can
+// use the functions too.
+func WithFuncs(funcs template.FuncMap) Option {
+	return func(o *options) {
+		// The map is copied so the functions of a Template are not changed
+		// by the options of a render.
+		m := make(template.FuncMap, len(o.funcs)+len(funcs))
+		for name, fn := range o.funcs {
+			m[name] = fn
+		}
+		for name, fn := range funcs {
+			m[name] = fn
+		}
+		o.funcs = m
+	}
+}
+
+// WithAllowedTopLevelKeys is an option that makes the validation of the
+// rendered output of a template fail with a SchemaError if it's an object with
+// a key that is not one of the given ones, like "subjekt" instead of
+// "subject". The error suggests the allowed key closest to the unknown one, if
+// any is close enough. Outputs that are not objects, and nested objects, are
+// not checked. By default, any key is allowed.
+func WithAllowedTopLevelKeys(keys ...string) Option {
+	return func(o *options) {
+		o.allowedKeys = append([]string{}, keys...)
+		sort.Strings(o.allowedKeys)
+	}
+}
+
+// WithRangeCheck is an option that makes the validation of the rendered output
+// of a template fail with a SchemaError if the number at path is less than min
+// or greater than max, like a negative "basicConstraints.maxPathLen". A nil
+// min or max is not checked. Paths use the same notation as the errors, like
+// "subject.names[2].type", with "[*]" matching any element of an array, like
+// in "extensions[*].critical". The numbers are compared exactly, so serial
+// numbers that don't fit in an int64 can be checked too. Values that are not
+// numbers are reported, but a missing value is not, use a schema for required
+// fields. The option can be used more than once, and all the violations are
+// reported, in an Errors if there's more than one.
+func WithRangeCheck(path string, min, max *big.Int) Option {
+	return func(o *options) {
+		// The map is copied so the checks of a Template are not changed by
+		// the options of a render.
+		ranges := make(map[string]rangeCheck, len(o.ranges)+1)
+		for p, r := range o.ranges {
+			ranges[p] = r
+		}
+		o.ranges = ranges
+		var r rangeCheck
+		if min != nil {
+			r.min = new(big.Rat).SetInt(min)
+		}
+		if max != nil {
+			r.max = new(big.Rat).SetInt(max)
+		}
+		o.ranges[path] = r
+	}
+}
+
+// RenderMode is the format of the output of Template.Render, set with
+// WithRenderMode.
+type RenderMode int
+
+const (
+	// RenderRaw returns the output as the template renders it, without
+	// validating it.
+	RenderRaw RenderMode = iota
+	// RenderCompact returns the validated output without insignificant white
+	// space.
+	RenderCompact
+	// RenderPretty returns the validated output indented with two spaces,
+	// with a new line at the end like NormalizeJSON.
+	RenderPretty
+)
+
+// WithRenderMode is an option that sets the format of the output of
+// Template.Render. With RenderCompact and RenderPretty, the output is
+// validated like in Template.Validate, and the validation error is returned
+// if it's not valid JSON. Only the white space changes, the order of the keys
+// and the numbers are kept as they are rendered. By default, the output is
+// returned as it's rendered, RenderRaw.
+func WithRenderMode(mode RenderMode) Option {
+	return func(o *options) {
+		o.renderMode = mode
+	}
+}
+
+// WithProfile is an option that makes the validation of the rendered output
+// of a template fail with a SchemaError for each field that is not valid in
+// the given profile, like the "principals" of an SSH certificate in the
+// template of an X.509 leaf certificate, or a CA with "isCA" set to false.
+// Each error has the path of the field and its position in the template, and
+// all of them are reported, in an Errors if there's more than one. Only the
+// rendered output is checked, not the template data. The profile is also
+// returned by the template functions "profile" and "isCA", and it can be set
+// for a single render with Template.Render. By default, the output is not
+// validated against a profile.
+func WithProfile(p Profile) Option {
+	return func(o *options) {
+		o.profile = p
+	}
+}
+
+// WithAllowCommonNameOnly is an option that allows the output of a template
+// validated with ProfileLeaf to have no subject alternative names, like the
+// legacy certificates with the name only in the common name of the subject.
+// By default, a leaf certificate must have at least one, in "sans",
+// "dnsNames", "emailAddresses", "ipAddresses" or "uris".
+func WithAllowCommonNameOnly(allow bool) Option {
+	return func(o *options) {
+		o.allowCommonNameOnly = allow
+	}
+}
+
+// WithWorkers is an option that sets the number of data sets validated at the
+// same time by BatchValidate. By default, or if n is 0 or less, it's the
+// number of CPUs that can be used, runtime.GOMAXPROCS(0).
+func WithWorkers(n int) Option {
+	return func(o *options) {
+		o.workers = n
+	}
+}
+
+// WithOutputValidators is an option that adds checks of the caller to the
+// validation of the rendered output of a template, like a policy requiring a
+// common name that matches a regular expression. The validators receive the
+// output once it's valid JSON and has passed the other checks, and all of them
+// run: each error returned is reported as a SchemaError with the error as its
+// cause, and several errors are returned in an Errors. Calling it more than
+// once adds all the validators, and they run in the order they are added.
+func WithOutputValidators(fns ...func(out []byte) error) Option {
+	return func(o *options) {
+		// The capacity is limited so the validators of a Template are not
+		// changed by the options of a render.
+		n := len(o.outputValidators)
+		o.outputValidators = append(o.outputValidators[:n:n], fns...)
+	}
+}
@@ -0,0 +1,34 @@
+package templates
+
+import (
+	"regexp"
+	"strconv"
+)
+
+var identifierRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// joinPath returns the path of the member key of the object at path. Paths
+// use a dotted notation like "subject.names[2].type", keys that are not
+// identifiers are quoted, and the empty path is the root document.
+func joinPath(path, key string) string {
+	if !identifierRegexp.MatchString(key) {
+		return path + "[" + strconv.Quote(key) + "]"
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// indexPath returns the path of the element i of the array at path.
+func indexPath(path string, i int) string {
+	return path + "[" + strconv.Itoa(i) + "]"
+}
+
+// displayPath returns the path to use in error messages.
+func displayPath(path string) string {
+	if path == "" {
+		return "(root)"
+	}
+	return path
+}
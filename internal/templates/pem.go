@@ -0,0 +1,260 @@
+package templates
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha1" //nolint:gosec // SubjectKeyIdentifier by RFC 5280
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The PEM block types supported by the "pem" and "deriveKeyID" functions.
+const (
+	pemTypeCertificate = "CERTIFICATE"
+	pemTypePublicKey   = "PUBLIC KEY"
+	pemTypePrivateKey  = "PRIVATE KEY"
+)
+
+// loosePEMRegexp matches a PEM block whose lines have been joined or split by
+// white space, like when it's copied from a terminal or a web page.
+var loosePEMRegexp = regexp.MustCompile(`^-----BEGIN ([A-Z0-9 ]+)-----([A-Za-z0-9+/=\s]*)-----END ([A-Z0-9 ]+)-----`)
+
+// decodePEM returns the blocks in s. Each block must be a certificate, a
+// public key or a PKCS #8 private key, and its contents must be valid. White
+// space around and inside the blocks is ignored, so blocks with the new lines
+// replaced by spaces, or with extra spaces, are decoded too.
+func decodePEM(s string) ([]*pem.Block, error) {
+	rest := []byte(strings.TrimSpace(s))
+	if len(rest) == 0 {
+		return nil, fmt.Errorf("error parsing pem: no PEM block found")
+	}
+
+	var blocks []*pem.Block
+	for len(rest) > 0 {
+		if !bytes.HasPrefix(rest, []byte("-----BEGIN ")) {
+			return nil, fmt.Errorf("error parsing pem: unexpected data outside of a PEM block")
+		}
+		// pem.Decode skips the invalid blocks, decode only the first one.
+		first := rest
+		if i := bytes.Index(rest, []byte("-----END ")); i >= 0 {
+			if j := bytes.Index(rest[i+9:], []byte("-----")); j >= 0 {
+				first = rest[:i+9+j+5]
+			}
+		}
+		block, r := pem.Decode(first)
+		if block == nil {
+			var err error
+			if block, r, err = decodeLoosePEM(rest); err != nil {
+				return nil, err
+			}
+		} else {
+			r = rest[len(first)-len(r):]
+		}
+		if err := checkPEMBlock(block); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+		rest = bytes.TrimSpace(r)
+	}
+	return blocks, nil
+}
+
+// decodeLoosePEM decodes the PEM block at the start of data removing any
+// white space in it.
+func decodeLoosePEM(data []byte) (*pem.Block, []byte, error) {
+	m := loosePEMRegexp.FindSubmatchIndex(data)
+	if m == nil {
+		return nil, nil, fmt.Errorf("error parsing pem: invalid PEM block")
+	}
+	typ, end := string(data[m[2]:m[3]]), string(data[m[6]:m[7]])
+	if typ != end {
+		return nil, nil, fmt.Errorf("error parsing pem: block %s ends with %s", typ, end)
+	}
+	body := bytes.Join(bytes.Fields(data[m[4]:m[5]]), nil)
+	b, err := base64.StdEncoding.DecodeString(string(body))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing pem: invalid %s block: %w", typ, err)
+	}
+	return &pem.Block{Type: typ, Bytes: b}, data[m[1]:], nil
+}
+
+// checkPEMBlock checks that the block is of a supported type, and that its
+// contents can be parsed.
+func checkPEMBlock(block *pem.Block) error {
+	var err error
+	switch block.Type {
+	case pemTypeCertificate:
+		_, err = x509.ParseCertificate(block.Bytes)
+	case pemTypePublicKey:
+		_, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case pemTypePrivateKey:
+		_, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return fmt.Errorf("error parsing pem: unsupported block type %q", block.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("error parsing pem: invalid %s block: %w", block.Type, err)
+	}
+	return nil
+}
+
+// normalizePEM returns the blocks in s encoded again, with the contents in
+// lines of 64 characters and a new line at the end of each block, so the
+// result is the same no matter how the input was formatted.
+func normalizePEM(s string) (string, error) {
+	blocks, err := decodePEM(s)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	for _, block := range blocks {
+		if err := pem.Encode(&buf, block); err != nil {
+			return "", fmt.Errorf("error encoding pem: %w", err)
+		}
+	}
+	return buf.String(), nil
+}
+
+// subjectPublicKeyInfo is the ASN.1 structure of a PKIX public key.
+type subjectPublicKeyInfo struct {
+	Algorithm        asn1.RawValue
+	SubjectPublicKey asn1.BitString
+}
+
+// deriveKeyID returns the key identifier of the public key in the first block
+// of s, a certificate, a public key, or a private key, as the SHA-1 hash of
+// the public key bits, like x509util does for the subject key identifier. The
+// identifier is encoded in standard base64, the encoding used by the
+// "subjectKeyId" and "authorityKeyId" fields of a certificate template.
+func deriveKeyID(s string) (string, error) {
+	blocks, err := decodePEM(s)
+	if err != nil {
+		return "", err
+	}
+
+	var pub crypto.PublicKey
+	block := blocks[0]
+	switch block.Type {
+	case pemTypeCertificate:
+		cert, _ := x509.ParseCertificate(block.Bytes)
+		pub = cert.PublicKey
+	case pemTypePublicKey:
+		pub, _ = x509.ParsePKIXPublicKey(block.Bytes)
+	case pemTypePrivateKey:
+		key, _ := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if pub, err = signerPublicKey(key); err != nil {
+			return "", err
+		}
+	}
+	return publicKeyID(pub)
+}
+
+// signerPublicKey returns the public key of a private key.
+func signerPublicKey(key interface{}) (crypto.PublicKey, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("error deriving key id: private key of type %T is not supported", key)
+	}
+	return signer.Public(), nil
+}
+
+// publicKeyID returns the SHA-1 hash of the bits of pub, method 1 of RFC 5280,
+// in standard base64.
+func publicKeyID(pub crypto.PublicKey) (string, error) {
+	b, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", fmt.Errorf("error deriving key id: %w", err)
+	}
+	var info subjectPublicKeyInfo
+	if _, err := asn1.Unmarshal(b, &info); err != nil {
+		return "", fmt.Errorf("error deriving key id: %w", err)
+	}
+	//nolint:gosec // SubjectKeyIdentifier by RFC 5280
+	sum := sha1.Sum(info.SubjectPublicKey.Bytes)
+	return base64.StdEncoding.EncodeToString(sum[:]), nil
+}
+
+// subjectKeyID returns the subject key identifier of a key like deriveKeyID.
+// The key can be given in PEM, like deriveKeyID, or in DER, as a byte slice or
+// a standard base64 string, with a PKIX public key, a certificate or a PKCS #8
+// private key.
+func subjectKeyID(v interface{}) (string, error) {
+	var der []byte
+	switch k := v.(type) {
+	case nil:
+		return "", fmt.Errorf("error deriving key id: key is missing")
+	case string:
+		if strings.HasPrefix(strings.TrimSpace(k), "-----BEGIN ") {
+			return deriveKeyID(k)
+		}
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(k))
+		if err != nil {
+			return "", fmt.Errorf("error deriving key id: key is not PEM or base64 DER: %w", err)
+		}
+		der = b
+	case []byte:
+		if bytes.HasPrefix(bytes.TrimSpace(k), []byte("-----BEGIN ")) {
+			return deriveKeyID(string(k))
+		}
+		der = k
+	default:
+		return "", fmt.Errorf("error deriving key id: unsupported key %v of type %T", v, v)
+	}
+	if len(der) == 0 {
+		return "", fmt.Errorf("error deriving key id: key is empty")
+	}
+
+	if pub, err := x509.ParsePKIXPublicKey(der); err == nil {
+		return publicKeyID(pub)
+	}
+	if cert, err := x509.ParseCertificate(der); err == nil {
+		return publicKeyID(cert.PublicKey)
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		pub, err := signerPublicKey(key)
+		if err != nil {
+			return "", err
+		}
+		return publicKeyID(pub)
+	}
+	return "", fmt.Errorf("error deriving key id: key is not a DER public key, certificate or PKCS #8 private key")
+}
+
+// keySubjectKeyID returns the subject key identifier of the key name, read
+// with resolve, like subjectKeyID.
+func keySubjectKeyID(resolve func(string) ([]byte, error), name string) (string, error) {
+	b, err := resolveKey("deriving key id of key", resolve, name)
+	if err != nil {
+		return "", err
+	}
+	return subjectKeyID(b)
+}
+
+// authorityKeyID returns the authority key identifier of the certificates
+// signed by issuer, a certificate or a key in PEM or DER, set with WithIssuer.
+// RFC 5280 requires the identifier to be the subject key identifier of the
+// issuer, so for a certificate that has one it's that identifier as it is,
+// even if it wasn't derived with method 1. Otherwise, it's derived from the
+// key like subjectKeyID does.
+func authorityKeyID(issuer []byte) (string, error) {
+	if issuer == nil {
+		return "", fmt.Errorf("error deriving authority key id: the issuer is unknown without WithIssuer")
+	}
+	der := issuer
+	if block, _ := pem.Decode(bytes.TrimSpace(issuer)); block != nil && block.Type == pemTypeCertificate {
+		der = block.Bytes
+	}
+	if cert, err := x509.ParseCertificate(der); err == nil && len(cert.SubjectKeyId) > 0 {
+		return base64.StdEncoding.EncodeToString(cert.SubjectKeyId), nil
+	}
+	id, err := subjectKeyID(issuer)
+	if err != nil {
+		return "", fmt.Errorf("error deriving authority key id: %s", strings.TrimPrefix(err.Error(), "error deriving key id: "))
+	}
+	return id, nil
+}
@@ -0,0 +1,287 @@
+package templates
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// Profile is the kind of certificate a template is used for, set with
+// WithProfile to validate the rendered output with the fields and values that
+// are legal for that kind of certificate.
+type Profile int
+
+const (
+	// ProfileLeaf is the profile of the templates for X.509 leaf
+	// certificates. They are validated with X509CertificateSchema, can only
+	// have basicConstraints with "isCA" set to false, can't have
+	// nameConstraints, and can't use the key usages certSign and crlSign.
+	// The critical flag of the extensions must be a boolean, and the one of
+	// the extensions that RFC 5280 requires to be critical, like
+	// nameConstraints, or not critical, like authorityKeyIdentifier, must
+	// have that value. At least one subject alternative name is required,
+	// unless WithAllowCommonNameOnly is used. The notBefore and notAfter
+	// times are not checked, x509util ignores them, but a template that sets
+	// them can check their order with the function "validity".
+	ProfileLeaf Profile = iota + 1
+	// ProfileCA is the profile of the templates for X.509 CA certificates.
+	// They are validated with X509CertificateSchema, and require a subject
+	// and basicConstraints with "isCA" set to true. The extensions are
+	// checked like in ProfileLeaf, and a basicConstraints extension must be
+	// critical too.
+	ProfileCA
+	// ProfileSSHHost is the profile of the templates for SSH host
+	// certificates. They are validated with SSHCertificateSchema, and require
+	// the type "host" and at least one principal.
+	ProfileSSHHost
+	// ProfileSSHUser is the profile of the templates for SSH user
+	// certificates. They are validated with SSHCertificateSchema, and require
+	// the type "user" and at least one principal.
+	ProfileSSHUser
+)
+
+// String returns the name of the profile.
+func (p Profile) String() string {
+	switch p {
+	case ProfileLeaf:
+		return "leaf"
+	case ProfileCA:
+		return "ca"
+	case ProfileSSHHost:
+		return "sshHost"
+	case ProfileSSHUser:
+		return "sshUser"
+	default:
+		return fmt.Sprintf("Profile(%d)", int(p))
+	}
+}
+
+// leafKeyUsagePattern matches the key usages of a leaf certificate, all of them
+// but certSign and crlSign.
+const leafKeyUsagePattern = `^(?i)(digitalSignature|contentCommitment|keyEncipherment|dataEncipherment|keyAgreement|encipherOnly|decipherOnly)$`
+
+// profileRules are the rules of each profile added to the schema of its kind
+// of certificate.
+var profileRules = map[Profile]struct {
+	schema string
+	rules  string
+}{
+	ProfileLeaf: {X509CertificateSchema, `{
+		"properties": {
+			"basicConstraints": {"properties": {"isCA": {"const": false}}},
+			"nameConstraints": {"type": "null"},
+			"keyUsage": {"pattern": "` + leafKeyUsagePattern + `", "items": {"pattern": "` + leafKeyUsagePattern + `"}}
+		}
+	}`},
+	ProfileCA: {X509CertificateSchema, `{
+		"required": ["subject", "basicConstraints"],
+		"properties": {
+			"basicConstraints": {"type": "object", "required": ["isCA"], "properties": {"isCA": {"const": true}}}
+		}
+	}`},
+	ProfileSSHHost: {SSHCertificateSchema, `{
+		"required": ["type", "principals"],
+		"properties": {
+			"type": {"pattern": "^(?i)host$"},
+			"principals": {"type": "array", "minItems": 1}
+		}
+	}`},
+	ProfileSSHUser: {SSHCertificateSchema, `{
+		"required": ["type", "principals"],
+		"properties": {
+			"type": {"pattern": "^(?i)user$"},
+			"principals": {"type": "array", "minItems": 1}
+		}
+	}`},
+}
+
+var (
+	profileSchemasOnce sync.Once
+	profileSchemas     map[Profile]*Schema
+)
+
+// profileSchema returns the schema of the profile p, or nil if it's not a
+// known profile.
+func profileSchema(p Profile) *Schema {
+	profileSchemasOnce.Do(func() {
+		profileSchemas = make(map[Profile]*Schema, len(profileRules))
+		for p, r := range profileRules {
+			s, err := ParseSchema([]byte(`{"allOf": [` + r.schema + `, ` + r.rules + `]}`))
+			if err != nil {
+				panic(fmt.Sprintf("error parsing the schema of profile %s: %v", p, err))
+			}
+			profileSchemas[p] = s
+		}
+	})
+	return profileSchemas[p]
+}
+
+// lastPathElement matches the last key or index in a path, see joinPath.
+var lastPathElement = regexp.MustCompile(`(^|\.)[^.\[]+$|\[[^\]]*\]$`)
+
+// checkProfile returns a SchemaError for each field of the valid JSON document
+// data that is not legal in the profile of the options o. The position of the
+// errors is reported using src and m like in locate.
+func checkProfile(data, src []byte, m *sourceMap, o *options) error {
+	p := o.profile
+	s := profileSchema(p)
+	if s == nil {
+		err := fmt.Errorf("unknown profile %s", p)
+		return newTemplateError(SchemaError, err, "error validating json template data: "+err.Error())
+	}
+	var violations Errors
+	if err := s.Validate(data); err != nil && !errors.As(err, &violations) {
+		return newTemplateError(JSONError, err, "error validating json template data: "+err.Error())
+	}
+	if p == ProfileLeaf || p == ProfileCA {
+		// The critical flags of the extensions are reported by
+		// checkExtensions with the name of the extension.
+		kept := violations[:0]
+		for _, v := range violations {
+			if sv, ok := v.(*schemaViolation); !ok || !extensionCriticalPath.MatchString(sv.path) {
+				kept = append(kept, v)
+			}
+		}
+		violations = append(kept, checkExtensions(data, p)...)
+	}
+	if p == ProfileLeaf && !o.allowCommonNameOnly {
+		violations = append(violations, checkSANsPresent(data)...)
+	}
+
+	offsets := dataKeyOffsets(data)
+	var errs Errors
+	var errOffsets []int
+	for _, v := range violations {
+		sv, ok := v.(*schemaViolation)
+		if !ok {
+			continue
+		}
+		path := sv.path
+		if sv.key != "" {
+			path = joinPath(path, sv.key)
+		}
+		// Missing properties and array elements are reported at the closest
+		// key found.
+		offset := 0
+		for k := path; k != ""; k = lastPathElement.ReplaceAllString(k, "") {
+			if o, ok := offsets[k]; ok {
+				offset = o
+				break
+			}
+		}
+		err := fmt.Errorf("value at %s (%s) is not valid for the %s profile: %s", displayPath(sv.path), locate(offset, src, m), p, sv.msg)
+		te := newTemplateError(SchemaError, err, "error validating json template data: "+err.Error())
+		te.Path = path
+		te.setPosition(offset, src, m)
+		errs = append(errs, te)
+		errOffsets = append(errOffsets, offset)
+	}
+	// The schema reports the properties sorted by name, the errors are
+	// reported in the order of the template.
+	sort.Stable(errorsByOffset{errs, errOffsets})
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return errs
+	}
+}
+
+// certificateSANFields are the fields of an X.509 certificate with subject
+// alternative names.
+var certificateSANFields = []string{"sans", "dnsNames", "emailAddresses", "ipAddresses", "uris"}
+
+// checkSANsPresent returns a violation if the valid JSON document data doesn't
+// have any subject alternative name, a leaf certificate with only a common
+// name, in any of certificateSANFields. A field with an empty string or list,
+// or null, doesn't have any.
+func checkSANsPresent(data []byte) Errors {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil || fields == nil {
+		return nil
+	}
+	for _, name := range certificateSANFields {
+		switch v := fields[name].(type) {
+		case string:
+			if v != "" {
+				return nil
+			}
+		case []interface{}:
+			if len(v) > 0 {
+				return nil
+			}
+		}
+	}
+	return Errors{&schemaViolation{key: "sans", msg: "at least one subject alternative name is required, in sans, dnsNames, emailAddresses, ipAddresses or uris"}}
+}
+
+// errorsByOffset sorts errors by the offsets of the same index.
+type errorsByOffset struct {
+	errs    Errors
+	offsets []int
+}
+
+func (e errorsByOffset) Len() int           { return len(e.errs) }
+func (e errorsByOffset) Less(i, j int) bool { return e.offsets[i] < e.offsets[j] }
+func (e errorsByOffset) Swap(i, j int) {
+	e.errs[i], e.errs[j] = e.errs[j], e.errs[i]
+	e.offsets[i], e.offsets[j] = e.offsets[j], e.offsets[i]
+}
+
+// ProfileResult is the result of validating a template for a profile with
+// MultiProfileValidate.
+type ProfileResult struct {
+	Profile Profile
+	// Err is the error of the validation, a *TemplateError or an Errors, or
+	// nil if the output of the template is valid for the profile.
+	Err error
+}
+
+// Compatible reports whether the output of the template is valid for the
+// profile.
+func (r ProfileResult) Compatible() bool {
+	return r.Err == nil
+}
+
+// MultiProfileValidate validates a template with its data for each of the
+// given profiles, like ValidateTemplateWithData with WithProfile, and returns
+// the result of each profile in the same order, so a template meant to be used
+// for several kinds of certificates, like SSH host and user certificates, can
+// be checked for all of them at once, and the profiles it's not compatible
+// with are known. The profiles replace the one set with WithProfile.
+//
+// The template is parsed, and validated without a profile, only once. If that
+// fails, the error has nothing to do with the profiles, and it's returned in
+// every result.
+func MultiProfileValidate(text, data []byte, profiles []Profile, opts ...Option) []ProfileResult {
+	results := make([]ProfileResult, len(profiles))
+	for i, p := range profiles {
+		results[i].Profile = p
+	}
+	if len(text) == 0 {
+		return results
+	}
+	opts = append(opts[:len(opts):len(opts)], WithProfile(0))
+	t, err := ParseTemplate(text, opts...)
+	if err == nil {
+		err = t.Validate(data)
+	}
+	if err != nil {
+		for i := range results {
+			results[i].Err = err
+		}
+		return results
+	}
+	for i, p := range profiles {
+		o := *t.o
+		o.profile = p
+		pt := &Template{text: t.text, tmpl: t.tmpl, o: &o}
+		results[i].Err = pt.Validate(data)
+	}
+	return results
+}
@@ -0,0 +1,238 @@
+package templates
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfile_String(t *testing.T) {
+	assert.Equal(t, "leaf", ProfileLeaf.String())
+	assert.Equal(t, "ca", ProfileCA.String())
+	assert.Equal(t, "sshHost", ProfileSSHHost.String())
+	assert.Equal(t, "sshUser", ProfileSSHUser.String())
+	assert.Equal(t, "Profile(0)", Profile(0).String())
+}
+
+func TestValidateTemplateWithData_profile(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile Profile
+		text    string
+		want    []string
+		paths   []string
+	}{
+		{"ok/leaf", ProfileLeaf, `{"subject": {"commonName": "foo"}, "keyUsage": ["digitalSignature"], "basicConstraints": {"isCA": false}}`, nil, nil},
+		{"ok/leaf-empty", ProfileLeaf, `{}`, nil, nil},
+		{"ok/ca", ProfileCA, `{"subject": "Root CA", "keyUsage": ["certSign", "crlSign"], "basicConstraints": {"isCA": true, "maxPathLen": 1}}`, nil, nil},
+		{"ok/sshHost", ProfileSSHHost, `{"type": "host", "principals": ["{{ .Name }}"]}`, nil, nil},
+		{"ok/sshUser", ProfileSSHUser, `{"type": "User", "keyId": "jane", "principals": ["jane"]}`, nil, nil},
+		{"fail/leaf-ssh", ProfileLeaf, "{\n  \"subject\": \"foo\",\n  \"principals\": [\"foo\"]\n}", []string{
+			`value at (root) (template line 3, column 3) is not valid for the leaf profile: property "principals" is not allowed`,
+		}, []string{"principals"}},
+		{"fail/leaf-ca", ProfileLeaf, `{"subject": "foo", "keyUsage": "certSign", "basicConstraints": {"isCA": true}}`, []string{
+			`value at keyUsage (template line 1, column 20) is not valid for the leaf profile: value "certSign" does not match "` + leafKeyUsagePattern + `"`,
+			"value at basicConstraints.isCA (template line 1, column 65) is not valid for the leaf profile: value true is not false",
+		}, []string{"keyUsage", "basicConstraints.isCA"}},
+		{"fail/ca", ProfileCA, `{"subject": "Root CA", "keyUsage": ["certSign"]}`, []string{
+			`value at (root) (template line 1, column 1) is not valid for the ca profile: missing required property "basicConstraints"`,
+		}, []string{"basicConstraints"}},
+		{"fail/ca-leaf", ProfileCA, `{"subject": "Root CA", "basicConstraints": {"isCA": false}}`, []string{
+			"value at basicConstraints.isCA (template line 1, column 45) is not valid for the ca profile: value false is not true",
+		}, []string{"basicConstraints.isCA"}},
+		{"ok/leaf-extensions", ProfileLeaf, `{"extensions": [{"id": "2.5.29.35", "value": "MAA="}, {"id": "2.5.29.30", "critical": true, "value": "MAA="}, {"id": "2.5.29.19", "critical": false}]}`, nil, nil},
+		{"ok/ca-extensions", ProfileCA, `{"subject": "Root CA", "basicConstraints": {"isCA": true}, "extensions": [{"id": "2.5.29.19", "critical": true, "value": "MAMBAf8="}]}`, nil, nil},
+		{"fail/leaf-critical-string", ProfileLeaf, `{"extensions": [{"id": "2.5.29.17", "critical": "true"}, {"id": "1.2.3.4", "critical": null}]}`, []string{
+			`value at extensions[0].critical (template line 1, column 37) is not valid for the leaf profile: the critical flag of extension 2.5.29.17 must be a boolean, not "true"`,
+			`value at extensions[1].critical (template line 1, column 76) is not valid for the leaf profile: the critical flag of extension 1.2.3.4 must be a boolean, not null`,
+		}, []string{"extensions[0].critical", "extensions[1].critical"}},
+		{"fail/leaf-critical", ProfileLeaf, `{"extensions": [{"id": "2.5.29.30"}, {"id": "2.5.29.35", "critical": true}, {"id": "2.5.29.54", "critical": false}]}`, []string{
+			"value at extensions[0] (template line 1, column 2) is not valid for the leaf profile: extension nameConstraints (2.5.29.30) must be critical",
+			"value at extensions[1].critical (template line 1, column 58) is not valid for the leaf profile: extension authorityKeyIdentifier (2.5.29.35) must not be critical",
+			"value at extensions[2].critical (template line 1, column 97) is not valid for the leaf profile: extension inhibitAnyPolicy (2.5.29.54) must be critical",
+		}, []string{"extensions[0].critical", "extensions[1].critical", "extensions[2].critical"}},
+		{"fail/ca-critical", ProfileCA, `{"subject": "Root CA", "basicConstraints": {"isCA": true}, "extensions": [{"id": "2.5.29.19", "value": "MAMBAf8="}]}`, []string{
+			"value at extensions[0] (template line 1, column 60) is not valid for the ca profile: extension basicConstraints (2.5.29.19) must be critical",
+		}, []string{"extensions[0].critical"}},
+		{"fail/sshHost", ProfileSSHHost, `{"type": "user", "principals": []}`, []string{
+			`value at type (template line 1, column 2) is not valid for the sshHost profile: value "user" does not match "^(?i)host$"`,
+			"value at principals (template line 1, column 18) is not valid for the sshHost profile: expected at least 1 items, got 0",
+		}, []string{"type", "principals"}},
+		{"fail/sshUser-x509", ProfileSSHUser, `{"subject": {"commonName": "foo"}}`, []string{
+			`value at (root) (template line 1, column 1) is not valid for the sshUser profile: missing required property "type"`,
+			`value at (root) (template line 1, column 1) is not valid for the sshUser profile: missing required property "principals"`,
+			`value at (root) (template line 1, column 2) is not valid for the sshUser profile: property "subject" is not allowed`,
+		}, []string{"type", "principals", "subject"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The subject alternative names are tested in
+			// TestValidateTemplateWithData_leafSANs.
+			err := ValidateTemplateWithData([]byte(tt.text), []byte(`{"Name": "foo"}`), WithProfile(tt.profile), WithAllowCommonNameOnly(true))
+			if tt.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			errs := Errors{err}
+			errors.As(err, &errs)
+			var got, paths []string
+			for _, e := range errs {
+				var te *TemplateError
+				if assert.True(t, errors.As(e, &te)) {
+					assert.Equal(t, SchemaError, te.Kind)
+					assert.NotZero(t, te.Line)
+					paths = append(paths, te.Path)
+				}
+				got = append(got, e.Error()[len("error validating json template data: "):])
+			}
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.paths, paths)
+		})
+	}
+}
+
+func TestValidateTemplateWithData_leafSANs(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		opts    []Option
+		wantErr string
+	}{
+		{"ok/sans", `{"subject": {"commonName": "foo"}, "sans": [{"type": "dns", "value": "foo.example.com"}]}`, nil, ""},
+		{"ok/dnsNames", `{"subject": {"commonName": "foo"}, "dnsNames": ["foo.example.com"]}`, nil, ""},
+		{"ok/dnsNames-string", `{"subject": {"commonName": "foo"}, "dnsNames": "foo.example.com"}`, nil, ""},
+		{"ok/emailAddresses", `{"emailAddresses": ["jane@example.com"]}`, nil, ""},
+		{"ok/ipAddresses", `{"sans": [], "ipAddresses": ["10.0.0.1"]}`, nil, ""},
+		{"ok/uris", `{"uris": "spiffe://example.com/foo"}`, nil, ""},
+		{"ok/common-name-only", `{"subject": {"commonName": "foo"}}`, []Option{WithAllowCommonNameOnly(true)}, ""},
+		{"ok/ca", `{"subject": {"commonName": "Root CA"}, "basicConstraints": {"isCA": true}}`, []Option{WithProfile(ProfileCA)}, ""},
+		{"fail/common-name-only", `{"subject": {"commonName": "foo"}}`, nil,
+			"error validating json template data: value at (root) (template line 1, column 1) is not valid for the leaf profile: at least one subject alternative name is required, in sans, dnsNames, emailAddresses, ipAddresses or uris"},
+		{"fail/empty", "{\n  \"subject\": {\"commonName\": \"foo\"},\n  \"sans\": [],\n  \"dnsNames\": \"\",\n  \"uris\": null\n}", nil,
+			"error validating json template data: value at (root) (template line 3, column 3) is not valid for the leaf profile: at least one subject alternative name is required, in sans, dnsNames, emailAddresses, ipAddresses or uris"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]Option{WithProfile(ProfileLeaf)}, tt.opts...)
+			err := ValidateTemplateWithData([]byte(tt.text), nil, opts...)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.wantErr)
+			var te *TemplateError
+			if assert.True(t, errors.As(err, &te)) {
+				assert.Equal(t, SchemaError, te.Kind)
+				assert.Equal(t, "sans", te.Path)
+			}
+		})
+	}
+}
+
+func TestTemplate_Validate_profile(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"type": "user", "principals": ["{{ .Name }}"]}`), WithProfile(ProfileSSHUser))
+	require.NoError(t, err)
+	assert.NoError(t, tmpl.Validate([]byte(`{"Name": "jane"}`)))
+
+	tmpl, err = ParseTemplate([]byte(`{"type": "host", "principals": ["{{ .Name }}"]}`), WithProfile(ProfileSSHUser))
+	require.NoError(t, err)
+	err = tmpl.Validate([]byte(`{"Name": "jane"}`))
+	var te *TemplateError
+	require.True(t, errors.As(err, &te))
+	assert.Equal(t, SchemaError, te.Kind)
+	assert.Equal(t, "type", te.Path)
+
+	tmpl, err = ParseTemplate([]byte(`{}`), WithProfile(Profile(99)))
+	require.NoError(t, err)
+	assert.EqualError(t, tmpl.Validate(nil), "error validating json template data: unknown profile Profile(99)")
+}
+
+func TestTemplate_isCA(t *testing.T) {
+	text := []byte(`{"subject": {{ toJson .Subject }}, "profile": {{ profile | jsonQuote }}{{ if isCA }}, "basicConstraints": {{ basicConstraints true 0 }}{{ end }}}`)
+	tmpl, err := ParseTemplate(text)
+	require.NoError(t, err)
+
+	// Without a profile.
+	out, err := tmpl.Render([]byte(`{"Subject": "foo"}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"subject": "foo", "profile": ""}`, string(out))
+	assert.NoError(t, ValidateTemplate(text))
+
+	// With a profile for a single render.
+	out, err = tmpl.Render([]byte(`{"Subject": "Root CA"}`), WithProfile(ProfileCA))
+	require.NoError(t, err)
+	assert.Equal(t, `{"subject": "Root CA", "profile": "ca", "basicConstraints": {"isCA":true,"maxPathLen":0}}`, string(out))
+	out, err = tmpl.Render([]byte(`{"Subject": "foo"}`), WithProfile(ProfileLeaf))
+	require.NoError(t, err)
+	assert.Equal(t, `{"subject": "foo", "profile": "leaf"}`, string(out))
+
+	// The profile is validated too.
+	text = []byte(`{"subject": {{ toJson .Subject }}{{ if isCA }}, "basicConstraints": {{ basicConstraints true 0 }}{{ else }}, "keyUsage": ["digitalSignature"]{{ end }}}`)
+	for _, p := range []Profile{ProfileLeaf, ProfileCA} {
+		tmpl, err = ParseTemplate(text, WithProfile(p), WithAllowCommonNameOnly(true))
+		require.NoError(t, err)
+		assert.NoError(t, tmpl.Validate([]byte(`{"Subject": "foo"}`)), p)
+	}
+}
+
+func TestMultiProfileValidate(t *testing.T) {
+	// The type of the certificate is taken from the data, so the same
+	// template is valid for SSH host and user certificates.
+	text := []byte(`{"type": {{ toJson .Type }}, "principals": {{ toJson .Principals }}}`)
+	both := []Profile{ProfileSSHHost, ProfileSSHUser}
+
+	results := MultiProfileValidate(text, []byte(`{"Type": "host", "Principals": ["host.example.com"]}`), both)
+	require.Len(t, results, 2)
+	assert.Equal(t, ProfileSSHHost, results[0].Profile)
+	assert.True(t, results[0].Compatible())
+	assert.Equal(t, ProfileSSHUser, results[1].Profile)
+	assert.False(t, results[1].Compatible())
+	assert.EqualError(t, results[1].Err, `error validating json template data: value at type (template line 1, column 2) is not valid for the sshUser profile: value "host" does not match "^(?i)user$"`)
+
+	results = MultiProfileValidate(text, []byte(`{"Type": "user", "Principals": []}`), both)
+	require.Len(t, results, 2)
+	assert.EqualError(t, results[0].Err, `error validating json template data: value at type (template line 1, column 2) is not valid for the sshHost profile: value "user" does not match "^(?i)host$"; error validating json template data: value at principals (template line 1, column 30) is not valid for the sshHost profile: expected at least 1 items, got 0`)
+	assert.EqualError(t, results[1].Err, `error validating json template data: value at principals (template line 1, column 30) is not valid for the sshUser profile: expected at least 1 items, got 0`)
+
+	// The profile of the options is replaced.
+	results = MultiProfileValidate(text, []byte(`{"Type": "user", "Principals": ["jane"]}`), []Profile{ProfileSSHUser, ProfileLeaf}, WithProfile(ProfileSSHHost))
+	require.Len(t, results, 2)
+	assert.NoError(t, results[0].Err)
+	var te *TemplateError
+	if assert.True(t, errors.As(results[1].Err, &te)) {
+		assert.Equal(t, SchemaError, te.Kind)
+	}
+}
+
+func TestMultiProfileValidate_errors(t *testing.T) {
+	profiles := []Profile{ProfileSSHHost, ProfileSSHUser}
+	tests := []struct {
+		name    string
+		text    string
+		data    string
+		wantErr string
+	}{
+		{"ok/empty", ``, `{}`, ""},
+		{"parse", `{"type": {{ toJson .Type }`, `{}`, `error parsing template: template: template:1: unexpected "}" in operand`},
+		{"data", `{"type": {{ toJson .Type }}}`, `{"Type": }`, "error validating json template data: invalid JSON at Type (line 1, column 10): invalid character '}' looking for beginning of value"},
+		{"output", `{"type": {{ .Type }}}`, `{"Type": "host"}`, "error validating json template data: invalid JSON at offset 9, near template line 1, column 13: invalid character 'h' looking for beginning of value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := MultiProfileValidate([]byte(tt.text), []byte(tt.data), profiles)
+			require.Len(t, results, 2)
+			for i, r := range results {
+				assert.Equal(t, profiles[i], r.Profile)
+				if tt.wantErr == "" {
+					assert.NoError(t, r.Err)
+				} else {
+					assert.EqualError(t, r.Err, tt.wantErr)
+				}
+			}
+		})
+	}
+	assert.Empty(t, MultiProfileValidate([]byte(`{}`), nil, nil))
+}
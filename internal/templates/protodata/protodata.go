@@ -0,0 +1,182 @@
+// Package protodata validates template data supplied as a protocol buffers
+// message. It's a separate package so the templates package, and the packages
+// using it, don't depend on the protocol buffers runtime.
+package protodata
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"go.step.sm/crypto/internal/templates"
+)
+
+// FieldError is an error in the template data caused by a field of the
+// message. Field is the path of the field with the names of the .proto file,
+// like "subject.common_name" for the JSON path "subject.commonName", and Err
+// is the error returned by templates.ValidateTemplateData, usually a
+// *templates.TemplateError.
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+// Error implements the error interface.
+func (e *FieldError) Error() string {
+	return "field " + e.Field + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying cause of the error.
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateTemplateData validates the message msg as template data like
+// templates.ValidateTemplateData does, with the message encoded as JSON with
+// protojson, the same way the data of a template is generated from a message.
+// The errors caused by a field of the message are returned as a FieldError
+// with the name of the field in the .proto file, so the errors can be traced
+// back to the message. The line and column of the errors are in the compact
+// JSON encoding of the message. A nil message is valid, like empty template
+// data.
+func ValidateTemplateData(msg proto.Message, opts ...templates.Option) error {
+	if msg == nil {
+		return nil
+	}
+	b, err := protojson.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("error encoding template data: %w", err)
+	}
+	// protojson adds random white space to its output.
+	var data bytes.Buffer
+	if err := json.Compact(&data, b); err != nil {
+		return fmt.Errorf("error encoding template data: %w", err)
+	}
+
+	err = templates.ValidateTemplateData(data.Bytes(), opts...)
+	if err == nil {
+		return nil
+	}
+	md := msg.ProtoReflect().Descriptor()
+	var errs templates.Errors
+	if errors.As(err, &errs) {
+		for i, e := range errs {
+			errs[i] = fieldError(md, e)
+		}
+		return errs
+	}
+	return fieldError(md, err)
+}
+
+// fieldError returns err as a FieldError if it's a TemplateError with the
+// path of a value in the message.
+func fieldError(md protoreflect.MessageDescriptor, err error) error {
+	var te *templates.TemplateError
+	if !errors.As(err, &te) || te.Path == "" {
+		return err
+	}
+	return &FieldError{Field: protoPath(md, te.Path), Err: err}
+}
+
+// pathElement is a member key or an array index of a path.
+type pathElement struct {
+	key   string
+	index bool
+}
+
+// splitPath returns the elements of a path in the notation of the
+// TemplateError, like "subject.names[2].type" or `labels["a.b"]`.
+func splitPath(path string) []pathElement {
+	var elems []pathElement
+	for path != "" {
+		switch path[0] {
+		case '.':
+			path = path[1:]
+		case '[':
+			if q, err := strconv.QuotedPrefix(path[1:]); err == nil {
+				key, _ := strconv.Unquote(q)
+				elems = append(elems, pathElement{key: key})
+				path = strings.TrimPrefix(path[1+len(q):], "]")
+				continue
+			}
+			i := strings.IndexByte(path, ']')
+			if i < 0 {
+				i = len(path) - 1
+			}
+			elems = append(elems, pathElement{key: path[1:i], index: true})
+			path = path[i+1:]
+		default:
+			i := strings.IndexAny(path, ".[")
+			if i < 0 {
+				i = len(path)
+			}
+			elems = append(elems, pathElement{key: path[:i]})
+			path = path[i:]
+		}
+	}
+	return elems
+}
+
+// joinKey returns the path of the member key of the object at path, with the
+// notation of the TemplateError: keys that are not identifiers are quoted.
+func joinKey(path, key string) string {
+	if !identifierRegexp.MatchString(key) {
+		return path + "[" + strconv.Quote(key) + "]"
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+var identifierRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// protoPath returns the JSON path of a value in the message md with the names
+// of the fields in the .proto file. The map keys and array indexes are kept,
+// and so are the paths inside values with a special JSON encoding, like a
+// google.protobuf.Struct.
+func protoPath(md protoreflect.MessageDescriptor, path string) string {
+	var out string
+	// field is the list or map field whose element or value is next.
+	var field protoreflect.FieldDescriptor
+	for _, e := range splitPath(path) {
+		var f protoreflect.FieldDescriptor
+		if field == nil && md != nil && !e.index && !strings.HasPrefix(string(md.FullName()), "google.protobuf.") {
+			if f = md.Fields().ByJSONName(e.key); f == nil {
+				f = md.Fields().ByTextName(e.key)
+			}
+		}
+		switch {
+		case field != nil && field.IsList() && e.index:
+			out += "[" + e.key + "]"
+			md, field = field.Message(), nil
+		case field != nil && field.IsMap() && !e.index:
+			out = joinKey(out, e.key)
+			md, field = field.MapValue().Message(), nil
+		case f != nil:
+			out = joinKey(out, f.TextName())
+			if f.IsList() || f.IsMap() {
+				field = f
+			} else {
+				md = f.Message()
+			}
+		default:
+			// The rest of the path is not in a message.
+			md, field = nil, nil
+			if e.index {
+				out += "[" + e.key + "]"
+			} else {
+				out = joinKey(out, e.key)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,167 @@
+package protodata
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	_ "google.golang.org/protobuf/types/known/structpb"
+
+	"go.step.sm/crypto/internal/templates"
+)
+
+// newRequest returns a message with the values in the JSON document data and
+// the descriptor:
+//
+//	message Subject {
+//	  string common_name = 1;
+//	  repeated string organization = 2;
+//	}
+//	message Request {
+//	  Subject subject = 1;
+//	  repeated Subject other_subjects = 2;
+//	  map<string, Subject> subjects_by_name = 3;
+//	  int32 max_path_len = 4;
+//	  google.protobuf.Struct extra_data = 5;
+//	}
+func newRequest(t *testing.T, data string) proto.Message {
+	t.Helper()
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, typeName string, label descriptorpb.FieldDescriptorProto_Label) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(number),
+			Type:   typ.Enum(),
+			Label:  label.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	const (
+		optional = descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+		repeated = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+		message  = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+		str      = descriptorpb.FieldDescriptorProto_TYPE_STRING
+	)
+	fdp := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("request.proto"),
+		Package:    proto.String("test"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/struct.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Subject"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("common_name", 1, str, "", optional),
+				field("organization", 2, str, "", repeated),
+			},
+		}, {
+			Name: proto.String("Request"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("subject", 1, message, ".test.Subject", optional),
+				field("other_subjects", 2, message, ".test.Subject", repeated),
+				field("subjects_by_name", 3, message, ".test.Request.SubjectsByNameEntry", repeated),
+				field("max_path_len", 4, descriptorpb.FieldDescriptorProto_TYPE_INT32, "", optional),
+				field("extra_data", 5, message, ".google.protobuf.Struct", optional),
+			},
+			NestedType: []*descriptorpb.DescriptorProto{{
+				Name: proto.String("SubjectsByNameEntry"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("key", 1, str, "", optional),
+					field("value", 2, message, ".test.Subject", optional),
+				},
+				Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+			}},
+		}},
+	}
+	// The import of structpb registers google/protobuf/struct.proto.
+	fd, err := protodesc.NewFile(fdp, protoregistry.GlobalFiles)
+	require.NoError(t, err)
+
+	msg := dynamicpb.NewMessage(fd.Messages().ByName("Request"))
+	require.NoError(t, protojson.Unmarshal([]byte(data), msg))
+	return msg
+}
+
+func TestValidateTemplateData(t *testing.T) {
+	opts := []templates.Option{
+		templates.WithRangeCheck("maxPathLen", big.NewInt(0), big.NewInt(10)),
+		templates.WithRangeCheck("subject.commonName", nil, nil),
+		templates.WithRangeCheck("otherSubjects[*].organization[*]", nil, nil),
+		templates.WithRangeCheck(`subjectsByName["a.b"].commonName`, nil, nil),
+		templates.WithRangeCheck("extraData.someKey", nil, nil),
+	}
+	tests := []struct {
+		name   string
+		data   string
+		want   []string
+		fields []string
+	}{
+		{"ok", `{"maxPathLen": 1, "otherSubjects": [{}]}`, nil, nil},
+		{"ok/empty", `{}`, nil, nil},
+		{"fail/field", `{"maxPathLen": 11}`, []string{
+			"field max_path_len: error validating json template data: value at maxPathLen (line 1, column 15): 11 is greater than the maximum 10",
+		}, []string{"max_path_len"}},
+		{"fail/nested", `{"subject": {"commonName": "foo"}}`, []string{
+			`field subject.common_name: error validating json template data: value at subject.commonName (line 1, column 26): "foo" is not a number`,
+		}, []string{"subject.common_name"}},
+		{"fail/all", `{"otherSubjects": [{"organization": ["Acme"]}], "subjectsByName": {"a.b": {"commonName": "foo"}}, "extraData": {"someKey": "bar"}}`, []string{
+			`field other_subjects[0].organization[0]: error validating json template data: value at otherSubjects[0].organization[0] (line 1, column 36): "Acme" is not a number`,
+			`field subjects_by_name["a.b"].common_name: error validating json template data: value at subjectsByName["a.b"].commonName (line 1, column 84): "foo" is not a number`,
+			`field extra_data.someKey: error validating json template data: value at extraData.someKey (line 1, column 115): "bar" is not a number`,
+		}, []string{"other_subjects[0].organization[0]", `subjects_by_name["a.b"].common_name`, "extra_data.someKey"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateTemplateData(newRequest(t, tt.data), opts...)
+			if tt.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			errs := templates.Errors{err}
+			errors.As(err, &errs)
+			var got, fields []string
+			for _, e := range errs {
+				var fe *FieldError
+				if assert.True(t, errors.As(e, &fe)) {
+					fields = append(fields, fe.Field)
+					var te *templates.TemplateError
+					assert.True(t, errors.As(e, &te))
+				}
+				got = append(got, e.Error())
+			}
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.fields, fields)
+		})
+	}
+}
+
+func TestValidateTemplateData_nil(t *testing.T) {
+	assert.NoError(t, ValidateTemplateData(nil))
+}
+
+func TestValidateTemplateData_noPath(t *testing.T) {
+	err := ValidateTemplateData(newRequest(t, `{"subject": {"commonName": "foo"}}`), templates.WithMaxDepth(1))
+	var te *templates.TemplateError
+	require.True(t, errors.As(err, &te))
+	assert.Equal(t, templates.JSONError, te.Kind)
+	var fe *FieldError
+	assert.False(t, errors.As(err, &fe))
+}
+
+func Test_splitPath(t *testing.T) {
+	assert.Nil(t, splitPath(""))
+	assert.Equal(t, []pathElement{
+		{key: "subject"}, {key: "names"}, {key: "2", index: true}, {key: "type"},
+		{key: "a.b[c]"}, {key: "x"},
+	}, splitPath(`subject.names[2].type["a.b[c]"].x`))
+}
@@ -0,0 +1,119 @@
+package templates
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// rangeCheck is a constraint added with WithRangeCheck.
+type rangeCheck struct {
+	min, max *big.Rat
+}
+
+// rangeChecker walks a JSON document checking the ranges set with
+// WithRangeCheck.
+type rangeChecker struct {
+	data   []byte
+	dec    *json.Decoder
+	ranges map[string]rangeCheck
+	src    []byte
+	m      *sourceMap
+	errs   Errors
+}
+
+// checkRanges returns the violations of the ranges in the valid JSON document
+// data. The position of the errors is reported using src and m like in locate.
+func checkRanges(data, src []byte, m *sourceMap, ranges map[string]rangeCheck) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	c := &rangeChecker{data: data, dec: dec, ranges: ranges, src: src, m: m}
+	if err := c.value("", ""); err != nil {
+		return newTemplateError(JSONError, err, "error validating json template data: "+err.Error())
+	}
+	switch len(c.errs) {
+	case 0:
+		return nil
+	case 1:
+		return c.errs[0]
+	default:
+		return c.errs
+	}
+}
+
+// value checks the value starting at the current offset of the decoder. path
+// is the path of the value, and pattern the same path with "[*]" instead of
+// the indexes.
+func (c *rangeChecker) value(path, pattern string) error {
+	offset := int(c.dec.InputOffset())
+	for offset < len(c.data) && bytes.IndexByte([]byte(" \t\r\n:,"), c.data[offset]) >= 0 {
+		offset++
+	}
+	tok, err := c.dec.Token()
+	if err != nil {
+		return err
+	}
+
+	r, checked := c.ranges[path]
+	if !checked {
+		r, checked = c.ranges[pattern]
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		if checked {
+			c.violation(path, offset, "an object is not a number")
+		}
+		for c.dec.More() {
+			tok, err := c.dec.Token()
+			if err != nil {
+				return err
+			}
+			key, _ := tok.(string)
+			if err := c.value(joinPath(path, key), joinPath(pattern, key)); err != nil {
+				return err
+			}
+		}
+		_, err = c.dec.Token()
+		return err
+	case json.Delim('['):
+		if checked {
+			c.violation(path, offset, "an array is not a number")
+		}
+		for i := 0; c.dec.More(); i++ {
+			if err := c.value(indexPath(path, i), pattern+"[*]"); err != nil {
+				return err
+			}
+		}
+		_, err = c.dec.Token()
+		return err
+	}
+	if !checked {
+		return nil
+	}
+
+	n, isNumber := tok.(json.Number)
+	var v *big.Rat
+	if isNumber {
+		v, isNumber = new(big.Rat).SetString(n.String())
+	}
+	switch {
+	case !isNumber:
+		c.violation(path, offset, toJSONString(tok)+" is not a number")
+	case r.min != nil && v.Cmp(r.min) < 0:
+		c.violation(path, offset, fmt.Sprintf("%s is less than the minimum %s", n, r.min.RatString()))
+	case r.max != nil && v.Cmp(r.max) > 0:
+		c.violation(path, offset, fmt.Sprintf("%s is greater than the maximum %s", n, r.max.RatString()))
+	}
+	return nil
+}
+
+// violation adds the SchemaError for the value at path starting at offset.
+func (c *rangeChecker) violation(path string, offset int, msg string) {
+	err := fmt.Errorf("value at %s (%s): %s", displayPath(path), locate(offset, c.src, c.m), msg)
+	te := newTemplateError(SchemaError, err, "error validating json template data: "+err.Error())
+	te.Path = path
+	te.setPosition(offset, c.src, c.m)
+	c.errs = append(c.errs, te)
+}
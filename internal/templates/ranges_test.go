@@ -0,0 +1,95 @@
+package templates
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateTemplateWithData_rangeCheck(t *testing.T) {
+	maxSerial, ok := new(big.Int).SetString("170141183460469231731687303715884105727", 10) // 2^127-1
+	require.True(t, ok)
+	opts := []Option{
+		WithRangeCheck("basicConstraints.maxPathLen", big.NewInt(0), nil),
+		WithRangeCheck("validity.hours", big.NewInt(1), big.NewInt(8760)),
+		WithRangeCheck("serialNumber", big.NewInt(1), maxSerial),
+		WithRangeCheck("extensions[*].id", big.NewInt(0), big.NewInt(10)),
+		WithRangeCheck("extensions[0].level", nil, big.NewInt(3)),
+	}
+
+	tests := []struct {
+		name  string
+		text  string
+		want  []string
+		paths []string
+	}{
+		{"ok", `{"basicConstraints": {"maxPathLen": 0}, "validity": {"hours": 24}, "serialNumber": 170141183460469231731687303715884105727, "extensions": [{"id": 1, "level": 3}, {"id": 10, "level": 4}]}`, nil, nil},
+		{"ok/missing", `{"subject": {"commonName": "foo"}}`, nil, nil},
+		{"ok/fraction", `{"validity": {"hours": 1.5}}`, nil, nil},
+		{"ok/not-object", `[1, 2]`, nil, nil},
+		{"fail/negative", `{"basicConstraints": {"maxPathLen": -1}}`, []string{
+			"value at basicConstraints.maxPathLen (template line 1, column 37): -1 is less than the minimum 0",
+		}, []string{"basicConstraints.maxPathLen"}},
+		{"fail/all", "{\n  \"validity\": {\"hours\": 0},\n  \"serialNumber\": 170141183460469231731687303715884105728,\n  \"extensions\": [{\"id\": 1, \"level\": 4}, {\"id\": 1e2}]\n}", []string{
+			"value at validity.hours (template line 2, column 25): 0 is less than the minimum 1",
+			"value at serialNumber (template line 3, column 19): 170141183460469231731687303715884105728 is greater than the maximum 170141183460469231731687303715884105727",
+			"value at extensions[0].level (template line 4, column 37): 4 is greater than the maximum 3",
+			"value at extensions[1].id (template line 4, column 48): 1e2 is greater than the maximum 10",
+		}, []string{"validity.hours", "serialNumber", "extensions[0].level", "extensions[1].id"}},
+		{"fail/fraction", `{"validity": {"hours": 0.5}}`, []string{
+			"value at validity.hours (template line 1, column 24): 0.5 is less than the minimum 1",
+		}, []string{"validity.hours"}},
+		{"fail/not-number", `{"validity": {"hours": "24"}, "basicConstraints": {"maxPathLen": null}, "serialNumber": [1]}`, []string{
+			`value at validity.hours (template line 1, column 24): "24" is not a number`,
+			"value at basicConstraints.maxPathLen (template line 1, column 66): null is not a number",
+			"value at serialNumber (template line 1, column 89): an array is not a number",
+		}, []string{"validity.hours", "basicConstraints.maxPathLen", "serialNumber"}},
+		{"fail/rendered", `{"validity": {"hours": {{ .Hours }}}}`, []string{
+			"value at validity.hours (offset 23, near template line 1, column 27): 0 is less than the minimum 1",
+		}, []string{"validity.hours"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateTemplateWithData([]byte(tt.text), []byte(`{"Hours": 0}`), opts...)
+			if tt.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			errs := Errors{err}
+			errors.As(err, &errs)
+			var got, paths []string
+			for _, e := range errs {
+				var te *TemplateError
+				if assert.True(t, errors.As(e, &te)) {
+					assert.Equal(t, SchemaError, te.Kind)
+					assert.NotZero(t, te.Line)
+					paths = append(paths, te.Path)
+				}
+				got = append(got, e.Error()[len("error validating json template data: "):])
+			}
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.paths, paths)
+		})
+	}
+}
+
+func TestTemplate_Render_rangeCheck(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"a": {{ .A }}, "b": {{ .B }}}`), WithRangeCheck("a", big.NewInt(0), big.NewInt(10)))
+	require.NoError(t, err)
+
+	// The check of a render is added to the ones of the template.
+	_, err = tmpl.Render([]byte(`{"A": 11, "B": 5}`), WithRenderMode(RenderCompact), WithRangeCheck("b", nil, big.NewInt(1)))
+	assert.EqualError(t, err, "error validating json template data: value at a (offset 6, near template line 1, column 10): 11 is greater than the maximum 10; error validating json template data: value at b (offset 15, near template line 1, column 25): 5 is greater than the maximum 1")
+	out, err := tmpl.Render([]byte(`{"A": 1, "B": 5}`), WithRenderMode(RenderCompact), WithRangeCheck("b", nil, big.NewInt(1)))
+	assert.EqualError(t, err, "error validating json template data: value at b (offset 14, near template line 1, column 25): 5 is greater than the maximum 1")
+	assert.Nil(t, out)
+
+	// And it doesn't change the template.
+	assert.NoError(t, tmpl.Validate([]byte(`{"A": 1, "B": 5}`)))
+	assert.EqualError(t, tmpl.Validate([]byte(`{"A": 11, "B": 5}`)), "error validating json template data: value at a (offset 6, near template line 1, column 10): 11 is greater than the maximum 10")
+	assert.Len(t, tmpl.o.ranges, 1)
+}
@@ -0,0 +1,55 @@
+package templates
+
+import (
+	"fmt"
+	"sync"
+	"text/template"
+)
+
+var (
+	registeredFuncsMu sync.RWMutex
+	registeredFuncs   = template.FuncMap{}
+)
+
+// RegisterFunc adds the function fn with the given name to the functions
+// available to all the templates of the process, like the ones returned by
+// GetFuncMap, so a deployment can have its own helpers without passing them
+// with WithFuncs to every call. The function must return a single value, or a
+// value and an error, like the ones given to text/template. It returns an
+// error if the name is not valid, if it's the name of a built-in function, of
+// one predefined by text/template, or of one already registered, or if fn is
+// not a function with valid return values. A function added with WithFuncs
+// cannot have the name of a registered one either.
+//
+// RegisterFunc is safe to call concurrently, but the functions should be
+// registered before the first use of the package, typically in an init
+// function: the templates parsed, the snapshots taken and the func maps built
+// before a function is registered don't have it, and a compiled template that
+// uses it needs to be loaded again. There's no way to remove a registered
+// function.
+func RegisterFunc(name string, fn interface{}) error {
+	builtins := newFuncMap(func(string, string) {}, new(options))
+
+	registeredFuncsMu.Lock()
+	defer registeredFuncsMu.Unlock()
+	if _, ok := registeredFuncs[name]; ok {
+		return fmt.Errorf("function %q is already registered", name)
+	}
+	if err := checkFunc(name, fn, builtins); err != nil {
+		return err
+	}
+	registeredFuncs[name] = fn
+	return nil
+}
+
+// addRegisteredFuncs adds the functions registered with RegisterFunc to m,
+// without replacing the ones in it.
+func addRegisteredFuncs(m template.FuncMap) {
+	registeredFuncsMu.RLock()
+	defer registeredFuncsMu.RUnlock()
+	for name, fn := range registeredFuncs {
+		if _, ok := m[name]; !ok && !builtinFuncs[name] {
+			m[name] = fn
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package templates
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unregisterFuncs removes the functions registered by a test.
+func unregisterFuncs(t *testing.T, names ...string) {
+	t.Cleanup(func() {
+		registeredFuncsMu.Lock()
+		defer registeredFuncsMu.Unlock()
+		for _, name := range names {
+			delete(registeredFuncs, name)
+		}
+	})
+}
+
+func TestRegisterFunc(t *testing.T) {
+	unregisterFuncs(t, "tenantName", "tenantID")
+	tenant := func(s string) string { return "tenant-" + s }
+	require.NoError(t, RegisterFunc("tenantName", tenant))
+	require.NoError(t, RegisterFunc("tenantID", func(s string) (string, error) { return "1", nil }))
+
+	tests := []struct {
+		name    string
+		fnName  string
+		fn      interface{}
+		wantErr string
+	}{
+		{"fail/registered", "tenantName", tenant, `function "tenantName" is already registered`},
+		{"fail/fail", "fail", tenant, `function "fail" cannot be redefined`},
+		{"fail/sprig", "toJson", tenant, `function "toJson" cannot be redefined`},
+		{"fail/builtin", "eq", tenant, `function "eq" cannot be redefined`},
+		{"fail/name", "tenant-name", tenant, `function name "tenant-name" is not valid`},
+		{"fail/notFunc", "tenantType", "foo", `function "tenantType" is a string, not a function`},
+		{"fail/nil", "tenantType", nil, `function "tenantType" is a <nil>, not a function`},
+		{"fail/results", "tenantType", func() (string, string) { return "", "" }, `function "tenantType" must return a value, or a value and an error`},
+		{"fail/noResults", "tenantType", func() {}, `function "tenantType" must return a value, or a value and an error`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.EqualError(t, RegisterFunc(tt.fnName, tt.fn), tt.wantErr)
+		})
+	}
+
+	var failMessage string
+	assert.Contains(t, GetFuncMap(&failMessage), "tenantName")
+	assert.Contains(t, NewFuncs().FuncMap(), "tenantID")
+	assert.NotContains(t, GetFuncMap(&failMessage), "tenantType")
+
+	// The registered functions are available to all the templates.
+	text := []byte(`{"subject": {"commonName": {{ tenantName .Name | jsonQuote }}}}`)
+	assert.NoError(t, ValidateTemplate(text))
+	tmpl, err := ParseTemplate(text)
+	require.NoError(t, err)
+	out, err := tmpl.Render([]byte(`{"Name": "foo"}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"subject": {"commonName": "tenant-foo"}}`, string(out))
+	lints, err := LintTemplate(text)
+	require.NoError(t, err)
+	assert.Empty(t, lints)
+
+	// They cannot be redefined with WithFuncs.
+	_, err = BuildFuncMap(&failMessage, WithFuncs(map[string]interface{}{"tenantName": tenant}))
+	assert.EqualError(t, err, `function "tenantName" cannot be redefined`)
+	_, err = ParseTemplate(text, WithFuncs(map[string]interface{}{"tenantName": tenant}))
+	assert.Error(t, err)
+}
@@ -0,0 +1,69 @@
+package templates
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"text/template"
+	"text/template/parse"
+)
+
+// reservedVariables are the internal names that cannot be used as the name of
+// a variable in a template.
+var reservedVariables = map[string]bool{
+	"failMessage": true,
+}
+
+// checkReservedNames returns a ParseError for the first definition, in the
+// order of the files, of a template with the name of one of the functions in
+// funcs, the same ones returned by GetFuncMap, or of a variable with a
+// reserved name, like {{ $failMessage := "" }}, so the names chosen by the
+// authors of a template can't be confused with the ones of the library.
+func checkReservedNames(set *template.Template, names []string, texts map[string][]byte, funcs template.FuncMap, leftDelim string) error {
+	for _, name := range names {
+		text := texts[name]
+		offset, msg := -1, ""
+		found := func(pos int, s string) {
+			if offset < 0 || pos < offset {
+				offset, msg = pos, s
+			}
+		}
+		for _, t := range set.Templates() {
+			if t.Tree == nil || t.Tree.ParseName != name {
+				continue
+			}
+			if _, ok := funcs[t.Name()]; ok && t.Name() != name {
+				found(definitionOffset(text, t, leftDelim), fmt.Sprintf("template %q has the name of a function", t.Name()))
+			}
+			walkTree(t.Tree.Root, func(node parse.Node) bool {
+				if n, ok := node.(*parse.PipeNode); ok {
+					for _, v := range n.Decl {
+						if reservedVariables[v.Ident[0][1:]] {
+							found(int(v.Pos), fmt.Sprintf("variable %s is reserved", v.Ident[0]))
+						}
+					}
+				}
+				return true
+			})
+		}
+		if offset >= 0 {
+			line, _ := position(text, offset)
+			err := fmt.Errorf("template: %s:%d: %s", name, line, msg)
+			te := newTemplateError(ParseError, err, "error parsing template: "+err.Error())
+			te.setPosition(offset, text, nil)
+			return te
+		}
+	}
+	return nil
+}
+
+// definitionOffset returns the offset in text of the {{ define }} or
+// {{ block }} action of the template t, or the offset of its contents if it
+// cannot be found.
+func definitionOffset(text []byte, t *template.Template, leftDelim string) int {
+	re := regexp.MustCompile(regexp.QuoteMeta(leftDelim) + `-?\s*(?:define|block)\s+` + regexp.QuoteMeta(strconv.Quote(t.Name())))
+	if loc := re.FindIndex(text); loc != nil {
+		return loc[0]
+	}
+	return int(t.Tree.Root.Pos)
+}
@@ -0,0 +1,145 @@
+package templates
+
+import (
+	"sort"
+	"strconv"
+	"text/template/parse"
+)
+
+// Result is the result of validating a template with Validate. It can be
+// encoded as JSON to report the validation in a machine readable way.
+type Result struct {
+	// IsValid is true if the template passes the checks of ValidateTemplate.
+	IsValid bool `json:"isValid"`
+	// Error is the message of the error returned by Validate, if any.
+	Error string `json:"error,omitempty"`
+	// Warnings are the lints with SeverityWarning found by LintTemplate and,
+	// with ValidateWithData, the keys of the data not used by the template.
+	// They don't make the template invalid.
+	Warnings []Lint `json:"warnings"`
+	// FuncMapVersion is the version of the functions required by the template
+	// with a comment like {{/* requires funcmap >= 3 */}}, or 0 if it doesn't
+	// require any version.
+	FuncMapVersion int `json:"funcMapVersion"`
+	// Functions are the sorted names of the functions used by the template,
+	// including the ones predefined by text/template.
+	Functions []string `json:"functions"`
+	// FuncMap is the snapshot of the functions available to the template in
+	// the validation, to validate it again with the same functions using
+	// WithFuncMapSnapshot. It's nil if the options are not valid.
+	FuncMap *FuncMapSnapshot `json:"funcMap,omitempty"`
+	// Findings are the errors and warnings of each stage of the validation,
+	// in the order of the stages. They are only set by ValidateAll.
+	Findings []Finding `json:"findings,omitempty"`
+}
+
+// Validate validates a template like ValidateTemplate, and returns a Result
+// with the warnings found by LintTemplate, the functions and version of the
+// functions used by the template, and the snapshot of the functions available
+// to it, so callers can tell apart a template that is valid but risky from one
+// that is not valid. The returned error is the one returned by
+// ValidateTemplate; the Result is returned even if the template is not valid,
+// and the warnings and functions are known as long as the template can be
+// parsed without resolving the function names.
+func Validate(data []byte, opts ...Option) (*Result, error) {
+	o := newOptions(opts)
+	left, right := o.delims()
+	res := &Result{
+		IsValid:        true,
+		Warnings:       []Lint{},
+		FuncMapVersion: requiredFuncMapVersion(data, left, right),
+		Functions:      []string{},
+	}
+
+	if checkFuncs(o) == nil {
+		res.FuncMap = snapshotFuncMap(o)
+	}
+
+	start := o.stageStart(StageTemplate)
+	err := ValidateTemplate(data, opts...)
+	o.stageEnd(StageTemplate, start, err)
+	if err != nil {
+		res.IsValid = false
+		res.Error = err.Error()
+	}
+	if len(data) == 0 {
+		return res, err
+	}
+
+	start = o.stageStart(StageLint)
+	lints, lintErr := LintTemplate(data, opts...)
+	o.stageEnd(StageLint, start, lintErr)
+	if lintErr == nil {
+		for _, l := range lints {
+			if l.Severity == SeverityWarning {
+				res.Warnings = append(res.Warnings, l)
+			}
+		}
+	}
+	if trees, treeErr := parseTrees(data, o); treeErr == nil {
+		res.Functions = usedFuncs(trees)
+	}
+	return res, err
+}
+
+// ValidateWithData validates a template with its data like
+// ValidateTemplateWithData, and returns a Result like Validate. The keys in
+// the data that are not used by the template, found with
+// Template.UnusedKeys, are added to the warnings after the ones of
+// LintTemplate, so data with a stale or misspelled key can be detected. The
+// returned error is the one returned by ValidateTemplateWithData.
+func ValidateWithData(text, data []byte, opts ...Option) (*Result, error) {
+	res, err := Validate(text, opts...)
+	if err != nil || len(text) == 0 {
+		return res, err
+	}
+
+	t, err := ParseTemplate(text, opts...)
+	if err == nil {
+		err = t.Validate(data)
+	}
+	if err != nil {
+		res.IsValid = false
+		res.Error = err.Error()
+		if t == nil {
+			return res, err
+		}
+	}
+	if lints, lintErr := t.UnusedKeys(data); lintErr == nil {
+		res.Warnings = append(res.Warnings, lints...)
+	}
+	return res, err
+}
+
+// usedFuncs returns the sorted names of the functions called in the trees.
+func usedFuncs(trees map[string]*parse.Tree) []string {
+	seen := make(map[string]bool)
+	names := []string{}
+	for _, tree := range trees {
+		walkTree(tree.Root, func(node parse.Node) bool {
+			if n, ok := node.(*parse.IdentifierNode); ok && !seen[n.Ident] {
+				seen[n.Ident] = true
+				names = append(names, n.Ident)
+			}
+			return true
+		})
+	}
+	sort.Strings(names)
+	return names
+}
+
+// requiredFuncMapVersion returns the highest version of the functions required
+// by the comments in the template text, or 0 if there are none.
+func requiredFuncMapVersion(text []byte, left, right string) int {
+	re := requiresRegexp
+	if left != "{{" || right != "}}" {
+		re = requiresPattern(left, right)
+	}
+	var version int
+	for _, m := range re.FindAllSubmatch(text, -1) {
+		if v, err := strconv.Atoi(string(m[1])); err == nil && v > version {
+			version = v
+		}
+	}
+	return version
+}
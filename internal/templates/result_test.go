@@ -0,0 +1,119 @@
+package templates
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	type args struct {
+		data []byte
+		opts []Option
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    *Result
+		wantErr bool
+	}{
+		{"ok", args{[]byte(`{"subject": {{ toJson .Subject }}, "sans": {{ .SANs | toJson }}}`), nil}, &Result{
+			IsValid: true, Warnings: []Lint{}, Functions: []string{"toJson"},
+		}, false},
+		{"ok/empty", args{[]byte(``), nil}, &Result{
+			IsValid: true, Warnings: []Lint{}, Functions: []string{},
+		}, false},
+		{"ok/warnings", args{[]byte(`{"commonName": "{{ .Subject.CommonName }}", "sans": {{ toJson (lower .SANs) }}}`), nil}, &Result{
+			IsValid: true,
+			Warnings: []Lint{
+				{Severity: SeverityWarning, Code: LintUnescapedString, Message: `output of {{.Subject.CommonName}} is not escaped inside a JSON string, use {{ jsonQuote .Subject.CommonName }} instead of "{{.Subject.CommonName}}"`, Offset: 19, Line: 1, Column: 20},
+			},
+			Functions: []string{"lower", "toJson"},
+		}, false},
+		{"ok/requires", args{[]byte("{{/* requires funcmap >= 2 */}}{{/* requires funcmap >= 4 */}}\n{{ if eq .A \"a\" }}{}{{ end }}"), nil}, &Result{
+			IsValid: true, Warnings: []Lint{}, FuncMapVersion: 4, Functions: []string{"eq"},
+		}, false},
+		{"ok/delims", args{[]byte(`[[/* requires funcmap >= 3 */]]{"a": [[ toJson .A ]]}`), []Option{WithDelims("[[", "]]")}}, &Result{
+			IsValid: true, Warnings: []Lint{}, FuncMapVersion: 3, Functions: []string{"toJson"},
+		}, false},
+		{"fail/unknown-function", args{[]byte(`{"a": "{{ .A }}", "b": {{ toJson (foo .B) }}}`), nil}, &Result{
+			IsValid: false,
+			Error:   `error parsing template: template: template:1: function "foo" not defined`,
+			Warnings: []Lint{
+				{Severity: SeverityWarning, Code: LintUnescapedString, Message: `output of {{.A}} is not escaped inside a JSON string, use {{ jsonQuote .A }} instead of "{{.A}}"`, Offset: 10, Line: 1, Column: 11},
+			},
+			Functions: []string{"foo", "toJson"},
+		}, true},
+		{"fail/parse", args{[]byte(`{{ if }}`), nil}, &Result{
+			IsValid:   false,
+			Error:     `error parsing template: template: template:1: missing value for if`,
+			Warnings:  []Lint{},
+			Functions: []string{},
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Validate(tt.args.data, tt.args.opts...)
+			if tt.wantErr {
+				var te *TemplateError
+				if assert.True(t, errors.As(err, &te)) {
+					assert.Equal(t, ParseError, te.Kind)
+				}
+			} else {
+				assert.NoError(t, err)
+			}
+			snapshot, err := SnapshotFuncMap(tt.args.opts...)
+			require.NoError(t, err)
+			tt.want.FuncMap = snapshot
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestValidateWithData(t *testing.T) {
+	text := []byte(`{"cn": {{ toJson .Subject.CommonName }}, "sans": {{ toJson .SANs }}}`)
+	res, err := ValidateWithData(text, []byte(`{"Subject": {"CommonName": "foo", "CN": "bar"}, "SANs": ["foo"]}`))
+	require.NoError(t, err)
+	assert.Equal(t, &Result{
+		IsValid: true,
+		Warnings: []Lint{
+			{Severity: SeverityWarning, Code: LintUnusedKey, Message: "key Subject.CN is not used by the template", Offset: 34, Line: 1, Column: 35},
+		},
+		Functions: []string{"toJson"},
+		FuncMap:   res.FuncMap,
+	}, res)
+	assert.NotEmpty(t, res.FuncMap.Functions)
+
+	res, err = ValidateWithData([]byte(`{"cn": {{ .Subject.CommonName }}}`), []byte(`{"Subject": {"CommonName": "foo"}, "Name": "foo"}`))
+	assert.EqualError(t, err, "error validating json template data: invalid JSON at offset 8, near template line 1, column 11: invalid character 'o' in literal false (expecting 'a')")
+	assert.False(t, res.IsValid)
+	assert.Equal(t, err.Error(), res.Error)
+	if assert.Len(t, res.Warnings, 2) {
+		assert.Equal(t, LintRawOutput, res.Warnings[0].Code)
+		assert.Equal(t, LintUnusedKey, res.Warnings[1].Code)
+		assert.Equal(t, "key Name is not used by the template", res.Warnings[1].Message)
+	}
+
+	res, err = ValidateWithData([]byte(`{{ if }}`), []byte(`{}`))
+	assert.Error(t, err)
+	assert.False(t, res.IsValid)
+	assert.Equal(t, []Lint{}, res.Warnings)
+}
+
+func TestValidate_json(t *testing.T) {
+	res, err := Validate([]byte(`{"cn": "{{ .CommonName }}"}`))
+	require.NoError(t, err)
+	res.FuncMap = &FuncMapSnapshot{Version: 3, Functions: []string{"quote", "toJson"}}
+	b, err := json.Marshal(res)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"isValid": true,
+		"warnings": [{"severity": "warning", "code": "unescaped-string", "message": "output of {{.CommonName}} is not escaped inside a JSON string, use {{ jsonQuote .CommonName }} instead of \"{{.CommonName}}\"", "offset": 11, "line": 1, "column": 12}],
+		"funcMapVersion": 0,
+		"functions": [],
+		"funcMap": {"version": 3, "functions": ["quote", "toJson"]}
+	}`, string(b))
+}
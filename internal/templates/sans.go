@@ -0,0 +1,119 @@
+package templates
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// The types of subject alternative names supported by the "sans" function.
+const (
+	sanTypeDNS   = "dns"
+	sanTypeEmail = "email"
+	sanTypeIP    = "ip"
+	sanTypeURI   = "uri"
+)
+
+// subjectAlternativeName is the JSON representation of a subject alternative
+// name in a certificate template.
+type subjectAlternativeName struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// sans returns the JSON array of subject alternative names for the elements of
+// the slice v. Each element is a map with the keys "type" and "value", or a
+// struct with the fields Type and Value, where the type is one of "dns",
+// "email", "ip" or "uri". Keys and types are case insensitive. IP addresses and
+// URIs are validated, and are written in their canonical form. DNS names with
+// a wildcard must follow the rules of validDNSName, and are not allowed at
+// all if allowWildcards is false.
+func sans(v interface{}, allowWildcards bool) (string, error) {
+	if v == nil {
+		return "[]", nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return "", fmt.Errorf("error creating sans: %v of type %T is not a list", v, v)
+	}
+
+	list := make([]subjectAlternativeName, rv.Len())
+	for i := range list {
+		typ, value, err := sanFields(rv.Index(i))
+		if err != nil {
+			return "", fmt.Errorf("error creating sans: element %d: %w", i, err)
+		}
+		switch strings.ToLower(typ) {
+		case sanTypeDNS:
+			if value == "" {
+				return "", fmt.Errorf("error creating sans: element %d: dns name is empty", i)
+			}
+			if strings.Contains(value, "*") && !validDNSName(value, allowWildcards) {
+				return "", fmt.Errorf("error creating sans: element %d: invalid dns name %q", i, value)
+			}
+		case sanTypeEmail:
+			if !strings.Contains(value, "@") {
+				return "", fmt.Errorf("error creating sans: element %d: invalid email address %q", i, value)
+			}
+		case sanTypeIP:
+			ip := parseIP(value)
+			if ip == nil {
+				return "", fmt.Errorf("error creating sans: element %d: invalid ip address %q", i, value)
+			}
+			value = ip.String()
+		case sanTypeURI:
+			u := parseURI(value)
+			if u == nil {
+				return "", fmt.Errorf("error creating sans: element %d: invalid uri %q", i, value)
+			}
+			value = u.String()
+		default:
+			return "", fmt.Errorf("error creating sans: element %d: unsupported type %q", i, typ)
+		}
+		list[i] = subjectAlternativeName{Type: strings.ToLower(typ), Value: value}
+	}
+
+	b, err := json.Marshal(list)
+	if err != nil {
+		return "", fmt.Errorf("error creating sans: %w", err)
+	}
+	return string(b), nil
+}
+
+// sanFields returns the type and value of an element of the list given to
+// sans.
+func sanFields(v reflect.Value) (string, string, error) {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", "", fmt.Errorf("element is nil")
+		}
+		v = v.Elem()
+	}
+
+	var typ, value reflect.Value
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return "", "", fmt.Errorf("map keys are not strings")
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			switch strings.ToLower(iter.Key().String()) {
+			case "type":
+				typ = iter.Value()
+			case "value":
+				value = iter.Value()
+			}
+		}
+	case reflect.Struct:
+		typ, value = v.FieldByName("Type"), v.FieldByName("Value")
+	default:
+		return "", "", fmt.Errorf("%v of type %s is not a map or a struct", v, v.Type())
+	}
+
+	if !typ.IsValid() || !value.IsValid() {
+		return "", "", fmt.Errorf("type or value is missing")
+	}
+	return fmt.Sprint(typ.Interface()), fmt.Sprint(value.Interface()), nil
+}
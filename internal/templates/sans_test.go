@@ -0,0 +1,94 @@
+package templates
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_sans(t *testing.T) {
+	type san struct {
+		Type  string
+		Value interface{}
+	}
+	tests := []struct {
+		name    string
+		v       interface{}
+		want    string
+		wantErr string
+	}{
+		{"ok/maps", []interface{}{
+			map[string]interface{}{"type": "dns", "value": "foo.com"},
+			map[string]interface{}{"Type": "IP", "Value": "2001:DB8::1"},
+			map[string]string{"type": "email", "value": "jane@example.com"},
+			map[string]interface{}{"type": "uri", "value": "spiffe://example.com/foo"},
+		}, `[{"type":"dns","value":"foo.com"},{"type":"ip","value":"2001:db8::1"},{"type":"email","value":"jane@example.com"},{"type":"uri","value":"spiffe://example.com/foo"}]`, ""},
+		{"ok/structs", []san{{"dns", "foo.com"}, {"ip", net.ParseIP("10.0.0.1")}}, `[{"type":"dns","value":"foo.com"},{"type":"ip","value":"10.0.0.1"}]`, ""},
+		{"ok/pointers", []*san{{"dns", "foo.com"}}, `[{"type":"dns","value":"foo.com"}]`, ""},
+		{"ok/empty", []interface{}{}, `[]`, ""},
+		{"ok/nil", nil, `[]`, ""},
+		{"fail/not-a-list", "foo.com", "", `error creating sans: foo.com of type string is not a list`},
+		{"fail/unknown-type", []interface{}{map[string]interface{}{"type": "registeredID", "value": "1.2.3"}}, "", `error creating sans: element 0: unsupported type "registeredID"`},
+		{"fail/ip", []san{{"dns", "foo.com"}, {"ip", "10.0.0.256"}}, "", `error creating sans: element 1: invalid ip address "10.0.0.256"`},
+		{"fail/uri", []san{{"uri", "foo.com/bar"}}, "", `error creating sans: element 0: invalid uri "foo.com/bar"`},
+		{"fail/uri-syntax", []san{{"uri", "https://foo.com/%zz"}}, "", `error creating sans: element 0: invalid uri "https://foo.com/%zz"`},
+		{"fail/email", []san{{"email", "jane"}}, "", `error creating sans: element 0: invalid email address "jane"`},
+		{"fail/dns", []san{{"dns", ""}}, "", `error creating sans: element 0: dns name is empty`},
+		{"fail/missing-value", []interface{}{map[string]interface{}{"type": "dns"}}, "", `error creating sans: element 0: type or value is missing`},
+		{"fail/nil-element", []interface{}{nil}, "", `error creating sans: element 0: element is nil`},
+		{"fail/scalar-element", []interface{}{"foo.com"}, "", `error creating sans: element 0: foo.com of type string is not a map or a struct`},
+		{"fail/map-keys", []map[int]string{{1: "dns"}}, "", `error creating sans: element 0: map keys are not strings`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sans(tt.v, true)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.True(t, json.Valid([]byte(got)))
+		})
+	}
+}
+
+func Test_sans_wildcards(t *testing.T) {
+	tests := []struct {
+		name           string
+		value          string
+		allowWildcards bool
+		wantErr        string
+	}{
+		{"ok", "*.example.com", true, ""},
+		{"ok/no-wildcard", "www.example.com", false, ""},
+		{"fail/double", "*.*.example.com", true, `error creating sans: element 0: invalid dns name "*.*.example.com"`},
+		{"fail/partial", "a*.example.com", true, `error creating sans: element 0: invalid dns name "a*.example.com"`},
+		{"fail/tld", "*.com", true, `error creating sans: element 0: invalid dns name "*.com"`},
+		{"fail/rejected", "*.example.com", false, `error creating sans: element 0: invalid dns name "*.example.com"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sans([]interface{}{map[string]string{"type": "dns", "value": tt.value}}, tt.allowWildcards)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, `[{"type":"dns","value":"`+tt.value+`"}]`, got)
+		})
+	}
+}
+
+func TestTemplate_sans(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"sans": {{ sans .SANs }}}`))
+	require.NoError(t, err)
+	out, err := tmpl.Render([]byte(`{"SANs": [{"type": "dns", "value": "foo.com"}, {"type": "ip", "value": "::ffff:10.0.0.1"}]}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"sans": [{"type":"dns","value":"foo.com"},{"type":"ip","value":"10.0.0.1"}]}`, string(out))
+
+	assert.EqualError(t, tmpl.Validate([]byte(`{"SANs": [{"type": "otherName", "value": "foo"}]}`)), `error executing template: error creating sans: element 0: unsupported type "otherName"`)
+}
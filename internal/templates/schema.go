@@ -0,0 +1,357 @@
+package templates
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is a JSON Schema used to validate the rendered output of a template.
+//
+// Only a subset of JSON Schema is supported: the keywords "type", "enum",
+// "const", "properties", "required", "additionalProperties", "items",
+// "minItems", "maxItems", "minLength", "maxLength", "pattern", "minimum",
+// "maximum", "anyOf" and "allOf". Other keywords like "$schema", "title" or
+// "description" are ignored. Patterns use the Go regular expression syntax.
+type Schema struct {
+	Type                 schemaTypes        `json:"type,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Const                *json.RawMessage   `json:"const,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *schemaOrBool      `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Minimum              *json.Number       `json:"minimum,omitempty"`
+	Maximum              *json.Number       `json:"maximum,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// schemaTypes is the value of the "type" keyword, a string or a list of
+// strings.
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*t = schemaTypes{s}
+		return nil
+	}
+	var ss []string
+	if err := json.Unmarshal(data, &ss); err != nil {
+		return fmt.Errorf("invalid type %s", data)
+	}
+	*t = ss
+	return nil
+}
+
+// schemaOrBool is the value of the "additionalProperties" keyword, a boolean
+// or a schema.
+type schemaOrBool struct {
+	allowed bool
+	schema  *Schema
+}
+
+func (s *schemaOrBool) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &s.allowed); err == nil {
+		return nil
+	}
+	s.allowed = true
+	return json.Unmarshal(data, &s.schema)
+}
+
+// ParseSchema parses the given JSON Schema.
+func ParseSchema(data []byte) (*Schema, error) {
+	s := new(Schema)
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("error parsing schema: %w", err)
+	}
+	if err := s.compile(); err != nil {
+		return nil, fmt.Errorf("error parsing schema: %w", err)
+	}
+	return s, nil
+}
+
+func (s *Schema) compile() (err error) {
+	if s == nil {
+		return nil
+	}
+	for _, t := range s.Type {
+		switch t {
+		case "string", "number", "integer", "boolean", "object", "array", "null":
+		default:
+			return fmt.Errorf("unsupported type %q", t)
+		}
+	}
+	if s.Pattern != "" {
+		if s.pattern, err = regexp.Compile(s.Pattern); err != nil {
+			return err
+		}
+	}
+	for _, p := range s.Properties {
+		if err := p.compile(); err != nil {
+			return err
+		}
+	}
+	if s.AdditionalProperties != nil {
+		if err := s.AdditionalProperties.schema.compile(); err != nil {
+			return err
+		}
+	}
+	if err := s.Items.compile(); err != nil {
+		return err
+	}
+	for _, ss := range append(append([]*Schema{}, s.AnyOf...), s.AllOf...) {
+		if err := ss.compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate validates a JSON document against the schema and returns all the
+// violations found.
+func (s *Schema) Validate(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	if errs := s.validate("", v); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (s *Schema) validate(path string, v interface{}) Errors {
+	if s == nil {
+		return nil
+	}
+
+	var errs Errors
+	report := func(format string, args ...interface{}) {
+		errs = append(errs, &schemaViolation{path: path, msg: fmt.Sprintf(format, args...)})
+	}
+	reportKey := func(key, format string, args ...interface{}) {
+		errs = append(errs, &schemaViolation{path: path, key: key, msg: fmt.Sprintf(format, args...)})
+	}
+
+	if len(s.Type) > 0 && !s.matchesType(v) {
+		report("expected %s, got %s", strings.Join(s.Type, " or "), jsonType(v))
+		return errs
+	}
+	if len(s.Enum) > 0 && !containsJSON(s.Enum, v) {
+		report("value %s is not one of %s", toJSONString(v), toJSONString(s.Enum))
+	}
+	if s.Const != nil {
+		var c interface{}
+		if err := json.Unmarshal(*s.Const, &c); err == nil && !equalJSON(c, v) {
+			report("value %s is not %s", toJSONString(v), string(*s.Const))
+		}
+	}
+
+	switch val := v.(type) {
+	case string:
+		n := utf8.RuneCountInString(val)
+		if s.MinLength != nil && n < *s.MinLength {
+			report("length %d is less than %d", n, *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			report("length %d is greater than %d", n, *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(val) {
+			report("value %q does not match %q", val, s.Pattern)
+		}
+	case json.Number:
+		if s.Minimum != nil && compareNumbers(val, *s.Minimum) < 0 {
+			report("value %s is less than %s", val, *s.Minimum)
+		}
+		if s.Maximum != nil && compareNumbers(val, *s.Maximum) > 0 {
+			report("value %s is greater than %s", val, *s.Maximum)
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(val) < *s.MinItems {
+			report("expected at least %d items, got %d", *s.MinItems, len(val))
+		}
+		if s.MaxItems != nil && len(val) > *s.MaxItems {
+			report("expected at most %d items, got %d", *s.MaxItems, len(val))
+		}
+		if s.Items != nil {
+			for i, item := range val {
+				errs = append(errs, s.Items.validate(indexPath(path, i), item)...)
+			}
+		}
+	case map[string]interface{}:
+		for _, key := range s.Required {
+			if _, ok := val[key]; !ok {
+				reportKey(key, "missing required property %q", key)
+			}
+		}
+		keys := make([]string, 0, len(val))
+		for key := range val {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if p, ok := s.Properties[key]; ok {
+				errs = append(errs, p.validate(joinPath(path, key), val[key])...)
+				continue
+			}
+			if ap := s.AdditionalProperties; ap != nil {
+				if !ap.allowed {
+					reportKey(key, "property %q is not allowed", key)
+				} else {
+					errs = append(errs, ap.schema.validate(joinPath(path, key), val[key])...)
+				}
+			}
+		}
+	}
+
+	for _, ss := range s.AllOf {
+		errs = append(errs, ss.validate(path, v)...)
+	}
+	if len(s.AnyOf) > 0 {
+		var matched bool
+		for _, ss := range s.AnyOf {
+			if len(ss.validate(path, v)) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			report("value does not match any of the allowed schemas")
+		}
+	}
+
+	return errs
+}
+
+// schemaViolation is an error found by Schema.Validate in the value at path,
+// or in its property key, if it's not empty.
+type schemaViolation struct {
+	path string
+	key  string
+	msg  string
+}
+
+func (e *schemaViolation) Error() string {
+	return displayPath(e.path) + ": " + e.msg
+}
+
+func (s *Schema) matchesType(v interface{}) bool {
+	t := jsonType(v)
+	for _, st := range s.Type {
+		if st == t {
+			return true
+		}
+		if st == "number" && t == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonType returns the JSON Schema type of a value decoded with UseNumber.
+func jsonType(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if r, ok := new(big.Rat).SetString(val.String()); ok && r.IsInt() {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// compareNumbers compares two JSON numbers without loss of precision.
+func compareNumbers(a, b json.Number) int {
+	ra, ok1 := new(big.Rat).SetString(a.String())
+	rb, ok2 := new(big.Rat).SetString(b.String())
+	if !ok1 || !ok2 {
+		return strings.Compare(a.String(), b.String())
+	}
+	return ra.Cmp(rb)
+}
+
+// equalJSON reports whether two values decoded from JSON are equal, numbers
+// are compared by value.
+func equalJSON(a, b interface{}) bool {
+	na, ok1 := toNumber(a)
+	nb, ok2 := toNumber(b)
+	if ok1 && ok2 {
+		return compareNumbers(na, nb) == 0
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func toNumber(v interface{}) (json.Number, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		return n, true
+	case float64:
+		return json.Number(fmt.Sprint(n)), true
+	default:
+		return "", false
+	}
+}
+
+func containsJSON(list []interface{}, v interface{}) bool {
+	for _, e := range list {
+		if equalJSON(e, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func toJSONString(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// ValidateTemplateAgainstSchema validates that the rendered output of a
+// template matches the given JSON Schema. All the violations are reported in
+// the returned error. The schemas X509CertificateSchema and
+// SSHCertificateSchema can be used to validate the templates for X.509 and
+// SSH certificates.
+func ValidateTemplateAgainstSchema(rendered, schema []byte) error {
+	s, err := ParseSchema(schema)
+	if err != nil {
+		return err
+	}
+	if err := s.Validate(rendered); err != nil {
+		if _, ok := err.(Errors); !ok {
+			return newTemplateError(JSONError, err, "error validating json template data: "+err.Error())
+		}
+		return newTemplateError(SchemaError, err, "error validating template against schema: "+err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package templates
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSchema(t *testing.T) {
+	_, err := ParseSchema([]byte(`{"type": "object", "properties": {"a": {"type": ["string", "null"]}}}`))
+	assert.NoError(t, err)
+
+	_, err = ParseSchema([]byte(`{"type": "foo"}`))
+	assert.EqualError(t, err, `error parsing schema: unsupported type "foo"`)
+	_, err = ParseSchema([]byte(`{"type": 1}`))
+	assert.EqualError(t, err, `error parsing schema: invalid type 1`)
+	_, err = ParseSchema([]byte(`{"properties": {"a": {"pattern": "("}}}`))
+	assert.EqualError(t, err, "error parsing schema: error parsing regexp: missing closing ): `(`")
+	_, err = ParseSchema([]byte(`{`))
+	assert.EqualError(t, err, "error parsing schema: unexpected end of JSON input")
+}
+
+func TestSchema_Validate(t *testing.T) {
+	schema, err := ParseSchema([]byte(`{
+		"type": "object",
+		"required": ["name"],
+		"additionalProperties": false,
+		"properties": {
+			"name": {"type": "string", "minLength": 1, "maxLength": 5, "pattern": "^[a-z]+$"},
+			"count": {"type": "integer", "minimum": 0, "maximum": 10},
+			"ratio": {"type": "number"},
+			"big": {"type": "integer", "maximum": 123456789012345678901234567890},
+			"kind": {"enum": ["a", "b", 1]},
+			"version": {"const": 3},
+			"list": {"type": "array", "minItems": 1, "maxItems": 2, "items": {"type": "string"}},
+			"map": {"type": "object", "additionalProperties": {"type": "boolean"}},
+			"any": {"anyOf": [{"type": "string"}, {"type": "integer"}]},
+			"all": {"allOf": [{"type": "string"}, {"maxLength": 2}]}
+		}
+	}`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		data string
+		err  error
+	}{
+		{"ok", `{"name": "foo", "count": 10, "ratio": 1.5, "big": 123456789012345678901234567890, "kind": 1, "version": 3, "list": ["a"], "map": {"x": true}, "any": 1, "all": "ab"}`, nil},
+		{"ok/minimal", `{"name": "a"}`, nil},
+		{"fail/type", `[]`, errors.New("(root): expected object, got array")},
+		{"fail/required", `{}`, errors.New(`(root): missing required property "name"`)},
+		{"fail/additional", `{"name": "a", "foo": 1}`, errors.New(`(root): property "foo" is not allowed`)},
+		{"fail/string", `{"name": "Foo-Bar"}`, errors.New(`name: length 7 is greater than 5; name: value "Foo-Bar" does not match "^[a-z]+$"`)},
+		{"fail/min-length", `{"name": ""}`, errors.New(`name: length 0 is less than 1; name: value "" does not match "^[a-z]+$"`)},
+		{"fail/integer", `{"name": "a", "count": 1.5}`, errors.New("count: expected integer, got number")},
+		{"fail/range", `{"name": "a", "count": -1, "big": 123456789012345678901234567891}`, errors.New("big: value 123456789012345678901234567891 is greater than 123456789012345678901234567890; count: value -1 is less than 0")},
+		{"fail/maximum", `{"name": "a", "count": 11}`, errors.New("count: value 11 is greater than 10")},
+		{"fail/enum", `{"name": "a", "kind": "c"}`, errors.New(`kind: value "c" is not one of ["a","b",1]`)},
+		{"fail/const", `{"name": "a", "version": 2}`, errors.New(`version: value 2 is not 3`)},
+		{"fail/items", `{"name": "a", "list": [1, "b", true]}`, errors.New("list: expected at most 2 items, got 3; list[0]: expected string, got integer; list[2]: expected string, got boolean")},
+		{"fail/min-items", `{"name": "a", "list": []}`, errors.New("list: expected at least 1 items, got 0")},
+		{"fail/additional-schema", `{"name": "a", "map": {"x": true, "y.z": 1}}`, errors.New(`map["y.z"]: expected boolean, got integer`)},
+		{"fail/any-of", `{"name": "a", "any": true}`, errors.New("any: value does not match any of the allowed schemas")},
+		{"fail/all-of", `{"name": "a", "all": "abc"}`, errors.New("all: length 3 is greater than 2")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := schema.Validate([]byte(tt.data))
+			if tt.err != nil {
+				assert.EqualError(t, err, tt.err.Error())
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestValidateTemplateAgainstSchema(t *testing.T) {
+	tests := []struct {
+		name     string
+		rendered string
+		schema   string
+		err      error
+	}{
+		{
+			name: "ok/x509",
+			rendered: `{
+				"subject": {"commonName": "foo.com", "organization": ["Smallstep"]},
+				"sans": [{"type": "dns", "value": "foo.com"}],
+				"keyUsage": ["keyEncipherment", "DigitalSignature"],
+				"extKeyUsage": ["serverAuth", "clientAuth"],
+				"extensions": [{"id": "1.2.840.113583.1.1.10", "value": "BQA="}],
+				"basicConstraints": {"isCA": false, "maxPathLen": 0}
+			}`,
+			schema: X509CertificateSchema,
+		},
+		{
+			name:     "ok/x509-empty-data",
+			rendered: `{"subject": null, "sans": null, "keyUsage": ["digitalSignature"], "extKeyUsage": ["serverAuth", "clientAuth"]}`,
+			schema:   X509CertificateSchema,
+		},
+		{
+			name:     "ok/ssh",
+			rendered: `{"type": "user", "keyId": "foo", "principals": ["foo", "bar"], "extensions": {"permit-pty": ""}, "criticalOptions": null}`,
+			schema:   SSHCertificateSchema,
+		},
+		{
+			name: "fail/x509",
+			rendered: `{
+				"subjekt": {"commonName": "foo.com"},
+				"sans": [{"type": "dnsName", "value": "foo.com"}],
+				"keyUsage": ["digitalSignature", "serverAuth"],
+				"extensions": [{"id": "foo", "critical": "true"}]
+			}`,
+			schema: X509CertificateSchema,
+			err: errors.New(`error validating template against schema: extensions[0].critical: expected boolean, got string; ` +
+				`extensions[0].id: value "foo" does not match "^[0-9]+(\\.[0-9]+)+$"; ` +
+				`keyUsage[1]: value "serverAuth" does not match "^(?i)(digitalSignature|contentCommitment|keyEncipherment|dataEncipherment|keyAgreement|certSign|crlSign|encipherOnly|decipherOnly)$"; ` +
+				`sans[0].type: value "dnsName" is not one of ["","auto","email","dns","x400Address","dn","ediPartyName","uri","ip","registeredID","permanentIdentifier","hardwareModuleName"]; ` +
+				`(root): property "subjekt" is not allowed`),
+		},
+		{
+			name:     "fail/x509-validity",
+			rendered: `{"subject": "foo", "notBefore": "2026-01-02T00:00:00Z", "notAfter": "2026-04-02T00:00:00Z"}`,
+			schema:   X509CertificateSchema,
+			err:      errors.New(`error validating template against schema: (root): property "notAfter" is not allowed; (root): property "notBefore" is not allowed`),
+		},
+		{
+			name:     "fail/x509-issuer-extra-names",
+			rendered: `{"issuer": {"commonName": "Root CA", "extraNames": [{"type": "2.5.4.3", "value": "Root CA"}, {"type": "commonName", "value": "Root CA"}]}}`,
+			schema:   X509CertificateSchema,
+			err:      errors.New(`error validating template against schema: issuer.extraNames[1].type: value "commonName" does not match "^[0-9]+(\\.[0-9]+)+$"`),
+		},
+		{
+			name:     "fail/ssh",
+			rendered: `{"type": "admin", "principals": "foo"}`,
+			schema:   SSHCertificateSchema,
+			err:      errors.New(`error validating template against schema: principals: expected array or null, got string; type: value "admin" does not match "^(?i)(user|host)$"`),
+		},
+		{
+			name:     "fail/invalid-json",
+			rendered: `{"type": }`,
+			schema:   SSHCertificateSchema,
+			err:      errors.New(`error validating json template data: invalid character '}' looking for beginning of value`),
+		},
+		{
+			name:     "fail/invalid-schema",
+			rendered: `{}`,
+			schema:   `{"type": "foo"}`,
+			err:      errors.New(`error parsing schema: unsupported type "foo"`),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateTemplateAgainstSchema([]byte(tt.rendered), []byte(tt.schema))
+			if tt.err != nil {
+				assert.EqualError(t, err, tt.err.Error())
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+
+	var te *TemplateError
+	err := ValidateTemplateAgainstSchema([]byte(`{"type": "admin"}`), []byte(SSHCertificateSchema))
+	if assert.True(t, errors.As(err, &te)) {
+		assert.Equal(t, SchemaError, te.Kind)
+		var errs Errors
+		assert.True(t, errors.As(err, &errs))
+		assert.Len(t, errs, 1)
+	}
+}
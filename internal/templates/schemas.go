@@ -0,0 +1,117 @@
+package templates
+
+// X509CertificateSchema is a JSON Schema for the rendered output of templates
+// used to create X.509 certificates. Key usages are matched without case
+// sensitivity like the x509util package does.
+const X509CertificateSchema = `{
+	"type": "object",
+	"additionalProperties": false,
+	"properties": {
+		"version": {"type": "integer", "minimum": 0},
+		"subject": {"type": ["string", "object", "null"], "properties": {
+			"country": {"type": ["string", "array", "null"], "items": {"type": "string"}},
+			"organization": {"type": ["string", "array", "null"], "items": {"type": "string"}},
+			"organizationalUnit": {"type": ["string", "array", "null"], "items": {"type": "string"}},
+			"locality": {"type": ["string", "array", "null"], "items": {"type": "string"}},
+			"province": {"type": ["string", "array", "null"], "items": {"type": "string"}},
+			"streetAddress": {"type": ["string", "array", "null"], "items": {"type": "string"}},
+			"postalCode": {"type": ["string", "array", "null"], "items": {"type": "string"}},
+			"serialNumber": {"type": "string"},
+			"commonName": {"type": "string"},
+			"extraNames": {"type": ["array", "null"], "items": {
+				"type": "object",
+				"required": ["type"],
+				"properties": {"type": {"type": "string", "pattern": "^[0-9]+(\\.[0-9]+)+$"}}
+			}}
+		}, "additionalProperties": false},
+		"issuer": {"type": ["string", "object", "null"], "properties": {
+			"country": {"type": ["string", "array", "null"], "items": {"type": "string"}},
+			"organization": {"type": ["string", "array", "null"], "items": {"type": "string"}},
+			"organizationalUnit": {"type": ["string", "array", "null"], "items": {"type": "string"}},
+			"locality": {"type": ["string", "array", "null"], "items": {"type": "string"}},
+			"province": {"type": ["string", "array", "null"], "items": {"type": "string"}},
+			"streetAddress": {"type": ["string", "array", "null"], "items": {"type": "string"}},
+			"postalCode": {"type": ["string", "array", "null"], "items": {"type": "string"}},
+			"serialNumber": {"type": "string"},
+			"commonName": {"type": "string"},
+			"extraNames": {"type": ["array", "null"], "items": {
+				"type": "object",
+				"required": ["type"],
+				"properties": {"type": {"type": "string", "pattern": "^[0-9]+(\\.[0-9]+)+$"}}
+			}}
+		}, "additionalProperties": false},
+		"serialNumber": {"type": ["string", "integer", "null"]},
+		"dnsNames": {"type": ["string", "array", "null"], "items": {"type": "string"}},
+		"emailAddresses": {"type": ["string", "array", "null"], "items": {"type": "string"}},
+		"ipAddresses": {"type": ["string", "array", "null"], "items": {"type": "string"}},
+		"uris": {"type": ["string", "array", "null"], "items": {"type": "string"}},
+		"sans": {"type": ["array", "null"], "items": {
+			"type": "object",
+			"additionalProperties": false,
+			"properties": {
+				"type": {"enum": ["", "auto", "email", "dns", "x400Address", "dn", "ediPartyName", "uri", "ip", "registeredID", "permanentIdentifier", "hardwareModuleName"]},
+				"value": {"type": "string"},
+				"asn1Value": {}
+			}
+		}},
+		"extensions": {"type": ["array", "null"], "items": {
+			"type": "object",
+			"required": ["id"],
+			"additionalProperties": false,
+			"properties": {
+				"id": {"type": "string", "pattern": "^[0-9]+(\\.[0-9]+)+$"},
+				"critical": {"type": "boolean"},
+				"value": {"type": ["string", "null"]}
+			}
+		}},
+		"keyUsage": {"type": ["string", "array", "null"], "items": {
+			"type": "string",
+			"pattern": "^(?i)(digitalSignature|contentCommitment|keyEncipherment|dataEncipherment|keyAgreement|certSign|crlSign|encipherOnly|decipherOnly)$"
+		}},
+		"extKeyUsage": {"type": ["string", "array", "null"], "items": {
+			"type": "string",
+			"pattern": "^(?i)(any|serverAuth|clientAuth|codeSigning|emailProtection|ipsecEndSystem|ipsecTunnel|ipsecUser|timeStamping|ocspSigning|microsoftServerGatedCrypto|netscapeServerGatedCrypto|microsoftCommercialCodeSigning|microsoftKernelCodeSigning)$"
+		}},
+		"unknownExtKeyUsage": {"type": ["string", "array", "null"], "items": {"type": "string", "pattern": "^[0-9]+(\\.[0-9]+)+$"}},
+		"subjectKeyId": {"type": ["string", "null"]},
+		"authorityKeyId": {"type": ["string", "null"]},
+		"ocspServer": {"type": ["string", "array", "null"], "items": {"type": "string"}},
+		"issuingCertificateURL": {"type": ["string", "array", "null"], "items": {"type": "string"}},
+		"crlDistributionPoints": {"type": ["string", "array", "null"], "items": {"type": "string"}},
+		"policyIdentifiers": {"type": ["string", "array", "null"], "items": {"type": "string", "pattern": "^[0-9]+(\\.[0-9]+)+$"}},
+		"basicConstraints": {"type": ["object", "null"], "additionalProperties": false, "properties": {
+			"isCA": {"type": "boolean"},
+			"maxPathLen": {"type": "integer", "minimum": -1}
+		}},
+		"nameConstraints": {"type": ["object", "null"], "additionalProperties": false, "properties": {
+			"critical": {"type": "boolean"},
+			"permittedDNSDomains": {"type": ["string", "array", "null"], "items": {"type": "string"}},
+			"excludedDNSDomains": {"type": ["string", "array", "null"], "items": {"type": "string"}},
+			"permittedIPRanges": {"type": ["string", "array", "null"], "items": {"type": "string"}},
+			"excludedIPRanges": {"type": ["string", "array", "null"], "items": {"type": "string"}},
+			"permittedEmailAddresses": {"type": ["string", "array", "null"], "items": {"type": "string"}},
+			"excludedEmailAddresses": {"type": ["string", "array", "null"], "items": {"type": "string"}},
+			"permittedURIDomains": {"type": ["string", "array", "null"], "items": {"type": "string"}},
+			"excludedURIDomains": {"type": ["string", "array", "null"], "items": {"type": "string"}}
+		}},
+		"signatureAlgorithm": {"type": ["string", "null"]}
+	}
+}`
+
+// SSHCertificateSchema is a JSON Schema for the rendered output of templates
+// used to create SSH certificates. The certificate type is matched without
+// case sensitivity like the sshutil package does.
+const SSHCertificateSchema = `{
+	"type": "object",
+	"additionalProperties": false,
+	"properties": {
+		"nonce": {"type": ["string", "null"]},
+		"serial": {"type": "integer", "minimum": 0},
+		"type": {"type": "string", "pattern": "^(?i)(user|host)$"},
+		"keyId": {"type": ["string", "null"]},
+		"principals": {"type": ["array", "null"], "items": {"type": "string"}},
+		"criticalOptions": {"type": ["object", "null"], "additionalProperties": {"type": "string"}},
+		"extensions": {"type": ["object", "null"], "additionalProperties": {"type": "string"}},
+		"reserved": {"type": ["string", "null"]}
+	}
+}`
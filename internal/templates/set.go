@@ -0,0 +1,123 @@
+package templates
+
+import (
+	"fmt"
+	"io/fs"
+	"text/template"
+	"text/template/parse"
+)
+
+// ParseTemplateSet parses the files in fsys that match the patterns, in the
+// syntax of fs.Glob, as a single template. The first file matched is the main
+// template, the one that is rendered, and the other files usually only define
+// partials with {{ define "name" }} that can be used from any file in the set
+// with {{ template "name" . }}.
+//
+// All the files are parsed with the functions returned by GetFuncMap, and the
+// definitions of all of them are associated before the references are
+// checked, so a file can use the partials defined in any other file. A
+// reference to a partial that is not defined in any file is reported as a
+// ParseError with the name of the partial and the position of the reference,
+// even if it's in a block that is never executed, and so is a partial with the
+// name of a function, like ParseTemplate does. The errors in a file include
+// its name, like "template: partials/san.tmpl:3: ...".
+func ParseTemplateSet(fsys fs.FS, patterns ...string) (*Template, error) {
+	o := newOptions(nil)
+	left, right := o.delims()
+
+	var names []string
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		matches, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, newTemplateError(ParseError, err, "error parsing template: "+err.Error())
+		}
+		if len(matches) == 0 {
+			err := fmt.Errorf("pattern matches no files: %#q", pattern)
+			return nil, newTemplateError(ParseError, err, "error parsing template: "+err.Error())
+		}
+		for _, name := range matches {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		err := fmt.Errorf("no files named in call to ParseTemplateSet")
+		return nil, newTemplateError(ParseError, err, "error parsing template: "+err.Error())
+	}
+
+	var main *template.Template
+	funcs := newFuncs(o).FuncMap()
+	texts := make(map[string][]byte, len(names))
+	for _, name := range names {
+		text, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, newTemplateError(ParseError, err, "error parsing template: "+err.Error())
+		}
+		if err := checkFuncMapVersion(text, left, right); err != nil {
+			return nil, err
+		}
+		texts[name] = text
+
+		var tmpl *template.Template
+		if main == nil {
+			main = template.New(name).Delims(left, right).Funcs(funcs)
+			tmpl = main
+		} else {
+			tmpl = main.New(name)
+		}
+		if _, err := tmpl.Parse(string(text)); err != nil {
+			return nil, newParseError(err, text, left)
+		}
+	}
+
+	if err := checkTemplateRefs(main, names, texts); err != nil {
+		return nil, err
+	}
+	if err := checkReservedNames(main, names, texts, funcs, left); err != nil {
+		return nil, err
+	}
+
+	return &Template{
+		text: texts[names[0]],
+		tmpl: main,
+		o:    o,
+	}, nil
+}
+
+// checkTemplateRefs returns a ParseError for the first {{ template }} action,
+// in the order of the files, that references a template not defined in the
+// set.
+func checkTemplateRefs(set *template.Template, names []string, texts map[string][]byte) error {
+	for _, name := range names {
+		// The trees of the templates defined in a file are named after the
+		// definition, but they keep the name of the file they come from.
+		var ref *parse.TemplateNode
+		for _, t := range set.Templates() {
+			if t.Tree == nil || t.Tree.ParseName != name {
+				continue
+			}
+			walkTree(t.Tree.Root, func(node parse.Node) bool {
+				n, ok := node.(*parse.TemplateNode)
+				if !ok || (ref != nil && ref.Pos < n.Pos) {
+					return true
+				}
+				if d := set.Lookup(n.Name); d == nil || d.Tree == nil {
+					ref = n
+				}
+				return true
+			})
+		}
+		if ref != nil {
+			text := texts[name]
+			line, _ := position(text, int(ref.Pos))
+			err := fmt.Errorf("template: %s:%d: template %q is not defined", name, line, ref.Name)
+			te := newTemplateError(ParseError, err, "error parsing template: "+err.Error())
+			te.setPosition(int(ref.Pos), text, nil)
+			return te
+		}
+	}
+	return nil
+}
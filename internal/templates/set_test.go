@@ -0,0 +1,67 @@
+package templates
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTemplateSet(t *testing.T) {
+	file := func(s string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(s)}
+	}
+	fsys := fstest.MapFS{
+		"leaf.tmpl":             file(`{"subject": {{ template "subject" .Subject }}, "sans": {{ template "subjectAltNames" . }}}`),
+		"partials/subject.tmpl": file(`{{ define "subject" }}{"commonName": {{ .CommonName | lower | toJson }}}{{ end }}`),
+		"partials/sans.tmpl":    file(`{{ define "subjectAltNames" }}{{ toJson .SANs }}{{ end }}{{ define "unused" }}{{ fail "unused" }}{{ end }}`),
+		"missing.tmpl":          file("{\n  \"subject\": {{ if .Subject }}{{ template \"subject\" . }}{{ else }}{{ template \"empty\" }}{{ end }}\n}"),
+		"unknown-func.tmpl":     file(`{{ define "bad" }}{{ unknownFunction . }}{{ end }}`),
+		"requires.tmpl":         file(`{{/* requires funcmap >= 9999 */}}`),
+		"reserved.tmpl":         file("{{ define \"subject\" }}{{ end }}\n{{ define \"sans\" }}{{ end }}"),
+	}
+
+	tests := []struct {
+		name     string
+		patterns []string
+		data     string
+		want     string
+		wantErr  string
+		wantLine int
+		wantCol  int
+	}{
+		{"ok", []string{"leaf.tmpl", "partials/*.tmpl"}, `{"Subject": {"CommonName": "Foo"}, "SANs": ["foo.com"]}`, `{"subject": {"commonName": "foo"}, "sans": ["foo.com"]}`, "", 0, 0},
+		{"ok/duplicated", []string{"leaf.tmpl", "partials/*.tmpl", "partials/sans.tmpl"}, `{"Subject": {"CommonName": ""}, "SANs": []}`, `{"subject": {"commonName": ""}, "sans": []}`, "", 0, 0},
+		{"fail/undefined", []string{"leaf.tmpl"}, "", "", `error parsing template: template: leaf.tmpl:1: template "subject" is not defined`, 1, 25},
+		{"fail/undefined-in-branch", []string{"missing.tmpl", "partials/subject.tmpl"}, "", "", `error parsing template: template: missing.tmpl:2: template "empty" is not defined`, 2, 79},
+		{"fail/no-files", []string{"leaf.tmpl", "other/*.tmpl"}, "", "", "error parsing template: pattern matches no files: `other/*.tmpl`", 0, 0},
+		{"fail/bad-pattern", []string{"[.tmpl"}, "", "", "error parsing template: syntax error in pattern", 0, 0},
+		{"fail/no-patterns", nil, "", "", "error parsing template: no files named in call to ParseTemplateSet", 0, 0},
+		{"fail/func", []string{"leaf.tmpl", "unknown-func.tmpl"}, "", "", `error parsing template: template: unknown-func.tmpl:1: function "unknownFunction" not defined`, 1, 22},
+		{"fail/reserved", []string{"leaf.tmpl", "partials/*.tmpl", "reserved.tmpl"}, "", "", `error parsing template: template: reserved.tmpl:2: template "sans" has the name of a function`, 2, 1},
+		{"fail/requires", []string{"leaf.tmpl", "requires.tmpl"}, "", "", "error parsing template: template requires newer func map: version 9999 required, have " + strconv.Itoa(FuncMapVersion()), 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseTemplateSet(fsys, tt.patterns...)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				var te *TemplateError
+				if assert.True(t, errors.As(err, &te)) {
+					assert.Equal(t, ParseError, te.Kind)
+					assert.Equal(t, tt.wantLine, te.Line)
+					assert.Equal(t, tt.wantCol, te.Column)
+				}
+				return
+			}
+			require.NoError(t, err)
+			assert.NoError(t, tmpl.Validate([]byte(tt.data)))
+			out, err := tmpl.Render([]byte(tt.data))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(out))
+		})
+	}
+}
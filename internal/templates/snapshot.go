@@ -0,0 +1,119 @@
+package templates
+
+import (
+	"fmt"
+	"sort"
+)
+
+// FuncMapSnapshot is the set of functions available to a template, with the
+// version of GetFuncMap that defines them. It's returned in the Result of
+// Validate, and it can be stored to validate the template again later with
+// WithFuncMapSnapshot and the same functions, for example to prove which
+// functions a template was validated with.
+type FuncMapSnapshot struct {
+	// Version is the version of the functions, like FuncMapVersion returns.
+	Version int `json:"version"`
+	// Functions are the sorted names of the functions available to the
+	// template, including the ones added with WithFuncs but not the ones
+	// denied with WithDeniedFuncs. The functions predefined by text/template
+	// are always available and are not included.
+	Functions []string `json:"functions"`
+}
+
+// SnapshotFuncMap returns the snapshot of the functions available to the
+// templates validated with the given options. It returns an error if the
+// options are not valid, like a function added with WithFuncs with the name
+// of a built-in one, or a snapshot given with WithFuncMapSnapshot that cannot
+// be used.
+func SnapshotFuncMap(opts ...Option) (*FuncMapSnapshot, error) {
+	o := newOptions(opts)
+	if err := checkFuncs(o); err != nil {
+		return nil, err
+	}
+	return snapshotFuncMap(o), nil
+}
+
+// snapshotFuncMap returns the snapshot of the functions available with the
+// options o.
+func snapshotFuncMap(o *options) *FuncMapSnapshot {
+	s := &FuncMapSnapshot{
+		Version:   funcMapVersion,
+		Functions: []string{},
+	}
+	for name := range newFuncMap(func(string, string) {}, o) {
+		if _, denied := o.deniedFunc(name); !denied {
+			s.Functions = append(s.Functions, name)
+		}
+	}
+	sort.Strings(s.Functions)
+	return s
+}
+
+// WithFuncMapSnapshot is an option that validates templates with the
+// functions of a snapshot, usually the one returned in the Result of a
+// previous validation, so a template is validated again with exactly the same
+// functions. The use of a function that is not in the snapshot is a
+// ParseError, like a function denied with WithDeniedFuncs. If a function of
+// the snapshot is not defined, or the snapshot has a version newer than
+// FuncMapVersion, the validation fails with a ParseError instead of using a
+// different set of functions; functions added with WithFuncs are defined if
+// the same option is given again. A nil snapshot makes all the functions
+// available.
+func WithFuncMapSnapshot(s *FuncMapSnapshot) Option {
+	return func(o *options) {
+		if s == nil {
+			o.snapshot = nil
+			return
+		}
+		o.snapshot = &funcMapSnapshot{
+			version: s.Version,
+			names:   make(map[string]struct{}, len(s.Functions)),
+		}
+		for _, name := range s.Functions {
+			o.snapshot.names[name] = struct{}{}
+		}
+	}
+}
+
+// funcMapSnapshot is a FuncMapSnapshot given with WithFuncMapSnapshot.
+type funcMapSnapshot struct {
+	version int
+	names   map[string]struct{}
+}
+
+// checkSnapshot returns an error if the functions of the snapshot given with
+// WithFuncMapSnapshot are not all defined with the options o.
+func checkSnapshot(o *options) error {
+	if o.snapshot == nil {
+		return nil
+	}
+	if o.snapshot.version > funcMapVersion {
+		return fmt.Errorf("func map snapshot requires version %d, have %d", o.snapshot.version, funcMapVersion)
+	}
+	funcs := newFuncMap(func(string, string) {}, o)
+	var missing []string
+	for name := range o.snapshot.names {
+		if _, ok := funcs[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("function %q of the func map snapshot is not defined", missing[0])
+	}
+	return nil
+}
+
+// deniedFunc returns the reason why the template function name cannot be
+// used with the options o, if it cannot be used.
+func (o *options) deniedFunc(name string) (string, bool) {
+	if _, ok := o.deniedFuncs[name]; ok {
+		return "is denied", true
+	}
+	if o.snapshot != nil && !builtinFuncs[name] {
+		if _, ok := o.snapshot.names[name]; !ok {
+			return "is not in the func map snapshot", true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,101 @@
+package templates
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotFuncMap(t *testing.T) {
+	s, err := SnapshotFuncMap()
+	require.NoError(t, err)
+	assert.Equal(t, FuncMapVersion(), s.Version)
+	assert.True(t, sort.StringsAreSorted(s.Functions))
+	assert.Contains(t, s.Functions, "toJson")
+	assert.Contains(t, s.Functions, "env")
+	assert.NotContains(t, s.Functions, "eq")
+	var failMessage string
+	assert.Len(t, s.Functions, len(GetFuncMap(&failMessage)))
+
+	s, err = SnapshotFuncMap(WithDeniedFuncs("env"), WithFuncs(template.FuncMap{"region": func() string { return "eu" }}))
+	require.NoError(t, err)
+	assert.NotContains(t, s.Functions, "env")
+	assert.Contains(t, s.Functions, "region")
+
+	_, err = SnapshotFuncMap(WithFuncs(template.FuncMap{"toJson": func() string { return "" }}))
+	assert.EqualError(t, err, `function "toJson" cannot be redefined`)
+}
+
+func TestWithFuncMapSnapshot(t *testing.T) {
+	region := WithFuncs(template.FuncMap{"region": func() string { return "eu" }})
+	tests := []struct {
+		name     string
+		text     string
+		snapshot *FuncMapSnapshot
+		opts     []Option
+		wantErr  string
+		wantLine int
+		wantCol  int
+	}{
+		{"ok", `{"a": {{ toJson (lower .A) }}}`, &FuncMapSnapshot{Version: FuncMapVersion(), Functions: []string{"lower", "toJson"}}, nil, "", 0, 0},
+		{"ok/builtins", `{{ if eq .A "a" }}{{ print 1 }}{{ else }}{}{{ end }}`, &FuncMapSnapshot{Version: 1, Functions: []string{}}, nil, "", 0, 0},
+		{"ok/older", `{"a": {{ toJson .A }}}`, &FuncMapSnapshot{Version: 1, Functions: []string{"toJson"}}, nil, "", 0, 0},
+		{"ok/funcs", `{"region": {{ region | toJson }}}`, &FuncMapSnapshot{Version: FuncMapVersion(), Functions: []string{"region", "toJson"}}, []Option{region}, "", 0, 0},
+		{"ok/nil", `{"a": {{ toJson (lower .A) }}}`, nil, nil, "", 0, 0},
+		{"fail/not-in-snapshot", "{\n\"a\": {{ toJson (lower .A) }}}", &FuncMapSnapshot{Version: FuncMapVersion(), Functions: []string{"toJson"}}, nil, `error parsing template: template: template:2:17: function "lower" is not in the func map snapshot`, 2, 17},
+		{"fail/denied", `{"a": {{ toJson (env "A") }}}`, &FuncMapSnapshot{Version: FuncMapVersion(), Functions: []string{"env", "toJson"}}, []Option{WithDeniedFuncs("env")}, `error parsing template: template: template:1:18: function "env" is denied`, 1, 18},
+		{"fail/missing", `{"a": {{ toJson .A }}}`, &FuncMapSnapshot{Version: FuncMapVersion(), Functions: []string{"toJson", "region", "oldFunc"}}, nil, `error parsing template: function "oldFunc" of the func map snapshot is not defined`, 0, 0},
+		{"fail/missing-funcs", `{"region": {{ region | toJson }}}`, &FuncMapSnapshot{Version: FuncMapVersion(), Functions: []string{"region", "toJson"}}, nil, `error parsing template: function "region" of the func map snapshot is not defined`, 0, 0},
+		{"fail/newer", `{"a": {{ toJson .A }}}`, &FuncMapSnapshot{Version: FuncMapVersion() + 1, Functions: []string{"toJson"}}, nil, fmt.Sprintf("error parsing template: func map snapshot requires version %d, have %d", FuncMapVersion()+1, FuncMapVersion()), 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]Option{WithFuncMapSnapshot(tt.snapshot)}, tt.opts...)
+			err := ValidateTemplate([]byte(tt.text), opts...)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.wantErr)
+			var te *TemplateError
+			if assert.True(t, errors.As(err, &te)) {
+				assert.Equal(t, ParseError, te.Kind)
+				assert.Equal(t, tt.wantLine, te.Line)
+				assert.Equal(t, tt.wantCol, te.Column)
+			}
+		})
+	}
+}
+
+func TestWithFuncMapSnapshot_result(t *testing.T) {
+	text := []byte(`{"a": {{ toJson (lower .A) }}}`)
+	res, err := Validate(text, WithDeniedFuncs("env"))
+	require.NoError(t, err)
+	require.NotNil(t, res.FuncMap)
+	assert.NotContains(t, res.FuncMap.Functions, "env")
+
+	// The snapshot is stored as JSON and used to validate the template again.
+	b, err := json.Marshal(res.FuncMap)
+	require.NoError(t, err)
+	var snapshot FuncMapSnapshot
+	require.NoError(t, json.Unmarshal(b, &snapshot))
+
+	again, err := Validate(text, WithFuncMapSnapshot(&snapshot))
+	require.NoError(t, err)
+	assert.Equal(t, res, again)
+
+	_, err = Validate([]byte(`{"a": {{ env "A" | toJson }}}`), WithFuncMapSnapshot(&snapshot))
+	assert.EqualError(t, err, `error parsing template: template: template:1:10: function "env" is not in the func map snapshot`)
+
+	snapshot.Functions = append(snapshot.Functions, "removed")
+	res, err = Validate(text, WithFuncMapSnapshot(&snapshot))
+	assert.EqualError(t, err, `error parsing template: function "removed" of the func map snapshot is not defined`)
+	assert.False(t, res.IsValid)
+	assert.Nil(t, res.FuncMap)
+}
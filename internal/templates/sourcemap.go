@@ -0,0 +1,239 @@
+package templates
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"text/template"
+	"text/template/parse"
+)
+
+// segment is a contiguous range of rendered output and the template source
+// offset it was produced from.
+type segment struct {
+	start, end int  // range in the rendered output
+	pos        int  // offset in the template source
+	literal    bool // true if the output is template text copied verbatim
+	// action is the offset of the action whose output, possibly empty, comes
+	// right before a literal segment, or -1 if there's none.
+	action int
+}
+
+// sourceMap maps offsets in the rendered output of a template to offsets in
+// the original template source.
+type sourceMap struct {
+	segments []segment
+}
+
+// lookup returns the template source offset that produced the output byte at
+// offset. The boolean is true if the byte was copied verbatim from the
+// template text, and the returned offset is exact. Otherwise the byte was
+// produced by an action, and the offset of that action is returned. If the
+// offset cannot be mapped at all, -1 is returned.
+//
+// The first byte of a literal that comes right after the output of an action
+// is mapped to the action, like the bytes produced by it: errors at that
+// boundary, like a missing value or a trailing comma, are usually caused by
+// what the action rendered, or didn't render, and not by the literal.
+func (m *sourceMap) lookup(offset int) (int, bool) {
+	if m == nil || len(m.segments) == 0 {
+		return -1, false
+	}
+	i := sort.Search(len(m.segments), func(i int) bool {
+		return m.segments[i].end > offset
+	})
+	if i == len(m.segments) {
+		// Past the end of the output, e.g. an unexpected end of JSON input;
+		// use the end of the last segment.
+		s := m.segments[i-1]
+		if s.literal {
+			return s.pos + (s.end - s.start), true
+		}
+		return s.pos, false
+	}
+	s := m.segments[i]
+	if s.literal && offset == s.start && s.action >= 0 {
+		return s.action, false
+	}
+	if s.literal {
+		return s.pos + (offset - s.start), true
+	}
+	return s.pos, false
+}
+
+// trackingWriter is an io.Writer that records a sourceMap while a template is
+// executed. It relies on text/template writing template text by passing the
+// TextNode bytes directly to Write: a write sharing the backing array of a
+// known TextNode is literal text, any other write is the output of an action.
+type trackingWriter struct {
+	w       io.Writer
+	n       int
+	text    map[*byte]int
+	actions []int
+	next    int
+	m       *sourceMap
+}
+
+func newTrackingWriter(w io.Writer, tmpl *template.Template) *trackingWriter {
+	tw := &trackingWriter{
+		w:    w,
+		text: make(map[*byte]int),
+		m:    new(sourceMap),
+	}
+	walkTemplates(tmpl, func(node parse.Node) bool {
+		switch n := node.(type) {
+		case *parse.TextNode:
+			if len(n.Text) > 0 {
+				tw.text[&n.Text[0]] = int(n.Pos)
+			}
+		case *parse.ActionNode:
+			tw.actions = append(tw.actions, int(n.Pos))
+		}
+		return true
+	})
+	sort.Ints(tw.actions)
+	return tw
+}
+
+// Write implements io.Writer.
+func (w *trackingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if n <= 0 {
+		return n, err
+	}
+
+	seg := segment{start: w.n, end: w.n + n, action: -1}
+	if pos, ok := w.text[&p[0]]; ok {
+		seg.pos, seg.literal = pos, true
+		seg.action = w.actionBefore(pos)
+		w.next = pos + len(p)
+	} else {
+		seg.pos = w.actionAfter(w.next)
+	}
+	w.m.segments = append(w.m.segments, seg)
+	w.n += n
+	return n, err
+}
+
+// actionBefore returns the offset of the action whose output comes right
+// before the template text at pos, or -1 if the previous output was template
+// text too. If the previous write was text ending before pos, the last action
+// between them rendered nothing, but it's still the one right before pos.
+func (w *trackingWriter) actionBefore(pos int) int {
+	if k := len(w.m.segments); k > 0 && !w.m.segments[k-1].literal {
+		return w.m.segments[k-1].pos
+	}
+	if w.next == pos {
+		return -1
+	}
+	i := sort.SearchInts(w.actions, pos)
+	if i == 0 || w.actions[i-1] < w.next {
+		return -1
+	}
+	return w.actions[i-1]
+}
+
+// actionAfter returns the offset of the first action at or after offset, the
+// most likely producer of output that follows the text ending at offset.
+func (w *trackingWriter) actionAfter(offset int) int {
+	i := sort.SearchInts(w.actions, offset)
+	if i == len(w.actions) {
+		return offset
+	}
+	return w.actions[i]
+}
+
+// executeTemplate executes tmpl with the given data and returns the rendered
+// output together with the sourceMap for it. If maxBytes is greater than 0,
+// the execution is aborted with an *outputLimitError as soon as the output
+// exceeds maxBytes.
+//
+// If ctx can be canceled, the template is executed in a new goroutine, and the
+// error of ctx is returned as soon as it's done. The execution cannot be
+// interrupted, but the following writes to the output fail, and so do the
+// functions wrapped with contextFuncs, so the goroutine finishes soon after.
+func executeTemplate(ctx context.Context, tmpl *template.Template, data interface{}, maxBytes int64) ([]byte, *sourceMap, error) {
+	buf := new(bytes.Buffer)
+	var w io.Writer = buf
+	if maxBytes > 0 {
+		w = &limitWriter{w: buf, limit: maxBytes}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	if ctx.Done() == nil {
+		tw := newTrackingWriter(w, tmpl)
+		err := tmpl.Execute(tw, data)
+		return buf.Bytes(), tw.m, err
+	}
+
+	tw := newTrackingWriter(&contextWriter{ctx: ctx, w: w}, tmpl)
+	done := make(chan error, 1)
+	go func() {
+		done <- tmpl.Execute(tw, data)
+	}()
+	select {
+	case err := <-done:
+		return buf.Bytes(), tw.m, err
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+}
+
+// contextWriter is an io.Writer that fails once its context is done.
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+// Write implements io.Writer.
+func (w *contextWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
+
+// outputLimitError is the error returned when the output of a template
+// exceeds the configured limit.
+type outputLimitError struct {
+	limit int64
+}
+
+func (e *outputLimitError) Error() string {
+	return fmt.Sprintf("output exceeds the limit of %d bytes", e.limit)
+}
+
+// limitWriter is an io.Writer that fails once more than limit bytes are
+// written to it. The write that exceeds the limit is discarded.
+type limitWriter struct {
+	w     io.Writer
+	n     int64
+	limit int64
+}
+
+// Write implements io.Writer.
+func (w *limitWriter) Write(p []byte) (int, error) {
+	if w.n+int64(len(p)) > w.limit {
+		return 0, &outputLimitError{limit: w.limit}
+	}
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// position returns the 1-based line and column of offset in src. Columns are
+// counted in bytes, like text/template does.
+func position(src []byte, offset int) (line, col int) {
+	if offset > len(src) {
+		offset = len(src)
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	line = 1 + bytes.Count(src[:offset], []byte("\n"))
+	col = offset - bytes.LastIndexByte(src[:offset], '\n')
+	return line, col
+}
@@ -0,0 +1,117 @@
+package templates
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_executeTemplate_sourceMap(t *testing.T) {
+	src := "{\n\t\"a\": {{ toPrettyJson .A }},\n\t{{- if .B }}\n\t\"b\": {{ .B }}\n\t{{- end }}\n}"
+	var failMessage string
+	tmpl, err := template.New("template").Funcs(GetFuncMap(&failMessage)).Parse(src)
+	require.NoError(t, err)
+
+	data := map[string]interface{}{
+		"A": map[string]interface{}{"x": 1, "y": 2},
+		"B": "value",
+	}
+	out, m, err := executeTemplate(context.Background(), tmpl, data, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "{\n\t\"a\": {\n  \"x\": 1,\n  \"y\": 2\n},\n\t\"b\": value\n}", string(out))
+
+	rendered := string(out)
+	tests := []struct {
+		name   string
+		offset int
+		want   int
+		exact  bool
+	}{
+		{"first literal", 0, 0, true},
+		{"pretty json", strings.Index(rendered, `"x"`), strings.Index(src, "toPrettyJson"), false},
+		{"boundary after multi-line action", strings.Index(rendered, "},") + 1, strings.Index(src, "toPrettyJson"), false},
+		{"literal after if", strings.Index(rendered, `"b"`), strings.Index(src, `"b"`), true},
+		{"value", strings.Index(rendered, "value"), strings.LastIndex(src, ".B"), false},
+		{"last literal", strings.LastIndex(rendered, "}"), strings.LastIndex(src, "}"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pos, exact := m.lookup(tt.offset)
+			assert.Equal(t, tt.exact, exact)
+			assert.Equal(t, tt.want, pos)
+		})
+	}
+
+	pos, exact := m.lookup(len(out))
+	assert.True(t, exact)
+	assert.Equal(t, len(src), pos)
+}
+
+func Test_sourceMap_lookup_boundary(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		data   map[string]interface{}
+		offset int
+		want   string
+		exact  bool
+	}{
+		{"empty action", `{"a": {{ .A }}}`, map[string]interface{}{"A": ""}, 6, ".A", false},
+		{"action and space", "{\"a\": {{ .A }}\n}", map[string]interface{}{"A": ""}, 7, "}", true},
+		{"action with comma", `{"a": 1{{ .A }}}`, map[string]interface{}{"A": ","}, 8, ".A", false},
+		{"empty action after text", `{"a": {{ if .B }}{{ .B }}{{ end }}{{ .A }}}`, map[string]interface{}{"A": ""}, 6, ".A", false},
+		{"after text", `{"a": {{ if .B }}1{{ end }}}`, map[string]interface{}{"B": true}, 7, "}", true},
+		{"after skipped text", `{"a": {{ if .B }}1{{ end }}}`, map[string]interface{}{"B": false}, 6, "}", true},
+		{"start", `{{ .A }}`, map[string]interface{}{"A": "1"}, 0, ".A", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var failMessage string
+			tmpl, err := template.New("template").Funcs(GetFuncMap(&failMessage)).Parse(tt.src)
+			require.NoError(t, err)
+			_, m, err := executeTemplate(context.Background(), tmpl, tt.data, 0)
+			require.NoError(t, err)
+
+			pos, exact := m.lookup(tt.offset)
+			assert.Equal(t, tt.exact, exact)
+			assert.Equal(t, strings.LastIndex(tt.src, tt.want), pos)
+		})
+	}
+}
+
+func Test_sourceMap_lookup_empty(t *testing.T) {
+	var m *sourceMap
+	pos, exact := m.lookup(0)
+	assert.Equal(t, -1, pos)
+	assert.False(t, exact)
+
+	pos, exact = new(sourceMap).lookup(10)
+	assert.Equal(t, -1, pos)
+	assert.False(t, exact)
+}
+
+func Test_position(t *testing.T) {
+	src := []byte("ab\ncd\n\nef")
+	tests := []struct {
+		offset    int
+		line, col int
+	}{
+		{-1, 1, 1},
+		{0, 1, 1},
+		{1, 1, 2},
+		{3, 2, 1},
+		{4, 2, 2},
+		{6, 3, 1},
+		{7, 4, 1},
+		{100, 4, 3},
+	}
+	for _, tt := range tests {
+		line, col := position(src, tt.offset)
+		assert.Equal(t, tt.line, line, "offset %d", tt.offset)
+		assert.Equal(t, tt.col, col, "offset %d", tt.offset)
+	}
+}
@@ -0,0 +1,184 @@
+package templates
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Stage is a stage of the validation done by ValidateAll.
+type Stage string
+
+const (
+	// StageTemplate parses the template and validates it like
+	// ValidateTemplate.
+	StageTemplate Stage = "template"
+	// StageLint looks for suspicious constructs like LintTemplate.
+	StageLint Stage = "lint"
+	// StageData validates the template data like ValidateTemplateData, and
+	// reports the keys of the data not used by the template.
+	StageData Stage = "data"
+	// StageRender renders the template with the data and validates the
+	// output like Template.Validate.
+	StageRender Stage = "render"
+	// StageProfile validates the output with the fields and values that are
+	// legal for a Profile.
+	StageProfile Stage = "profile"
+)
+
+// StageError is an error found by a stage of ValidateAll. Err is the error of
+// the stage, usually a *TemplateError or an Errors.
+type StageError struct {
+	Stage Stage
+	Err   error
+}
+
+// Error implements the error interface and returns the error of the stage
+// prefixed by its name, like "render stage: error executing template: ...".
+func (e *StageError) Error() string {
+	return string(e.Stage) + " stage: " + e.Err.Error()
+}
+
+// Unwrap returns the error of the stage.
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// Finding is an error or a warning found by a stage of ValidateAll.
+type Finding struct {
+	Stage    Stage    `json:"stage"`
+	Severity Severity `json:"severity"`
+	// Code is the code of a lint, the one of a FailError, if any, or
+	// FindingProfileDefault.
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+	// Path, Line and Column are the ones of the TemplateError or the Lint.
+	// The position is in the template data for the findings of StageData,
+	// and in the template text for the other stages.
+	Path   string `json:"path,omitempty"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+// ValidateAll validates a template, its data and the output for a profile in
+// a single call, and returns a Result like ValidateWithData with the errors
+// and warnings of every stage in its Findings, tagged with the stage that
+// found them. The stages run in order, StageTemplate, StageLint, StageData,
+// StageRender and StageProfile, and all of them run even if a previous one
+// fails, unless it makes them impossible: a ParseError skips the render and
+// the profile, invalid data skips the render, and an invalid output skips the
+// profile. The profile given replaces the one set with WithProfile; with 0,
+// the profile stage is skipped. With WithProfileDefaults, the defaults added to
+// the output are reported by the profile stage as findings with SeverityInfo.
+//
+// The returned error is a *StageError for each stage that failed, in an
+// Errors if there are more than one, and Result.Error is its message.
+func ValidateAll(text, data []byte, profile Profile, opts ...Option) (*Result, error) {
+	opts = append(opts[:len(opts):len(opts)], WithProfile(0))
+	res, err := Validate(text, opts...)
+	res.Findings = []Finding{}
+	var errs Errors
+	fail := func(stage Stage, err error) {
+		errs = append(errs, &StageError{Stage: stage, Err: err})
+		res.Findings = append(res.Findings, errorFindings(stage, err)...)
+	}
+
+	if err != nil {
+		fail(StageTemplate, err)
+	}
+	for _, l := range res.Warnings {
+		res.Findings = append(res.Findings, lintFinding(StageLint, l))
+	}
+	o := newOptions(opts)
+	start := o.stageStart(StageData)
+	dataErr := ValidateTemplateData(data, opts...)
+	o.stageEnd(StageData, start, dataErr)
+	if dataErr != nil {
+		fail(StageData, dataErr)
+	}
+
+	if len(text) > 0 {
+		t, parseErr := ParseTemplate(text, opts...)
+		if parseErr == nil && dataErr == nil {
+			if lints, err := t.UnusedKeys(data); err == nil {
+				res.Warnings = append(res.Warnings, lints...)
+				for _, l := range lints {
+					res.Findings = append(res.Findings, lintFinding(StageData, l))
+				}
+			}
+			if err := t.Validate(data); err != nil {
+				fail(StageRender, err)
+			} else if profile != 0 {
+				po := *t.o
+				po.profile = profile
+				// The render of the profile is observed as StageProfile.
+				po.observer = nil
+				pt := &Template{text: t.text, tmpl: t.tmpl, o: &po}
+				start := o.stageStart(StageProfile)
+				err := pt.Validate(data)
+				o.stageEnd(StageProfile, start, err)
+				if err != nil {
+					fail(StageProfile, err)
+				}
+				if po.applyProfileDefaults {
+					applied, _ := pt.AppliedDefaults(data)
+					for _, d := range applied {
+						res.Findings = append(res.Findings, Finding{
+							Stage:    StageProfile,
+							Severity: SeverityInfo,
+							Code:     FindingProfileDefault,
+							Message:  fmt.Sprintf("default %s applied for the %s profile: %s", d.Field, profile, d.Value),
+							Path:     d.Field,
+						})
+					}
+				}
+			}
+		}
+	}
+
+	switch len(errs) {
+	case 0:
+		return res, nil
+	case 1:
+		err = errs[0]
+	default:
+		err = errs
+	}
+	res.IsValid = false
+	res.Error = err.Error()
+	return res, err
+}
+
+// errorFindings returns the findings of the error of a stage, one for each
+// error in an Errors.
+func errorFindings(stage Stage, err error) []Finding {
+	var list Errors
+	if !errors.As(err, &list) {
+		list = Errors{err}
+	}
+	findings := make([]Finding, 0, len(list))
+	for _, err := range list {
+		f := Finding{Stage: stage, Severity: SeverityError, Message: err.Error()}
+		var te *TemplateError
+		if errors.As(err, &te) {
+			f.Path, f.Line, f.Column = te.Path, te.Line, te.Column
+		}
+		var fe *FailError
+		if errors.As(err, &fe) {
+			f.Code = fe.Code
+		}
+		findings = append(findings, f)
+	}
+	return findings
+}
+
+// lintFinding returns the finding of a lint found by a stage.
+func lintFinding(stage Stage, l Lint) Finding {
+	return Finding{
+		Stage:    stage,
+		Severity: l.Severity,
+		Code:     l.Code,
+		Message:  l.Message,
+		Line:     l.Line,
+		Column:   l.Column,
+	}
+}
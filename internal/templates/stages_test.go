@@ -0,0 +1,117 @@
+package templates
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateAll(t *testing.T) {
+	text := []byte(`{"subject": {"commonName": {{ toJson .CN }}}, "basicConstraints": {"isCA": {{ .IsCA }}}}`)
+	res, err := ValidateAll(text, []byte(`{"CN": "foo", "IsCA": false}`), ProfileLeaf, WithAllowCommonNameOnly(true))
+	require.NoError(t, err)
+	assert.True(t, res.IsValid)
+	assert.Empty(t, res.Error)
+	assert.Equal(t, []string{"toJson"}, res.Functions)
+	assert.NotNil(t, res.FuncMap)
+	if assert.Len(t, res.Warnings, 1) {
+		assert.Equal(t, LintRawOutput, res.Warnings[0].Code)
+	}
+	assert.Equal(t, []Finding{
+		{Stage: StageLint, Severity: SeverityWarning, Code: LintRawOutput, Message: "output of {{.IsCA}} is not JSON encoded, consider using toJson", Line: 1, Column: 79},
+	}, res.Findings)
+
+	// The output is valid, but not for the profile.
+	res, err = ValidateAll(text, []byte(`{"CN": "foo", "IsCA": true, "Other": 1}`), ProfileLeaf, WithAllowCommonNameOnly(true))
+	assert.EqualError(t, err, "profile stage: error validating json template data: value at basicConstraints.isCA (template line 1, column 68) is not valid for the leaf profile: value true is not false")
+	assert.False(t, res.IsValid)
+	assert.Equal(t, err.Error(), res.Error)
+	assert.Equal(t, []Finding{
+		{Stage: StageLint, Severity: SeverityWarning, Code: LintRawOutput, Message: "output of {{.IsCA}} is not JSON encoded, consider using toJson", Line: 1, Column: 79},
+		{Stage: StageData, Severity: SeverityWarning, Code: LintUnusedKey, Message: "key Other is not used by the template", Line: 1, Column: 29},
+		{Stage: StageProfile, Severity: SeverityError, Message: "error validating json template data: value at basicConstraints.isCA (template line 1, column 68) is not valid for the leaf profile: value true is not false", Path: "basicConstraints.isCA", Line: 1, Column: 68},
+	}, res.Findings)
+	var se *StageError
+	if assert.True(t, errors.As(err, &se)) {
+		assert.Equal(t, StageProfile, se.Stage)
+	}
+	var te *TemplateError
+	if assert.True(t, errors.As(err, &te)) {
+		assert.Equal(t, SchemaError, te.Kind)
+	}
+
+	// Without a profile the output is valid.
+	res, err = ValidateAll(text, []byte(`{"CN": "foo", "IsCA": true}`), 0, WithProfile(ProfileLeaf))
+	assert.NoError(t, err)
+	assert.True(t, res.IsValid)
+}
+
+func TestValidateAll_stages(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		data     string
+		profile  Profile
+		opts     []Option
+		stages   []Stage
+		findings []Finding
+	}{
+		{"ok/empty", ``, ``, ProfileLeaf, nil, nil, []Finding{}},
+		{"parse-and-data", `{"cn": {{ toJson .CN }`, `{"CN": }`, ProfileLeaf, nil, []Stage{StageTemplate, StageData}, []Finding{
+			{Stage: StageTemplate, Severity: SeverityError, Message: `error parsing template: template: template:1: unexpected "}" in operand`, Line: 1, Column: 22},
+			{Stage: StageData, Severity: SeverityError, Message: "error validating json template data: invalid JSON at CN (line 1, column 8): invalid character '}' looking for beginning of value", Path: "CN", Line: 1, Column: 8},
+		}},
+		{"definition-and-render", `{{ define "cn" }}{"cn": {{ end }}{"cn": {{ .CN }}}`, `{"CN": "foo"}`, 0, []Option{WithValidateDefinitions(true)}, []Stage{StageTemplate, StageRender}, []Finding{
+			{Stage: StageTemplate, Severity: SeverityError, Message: `template "cn": error validating json template data: invalid JSON at template line 1, column 25: unexpected end of JSON input`, Line: 1, Column: 25},
+			{Stage: StageLint, Severity: SeverityWarning, Code: LintRawOutput, Message: "output of {{.CN}} is not JSON encoded, consider using toJson", Line: 1, Column: 44},
+			{Stage: StageRender, Severity: SeverityError, Message: "error validating json template data: invalid JSON at offset 8, near template line 1, column 44: invalid character 'o' in literal false (expecting 'a')", Line: 1, Column: 44},
+		}},
+		{"fail", `{{ if not .CN }}{{ fail "E_NO_CN" "common name is required" }}{{ end }}{"cn": {{ toJson .CN }}}`, `{}`, ProfileLeaf, nil, []Stage{StageRender}, []Finding{
+			{Stage: StageRender, Severity: SeverityError, Code: "E_NO_CN", Message: "error executing template: common name is required"},
+		}},
+		{"all-errors", `{"cn": {{ toJson .CN }}}`, `{"CN": , "O": }`, 0, []Option{WithAllErrors(true)}, []Stage{StageData}, []Finding{
+			{Stage: StageData, Severity: SeverityError, Message: "error validating json template data: invalid JSON at CN (line 1, column 8): invalid character ',' looking for beginning of value", Path: "CN", Line: 1, Column: 8},
+			{Stage: StageData, Severity: SeverityError, Message: "error validating json template data: invalid JSON at O (line 1, column 15): invalid character '}' looking for beginning of value", Path: "O", Line: 1, Column: 15},
+		}},
+		{"unknown-profile", `{"cn": {{ toJson .CN }}}`, `{"CN": "foo"}`, Profile(99), nil, []Stage{StageProfile}, []Finding{
+			{Stage: StageProfile, Severity: SeverityError, Message: "error validating json template data: unknown profile Profile(99)"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := ValidateAll([]byte(tt.text), []byte(tt.data), tt.profile, tt.opts...)
+			assert.Equal(t, tt.findings, res.Findings)
+			if len(tt.stages) == 0 {
+				assert.NoError(t, err)
+				assert.True(t, res.IsValid)
+				return
+			}
+			assert.False(t, res.IsValid)
+			assert.EqualError(t, err, res.Error)
+			var errs Errors
+			if len(tt.stages) == 1 {
+				errs = Errors{err}
+			} else {
+				require.True(t, errors.As(err, &errs))
+			}
+			stages := make([]Stage, len(errs))
+			for i, err := range errs {
+				var se *StageError
+				require.True(t, errors.As(err, &se))
+				stages[i] = se.Stage
+			}
+			assert.Equal(t, tt.stages, stages)
+		})
+	}
+}
+
+func TestValidateAll_json(t *testing.T) {
+	res, err := ValidateAll([]byte(`{"cn": {{ toJson .CN }}}`), []byte(`{"CN": 1, "O": 2}`), 0)
+	require.NoError(t, err)
+	b, err := json.Marshal(res.Findings)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"stage": "data", "severity": "warning", "code": "unused-key", "message": "key O is not used by the template", "line": 1, "column": 11}]`, string(b))
+}
@@ -0,0 +1,315 @@
+package templates
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ValidateTemplateDataReader is like ValidateTemplateData, but it validates
+// the template data while it's read from r, keeping in memory only the part
+// of the document being decoded, so large data files can be validated without
+// reading them first.
+//
+// The same errors are reported, with the same paths and positions: syntax
+// errors, values after the top-level one, NaN and infinite numbers, documents
+// nested more than WithMaxDepth levels, and with the WithRejectDuplicateKeys
+// option, duplicate keys. As the document is not read in advance, the first
+// error found is returned, even if the data has a syntax error later, and the
+// WithAllErrors option is ignored. With the WithLenientJSON option, the whole
+// data is read before removing the comments and trailing commas. Errors
+// reading from r are returned as a JSONError.
+func ValidateTemplateDataReader(r io.Reader, opts ...Option) error {
+	o := newOptions(opts)
+	if o.lenientJSON {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return newTemplateError(JSONError, err, "error reading template data: "+err.Error())
+		}
+		return validateData(stripJSONExtensions(data), o)
+	}
+	return validateDataReader(r, o)
+}
+
+// windowReader is an io.Reader that keeps the bytes read from r after the
+// offset set with discard, so the positions of the errors found by a
+// json.Decoder can be computed without keeping the whole input.
+type windowReader struct {
+	r   io.Reader
+	buf []byte
+	// start is the index in buf of the byte at offset base, the first one
+	// kept. line is the number of lines before base, and lineStart the offset
+	// where the line with the byte at base starts.
+	start     int
+	base      int64
+	line      int
+	lineStart int64
+	total     int64
+}
+
+func (w *windowReader) Read(p []byte) (int, error) {
+	n, err := w.r.Read(p)
+	if w.start > 0 && w.start >= len(w.buf)/2 {
+		w.buf = append(w.buf[:0], w.buf[w.start:]...)
+		w.start = 0
+	}
+	w.buf = append(w.buf, p[:n]...)
+	w.total += int64(n)
+	return n, err
+}
+
+// window returns the bytes kept, starting at offset base.
+func (w *windowReader) window() []byte {
+	return w.buf[w.start:]
+}
+
+// discard drops the bytes before offset.
+func (w *windowReader) discard(offset int64) {
+	k := int(offset - w.base)
+	if k <= 0 {
+		return
+	}
+	if win := w.window(); k > len(win) {
+		k = len(win)
+	}
+	chunk := w.window()[:k]
+	w.line += bytes.Count(chunk, []byte("\n"))
+	if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+		w.lineStart = w.base + int64(i) + 1
+	}
+	w.start += k
+	w.base += int64(k)
+}
+
+// index returns the index in the window of the byte at offset.
+func (w *windowReader) index(offset int64) int {
+	k := int(offset - w.base)
+	if k < 0 {
+		return 0
+	}
+	if n := len(w.window()); k > n {
+		return n
+	}
+	return k
+}
+
+// locate returns the position of offset like locate does without a
+// sourceMap, and the 1-based line and column.
+func (w *windowReader) locate(offset int64) (string, int, int) {
+	chunk := w.window()[:w.index(offset)]
+	line := w.line + 1 + bytes.Count(chunk, []byte("\n"))
+	col := int(offset-w.lineStart) + 1
+	if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+		col = len(chunk) - i
+	}
+	return fmt.Sprintf("line %d, column %d", line, col), line, col
+}
+
+// fill reads from r until there are at least n bytes after offset in the
+// window, or the input ends.
+func (w *windowReader) fill(offset int64, n int) {
+	p := make([]byte, n)
+	for len(w.window())-w.index(offset) < n {
+		if k, err := w.Read(p); k == 0 || err != nil {
+			return
+		}
+	}
+}
+
+// nextValue returns the offset of the first byte that is not white space at
+// or after offset, or -1 if there's none.
+func (w *windowReader) nextValue(offset int64) int64 {
+	win := w.window()
+	for i := w.index(offset); i < len(win); i++ {
+		switch win[i] {
+		case ' ', '\t', '\n', '\r':
+		default:
+			return w.base + int64(i)
+		}
+	}
+	return -1
+}
+
+// streamFrame is the state of an object or array being read by
+// validateDataReader.
+type streamFrame struct {
+	object    bool
+	keys      map[string]struct{}
+	expectKey bool
+	key       string
+	index     int
+}
+
+// streamPath returns the path of the value being read, like jsonErrorPath
+// does. The paths are only computed for the errors, as the path of a frame is
+// the path of the value being read in its parent.
+func streamPath(stack []*streamFrame) string {
+	var path string
+	for _, f := range stack {
+		switch {
+		case f.object && f.key == "" && f.expectKey:
+		case f.object:
+			path = joinPath(path, f.key)
+		default:
+			path = indexPath(path, f.index)
+		}
+	}
+	return path
+}
+
+// stackPrefix returns a JSON text that leaves the scanner of encoding/json in
+// the same state as the decoder of validateDataReader after reading the tokens
+// that resulted in stack. The decoder reads the commas and colons with the
+// next token, so in an object the prefix ends after the key or the value, and
+// in an array after the bracket or the last element.
+func stackPrefix(stack []*streamFrame) []byte {
+	var b []byte
+	for i, f := range stack {
+		inner := i == len(stack)-1
+		switch {
+		case f.object && !inner:
+			b = append(b, `{"k":`...)
+		case f.object && f.expectKey && f.key == "":
+			b = append(b, '{')
+		case f.object && f.expectKey:
+			b = append(b, `{"k":0`...)
+		case f.object:
+			b = append(b, `{"k"`...)
+		case inner && f.index > 0:
+			b = append(b, "[0"...)
+		default:
+			b = append(b, '[')
+		}
+	}
+	return b
+}
+
+// validateDataReader validates the template data read from r token by token.
+// It reports the same errors as validateData.
+func validateDataReader(r io.Reader, o *options) error {
+	maxDepth := o.maxDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxDepth
+	}
+
+	w := &windowReader{r: r}
+	dec := json.NewDecoder(w)
+	dec.UseNumber()
+
+	var stack []*streamFrame
+	// next marks that a complete value has been read in the innermost frame.
+	next := func() {
+		if len(stack) == 0 {
+			return
+		}
+		if top := stack[len(stack)-1]; top.object {
+			top.expectKey = true
+		} else {
+			top.index++
+		}
+	}
+	syntaxError := func(offset int64, err error) error {
+		path := streamPath(stack)
+		at, line, col := w.locate(offset)
+		// The decoder stops at the first invalid byte, read the rest of the
+		// token, from NaN to Infinity.
+		w.fill(offset, len("Infinity"))
+		if tok := nonFiniteToken(w.window(), w.index(offset)); tok != "" {
+			err = fmt.Errorf("invalid JSON at %s (%s): %s is not a valid JSON number: %w", displayPath(path), at, tok, err)
+		} else {
+			err = fmt.Errorf("invalid JSON at %s (%s): %w", displayPath(path), at, err)
+		}
+		te := newTemplateError(JSONError, err, "error validating json template data: "+err.Error())
+		te.Path = path
+		te.Line, te.Column = line, col
+		return te
+	}
+
+	var values int
+	for {
+		before := dec.InputOffset()
+		w.discard(before)
+
+		if len(stack) == 0 && values > 0 {
+			// Only white space can follow the top-level value. More reads the
+			// next byte that is not white space, if any.
+			dec.More()
+			if offset := w.nextValue(before); offset >= 0 {
+				c := rune(w.window()[w.index(offset)])
+				return syntaxError(offset, fmt.Errorf("invalid character %q after top-level value", c))
+			}
+			break
+		}
+
+		tok, err := dec.Token()
+		var jsonErr *json.SyntaxError
+		switch {
+		case errors.Is(err, io.EOF) && w.total == 0:
+			return nil
+		case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF), errors.As(err, &jsonErr):
+			// The messages of the decoder are not the ones of json.Unmarshal,
+			// get the same error decoding the rest of the input in the same
+			// state.
+			prefix := stackPrefix(stack)
+			var v interface{}
+			err = json.Unmarshal(append(prefix, w.window()[w.index(before):]...), &v)
+			if errors.As(err, &jsonErr) {
+				return syntaxError(before+jsonErr.Offset-int64(len(prefix))-1, err)
+			}
+			return syntaxError(w.total-1, errors.New("unexpected end of JSON input"))
+		case err != nil:
+			return newTemplateError(JSONError, err, "error reading template data: "+err.Error())
+		}
+
+		if len(stack) > 0 {
+			if top := stack[len(stack)-1]; top.object && top.expectKey {
+				if key, ok := tok.(string); ok {
+					top.key, top.expectKey = key, false
+					if o.rejectDuplicateKeys {
+						if _, ok := top.keys[key]; ok {
+							offset := keyOffset(before, dec.InputOffset(), key)
+							at, line, col := w.locate(offset)
+							err := fmt.Errorf("duplicate key %q at %s", key, at)
+							te := newTemplateError(JSONError, err, "error validating json template data: "+err.Error())
+							te.Line, te.Column = line, col
+							return te
+						}
+						top.keys[key] = struct{}{}
+					}
+					continue
+				}
+			}
+		}
+
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			if len(stack) >= maxDepth {
+				offset := dec.InputOffset() - 1
+				at, line, col := w.locate(offset)
+				err := fmt.Errorf("maximum nesting depth of %d exceeded at offset %d (%s)", maxDepth, offset, at)
+				te := newTemplateError(JSONError, err, "error validating json template data: "+err.Error())
+				te.Line, te.Column = line, col
+				return te
+			}
+			f := new(streamFrame)
+			if tok == json.Delim('{') {
+				f.object, f.expectKey = true, true
+				if o.rejectDuplicateKeys {
+					f.keys = make(map[string]struct{})
+				}
+			}
+			stack = append(stack, f)
+		case json.Delim('}'), json.Delim(']'):
+			stack = stack[:len(stack)-1]
+			next()
+		default:
+			next()
+		}
+		if len(stack) == 0 {
+			values++
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package templates
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTemplateDataReader(t *testing.T) {
+	long := `{"a": "` + strings.Repeat("x", 5000) + `",` + "\n" + `"b": 1, "c": [true, null, {"d": 1.5e3}]}`
+	deep := strings.Repeat("[", 101) + strings.Repeat("]", 101)
+	tests := []struct {
+		name string
+		data string
+		opts []Option
+	}{
+		{"ok", `{"Subject": {"CommonName": "foo"}, "SANs": ["foo.com", 1, true, null]}`, nil},
+		{"ok/empty", ``, nil},
+		{"ok/scalar", ` "foo" `, nil},
+		{"ok/long", long, nil},
+		{"ok/duplicate", `{"a": 1, "a": 2}`, nil},
+		{"ok/depth", strings.Repeat("[", 100) + strings.Repeat("]", 100), nil},
+		{"fail/whitespace", "  \n ", nil},
+		{"fail/syntax", `{"Subject": {"CommonName": }}`, nil},
+		{"fail/syntax-array", "{\n  \"sans\": [\"a\", \"b\",]\n}", nil},
+		{"fail/syntax-after-long", long[:len(long)-1] + `,}`, nil},
+		{"fail/key", `{"a": 1, 2: 3}`, nil},
+		{"fail/colon", `{"a" 1}`, nil},
+		{"fail/unexpected-end", `{"a": [1, 2`, nil},
+		{"fail/unexpected-end-string", `{"a": "foo`, nil},
+		{"fail/trailing", `{"a": 1} {"b": 2}`, nil},
+		{"fail/trailing-garbage", "{\"a\": 1}\n  x", nil},
+		{"fail/trailing-bracket", `[1]]`, nil},
+		{"fail/nan", `{"a": {"b": NaN}}`, nil},
+		{"fail/infinity", `{"a": [1, -Infinity]}`, nil},
+		{"fail/nested", `[{"a": [1 2]}]`, nil},
+		{"fail/object-comma", `{,}`, nil},
+		{"fail/array-comma", `[,1]`, nil},
+		{"fail/trailing-comma", `{"a": 1,}`, nil},
+		{"fail/nested-colon", `{"a": {"b" : }}`, nil},
+		{"fail/escape", `{"a": "\x"}`, nil},
+		{"fail/number", `{"a": 01}`, nil},
+		{"fail/duplicate", "{\"a\": {\"b\": 1,\n \"b\": 2}}", []Option{WithRejectDuplicateKeys(true)}},
+		{"fail/duplicate-escaped", `{"ab": 1, "ab": 2}`, []Option{WithRejectDuplicateKeys(true)}},
+		{"fail/depth", deep, nil},
+		{"fail/max-depth", `{"a": {"b": {"c": 1}}}`, []Option{WithMaxDepth(2)}},
+		{"ok/lenient", "{\n  // comment\n  \"a\": 1,\n}", []Option{WithLenientJSON(true)}},
+		{"fail/lenient", "{\n  // comment\n  \"a\": ,\n}", []Option{WithLenientJSON(true)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := ValidateTemplateData([]byte(tt.data), tt.opts...)
+			for name, r := range map[string]io.Reader{
+				"reader":   strings.NewReader(tt.data),
+				"one-byte": iotest.OneByteReader(strings.NewReader(tt.data)),
+				"half":     iotest.HalfReader(strings.NewReader(tt.data)),
+			} {
+				got := ValidateTemplateDataReader(r, tt.opts...)
+				if want == nil {
+					assert.NoError(t, got, name)
+					continue
+				}
+				assert.EqualError(t, got, want.Error(), name)
+				var wantErr, gotErr *TemplateError
+				if assert.True(t, errors.As(want, &wantErr)) && assert.True(t, errors.As(got, &gotErr), name) {
+					assert.Equal(t, wantErr.Kind, gotErr.Kind, name)
+					assert.Equal(t, wantErr.Path, gotErr.Path, name)
+					assert.Equal(t, wantErr.Line, gotErr.Line, name)
+					assert.Equal(t, wantErr.Column, gotErr.Column, name)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateTemplateDataReader_readError(t *testing.T) {
+	r := io.MultiReader(strings.NewReader(`{"a": [1, `), iotest.ErrReader(errors.New("read failed")))
+	err := ValidateTemplateDataReader(r)
+	assert.EqualError(t, err, "error reading template data: read failed")
+	var te *TemplateError
+	if assert.True(t, errors.As(err, &te)) {
+		assert.Equal(t, JSONError, te.Kind)
+	}
+
+	err = ValidateTemplateDataReader(iotest.ErrReader(errors.New("read failed")), WithLenientJSON(true))
+	assert.EqualError(t, err, "error reading template data: read failed")
+}
+
+// largeData returns a JSON document with n objects in an array.
+func largeData(n int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(`{"items": [`)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			buf.WriteString(",\n")
+		}
+		fmt.Fprintf(&buf, `{"name": "item %d", "sans": ["%d.example.com", "10.0.0.1"], "ca": false}`, i, i)
+	}
+	buf.WriteString(`]}`)
+	return buf.Bytes()
+}
+
+func BenchmarkValidateTemplateData(b *testing.B) {
+	data := largeData(10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Reading the data is part of the cost of the []byte version.
+		buf, err := io.ReadAll(bytes.NewReader(data))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := ValidateTemplateData(buf, WithRejectDuplicateKeys(true)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkValidateTemplateDataReader(b *testing.B) {
+	data := largeData(10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := ValidateTemplateDataReader(bytes.NewReader(data), WithRejectDuplicateKeys(true)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
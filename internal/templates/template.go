@@ -0,0 +1,374 @@
+package templates
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"text/template"
+	"text/template/parse"
+)
+
+// Template is a parsed template that can be validated and rendered many times
+// without parsing it again. A Template is safe for concurrent use, each
+// execution uses its own functions, so the failures of one execution are not
+// reported in another one.
+type Template struct {
+	text []byte
+	tmpl *template.Template
+	o    *options
+	// analysis is the Analysis of a template loaded with LoadTemplate.
+	analysis *Analysis
+}
+
+// ParseTemplate parses the given template text with the functions returned by
+// GetFuncMap. If the text cannot be parsed, the returned ParseError has the
+// line and, if it can be found, the column of the error. If the template
+// requires a newer version of the functions with a comment like
+// {{/* requires funcmap >= 3 */}}, a ParseError saying so is returned. The
+// options are used in all the validations and renders of the returned
+// template, WithDelims sets the delimiters used to parse it, and with
+// WithDeniedFuncs, the use of a denied function is a ParseError. Defining a
+// template with the name of a function, like {{ define "fail" }}, or a
+// variable with a reserved name, like $failMessage, is a ParseError too, and
+// so is adding a function with the name of a built-in one with WithFuncs.
+func ParseTemplate(text []byte, opts ...Option) (*Template, error) {
+	return parseTemplate(text, newOptions(opts), true)
+}
+
+// parseTemplate parses a template with the options o. If checkSource is
+// false, the checks that only depend on the text and the built-in functions,
+// already done by a previous parse, are skipped.
+func parseTemplate(text []byte, o *options, checkSource bool) (*Template, error) {
+	if err := checkFuncs(o); err != nil {
+		return nil, newTemplateError(ParseError, err, "error parsing template: "+err.Error())
+	}
+	left, right := o.delims()
+	if checkSource {
+		if err := checkFuncMapVersion(text, left, right); err != nil {
+			return nil, err
+		}
+	}
+
+	funcs := newFuncs(o).FuncMap()
+	tmpl := template.New("template").Delims(left, right).Funcs(funcs)
+	if o.strict {
+		tmpl = tmpl.Option("missingkey=error")
+	}
+	tmpl, err := tmpl.Parse(string(text))
+	if err != nil {
+		return nil, newParseError(err, text, left)
+	}
+	if err := checkDeniedFuncs(tmpl, text, o); err != nil {
+		return nil, err
+	}
+	if checkSource || len(o.funcs) > 0 {
+		if err := checkReservedNames(tmpl, []string{tmpl.Name()}, map[string][]byte{tmpl.Name(): text}, funcs, left); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Template{
+		text: text,
+		tmpl: tmpl,
+		o:    o,
+	}, nil
+}
+
+// parseErrorRegexp matches the errors returned by text/template when a template
+// cannot be parsed, like "template: template:3: unexpected EOF". The line is
+// counted from the start of the text, even in {{ define }} blocks.
+var parseErrorRegexp = regexp.MustCompile(`^template: [^:]*:([0-9]+):(?:([0-9]+):)? (.*)$`)
+
+// quotedRegexp matches the first quoted string in an error message, usually the
+// token that caused the error.
+var quotedRegexp = regexp.MustCompile(`"(?:[^"\\]|\\.)*"`)
+
+// newParseError returns the ParseError for an error parsing text, with the
+// line of the error from the message. text/template errors don't include the
+// column, so the column is the one of the token quoted in the message in that
+// line, like the name of an unknown function, or the first action on the line.
+func newParseError(err error, text []byte, leftDelim string) *TemplateError {
+	te := newTemplateError(ParseError, err, "error parsing template: "+err.Error())
+	m := parseErrorRegexp.FindStringSubmatch(err.Error())
+	if m == nil {
+		return te
+	}
+	lines := bytes.Split(text, []byte("\n"))
+	line, _ := strconv.Atoi(m[1])
+	if line < 1 || line > len(lines) {
+		return te
+	}
+	te.Line = line
+	if m[2] != "" {
+		te.Column, _ = strconv.Atoi(m[2])
+		return te
+	}
+
+	col := -1
+	if q := quotedRegexp.FindString(m[3]); q != "" {
+		if token, err := strconv.Unquote(q); err == nil && token != "" {
+			col = bytes.Index(lines[line-1], []byte(token))
+		}
+	}
+	if col < 0 {
+		col = bytes.Index(lines[line-1], []byte(leftDelim))
+	}
+	if col >= 0 {
+		te.Column = col + 1
+	}
+	return te
+}
+
+// checkDeniedFuncs returns a ParseError for the first use in the parsed
+// template text of a function denied with WithDeniedFuncs, or not in the
+// snapshot given with WithFuncMapSnapshot.
+func checkDeniedFuncs(tmpl *template.Template, text []byte, o *options) error {
+	if len(o.deniedFuncs) == 0 && o.snapshot == nil {
+		return nil
+	}
+	var denied *parse.IdentifierNode
+	var reason string
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+		walkTree(t.Tree.Root, func(node parse.Node) bool {
+			n, ok := node.(*parse.IdentifierNode)
+			if !ok || (denied != nil && denied.Pos < n.Pos) {
+				return true
+			}
+			if r, ok := o.deniedFunc(n.Ident); ok {
+				denied, reason = n, r
+			}
+			return true
+		})
+	}
+	if denied == nil {
+		return nil
+	}
+	line, col := position(text, int(denied.Pos))
+	err := fmt.Errorf("template: %s:%d:%d: function %q %s", tmpl.Name(), line, col, denied.Ident, reason)
+	te := newTemplateError(ParseError, err, "error parsing template: "+err.Error())
+	te.Line, te.Column = line, col
+	return te
+}
+
+// Validate validates that the template results in valid JSON when it's
+// executed with the given template data. It reports the same errors as
+// ValidateTemplateWithData, with the Line and Column of the template source
+// that produced the invalid output. Errors found right after the output of an
+// action, even if it rendered nothing, are reported at the action.
+func (t *Template) Validate(data []byte) error {
+	return t.ValidateContext(context.Background(), data)
+}
+
+// ValidateContext is like Validate, but the execution of the template is
+// aborted with an ExecError if ctx is done before it finishes.
+func (t *Template) ValidateContext(ctx context.Context, data []byte) error {
+	if len(t.text) == 0 {
+		return nil
+	}
+
+	start := t.o.stageStart(StageRender)
+	out, m, err := t.render(ctx, "", data, nil)
+	if err == nil {
+		err = validateOutput(out, t.text, m, t.o)
+	}
+	t.o.stageEnd(StageRender, start, err)
+	return err
+}
+
+// Render executes the template with the given template data and returns the
+// output. The output is not validated, use Validate to check that it is valid
+// JSON, or the WithRenderMode option to get it validated and formatted. The
+// options are added to the ones given to ParseTemplate for this render only;
+// the ones used to parse the template, like WithDelims, have no effect.
+func (t *Template) Render(data []byte, opts ...Option) ([]byte, error) {
+	if len(opts) > 0 {
+		o := *t.o
+		for _, fn := range opts {
+			fn(&o)
+		}
+		t = &Template{text: t.text, tmpl: t.tmpl, o: &o}
+	}
+
+	out, m, err := t.render(context.Background(), "", data, nil)
+	if err != nil || t.o.renderMode == RenderRaw {
+		return out, err
+	}
+	if err := validateOutput(out, t.text, m, t.o); err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return out, nil
+	}
+
+	var buf bytes.Buffer
+	if t.o.renderMode == RenderPretty {
+		if err = json.Indent(&buf, bytes.TrimSpace(out), "", "  "); err == nil {
+			buf.WriteByte('\n')
+		}
+	} else {
+		err = json.Compact(&buf, out)
+	}
+	if err != nil {
+		return nil, newTemplateError(JSONError, err, "error formatting json: "+err.Error())
+	}
+	return buf.Bytes(), nil
+}
+
+// RenderWithTrace executes the template like Render, and also returns the
+// sorted names of the functions returned by GetFuncMap that were called during
+// the execution. Functions that are in the template but in a branch that is
+// not executed are not included. The names are returned even if the execution
+// fails, and include the function that caused the failure.
+func (t *Template) RenderWithTrace(data []byte) ([]byte, []string, error) {
+	// With WithTimeout the execution can continue after render returns, so
+	// the calls are recorded with a lock.
+	var mu sync.Mutex
+	called := make(map[string]struct{})
+	out, _, err := t.render(context.Background(), "", data, func(name string) {
+		mu.Lock()
+		called[name] = struct{}{}
+		mu.Unlock()
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	used := make([]string, 0, len(called))
+	for name := range called {
+		used = append(used, name)
+	}
+	sort.Strings(used)
+	return out, used, err
+}
+
+// render executes the template with the given data. If name is not empty, the
+// template defined with that name is executed instead of the main one. If
+// record is not nil, it is called with the name of each function called. The
+// execution is aborted when ctx is done, or after the timeout set with
+// WithTimeout.
+func (t *Template) render(ctx context.Context, name string, data []byte, record func(name string)) ([]byte, *sourceMap, error) {
+	if t.o.lenientJSON {
+		data = stripJSONExtensions(data)
+	}
+	if err := validateData(data, t.o); err != nil {
+		return nil, nil, err
+	}
+	values, err := unmarshalData(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if t.o.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.o.timeout)
+		defer cancel()
+	}
+
+	// Clone the template so the execution uses its own "fail" function.
+	funcs := newFuncs(t.o)
+	tmpl, err := t.tmpl.Clone()
+	if err != nil {
+		return nil, nil, newTemplateError(ExecError, err, "error executing template: "+err.Error())
+	}
+	fm := funcs.FuncMap()
+	if record != nil {
+		fm = traceFuncs(fm, record)
+	}
+	if ctx.Done() != nil {
+		fm = contextFuncs(ctx, fm)
+	}
+	tmpl.Funcs(fm)
+	if name != "" {
+		if tmpl = tmpl.Lookup(name); tmpl == nil {
+			err := fmt.Errorf("template %q is not defined", name)
+			return nil, nil, newTemplateError(ExecError, err, "error executing template: "+err.Error())
+		}
+	}
+
+	out, m, err := executeTemplate(ctx, tmpl, values, t.o.maxOutputBytes)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, nil, newTemplateError(ExecError, ctxErr, "error executing template: execution aborted: "+ctxErr.Error())
+		}
+		if failMessage, _ := funcs.Failure(); failMessage != "" {
+			fe := &FailError{Code: funcs.FailureCode(), Message: failMessage, err: err}
+			return nil, nil, newTemplateError(ExecError, fe, "error executing template: "+failMessage)
+		}
+		if path, key, ok := parseMissingKey(err); ok {
+			te := newTemplateError(ExecError, err, fmt.Sprintf("error executing template: missing key %q in %s: %s", key, path, err.Error()))
+			te.Path = path
+			return nil, nil, te
+		}
+		return nil, nil, newTemplateError(ExecError, err, "error executing template: "+err.Error())
+	}
+	if name == "" && t.o.applyProfileDefaults && t.o.profile != 0 {
+		if out, _, err = applyProfileDefaults(out, m, t.o.profile, t.o); err != nil {
+			return nil, nil, err
+		}
+	}
+	return out, m, nil
+}
+
+// unmarshalData returns the value of the template data. The data can be any
+// JSON value, objects are decoded as a map[string]interface{}, arrays as a
+// []interface{}, and scalars as strings, float64 or bool. Empty data is an
+// empty object.
+func unmarshalData(data []byte) (interface{}, error) {
+	if len(data) == 0 {
+		return make(map[string]interface{}), nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, newTemplateError(JSONError, err, "error unmarshaling template data: "+err.Error())
+	}
+	return v, nil
+}
+
+// traceFuncs returns a copy of the functions in m that call record with the
+// name of the function before calling it.
+func traceFuncs(m template.FuncMap, record func(name string)) template.FuncMap {
+	traced := make(template.FuncMap, len(m))
+	for name, fn := range m {
+		name, v := name, reflect.ValueOf(fn)
+		traced[name] = reflect.MakeFunc(v.Type(), func(args []reflect.Value) []reflect.Value {
+			record(name)
+			if v.Type().IsVariadic() {
+				return v.CallSlice(args)
+			}
+			return v.Call(args)
+		}).Interface()
+	}
+	return traced
+}
+
+// contextFuncs returns a copy of the functions in m that fail once ctx is
+// done, so an execution that calls functions without writing its output stops
+// too. Functions without an error result panic with the error of ctx, and the
+// panic is returned as the error of the call by text/template.
+func contextFuncs(ctx context.Context, m template.FuncMap) template.FuncMap {
+	wrapped := make(template.FuncMap, len(m))
+	for name, fn := range m {
+		v := reflect.ValueOf(fn)
+		wrapped[name] = reflect.MakeFunc(v.Type(), func(args []reflect.Value) []reflect.Value {
+			if err := ctx.Err(); err != nil {
+				if v.Type().NumOut() == 2 {
+					return []reflect.Value{reflect.Zero(v.Type().Out(0)), reflect.ValueOf(&err).Elem()}
+				}
+				panic(err)
+			}
+			if v.Type().IsVariadic() {
+				return v.CallSlice(args)
+			}
+			return v.Call(args)
+		}).Interface()
+	}
+	return wrapped
+}
@@ -0,0 +1,1259 @@
+package templates
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"text/template"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTemplate(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"subject": {{ toJson .Subject }}}`))
+	assert.NoError(t, err)
+	assert.NotNil(t, tmpl)
+
+	tmpl, err = ParseTemplate([]byte(`{"subject": {{ unknownFunction .Subject }}}`))
+	assert.Nil(t, tmpl)
+	assert.EqualError(t, err, `error parsing template: template: template:1: function "unknownFunction" not defined`)
+	var te *TemplateError
+	if assert.True(t, errors.As(err, &te)) {
+		assert.Equal(t, ParseError, te.Kind)
+	}
+}
+
+func TestParseTemplate_position(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		opts      []Option
+		wantErr   string
+		line, col int
+	}{
+		{"unknown-function", "{\n  \"a\": {{ foo .A }}\n}", nil, `template: template:2: function "foo" not defined`, 2, 11},
+		{"operand", "{\n  \"a\": {{ .A }\n}", nil, `template: template:2: unexpected "}" in operand`, 2, 14},
+		{"undefined-variable", "{\n\n{{ $x }}}", nil, `template: template:3: undefined variable "$x"`, 3, 4},
+		{"unclosed-action", "{\n  \"a\": {{ .A", nil, `template: template:2: unclosed action`, 2, 8},
+		{"unexpected-eof", "{{ if .A }}\n  {{ else }}", nil, `template: template:2: unexpected EOF`, 2, 3},
+		{"define", "{{ define \"x\" }}\n\n  {{ bar .A }}\n{{ end }}{}", nil, `template: template:3: function "bar" not defined`, 3, 6},
+		{"nested-define", "{{ define \"x\" }}\n  {{ if .A }}\n    {{ define \"y\" }}{{ end }}\n  {{ end }}\n{{ end }}", nil, `template: template:3: unexpected <define> in command`, 3, 5},
+		{"second-define", "{{ define \"x\" }}{{ .A }}{{ end }}\n{{ define \"y\" }}\n  {{ .B | 3 }}\n{{ end }}", nil, `template: template:3: non executable command in pipeline stage 2`, 3, 3},
+		{"delims", "{\n  \"a\": [[ .A", []Option{WithDelims("[[", "]]")}, `template: template:2: unclosed action`, 2, 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseTemplate([]byte(tt.text), tt.opts...)
+			assert.Nil(t, tmpl)
+			assert.EqualError(t, err, "error parsing template: "+tt.wantErr)
+			var te *TemplateError
+			if assert.True(t, errors.As(err, &te)) {
+				assert.Equal(t, ParseError, te.Kind)
+				assert.Equal(t, tt.line, te.Line)
+				assert.Equal(t, tt.col, te.Column)
+			}
+
+			// The linter reports the same position.
+			_, err = LintTemplate([]byte(tt.text), tt.opts...)
+			if errors.As(err, &te) && te.Line != 0 {
+				assert.Equal(t, tt.line, te.Line)
+				assert.Equal(t, tt.col, te.Column)
+			}
+		})
+	}
+}
+
+func TestParseTemplate_reservedNames(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		opts      []Option
+		wantErr   string
+		line, col int
+	}{
+		{"ok", `{{ define "subject" }}{{ $cn := .CommonName }}{{ toJson $cn }}{{ end }}{"subject": {{ template "subject" . }}}`, nil, "", 0, 0},
+		{"ok/variable-named-like-function", `{{ $sans := .SANs }}{"sans": {{ toJson $sans }}}`, nil, "", 0, 0},
+		{"define", "{}\n{{ define \"fail\" }}{{ end }}", nil, `template: template:2: template "fail" has the name of a function`, 2, 1},
+		{"block", `{{ block "toJson" . }}{}{{ end }}`, nil, `template: template:1: template "toJson" has the name of a function`, 1, 1},
+		{"sprig", `{{- define "upper" }}{{ end }}{}`, nil, `template: template:1: template "upper" has the name of a function`, 1, 1},
+		{"delims", `[[ define "include" ]][[ end ]]{}`, []Option{WithDelims("[[", "]]")}, `template: template:1: template "include" has the name of a function`, 1, 1},
+		{"variable", `{{ $failMessage := "" }}{}`, nil, `template: template:1: variable $failMessage is reserved`, 1, 4},
+		{"range-variable", "{\n{{ range $i, $failMessage := .SANs }}{{ end }}}", nil, `template: template:2: variable $failMessage is reserved`, 2, 14},
+		{"variable-in-define", `{{ define "x" }}{{ with $failMessage := .A }}{{ end }}{{ end }}{}`, nil, `template: template:1: variable $failMessage is reserved`, 1, 25},
+		{"first", `{{ $failMessage := "" }}{{ define "fail" }}{{ end }}`, nil, `template: template:1: variable $failMessage is reserved`, 1, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseTemplate([]byte(tt.text), tt.opts...)
+			assert.Equal(t, err, ValidateTemplate([]byte(tt.text), tt.opts...))
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				assert.NotNil(t, tmpl)
+				return
+			}
+			assert.Nil(t, tmpl)
+			assert.EqualError(t, err, "error parsing template: "+tt.wantErr)
+			var te *TemplateError
+			if assert.True(t, errors.As(err, &te)) {
+				assert.Equal(t, ParseError, te.Kind)
+				assert.Equal(t, tt.line, te.Line)
+				assert.Equal(t, tt.col, te.Column)
+			}
+		})
+	}
+}
+
+func TestParseTemplate_deniedFuncs(t *testing.T) {
+	denied := WithDeniedFuncs("env", "include")
+	tests := []struct {
+		name      string
+		text      string
+		opts      []Option
+		wantErr   string
+		line, col int
+	}{
+		{"ok", `{"home": {{ env "HOME" | toJson }}}`, nil, "", 0, 0},
+		{"ok/other", `{"cn": {{ toJson .CommonName }}}`, []Option{denied}, "", 0, 0},
+		{"env", "{\n  \"home\": {{ env \"HOME\" | toJson }}\n}", []Option{denied}, `template: template:2:14: function "env" is denied`, 2, 14},
+		{"pipeline", `{"a": {{ .A | include "x.tmpl" }}}`, []Option{denied}, `template: template:1:15: function "include" is denied`, 1, 15},
+		{"first", `{{ if .A }}{{ include "a.tmpl" }}{{ end }}{{ env "A" }}`, []Option{denied}, `template: template:1:15: function "include" is denied`, 1, 15},
+		{"define", "{{ define \"x\" }}{{ env \"A\" }}{{ end }}\n{}{{ template \"x\" }}", []Option{denied}, `template: template:1:20: function "env" is denied`, 1, 20},
+		{"unused-branch", `{{ if false }}{{ env "A" }}{{ end }}{}`, []Option{denied}, `template: template:1:18: function "env" is denied`, 1, 18},
+		{"sprig", `{{ uuidv4 | toJson }}`, []Option{WithDeniedFuncs("uuidv4")}, `template: template:1:4: function "uuidv4" is denied`, 1, 4},
+		{"delims", `{"a": [[ env "A" | toJson ]]}`, []Option{denied, WithDelims("[[", "]]")}, `template: template:1:10: function "env" is denied`, 1, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseTemplate([]byte(tt.text), tt.opts...)
+			assert.Equal(t, err, ValidateTemplate([]byte(tt.text), tt.opts...))
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				assert.NotNil(t, tmpl)
+				return
+			}
+			assert.Nil(t, tmpl)
+			assert.EqualError(t, err, "error parsing template: "+tt.wantErr)
+			var te *TemplateError
+			if assert.True(t, errors.As(err, &te)) {
+				assert.Equal(t, ParseError, te.Kind)
+				assert.Equal(t, tt.line, te.Line)
+				assert.Equal(t, tt.col, te.Column)
+			}
+		})
+	}
+
+	// Included files are checked too.
+	fsys := fstest.MapFS{"env.tmpl": {Data: []byte(`{{ env "HOME" | toJson }}`)}}
+	tmpl, err := ParseTemplate([]byte(`{"home": {{ include "env.tmpl" }}}`), WithIncludeFS(fsys), WithDeniedFuncs("env"))
+	require.NoError(t, err)
+	_, err = tmpl.Render(nil)
+	assert.EqualError(t, err, `error executing template: error including "env.tmpl": template: env.tmpl:1:4: function "env" is denied`)
+}
+
+func TestTemplate_Validate(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{{ if not .SANs }}{{ fail "at least one SAN is required" }}{{ end }}{"sans": {{ toJson .SANs }}}`))
+	require.NoError(t, err)
+
+	// The same template can be validated multiple times.
+	assert.NoError(t, tmpl.Validate([]byte(`{"SANs": ["foo.com"]}`)))
+	assert.EqualError(t, tmpl.Validate([]byte(`{}`)), "error executing template: at least one SAN is required")
+	assert.NoError(t, tmpl.Validate([]byte(`{"SANs": ["bar.com"]}`)))
+	assert.EqualError(t, tmpl.Validate([]byte(`{"SANs": }`)), "error validating json template data: invalid JSON at SANs (line 1, column 10): invalid character '}' looking for beginning of value")
+
+	empty, err := ParseTemplate(nil)
+	require.NoError(t, err)
+	assert.NoError(t, empty.Validate([]byte(`{!?}`)))
+}
+
+func TestTemplate_withFuncs(t *testing.T) {
+	funcs := WithFuncs(template.FuncMap{
+		"tenant": func(s string) string { return "tenant-" + s },
+		"region": func(s string) (string, error) {
+			if s == "" {
+				return "", errors.New("region is empty")
+			}
+			return s + ".example.com", nil
+		},
+	})
+	fsys := fstest.MapFS{"dns.tmpl": {Data: []byte(`{{ toJson (region .) }}`)}}
+	tmpl, err := ParseTemplate([]byte(`{{ if not .Region }}{{ fail "E_REGION" "a region is required" }}{{ end }}{"cn": {{ tenant .Name | toJson }}, "dnsNames": [{{ include "dns.tmpl" .Region }}]}`), funcs, WithIncludeFS(fsys))
+	require.NoError(t, err)
+
+	out, err := tmpl.Render([]byte(`{"Name": "foo", "Region": "eu"}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"cn": "tenant-foo", "dnsNames": ["eu.example.com"]}`, string(out))
+
+	err = tmpl.Validate([]byte(`{"Name": "foo"}`))
+	assert.EqualError(t, err, "error executing template: a region is required")
+	var fe *FailError
+	if assert.True(t, errors.As(err, &fe)) {
+		assert.Equal(t, "E_REGION", fe.Code)
+	}
+
+	_, err = ParseTemplate([]byte(`{{ fail "foo" }}`), WithFuncs(template.FuncMap{"fail": func() string { return "" }}))
+	assert.EqualError(t, err, `error parsing template: function "fail" cannot be redefined`)
+	var te *TemplateError
+	if assert.True(t, errors.As(err, &te)) {
+		assert.Equal(t, ParseError, te.Kind)
+	}
+}
+
+func TestTemplate_fail(t *testing.T) {
+	fsys := fstest.MapFS{"sans.tmpl": {Data: []byte(`{{ if not . }}{{ fail "E_NO_SAN" "at least one SAN is required" }}{{ end }}{{ toJson . }}`)}}
+	tmpl, err := ParseTemplate([]byte(`{{ if not .CommonName }}{{ fail "a common name is required" }}{{ end }}{"cn": {{ toJson .CommonName }}, "sans": {{ include "sans.tmpl" .SANs }}}`), WithIncludeFS(fsys))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		wantErr  string
+		wantCode string
+	}{
+		{"message", []byte(`{"SANs": ["foo.com"]}`), "error executing template: a common name is required", ""},
+		{"code", []byte(`{"CommonName": "foo"}`), `error executing template: error including "sans.tmpl": at least one SAN is required`, "E_NO_SAN"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, err := range []error{tmpl.Validate(tt.data), func() error { _, err := tmpl.Render(tt.data); return err }()} {
+				assert.EqualError(t, err, tt.wantErr)
+				var fe *FailError
+				if assert.True(t, errors.As(err, &fe)) {
+					assert.Equal(t, tt.wantCode, fe.Code)
+					assert.Equal(t, strings.TrimPrefix(tt.wantErr, "error executing template: "), fe.Message)
+				}
+				var te *TemplateError
+				if assert.True(t, errors.As(err, &te)) {
+					assert.Equal(t, ExecError, te.Kind)
+				}
+				var execErr template.ExecError
+				assert.True(t, errors.As(err, &execErr))
+			}
+		})
+	}
+
+	out, err := tmpl.Render([]byte(`{"CommonName": "foo", "SANs": ["foo.com"]}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"cn": "foo", "sans": ["foo.com"]}`, string(out))
+}
+
+func TestTemplate_Validate_position(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte("{\n  \"cn\": {{ .CommonName }},\n  \"sans\": [{{ range .SANs }}{{ toJson . }},{{ end }}]\n}"))
+	require.NoError(t, err)
+	require.NoError(t, tmpl.Validate([]byte(`{"CommonName": "\"foo\"", "SANs": []}`)))
+
+	tests := []struct {
+		name      string
+		data      []byte
+		err       string
+		line, col int
+	}{
+		{"inside action", []byte(`{"CommonName": "foo", "SANs": []}`), "invalid JSON at offset 11, near template line 2, column 12: invalid character 'o' in literal false (expecting 'a')", 2, 12},
+		{"empty action", []byte(`{"CommonName": "", "SANs": []}`), "invalid JSON at offset 10, near template line 2, column 12: invalid character ',' looking for beginning of value", 2, 12},
+		{"after text", []byte(`{"CommonName": "1", "SANs": ["foo.com"]}`), "invalid JSON at template line 3, column 53: invalid character ']' looking for beginning of value", 3, 53},
+		{"literal", []byte(`{"CommonName": "1 2", "SANs": []}`), "invalid JSON at offset 12, near template line 2, column 12: invalid character '2' after object key:value pair", 2, 12},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tmpl.Validate(tt.data)
+			assert.EqualError(t, err, "error validating json template data: "+tt.err)
+			var te *TemplateError
+			if assert.True(t, errors.As(err, &te)) {
+				assert.Equal(t, JSONError, te.Kind)
+				assert.Equal(t, tt.line, te.Line)
+				assert.Equal(t, tt.col, te.Column)
+			}
+		})
+	}
+}
+
+func TestTemplate_Validate_options(t *testing.T) {
+	text := []byte(`{"commonName": {{ toJson .Subject.CommonName }}}`)
+
+	tmpl, err := ParseTemplate(text)
+	require.NoError(t, err)
+	assert.NoError(t, tmpl.Validate([]byte(`{"Subject": {}}`)))
+
+	tmpl, err = ParseTemplate(text, WithStrict(true), WithRejectDuplicateKeys(true))
+	require.NoError(t, err)
+	assert.EqualError(t, tmpl.Validate([]byte(`{"Subject": {}}`)), `error executing template: missing key "CommonName" in .Subject.CommonName: template: template:1:33: executing "template" at <.Subject.CommonName>: map has no entry for key "CommonName"`)
+	assert.EqualError(t, tmpl.Validate([]byte(`{"Subject": {}, "Subject": {}}`)), `error validating json template data: duplicate key "Subject" at line 1, column 17`)
+}
+
+func TestTemplate_Render(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"commonName": {{ toJson .Subject.CommonName }}, "sans": {{ .SANs }}}`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []byte
+		wantErr string
+	}{
+		{"ok", []byte(`{"Subject": {"CommonName": "foo"}, "SANs": "invalid"}`), []byte(`{"commonName": "foo", "sans": invalid}`), ""},
+		{"ok/empty-data", nil, []byte(`{"commonName": null, "sans": <no value>}`), ""},
+		{"fail/data", []byte(`{"Subject"}`), nil, "error validating json template data: invalid JSON at Subject (line 1, column 11): invalid character '}' after object key"},
+		{"fail/data-not-an-object", []byte(`[]`), nil, `error executing template: template: template:1:33: executing "template" at <.Subject.CommonName>: can't evaluate field Subject in type []interface {}`},
+		{"fail/execute", []byte(`{"Subject": "foo"}`), nil, `error executing template: template: template:1:33: executing "template" at <.Subject.CommonName>: can't evaluate field CommonName in type interface {}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tmpl.Render(tt.data)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				assert.Nil(t, got)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestTemplate_parallel(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{{ if .fail }}{{ fail .message }}{{ end }}{"message": {{ toJson .message }}}`))
+	require.NoError(t, err)
+
+	for i := 0; i < 50; i++ {
+		i := i
+		t.Run(fmt.Sprintf("render-%d", i), func(t *testing.T) {
+			t.Parallel()
+			data := []byte(fmt.Sprintf(`{"fail": %v, "message": "message %d"}`, i%2 == 0, i))
+			got, err := tmpl.Render(data)
+			if i%2 == 0 {
+				assert.EqualError(t, err, fmt.Sprintf("error executing template: message %d", i))
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, fmt.Sprintf(`{"message": "message %d"}`, i), string(got))
+			}
+		})
+	}
+}
+
+// largeTemplate returns a template with n properties and the data to execute
+// it.
+func largeTemplate(n int) (text, data []byte) {
+	var tb, db strings.Builder
+	tb.WriteString("{\n")
+	db.WriteString("{")
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			tb.WriteString(",\n")
+			db.WriteString(",")
+		}
+		fmt.Fprintf(&tb, `  "key%d": {{ if .key%d }}{{ toJson .key%d | trim }}{{ else }}{{ default "none" .missing | toJson }}{{ end }}`, i, i, i)
+		fmt.Fprintf(&db, `"key%d": "value %d"`, i, i)
+	}
+	tb.WriteString("\n}")
+	db.WriteString("}")
+	return []byte(tb.String()), []byte(db.String())
+}
+
+func BenchmarkValidateTemplateWithData(b *testing.B) {
+	text, data := largeTemplate(500)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := ValidateTemplateWithData(text, data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTemplate_Validate(b *testing.B) {
+	text, data := largeTemplate(500)
+	tmpl, err := ParseTemplate(text)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := tmpl.Validate(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestTemplate_Render_funcs(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"a": {{ a | toJson }}}`), WithFuncs(template.FuncMap{"a": func() string { return "a" }}))
+	require.NoError(t, err)
+
+	// The functions of a render are added to the ones of the template, and
+	// don't change it.
+	out, err := tmpl.Render(nil, WithFuncs(template.FuncMap{"b": func() string { return "b" }}))
+	require.NoError(t, err)
+	assert.Equal(t, `{"a": "a"}`, string(out))
+	assert.Len(t, tmpl.o.funcs, 1)
+	assert.Contains(t, tmpl.o.funcs, "a")
+}
+
+func TestTemplate_RenderWithTrace(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{{ if .fail }}{{ fail "failed" }}{{ end }}{"cn": {{ .cn | default "foo" | upper | toJson }}, "sans": {{ toJson (list .cn (lower .cn)) }}{{ if .b64 }}, "b64": {{ b64enc .cn | toJson }}{{ end }}, "len": {{ len .cn }}}`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		want     []byte
+		wantUsed []string
+		wantErr  string
+	}{
+		{"ok", []byte(`{"cn": "Foo"}`), []byte(`{"cn": "FOO", "sans": ["Foo","foo"], "len": 3}`), []string{"default", "list", "lower", "toJson", "upper"}, ""},
+		{"ok/branch", []byte(`{"cn": "Foo", "b64": true}`), []byte(`{"cn": "FOO", "sans": ["Foo","foo"], "b64": "Rm9v", "len": 3}`), []string{"b64enc", "default", "list", "lower", "toJson", "upper"}, ""},
+		{"fail", []byte(`{"fail": true}`), nil, []string{"fail"}, "error executing template: failed"},
+		{"fail/data", []byte(`{`), nil, []string{}, "error validating json template data: invalid JSON at (root) (line 1, column 1): unexpected end of JSON input"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, used, err := tmpl.RenderWithTrace(tt.data)
+			assert.Equal(t, tt.wantUsed, used)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				assert.Nil(t, got)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, string(tt.want), string(got))
+		})
+	}
+
+	// Tracing doesn't change the output of the template.
+	out, err := tmpl.Render([]byte(`{"cn": "Foo", "b64": true}`))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"cn": "FOO", "sans": ["Foo","foo"], "b64": "Rm9v", "len": 3}`, string(out))
+}
+
+func TestTemplate_env(t *testing.T) {
+	text := []byte(`{"region": {{ env "REGION" | toJson }}}`)
+	lookup := func(name string) (string, bool) {
+		return "us-east-1", name == "REGION"
+	}
+
+	tmpl, err := ParseTemplate(text, WithAllowedEnv("REGION"), WithEnvLookup(lookup))
+	require.NoError(t, err)
+	out, err := tmpl.Render(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"region": "us-east-1"}`, string(out))
+
+	// Without an allowlist, the template is rejected.
+	assert.EqualError(t, ValidateTemplateWithData(text, nil, WithEnvLookup(lookup)), `error executing template: environment variable "REGION" is not allowed`)
+}
+
+func TestTemplate_maxOutputBytes(t *testing.T) {
+	text := []byte(`[{{ range $i, $e := .list }}{{ if $i }},{{ end }}{{ toJson $e }}{{ end }}]`)
+	data := []byte(`{"list": ["a", "b", "c"]}`)
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantErr string
+	}{
+		{"ok/unlimited", nil, ""},
+		{"ok/zero", []Option{WithMaxOutputBytes(0)}, ""},
+		{"ok/exact", []Option{WithMaxOutputBytes(13)}, ""},
+		{"fail", []Option{WithMaxOutputBytes(12)}, "error executing template: output exceeds the limit of 12 bytes"},
+		{"fail/small", []Option{WithMaxOutputBytes(1)}, "error executing template: output exceeds the limit of 1 bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseTemplate(text, tt.opts...)
+			require.NoError(t, err)
+			out, err := tmpl.Render(data)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				assert.Nil(t, out)
+				assert.EqualError(t, ValidateTemplateWithData(text, data, tt.opts...), tt.wantErr)
+				var te *TemplateError
+				if assert.True(t, errors.As(err, &te)) {
+					assert.Equal(t, ExecError, te.Kind)
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, `["a","b","c"]`, string(out))
+		})
+	}
+}
+
+func TestTemplate_maxOutputBytes_unbounded(t *testing.T) {
+	// A range over a large list is aborted before rendering all of it.
+	tmpl, err := ParseTemplate([]byte(`{{ range .list }}{{ . }}{{ . }}{{ . }}{{ end }}`), WithMaxOutputBytes(1024))
+	require.NoError(t, err)
+	data := []byte(`{"list": [` + strings.Repeat(`"aaaaaaaaaa",`, 100000) + `"a"]}`)
+	_, err = tmpl.Render(data)
+	assert.EqualError(t, err, "error executing template: output exceeds the limit of 1024 bytes")
+}
+
+func TestTemplate_default(t *testing.T) {
+	// "default" is the sprig function, false and zero numbers are empty.
+	tmpl, err := ParseTemplate([]byte(`{"isCA": {{ default true .IsCA }}, "maxPathLen": {{ default 1 .MaxPathLen }}, "fallback": [{{ fallback true .IsCA }}, {{ fallback 1 .MaxPathLen }}]}`))
+	require.NoError(t, err)
+	out, err := tmpl.Render([]byte(`{"IsCA": false, "MaxPathLen": 0}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"isCA": true, "maxPathLen": 1, "fallback": [false, 0]}`, string(out))
+
+	out, err = tmpl.Render([]byte(`{}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"isCA": true, "maxPathLen": 1, "fallback": [true, 1]}`, string(out))
+}
+
+func TestTemplate_base64(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"enc": {{ b64enc .V | toJson }}, "dec": {{ b64dec .V | toJson }}, "strict": {{ b64decStrict .V | toJson }}}`))
+	require.NoError(t, err)
+	out, err := tmpl.Render([]byte(`{"V": "Zm9v"}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"enc": "Wm05dg==", "dec": "foo", "strict": "foo"}`, string(out))
+
+	// "b64dec" is the sprig function, that returns the error.
+	tmpl, err = ParseTemplate([]byte(`{{ b64dec .V }}`))
+	require.NoError(t, err)
+	out, err = tmpl.Render([]byte(`{"V": "not base64!"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "illegal base64 data at input byte 3", string(out))
+	assert.EqualError(t, ValidateTemplateWithData([]byte(`{{ b64decStrict .V }}`), []byte(`{"V": "not base64!"}`)), "error executing template: error decoding base64: illegal base64 data at input byte 3")
+}
+
+func TestTemplate_has(t *testing.T) {
+	// "has" and "hasKey" are the sprig functions, that compare strictly.
+	tmpl, err := ParseTemplate([]byte(`{"has": [{{ has 1 .Counts }}, {{ has "1" .Counts }}, {{ hasKey .Extensions "permit-pty" }}], "hasElem": [{{ hasElem 1 .Counts }}, {{ hasElem "1" .Counts }}, {{ hasMapKey .Extensions "permit-pty" }}]}`))
+	require.NoError(t, err)
+	out, err := tmpl.Render([]byte(`{"Counts": [1, 2], "Extensions": {"permit-pty": ""}}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"has": [false, false, true], "hasElem": [true, true, true]}`, string(out))
+}
+
+func TestTemplate_coalesce(t *testing.T) {
+	// "coalesce" is the sprig function, false and zero numbers are empty.
+	tmpl, err := ParseTemplate([]byte(`{"isCA": {{ coalesce .IsCA .Default }}, "firstNonEmpty": {{ firstNonEmpty .IsCA .Default }}}`))
+	require.NoError(t, err)
+	out, err := tmpl.Render([]byte(`{"IsCA": false, "Default": true}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"isCA": true, "firstNonEmpty": false}`, string(out))
+}
+
+func TestTemplate_firstNonEmpty(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"cn": {{ firstNonEmpty .Preferred .Fallback "static" | toJson }}, "empty": {{ firstNonEmpty .Missing "" | toJson }}}`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		data string
+		want string
+	}{
+		{`{"Preferred": "foo", "Fallback": "bar"}`, `{"cn": "foo", "empty": ""}`},
+		{`{"Preferred": "", "Fallback": "bar"}`, `{"cn": "bar", "empty": ""}`},
+		{`{"Preferred": null}`, `{"cn": "static", "empty": ""}`},
+	}
+	for _, tt := range tests {
+		out, err := tmpl.Render([]byte(tt.data))
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, string(out))
+	}
+}
+
+func TestTemplate_delims(t *testing.T) {
+	text := []byte(`{"description": "use {{ .Name }} in templates", "name": [[ toJson .Name ]]}`)
+
+	tmpl, err := ParseTemplate(text, WithDelims("[[", "]]"))
+	require.NoError(t, err)
+	out, err := tmpl.Render([]byte(`{"Name": "foo"}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"description": "use {{ .Name }} in templates", "name": "foo"}`, string(out))
+	assert.NoError(t, tmpl.Validate([]byte(`{"Name": "foo"}`)))
+
+	assert.NoError(t, ValidateTemplate(text, WithDelims("[[", "]]")))
+	assert.NoError(t, ValidateTemplateWithData(text, []byte(`{"Name": "foo"}`), WithDelims("[[", "]]")))
+	lints, err := LintTemplate(text, WithDelims("[[", "]]"))
+	assert.NoError(t, err)
+	assert.Empty(t, lints)
+
+	// The version requirement uses the same delimiters.
+	err = ValidateTemplate([]byte(fmt.Sprintf(`[[/* requires funcmap >= %d */]]{}`, FuncMapVersion()+1)), WithDelims("[[", "]]"))
+	assert.EqualError(t, err, fmt.Sprintf("error parsing template: template requires newer func map: version %d required, have %d", FuncMapVersion()+1, FuncMapVersion()))
+	assert.NoError(t, ValidateTemplate([]byte(fmt.Sprintf(`{{/* requires funcmap >= %d */}}{}`, FuncMapVersion()+1)), WithDelims("[[", "]]")))
+}
+
+func TestTemplate_quote(t *testing.T) {
+	// "quote" and "squote" are the sprig functions, with Go escaping and no
+	// escaping at all.
+	tmpl, err := ParseTemplate([]byte(`{{ quote .CommonName .Organization }} {{ squote .CommonName }}`))
+	require.NoError(t, err)
+	out, err := tmpl.Render([]byte(`{"CommonName": "a\u0001", "Organization": null}`))
+	require.NoError(t, err)
+	assert.Equal(t, "\"a\\x01\" 'a\x01'", string(out))
+}
+
+func TestTemplate_jsonQuote(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"cn": {{ jsonQuote .CommonName }}, "o": {{ .Organization | jsonQuote }}}`))
+	require.NoError(t, err)
+
+	data := []byte(`{"CommonName": "a \"b\" \\ c\u0001", "Organization": null}`)
+	assert.NoError(t, tmpl.Validate(data))
+	out, err := tmpl.Render(data)
+	require.NoError(t, err)
+	assert.Equal(t, `{"cn": "a \"b\" \\ c\u0001", "o": ""}`, string(out))
+}
+
+func TestTemplate_printf(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"cn": {{ printf "%s-%v" .Name .ID | jsonQuote }}, "o": {{ jsonPrintf "%s (%v)" .Name .ID }}}`))
+	require.NoError(t, err)
+
+	data := []byte(`{"Name": "a \"b\"", "ID": 42}`)
+	assert.NoError(t, tmpl.Validate(data))
+	out, err := tmpl.Render(data)
+	require.NoError(t, err)
+	assert.Equal(t, `{"cn": "a \"b\"-42", "o": "a \"b\" (42)"}`, string(out))
+
+	// Without jsonQuote, the output of printf breaks the JSON.
+	tmpl, err = ParseTemplate([]byte(`{"cn": "{{ printf "%s-%v" .Name .ID }}"}`))
+	require.NoError(t, err)
+	assert.Error(t, tmpl.Validate(data))
+}
+
+func TestTemplate_lists(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"cn": {{ firstElem .SANs | toJson }}, "last": {{ lastElem .SANs | toJson }}, "rest": {{ restElems .SANs | toJson }}, "sans": {{ .SANs | sliceElems 0 2 | toJson }}}`))
+	require.NoError(t, err)
+
+	out, err := tmpl.Render([]byte(`{"SANs": ["a.com", "b.com", "c.com"]}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"cn": "a.com", "last": "c.com", "rest": ["b.com","c.com"], "sans": ["a.com","b.com"]}`, string(out))
+
+	_, err = tmpl.Render([]byte(`{"SANs": ["a.com"]}`))
+	assert.EqualError(t, err, "error executing template: error calling sliceElems: index 2 out of range for a list of 1 elements")
+	_, err = tmpl.Render([]byte(`{"SANs": "a.com"}`))
+	assert.EqualError(t, err, "error executing template: error calling firstElem: a.com of type string is not a list")
+
+	tmpl, err = ParseTemplate([]byte(`{"cn": {{ firstElem .SANs | toJson }}, "rest": {{ restElems .SANs | toJson }}, "sans": {{ sliceElems .SANs 0 | toJson }}}`))
+	require.NoError(t, err)
+	out, err = tmpl.Render([]byte(`{"SANs": []}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"cn": null, "rest": [], "sans": []}`, string(out))
+
+	// "first", "last" and "rest" are the sprig functions, and "slice" the one
+	// of text/template.
+	tmpl, err = ParseTemplate([]byte(`{"cn": {{ first .SANs | toJson }}, "last": {{ last .SANs | toJson }}, "rest": {{ rest .SANs | toJson }}, "sans": {{ slice .SANs 0 2 | toJson }}}`))
+	require.NoError(t, err)
+	out, err = tmpl.Render([]byte(`{"SANs": ["a.com", "b.com", "c.com"]}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"cn": "a.com", "last": "c.com", "rest": ["b.com","c.com"], "sans": ["a.com","b.com"]}`, string(out))
+}
+
+func TestTemplate_joinSplit(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"domains": {{ joinParts "," .Domains | toJson }}, "names": {{ splitParts "," .Names | toJson }}}`))
+	require.NoError(t, err)
+
+	out, err := tmpl.Render([]byte(`{"Domains": ["foo.com", "bar.com", 1], "Names": "a,b"}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"domains": "foo.com,bar.com,1", "names": ["a","b"]}`, string(out))
+
+	out, err = tmpl.Render([]byte(`{"Domains": [], "Names": ""}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"domains": "", "names": []}`, string(out))
+
+	// "join" and "split" are the sprig functions, "split" returns a map.
+	tmpl, err = ParseTemplate([]byte(`{{ $p := split "." .Name }}{{ $p._0 }} {{ $p._1 }} {{ join "," .Domains }}`))
+	require.NoError(t, err)
+	out, err = tmpl.Render([]byte(`{"Name": "foo.com", "Domains": ["foo.com", 1]}`))
+	require.NoError(t, err)
+	assert.Equal(t, "foo com foo.com,1", string(out))
+}
+
+func TestTemplate_Validate_topLevel(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		data    string
+		opts    []Option
+		want    string
+		wantErr string
+	}{
+		{"ok/array", `{{ toJson .SANs }}`, `{"SANs": ["foo.com", "bar.com"]}`, nil, `["foo.com","bar.com"]`, ""},
+		{"ok/array-data", `[{{ range $i, $v := . }}{{ if $i }}, {{ end }}{{ toJson $v }}{{ end }}]`, `["foo.com", "bar.com"]`, nil, `["foo.com", "bar.com"]`, ""},
+		{"ok/string", `{{ toJson .CommonName }}`, `{"CommonName": "foo"}`, nil, `"foo"`, ""},
+		{"ok/string-data", `{{ toJson . }}`, `"foo"`, nil, `"foo"`, ""},
+		{"ok/number", `{{ .Days }}`, `{"Days": 30}`, nil, `30`, ""},
+		{"ok/number-data", `{{ . }}`, `30`, nil, `30`, ""},
+		{"ok/boolean", `{{ .IsCA }}`, `{"IsCA": true}`, nil, `true`, ""},
+		{"ok/boolean-data", `{{ not . }}`, `false`, nil, `true`, ""},
+		{"ok/null-data", `{{ toJson . }}`, `null`, nil, `null`, ""},
+		{"ok/array-distinct-keys", `[{"a": 1}, {{ toJson .B }}]`, `{"B": {"c": 1}}`, []Option{WithRejectDuplicateKeys(true)}, `[{"a": 1}, {"c":1}]`, ""},
+		{"fail/array-output-duplicate-keys", `[{"a": 1, "a": 2}]`, ``, []Option{WithRejectDuplicateKeys(true)}, "", `error validating json template data: duplicate key "a" at template line 1, column 11`},
+		{"fail/array-data-duplicate-keys", `{{ toJson . }}`, `[{"a": 1}, {"b": 1, "b": 2}]`, []Option{WithRejectDuplicateKeys(true)}, "", `error validating json template data: duplicate key "b" at line 1, column 21`},
+		{"fail/array-trailing-data", `["a"] "b"`, ``, nil, "", `error validating json template data: invalid JSON at template line 1, column 7: invalid character '"' after top-level value`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseTemplate([]byte(tt.text), tt.opts...)
+			require.NoError(t, err)
+			err = tmpl.Validate([]byte(tt.data))
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			out, err := tmpl.Render([]byte(tt.data))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, string(out))
+		})
+	}
+}
+
+func TestTemplate_regex(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"sans": [{{ range $i, $s := .SANs }}{{ if $i }}, {{ end }}{{ if regexMatchStrict "^[a-z0-9.-]+$" $s }}{{ regexReplace "^www\\." $s "" | toJson }}{{ else }}{{ toJson $s }}{{ end }}{{ end }}]}`))
+	require.NoError(t, err)
+	out, err := tmpl.Render([]byte(`{"SANs": ["www.example.com", "Bad Name", "foo.com"]}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"sans": ["example.com", "Bad Name", "foo.com"]}`, string(out))
+
+	tmpl, err = ParseTemplate([]byte(`{{ if regexMatchStrict .Pattern "foo" }}{}{{ end }}`))
+	require.NoError(t, err)
+	assert.EqualError(t, tmpl.Validate([]byte(`{"Pattern": "[a-"}`)), "error executing template: error compiling regexp \"[a-\": error parsing regexp: missing closing ]: `[a-`")
+
+	// "regexMatch" is the sprig function, an invalid pattern doesn't match.
+	tmpl, err = ParseTemplate([]byte(`{"match": {{ regexMatch .Pattern "foo" }}, "valid": {{ regexMatch "^f" "foo" }}}`))
+	require.NoError(t, err)
+	out, err = tmpl.Render([]byte(`{"Pattern": "[a-"}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"match": false, "valid": true}`, string(out))
+}
+
+func TestTemplate_clock(t *testing.T) {
+	clock := func() time.Time {
+		return time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	}
+	tmpl, err := ParseTemplate([]byte(`{"notBefore": {{ now | dateAdd "-5m" | toJson }}, "notAfter": {{ now | dateAdd .Validity | toJson }}}`), WithClock(clock))
+	require.NoError(t, err)
+
+	out, err := tmpl.Render([]byte(`{"Validity": "720h"}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"notBefore": "2026-01-02T02:59:05Z", "notAfter": "2026-02-01T03:04:05Z"}`, string(out))
+	assert.NoError(t, tmpl.Validate([]byte(`{"Validity": "720h"}`)))
+	assert.EqualError(t, tmpl.Validate([]byte(`{"Validity": "1 month"}`)), `error executing template: error parsing duration: time: unknown unit " month" in duration "1 month"`)
+
+	// Without a clock the current time is used.
+	tmpl, err = ParseTemplate([]byte(`{{ now | dateAdd "1h" | toJson }}`))
+	require.NoError(t, err)
+	out, err = tmpl.Render(nil)
+	require.NoError(t, err)
+	got, err := time.Parse(`"`+time.RFC3339+`"`, string(out))
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), got, time.Minute)
+}
+
+func TestTemplate_addDuration(t *testing.T) {
+	clock := func() time.Time {
+		return time.Date(2026, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600))
+	}
+	tmpl, err := ParseTemplate([]byte(`{"notBefore": {{ toJson .NotBefore }}, "notAfter": {{ addDuration .NotBefore "2160h" | toJson }}, "renewAfter": {{ addDuration now "720h" | toJson }}}`), WithClock(clock))
+	require.NoError(t, err)
+
+	out, err := tmpl.Render([]byte(`{"NotBefore": "2026-01-02T00:00:00-05:00"}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"notBefore": "2026-01-02T00:00:00-05:00", "notAfter": "2026-04-02T00:00:00-05:00", "renewAfter": "2026-02-01T03:04:05+01:00"}`, string(out))
+	assert.EqualError(t, tmpl.Validate([]byte(`{"NotBefore": "tomorrow"}`)), `error executing template: error parsing time: parsing time "tomorrow" as "2006-01-02T15:04:05Z07:00": cannot parse "tomorrow" as "2006"`)
+}
+
+func TestTemplate_formatTime(t *testing.T) {
+	clock := func() time.Time {
+		return time.Date(2026, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600))
+	}
+	tmpl, err := ParseTemplate([]byte(`{"notBefore": "{{ now | formatTime "utctime" }}", "notAfter": "{{ parseTime "utctime" .NotAfter | formatTime "rfc3339" }}", "day": "{{ now | dateAdd "24h" | formatTime "2006-01-02" }}"}`), WithClock(clock))
+	require.NoError(t, err)
+	out, err := tmpl.Render([]byte(`{"NotAfter": "270102030405Z"}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"notBefore": "260102020405Z", "notAfter": "2027-01-02T03:04:05Z", "day": "2026-01-03"}`, string(out))
+
+	_, err = tmpl.Render([]byte(`{"NotAfter": "2027-01-02"}`))
+	assert.EqualError(t, err, `error executing template: error parsing time: parsing time "2027-01-02": month out of range`)
+}
+
+func TestTemplate_arithmetic(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`[{{ range $i, $s := .SANs }}{{ if $i }}, {{ end }}{"index": {{ addInt $i 1 }}, "even": {{ eq (modInt $i 2) 0 }}}{{ end }}], {{ divInt .Total .Size }}`))
+	require.NoError(t, err)
+	out, err := tmpl.Render([]byte(`{"SANs": ["a", "b"], "Total": 7, "Size": 2}`))
+	require.NoError(t, err)
+	assert.Equal(t, `[{"index": 1, "even": true}, {"index": 2, "even": false}], 3`, string(out))
+
+	_, err = tmpl.Render([]byte(`{"SANs": [], "Total": 7, "Size": 0}`))
+	assert.EqualError(t, err, "error executing template: divInt: integer division by zero: 7 / 0")
+	_, err = tmpl.Render([]byte(`{"SANs": [], "Total": 7.5, "Size": 1}`))
+	assert.EqualError(t, err, "error executing template: divInt: 7.5 is not an integer")
+
+	// JSON numbers are decoded as float64, the integral ones are accepted.
+	tmpl, err = ParseTemplate([]byte(`{{ mulInt .X 2 }} {{ addInt .X .Y }} {{ subInt .Y .X }} {{ modInt .Y .X }}`))
+	require.NoError(t, err)
+	out, err = tmpl.Render([]byte(`{"X": 3, "Y": 1e2}`))
+	require.NoError(t, err)
+	assert.Equal(t, "6 103 97 1", string(out))
+	_, err = tmpl.Render([]byte(`{"X": 1.5, "Y": 2}`))
+	assert.EqualError(t, err, "error executing template: mulInt: 1.5 is not an integer")
+	_, err = tmpl.Render([]byte(`{"X": 1, "Y": 1e19}`))
+	assert.EqualError(t, err, "error executing template: addInt: integer overflow: 1e+19")
+
+	// "add", "sub", "mul", "div" and "mod" are the sprig functions, that
+	// truncate the numbers.
+	tmpl, err = ParseTemplate([]byte(`{{ add .X 1 }} {{ sub .X 1 }} {{ mul .X 2 }} {{ div .X 1 }} {{ mod .X 2 }}`))
+	require.NoError(t, err)
+	out, err = tmpl.Render([]byte(`{"X": 3.5}`))
+	require.NoError(t, err)
+	assert.Equal(t, "4 2 6 3 1", string(out))
+}
+
+func TestTemplate_timeout(t *testing.T) {
+	// The template never finishes in time, it writes 10^9 times.
+	text := []byte(`{{ range $a := .L }}{{ range $b := $.L }}{{ range $c := $.L }}x{{ end }}{{ end }}{{ end }}`)
+	data := []byte(`{"L": [` + strings.Repeat(`1,`, 999) + `1]}`)
+
+	tmpl, err := ParseTemplate(text, WithTimeout(50*time.Millisecond))
+	require.NoError(t, err)
+	start := time.Now()
+	err = tmpl.Validate(data)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.EqualError(t, err, "error executing template: execution aborted: context deadline exceeded")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	var te *TemplateError
+	if assert.True(t, errors.As(err, &te)) {
+		assert.Equal(t, ExecError, te.Kind)
+	}
+	assert.EqualError(t, ValidateTemplateWithData(text, data, WithTimeout(time.Nanosecond)), "error executing template: execution aborted: context deadline exceeded")
+
+	// A fast template is not affected.
+	assert.NoError(t, ValidateTemplateWithData([]byte(`{"a": {{ toJson .L }}}`), data, WithTimeout(time.Minute)))
+
+	// The context given to ValidateContext is also used.
+	tmpl, err = ParseTemplate(text)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = tmpl.ValidateContext(ctx, data)
+	assert.EqualError(t, err, "error executing template: execution aborted: context canceled")
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.NoError(t, tmpl.ValidateContext(context.Background(), []byte(`{"L": []}`)))
+}
+
+func TestTemplate_timeout_goroutine(t *testing.T) {
+	// The template never writes, it calls functions 10^9 times.
+	text := []byte(`{{ range $a := .L }}{{ range $b := $.L }}{{ range $c := $.L }}{{ $x := add 1 1 }}{{ $y := lower "X" }}{{ end }}{{ end }}{{ end }}`)
+	data := []byte(`{"L": [` + strings.Repeat(`1,`, 999) + `1]}`)
+
+	tmpl, err := ParseTemplate(text, WithTimeout(50*time.Millisecond))
+	require.NoError(t, err)
+	before := runtime.NumGoroutine()
+	assert.EqualError(t, tmpl.Validate(data), "error executing template: execution aborted: context deadline exceeded")
+
+	// The execution stops in the next function call.
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before)
+}
+
+func TestTemplate_timeout_background(t *testing.T) {
+	// The template never writes or calls functions, it iterates 2.7*10^7
+	// times, around a second.
+	text := []byte(`{{ range $a := .L }}{{ range $b := $.L }}{{ range $c := $.L }}{{ end }}{{ end }}{{ end }}`)
+	data := []byte(`{"L": [` + strings.Repeat(`1,`, 299) + `1]}`)
+
+	// executions returns the number of templates running in the background.
+	executions := func() int {
+		buf := make([]byte, 1<<20)
+		return strings.Count(string(buf[:runtime.Stack(buf, true)]), "templates.executeTemplate.func1")
+	}
+	waitExecutions := func() {
+		deadline := time.Now().Add(30 * time.Second)
+		for executions() > 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	// The executions of other tests stop on their own.
+	waitExecutions()
+	require.Zero(t, executions())
+
+	tmpl, err := ParseTemplate(text, WithTimeout(20*time.Millisecond))
+	require.NoError(t, err)
+	assert.EqualError(t, tmpl.Validate(data), "error executing template: execution aborted: context deadline exceeded")
+
+	// The execution can't be stopped, but it finishes in the background.
+	assert.Equal(t, 1, executions())
+	waitExecutions()
+	assert.Zero(t, executions())
+}
+
+func TestTemplate_stringFuncs(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"cn": {{ .CommonName | trim | toJson }}, "c": {{ .Country | upperCase | toJson }}, "o": {{ .Organization | titleCase | toJson }}, "dns": {{ .DNS | trimPrefix "www." | lowerCase | toJson }}}`))
+	require.NoError(t, err)
+	out, err := tmpl.Render([]byte(`{"CommonName": " \t ñandú \n", "Country": "straße", "Organization": "ACME ÉLAN", "DNS": "www.Foo.COM"}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"cn": "ñandú", "c": "STRASSE", "o": "Acme Élan", "dns": "foo.com"}`, string(out))
+
+	// "upper", "lower" and "title" are the sprig functions.
+	tmpl, err = ParseTemplate([]byte(`{"c": {{ .Country | upper | toJson }}, "o": {{ .Organization | title | toJson }}, "dns": {{ .DNS | trimSuffix ".COM" | lower | toJson }}}`))
+	require.NoError(t, err)
+	out, err = tmpl.Render([]byte(`{"Country": "straße", "Organization": "ACME ÉLAN", "DNS": "www.Foo.COM"}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"c": "STRAßE", "o": "ACME ÉLAN", "dns": "www.foo"}`, string(out))
+}
+
+func TestTemplate_object(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"subject": {{ object "commonName" .CN "organization" .Org }}, "issuer": {{ object "commonName" .Issuer }}, "extra": {{ object "a" null "b" (object "c" .C) "sans" .SANs | toJson }}, "none": {{ null }}}`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"full", `{"CN": "foo", "Org": ["Acme"], "Issuer": "ca", "C": "US", "SANs": ["foo.com"]}`, `{"subject": {"commonName":"foo","organization":["Acme"]}, "issuer": {"commonName":"ca"}, "extra": {"a":null,"b":{"c":"US"},"sans":["foo.com"]}, "none": null}`},
+		{"empty", `{"CN": "", "Org": []}`, `{"subject": {}, "issuer": {}, "extra": {"a":null}, "none": null}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(t, tmpl.Validate([]byte(tt.data)))
+			out, err := tmpl.Render([]byte(tt.data))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(out))
+		})
+	}
+
+	tmpl, err = ParseTemplate([]byte(`{{ object "cn" }}`))
+	require.NoError(t, err)
+	_, err = tmpl.Render(nil)
+	assert.EqualError(t, err, "error executing template: error creating object: odd number of arguments")
+}
+
+func TestTemplate_jsonKey(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"claims": { {{- range $i, $c := .Claims }}{{ if $i }}, {{ end }}{{ jsonKey $c.Name }}: {{ object "value" $c.Value }}{{ end -}} }}`))
+	require.NoError(t, err)
+
+	data := []byte(`{"Claims": [{"Name": "a\"b", "Value": 1}, {"Name": "x.y", "Value": "z"}, {"Name": "ü", "Value": true}]}`)
+	require.NoError(t, tmpl.Validate(data))
+	out, err := tmpl.Render(data)
+	require.NoError(t, err)
+	assert.Equal(t, `{"claims": {"a\"b": {"value":1}, "x.y": {"value":"z"}, "ü": {"value":true}}}`, string(out))
+
+	err = tmpl.Validate([]byte(`{"Claims": [{"Name": "", "Value": 1}]}`))
+	assert.EqualError(t, err, "error executing template: error creating json key: key is empty")
+}
+
+func TestTemplate_lookup(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"cn": {{ lookup "/subject/names/0/value" . | default .CommonName | toJson }}, "org": {{ lookup "/subject/org" . | toJson }}}`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"ok", `{"subject": {"names": [{"value": "foo"}], "org": "Acme"}}`, `{"cn": "foo", "org": "Acme"}`},
+		{"default", `{"subject": {"names": []}, "CommonName": "bar"}`, `{"cn": "bar", "org": null}`},
+		{"empty", ``, `{"cn": null, "org": null}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(t, tmpl.Validate([]byte(tt.data)))
+			out, err := tmpl.Render([]byte(tt.data))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(out))
+		})
+	}
+
+	tmpl, err = ParseTemplate([]byte(`{{ lookup "subject" . }}`))
+	require.NoError(t, err)
+	_, err = tmpl.Render(nil)
+	assert.EqualError(t, err, `error executing template: error looking up "subject": pointer must be empty or start with '/'`)
+}
+
+func TestTemplate_Render_mode(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte("\n{\n  \"subject\": {{ toJson .Subject }},\n\t\"sans\": [ {{ range $i, $s := .SANs }}{{ if $i }}, {{ end }}{{ toJson $s }}{{ end }} ],\n  \"n\": 1.0, \"a\": \"x y\"\n}\n"))
+	require.NoError(t, err)
+	data := []byte(`{"Subject": {"commonName": "foo"}, "SANs": ["a.com", "b.com"]}`)
+
+	tests := []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{"raw", nil, "\n{\n  \"subject\": {\"commonName\":\"foo\"},\n\t\"sans\": [ \"a.com\", \"b.com\" ],\n  \"n\": 1.0, \"a\": \"x y\"\n}\n"},
+		{"raw/explicit", []Option{WithRenderMode(RenderRaw)}, "\n{\n  \"subject\": {\"commonName\":\"foo\"},\n\t\"sans\": [ \"a.com\", \"b.com\" ],\n  \"n\": 1.0, \"a\": \"x y\"\n}\n"},
+		{"compact", []Option{WithRenderMode(RenderCompact)}, `{"subject":{"commonName":"foo"},"sans":["a.com","b.com"],"n":1.0,"a":"x y"}`},
+		{"pretty", []Option{WithRenderMode(RenderPretty)}, "{\n  \"subject\": {\n    \"commonName\": \"foo\"\n  },\n  \"sans\": [\n    \"a.com\",\n    \"b.com\"\n  ],\n  \"n\": 1.0,\n  \"a\": \"x y\"\n}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := tmpl.Render(data, tt.opts...)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(out))
+		})
+	}
+
+	// The mode can also be set when the template is parsed.
+	tmpl, err = ParseTemplate([]byte(`{"cn": "{{ .CN }}"}`), WithRenderMode(RenderCompact))
+	require.NoError(t, err)
+	out, err := tmpl.Render([]byte(`{"CN": "foo"}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"cn":"foo"}`, string(out))
+
+	// Invalid output is not formatted.
+	_, err = tmpl.Render([]byte(`{"CN": "a\"b"}`))
+	assert.EqualError(t, err, "error validating json template data: invalid JSON at offset 10, near template line 1, column 12: invalid character 'b' after object key:value pair")
+	var te *TemplateError
+	if assert.True(t, errors.As(err, &te)) {
+		assert.Equal(t, JSONError, te.Kind)
+	}
+	out, err = tmpl.Render([]byte(`{"CN": "a\"b"}`), WithRenderMode(RenderRaw))
+	require.NoError(t, err)
+	assert.Equal(t, `{"cn": "a"b"}`, string(out))
+
+	// And empty output is returned as it is.
+	tmpl, err = ParseTemplate([]byte("{{ if .A }}{}{{ end }}"))
+	require.NoError(t, err)
+	out, err = tmpl.Render(nil, WithRenderMode(RenderPretty))
+	require.NoError(t, err)
+	assert.Empty(t, out)
+}
+
+func TestTemplate_rand(t *testing.T) {
+	text := []byte(`{"serialSuffix": {{ randHex 8 | toJson }}, "nonce": {{ randAlnum .Length | toJson }}}`)
+	tmpl, err := ParseTemplate(text)
+	require.NoError(t, err)
+	data := []byte(`{"Length": 12}`)
+	require.NoError(t, tmpl.Validate(data))
+	out1, err := tmpl.Render(data)
+	require.NoError(t, err)
+	out2, err := tmpl.Render(data)
+	require.NoError(t, err)
+	assert.Regexp(t, `^\{"serialSuffix": "[0-9a-f]{8}", "nonce": "[0-9A-Za-z]{12}"\}$`, string(out1))
+	assert.NotEqual(t, string(out1), string(out2))
+
+	tmpl, err = ParseTemplate(text, WithRandReader(bytes.NewReader(bytes.Repeat([]byte{1}, 20))))
+	require.NoError(t, err)
+	out, err := tmpl.Render(data)
+	require.NoError(t, err)
+	assert.Equal(t, `{"serialSuffix": "11111111", "nonce": "BBBBBBBBBBBB"}`, string(out))
+	_, err = tmpl.Render(data)
+	assert.EqualError(t, err, "error executing template: error generating random string: EOF")
+
+	tmpl, err = ParseTemplate(text)
+	require.NoError(t, err)
+	_, err = tmpl.Render([]byte(`{"Length": 4096}`))
+	assert.EqualError(t, err, "error executing template: error generating random string: 4096 characters exceeds the maximum of 1024")
+
+	// The sprig function ignores WithRandReader.
+	tmpl, err = ParseTemplate([]byte(`{{ randAlphaNum 32 }}`), WithRandReader(bytes.NewReader(bytes.Repeat([]byte{1}, 32))))
+	require.NoError(t, err)
+	out, err = tmpl.Render(nil)
+	require.NoError(t, err)
+	assert.Regexp(t, `^[0-9A-Za-z]{32}$`, string(out))
+	assert.NotEqual(t, strings.Repeat("B", 32), string(out))
+}
+
+func TestTemplate_merge(t *testing.T) {
+	// "merge" is the sprig function, the first object takes precedence.
+	tmpl, err := ParseTemplate([]byte(`{{ merge .User .Defaults | toJson }}`))
+	require.NoError(t, err)
+	out, err := tmpl.Render([]byte(`{
+		"User": {"subject": {"commonName": "jane"}, "keyUsage": ["keyEncipherment"]},
+		"Defaults": {"subject": {"commonName": "default", "organization": "Acme"}, "keyUsage": ["digitalSignature"], "extKeyUsage": ["clientAuth"]}
+	}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"subject": {"commonName": "jane", "organization": "Acme"}, "keyUsage": ["keyEncipherment"], "extKeyUsage": ["clientAuth"]}`, string(out))
+}
+
+func TestTemplate_deepMerge(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{{ deepMerge .Base .Override | toJson }}`))
+	require.NoError(t, err)
+	out, err := tmpl.Render([]byte(`{
+		"Base": {"subject": {"commonName": "foo", "organization": ["Acme"]}, "keyUsage": ["digitalSignature"], "basicConstraints": {"isCA": false}},
+		"Override": {"subject": {"organization": ["Smallstep"]}, "keyUsage": ["certSign", "crlSign"], "basicConstraints": {"isCA": true, "maxPathLen": 0}}
+	}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"subject": {"commonName": "foo", "organization": ["Smallstep"]}, "keyUsage": ["certSign", "crlSign"], "basicConstraints": {"isCA": true, "maxPathLen": 0}}`, string(out))
+
+	// A missing override is an empty object.
+	out, err = tmpl.Render([]byte(`{"Base": {"subject": "foo"}}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"subject":"foo"}`, string(out))
+
+	_, err = tmpl.Render([]byte(`{"Base": {}, "Override": ["foo"]}`))
+	assert.EqualError(t, err, "error executing template: error merging: argument 2 of type []interface {} is not an object")
+}
+
+func TestTemplate_basicConstraints(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"subject": {{ toJson .CommonName }}, "basicConstraints": {{ basicConstraints .IsCA .PathLen }}}`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    string
+		wantErr string
+	}{
+		{"ok/ca", []byte(`{"CommonName": "Root", "IsCA": true}`), `{"subject": "Root", "basicConstraints": {"isCA":true,"maxPathLen":-1}}`, ""},
+		{"ok/intermediate", []byte(`{"CommonName": "Intermediate", "IsCA": true, "PathLen": 0}`), `{"subject": "Intermediate", "basicConstraints": {"isCA":true,"maxPathLen":0}}`, ""},
+		{"ok/leaf", []byte(`{"CommonName": "foo", "IsCA": false}`), `{"subject": "foo", "basicConstraints": {"isCA":false}}`, ""},
+		{"fail/leaf", []byte(`{"CommonName": "foo", "IsCA": false, "PathLen": 1}`), "", "error executing template: error creating basicConstraints: pathLen cannot be set if isCA is false"},
+		{"fail/negative", []byte(`{"CommonName": "foo", "IsCA": true, "PathLen": -1}`), "", "error executing template: error creating basicConstraints: pathLen -1 must be between 0 and 2147483647"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := tmpl.Render(tt.data)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(out))
+		})
+	}
+}
+
+func TestTemplate_number(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"pathLen": {{ number .PathLen }}}`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    string
+		wantErr string
+	}{
+		{"ok/string", []byte(`{"PathLen": "1"}`), `{"pathLen": 1}`, ""},
+		{"ok/number", []byte(`{"PathLen": 2}`), `{"pathLen": 2}`, ""},
+		{"fail/empty", []byte(`{"PathLen": ""}`), "", `error executing template: error creating number: "" is not a JSON number`},
+		{"fail/missing", []byte(`{}`), "", "error executing template: error creating number: value is missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := tmpl.Render(tt.data)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(out))
+		})
+	}
+}
+
+func TestTemplate_serial(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"serialNumber": {{ .Serial | serial "hex" | jsonQuote }}, "comment": {{ serial "decimal" .Serial | jsonQuote }}}`))
+	require.NoError(t, err)
+	out, err := tmpl.Render([]byte(`{"Serial": "0x00ffee"}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"serialNumber": "0xffee", "comment": "65518"}`, string(out))
+
+	_, err = tmpl.Render([]byte(`{"Serial": 0}`))
+	assert.EqualError(t, err, "error executing template: error formatting serial number: 0 is not positive")
+}
+
+func TestTemplate_keyFingerprint(t *testing.T) {
+	text := []byte(`{"extensions": [{"id": "1.2.3.4", "value": {{ keyFingerprint .Key "base64" | toJson }}}]}`)
+	keys := map[string][]byte{"issuer": []byte("abc")}
+	resolver := WithKeyResolver(func(name string) ([]byte, error) {
+		if b, ok := keys[name]; ok {
+			return b, nil
+		}
+		return nil, fmt.Errorf("unknown key")
+	})
+
+	tmpl, err := ParseTemplate(text, resolver)
+	require.NoError(t, err)
+	out, err := tmpl.Render([]byte(`{"Key": "issuer"}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"extensions": [{"id": "1.2.3.4", "value": "ungWv48Bz+pBQUDeXa4iI7ADYaOWF3qctBD/YfIAFa0="}]}`, string(out))
+
+	err = tmpl.Validate([]byte(`{"Key": "other"}`))
+	assert.EqualError(t, err, `error executing template: error resolving key "other": unknown key`)
+
+	// The template can be validated without a resolver as long as the
+	// function is not called.
+	assert.NoError(t, ValidateTemplate(text))
+	err = ValidateTemplateWithData(text, []byte(`{"Key": "issuer"}`))
+	assert.EqualError(t, err, `error executing template: error creating fingerprint of key "issuer": keys cannot be resolved without WithKeyResolver`)
+}
+
+func TestTemplate_hashFuncs(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"serialNumber": {{ sha256 .CommonName | trunc 16 | toJson }}, "keyId": {{ .Key | fingerprint "colon" | toJson }}, "legacy": {{ sha1 .CommonName | toJson }}}`))
+	require.NoError(t, err)
+	out, err := tmpl.Render([]byte(`{"CommonName": "abc", "Key": "abc"}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"serialNumber": "ba7816bf8f01cfea", "keyId": "ba:78:16:bf:8f:01:cf:ea:41:41:40:de:5d:ae:22:23:b0:03:61:a3:96:17:7a:9c:b4:10:ff:61:f2:00:15:ad", "legacy": "a9993e364706816aba3e25717850c26c9cd0d89d"}`, string(out))
+
+	tmpl, err = ParseTemplate([]byte(`{{ fingerprint "sha512" .Key }}`))
+	require.NoError(t, err)
+	_, err = tmpl.Render([]byte(`{"Key": "abc"}`))
+	assert.EqualError(t, err, `error executing template: error creating fingerprint: unsupported encoding "sha512"`)
+}
+
+func TestTemplate_keyIDFuncs(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"subjectKeyId": "{{ hexGroup .KeyID }}", "label": "{{ sha1 .CommonName | base32 }}"}`))
+	require.NoError(t, err)
+	out, err := tmpl.Render([]byte(`{"KeyID": "a9993e364706816aba3e25717850c26c9cd0d89d", "CommonName": "abc"}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"subjectKeyId": "A9:99:3E:36:47:06:81:6A:BA:3E:25:71:78:50:C2:6C:9C:D0:D8:9D", "label": "VGMT4NSHA2AWVOR6EVYXQUGCNSONBWE5"}`, string(out))
+
+	_, err = tmpl.Render([]byte(`{"KeyID": "a9993", "CommonName": "abc"}`))
+	assert.EqualError(t, err, `error executing template: error decoding key id: "a9993" has an odd number of hex digits`)
+}
+
+func TestTemplate_indentLines(t *testing.T) {
+	fsys := fstest.MapFS{
+		"ext.tmpl": {Data: []byte("{\n  \"id\": {{ toJson .ID }},\n  \"value\": {{ toPrettyJson .Value | nindentLines 2 | trim }}\n}\n")},
+	}
+	tmpl, err := ParseTemplate([]byte("{\n  \"subject\": {{ toPrettyJson .Subject | indentLines 2 | trim }},\n  \"extensions\": [{{ range $i, $e := .Extensions }}{{ if $i }},{{ end }}{{ include \"ext.tmpl\" $e | nindentLines 4 }}{{ end }}\n  ]\n}"), WithIncludeFS(fsys))
+	require.NoError(t, err)
+
+	data := []byte(`{"Subject": {"commonName": "foo", "organization": ["Acme"]}, "Extensions": [{"ID": "1.2.3", "Value": {"a": [1]}}, {"ID": "1.2.4", "Value": "x"}]}`)
+	require.NoError(t, tmpl.Validate(data))
+	out, err := tmpl.Render(data)
+	require.NoError(t, err)
+	assert.Equal(t, `{
+  "subject": {
+    "commonName": "foo",
+    "organization": [
+      "Acme"
+    ]
+  },
+  "extensions": [
+    {
+      "id": "1.2.3",
+      "value": {
+        "a": [
+          1
+        ]
+      }
+    }
+    ,
+    {
+      "id": "1.2.4",
+      "value": "x"
+    }
+    
+  ]
+}`, string(out))
+
+	tmpl, err = ParseTemplate([]byte(`{"a": {{ .A | nindentLines .Spaces }}}`))
+	require.NoError(t, err)
+	out, err = tmpl.Render([]byte(`{"A": "", "Spaces": 2}`))
+	require.NoError(t, err)
+	assert.Equal(t, "{\"a\": \n  }", string(out))
+	_, err = tmpl.Render([]byte(`{"A": "1", "Spaces": -2}`))
+	assert.EqualError(t, err, "error executing template: error indenting: -2 spaces is negative")
+
+	// The sprig functions only take an int.
+	tmpl, err = ParseTemplate([]byte(`{"a": {{ .A | indent 2 }}, "b": {{ .A | nindent 1 }}}`))
+	require.NoError(t, err)
+	out, err = tmpl.Render([]byte(`{"A": "1\n2"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "{\"a\":   1\n  2, \"b\": \n 1\n 2}", string(out))
+	tmpl, err = ParseTemplate([]byte(`{"a": {{ .A | indent .Spaces }}}`))
+	require.NoError(t, err)
+	_, err = tmpl.Render([]byte(`{"A": "1", "Spaces": 2}`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,84 @@
+package templates
+
+import (
+	"text/template"
+	"text/template/parse"
+)
+
+// walkTree calls fn for node and all its descendants in depth-first order. If
+// fn returns false, the children of the current node are not visited.
+func walkTree(node parse.Node, fn func(parse.Node) bool) {
+	if node == nil || isNilNode(node) || !fn(node) {
+		return
+	}
+
+	switch n := node.(type) {
+	case *parse.ListNode:
+		for _, c := range n.Nodes {
+			walkTree(c, fn)
+		}
+	case *parse.ActionNode:
+		walkTree(n.Pipe, fn)
+	case *parse.IfNode:
+		walkBranch(&n.BranchNode, fn)
+	case *parse.RangeNode:
+		walkBranch(&n.BranchNode, fn)
+	case *parse.WithNode:
+		walkBranch(&n.BranchNode, fn)
+	case *parse.TemplateNode:
+		walkTree(n.Pipe, fn)
+	case *parse.PipeNode:
+		for _, d := range n.Decl {
+			walkTree(d, fn)
+		}
+		for _, c := range n.Cmds {
+			walkTree(c, fn)
+		}
+	case *parse.CommandNode:
+		for _, a := range n.Args {
+			walkTree(a, fn)
+		}
+	case *parse.ChainNode:
+		walkTree(n.Node, fn)
+	}
+}
+
+func walkBranch(n *parse.BranchNode, fn func(parse.Node) bool) {
+	walkTree(n.Pipe, fn)
+	walkTree(n.List, fn)
+	walkTree(n.ElseList, fn)
+}
+
+// isNilNode reports whether node is a typed nil, such as the nil *ListNode
+// used for a branch without an else clause.
+func isNilNode(node parse.Node) bool {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		return n == nil
+	case *parse.PipeNode:
+		return n == nil
+	}
+	return false
+}
+
+// walkTemplates calls walkTree on the root of every template associated with
+// tmpl.
+func walkTemplates(tmpl *template.Template, fn func(parse.Node) bool) {
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			walkTree(t.Tree.Root, fn)
+		}
+	}
+}
+
+// templateTrees returns the parse trees of the templates associated with
+// tmpl, by name.
+func templateTrees(tmpl *template.Template) map[string]*parse.Tree {
+	trees := make(map[string]*parse.Tree)
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			trees[t.Name()] = t.Tree
+		}
+	}
+	return trees
+}
@@ -0,0 +1,166 @@
+package templates
+
+import (
+	"bytes"
+	"text/template/parse"
+)
+
+// delimitedAction is an action in the source of a template, from the start of
+// its left delimiter to the end of its right delimiter, and whether it has the
+// trim markers "{{- " and " -}}".
+type delimitedAction struct {
+	start, end          int
+	trimLeft, trimRight bool
+}
+
+// isTrimSpace reports whether c is white space removed by a trim marker.
+func isTrimSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+// scanActions returns the actions in src delimited by left and right, skipping
+// the delimiters inside strings and comments. It assumes src can be parsed.
+func scanActions(src []byte, left, right string) []delimitedAction {
+	var actions []delimitedAction
+	for i := 0; i < len(src); {
+		start := bytes.Index(src[i:], []byte(left))
+		if start < 0 {
+			break
+		}
+		start += i
+		a := delimitedAction{start: start}
+		j := start + len(left)
+		a.trimLeft = j+1 < len(src) && src[j] == '-' && isTrimSpace(src[j+1])
+		for j < len(src) {
+			switch c := src[j]; {
+			case bytes.HasPrefix(src[j:], []byte(right)):
+				a.trimRight = j >= 2 && src[j-1] == '-' && isTrimSpace(src[j-2]) && j-2 > start+len(left)
+				a.end = j + len(right)
+				j = len(src)
+			case bytes.HasPrefix(src[j:], []byte("/*")):
+				if k := bytes.Index(src[j+2:], []byte("*/")); k >= 0 {
+					j += k + 4
+				} else {
+					j = len(src)
+				}
+			case c == '"' || c == '\'' || c == '`':
+				j++
+				for j < len(src) && src[j] != c {
+					if src[j] == '\\' && c != '`' {
+						j++
+					}
+					j++
+				}
+				j++
+			default:
+				j++
+			}
+		}
+		if a.end == 0 {
+			break
+		}
+		actions = append(actions, a)
+		i = a.end
+	}
+	return actions
+}
+
+// isJSONPunctuation reports whether c is a character of JSON that a value can
+// be next to without white space, like a comma or a brace. A quote is
+// included because joining a value to the end of a string only changes its
+// content.
+func isJSONPunctuation(c byte) bool {
+	switch c {
+	case '{', '}', '[', ']', ',', ':', '"':
+		return true
+	default:
+		return false
+	}
+}
+
+// checkTrimMarkers reports the trim markers that remove the white space between
+// the output of an action and a token of the template text, like the 1 in
+// {{ .Port -}} 1, or the output of another action. The output is then joined
+// to it, which changes the JSON or breaks it depending on the data. outputs
+// are the actions that render output. Trimming the space next to
+// punctuation, like in "a": {{- toJson .A -}} , is always safe and is not
+// reported.
+func (l *linter) checkTrimMarkers(left, right string, outputs []*parse.ActionNode) {
+	actions := scanActions(l.src, left, right)
+	// output returns the action of outputs delimited by a, if any.
+	output := func(a delimitedAction) *parse.ActionNode {
+		for _, n := range outputs {
+			if pos := int(n.Position()); pos >= a.start && pos < a.end {
+				return n
+			}
+		}
+		return nil
+	}
+
+	// joinedTo returns the token of the template text joined to the action
+	// by the trim marker, or the action at the other side. step is -1 for the
+	// left side of the action and 1 for the right side.
+	joinedTo := func(i, step int) (token string, other int, ok bool) {
+		pos := actions[i].end
+		if step < 0 {
+			pos = actions[i].start - 1
+		}
+		trimmed := false
+		for pos >= 0 && pos < len(l.src) && isTrimSpace(l.src[pos]) {
+			pos += step
+			trimmed = true
+		}
+		if !trimmed || pos < 0 || pos >= len(l.src) {
+			return "", -1, false
+		}
+		if j := i + step; j >= 0 && j < len(actions) && pos >= actions[j].start && pos < actions[j].end {
+			return "", j, true
+		}
+		if isJSONPunctuation(l.src[pos]) {
+			return "", -1, false
+		}
+		start, end := pos, pos+1
+		if step < 0 {
+			for start > 0 && end-start < 20 && !isTrimSpace(l.src[start-1]) && !isJSONPunctuation(l.src[start-1]) {
+				start--
+			}
+		} else {
+			for end < len(l.src) && end-start < 20 && !isTrimSpace(l.src[end]) && !isJSONPunctuation(l.src[end]) && !bytes.HasPrefix(l.src[end:], []byte(left)) {
+				end++
+			}
+		}
+		return string(l.src[start:end]), -1, true
+	}
+
+	for i, a := range actions {
+		n := output(a)
+		if n == nil {
+			continue
+		}
+		for _, side := range []struct {
+			trim bool
+			step int
+		}{{a.trimLeft, -1}, {a.trimRight, 1}} {
+			if !side.trim {
+				continue
+			}
+			token, other, ok := joinedTo(i, side.step)
+			switch {
+			case !ok:
+			case other < 0:
+				l.add(n, SeverityWarning, LintWhitespaceTrim, "trim marker of %s joins its output to %q, which can change or break the JSON depending on the data", n, token)
+				l.suggest("remove the trim marker of %s, or separate the values with a comma", n)
+			case side.step < 0 && actions[other].trimRight:
+				// Reported by the other action, if it renders output.
+			default:
+				m := output(actions[other])
+				if m == nil {
+					continue
+				}
+				line, col := position(l.src, int(m.Position()))
+				l.add(n, SeverityWarning, LintWhitespaceTrim, "trim marker of %s joins its output to the output of %s at line %d, column %d, which can change or break the JSON depending on the data", n, m, line, col)
+				l.suggest("remove the trim marker of %s, or separate the values with a comma", n)
+			}
+		}
+	}
+}
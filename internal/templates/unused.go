@@ -0,0 +1,133 @@
+package templates
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+)
+
+// UnusedKeys returns a lint with SeverityWarning and the code LintUnusedKey
+// for every key in data that is not referenced by the template, like the old
+// name of a field that was renamed in the template but not in the data, whose
+// value would be silently ignored. Keys of nested objects are reported with
+// dotted paths, like "subject.province". The position of these lints is the
+// position of the key in data, not in the template.
+//
+// The fields are found statically like in DryRunRender, so the analysis is
+// conservative: values used as a whole, like in {{ toJson .Subject }} or as
+// the argument of a function, use all their keys, and the keys of the values
+// used in range loops are never reported.
+func (t *Template) UnusedKeys(data []byte) ([]Lint, error) {
+	l, err := t.unusedKeys(data)
+	if err != nil {
+		return nil, err
+	}
+	return l.lints, nil
+}
+
+// unusedKeys returns the linter with the lints of UnusedKeys and the fixes
+// suggested for them.
+func (t *Template) unusedKeys(data []byte) (*linter, error) {
+	if t.o.lenientJSON {
+		data = stripJSONExtensions(data)
+	}
+	if err := validateData(data, t.o); err != nil {
+		return nil, err
+	}
+	values, err := unmarshalData(data)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &placeholderScanner{trees: templateTrees(t.tmpl), root: newPlaceholder()}
+	if t.tmpl.Tree != nil {
+		s.scan(t.tmpl.Tree.Root, s.root, map[string]*placeholder{"$": s.root})
+	}
+
+	var offsets map[string]int
+	l := &linter{src: data}
+	s.root.unused(values, "", func(path string) {
+		if offsets == nil {
+			offsets = dataKeyOffsets(data)
+		}
+		l.addAt(offsets[path], SeverityWarning, LintUnusedKey, "key %s is not used by the template", path)
+		l.suggest("remove %s from the data, or rename it to the field used by the template", path)
+	})
+	l.sort()
+	return l, nil
+}
+
+// unused calls fn with the path of the keys in data that are not fields of
+// the placeholder, and looks for more in the objects that are.
+func (p *placeholder) unused(data interface{}, path string, fn func(path string)) {
+	m, ok := data.(map[string]interface{})
+	if !ok || p.whole || p.list || p.object {
+		return
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if f, ok := p.fields[k]; ok {
+			f.unused(m[k], joinPath(path, k), fn)
+		} else {
+			fn(joinPath(path, k))
+		}
+	}
+}
+
+// dataKeyOffsets returns the offset of every key of the objects in data by
+// its path. It assumes data is valid JSON.
+func dataKeyOffsets(data []byte) map[string]int {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	offsets := make(map[string]int)
+	var stack []*jsonPathFrame
+	next := func() {
+		if len(stack) == 0 {
+			return
+		}
+		if top := stack[len(stack)-1]; top.object {
+			top.expectKey = true
+		} else {
+			top.index++
+		}
+	}
+
+	for {
+		path := ""
+		if len(stack) > 0 {
+			path = stack[len(stack)-1].current()
+		}
+		before := dec.InputOffset()
+		tok, err := dec.Token()
+		if err != nil {
+			return offsets
+		}
+
+		if len(stack) > 0 {
+			if top := stack[len(stack)-1]; top.object && top.expectKey {
+				if key, ok := tok.(string); ok {
+					top.key, top.expectKey = key, false
+					offsets[joinPath(top.path, key)] = int(keyOffset(before, dec.InputOffset(), key))
+					continue
+				}
+			}
+		}
+
+		switch tok {
+		case json.Delim('{'):
+			stack = append(stack, &jsonPathFrame{object: true, path: path, expectKey: true})
+		case json.Delim('['):
+			stack = append(stack, &jsonPathFrame{path: path})
+		case json.Delim('}'), json.Delim(']'):
+			stack = stack[:len(stack)-1]
+			next()
+		default:
+			next()
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package templates
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplate_UnusedKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		data    string
+		want    []string
+		wantErr string
+	}{
+		{"ok/none", `{"cn": {{ toJson .CommonName }}}`, `{"CommonName": "foo"}`, nil, ""},
+		{"ok/renamed", `{"cn": {{ toJson .CommonName }}}`, `{"CommonName": "foo", "Name": "bar"}`, []string{"1:23: key Name is not used by the template"}, ""},
+		{"ok/nested", `{"cn": {{ toJson .Subject.CommonName }}}`, "{\n  \"Subject\": {\"CommonName\": \"foo\", \"Province\": \"CA\"},\n  \"my-key\": 1\n}",
+			[]string{"2:36: key Subject.Province is not used by the template", `3:3: key ["my-key"] is not used by the template`}, ""},
+		{"ok/whole", `{"subject": {{ toJson .Subject }}, "sans": {{ .SANs | toJson }}}`, `{"Subject": {"CommonName": "foo"}, "SANs": {"a": 1}}`, nil, ""},
+		{"ok/function", `{"cn": {{ default "foo" .Subject.CommonName | toJson }}, "x": {{ include "x.tmpl" . }}}`, `{"Subject": {"CommonName": "foo"}, "Extra": 1}`, nil, ""},
+		{"ok/dot", `{{ toJson . }}`, `{"Subject": {"CommonName": "foo"}}`, nil, ""},
+		{"ok/with", `{{ with .Subject }}{"cn": {{ toJson .CommonName }}}{{ end }}`, `{"Subject": {"CommonName": "foo", "Country": "US"}}`,
+			[]string{"1:35: key Subject.Country is not used by the template"}, ""},
+		{"ok/if", `{{ if .Subject }}{}{{ end }}`, `{"Subject": {"CommonName": "foo"}}`,
+			[]string{"1:14: key Subject.CommonName is not used by the template"}, ""},
+		{"ok/variables", `{{ $s := .Subject }}{"cn": {{ toJson $s.CommonName }}, "root": {{ toJson $.Root }}}`, `{"Subject": {"CommonName": "foo", "Country": "US"}, "Root": true}`,
+			[]string{"1:35: key Subject.Country is not used by the template"}, ""},
+		{"ok/range", `[{{ range .SANs }}{{ toJson .Value }},{{ end }}null]`, `{"SANs": [{"Value": "foo", "Type": "dns"}], "Labels": {}}`,
+			[]string{"1:45: key Labels is not used by the template"}, ""},
+		{"ok/range-map", `{{ range $k, $v := .Labels }}{{ $k }}{{ end }}{}`, `{"Labels": {"a": "b"}}`, nil, ""},
+		{"ok/template", `{{ define "cn" }}{{ toJson .CommonName }}{{ end }}{"cn": {{ template "cn" .Subject }}}`, `{"Subject": {"CommonName": "foo", "Country": "US"}}`,
+			[]string{"1:35: key Subject.Country is not used by the template"}, ""},
+		{"ok/not-object", `{"cn": {{ toJson .CommonName }}}`, `["foo"]`, nil, ""},
+		{"ok/empty", `{}`, ``, nil, ""},
+		{"fail/data", `{}`, `{"Subject"}`, nil, `error validating json template data: invalid JSON at Subject (line 1, column 11): invalid character '}' after object key`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseTemplate([]byte(tt.text))
+			require.NoError(t, err)
+			lints, err := tmpl.UnusedKeys([]byte(tt.data))
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			var got []string
+			for _, l := range lints {
+				assert.Equal(t, SeverityWarning, l.Severity)
+				assert.Equal(t, LintUnusedKey, l.Code)
+				got = append(got, fmt.Sprintf("%d:%d: %s", l.Line, l.Column, l.Message))
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
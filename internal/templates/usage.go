@@ -0,0 +1,92 @@
+package templates
+
+import (
+	"fmt"
+	"strings"
+)
+
+// keyUsageNames are the key usages supported in the "keyUsage" of a
+// certificate template, in the order of RFC 5280.
+var keyUsageNames = []string{
+	"digitalSignature", "contentCommitment", "keyEncipherment",
+	"dataEncipherment", "keyAgreement", "certSign", "crlSign", "encipherOnly",
+	"decipherOnly",
+}
+
+// extKeyUsageNames are the extended key usages supported in the
+// "extKeyUsage" of a certificate template.
+var extKeyUsageNames = []string{
+	"any", "serverAuth", "clientAuth", "codeSigning", "emailProtection",
+	"ipsecEndSystem", "ipsecTunnel", "ipsecUser", "timeStamping", "ocspSigning",
+	"microsoftServerGatedCrypto", "netscapeServerGatedCrypto",
+	"microsoftCommercialCodeSigning", "microsoftKernelCodeSigning",
+}
+
+// usageName returns the name in names matching s like x509util does, ignoring
+// the case and the underscores, so "digital_signature" is "digitalSignature".
+func usageName(s string, names []string) (string, bool) {
+	key := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(s)), "_", "")
+	for _, name := range names {
+		if strings.ToLower(name) == key {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// usages returns the usages in v, a string or a list of strings, with the
+// names in names, like "serverAuth" for "ServerAuth". A string returns a
+// string and a list returns a list. kind is the name of the usages in the
+// errors.
+func usages(kind string, names []string, v interface{}) (interface{}, error) {
+	normalize := func(s string) (string, error) {
+		name, ok := usageName(s, names)
+		if !ok {
+			return "", fmt.Errorf("error validating %s: unknown %s %q, valid values are %s", kind, kind, s, strings.Join(names, ", "))
+		}
+		return name, nil
+	}
+
+	switch t := v.(type) {
+	case string:
+		return normalize(t)
+	case []string:
+		list := make([]string, len(t))
+		for i, s := range t {
+			name, err := normalize(s)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = name
+		}
+		return list, nil
+	case []interface{}:
+		list := make([]string, len(t))
+		for i, e := range t {
+			s, ok := e.(string)
+			if !ok {
+				return nil, fmt.Errorf("error validating %s: element %d of type %T is not a string", kind, i, e)
+			}
+			name, err := normalize(s)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = name
+		}
+		return list, nil
+	default:
+		return nil, fmt.Errorf("error validating %s: %v of type %T is not a string or a list of strings", kind, v, v)
+	}
+}
+
+// keyUsage returns the key usages in v, a string or a list of strings, with
+// the names used in certificate templates, like "digitalSignature".
+func keyUsage(v interface{}) (interface{}, error) {
+	return usages("keyUsage", keyUsageNames, v)
+}
+
+// extKeyUsage returns the extended key usages in v, a string or a list of
+// strings, with the names used in certificate templates, like "serverAuth".
+func extKeyUsage(v interface{}) (interface{}, error) {
+	return usages("extKeyUsage", extKeyUsageNames, v)
+}
@@ -0,0 +1,81 @@
+package templates
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_keyUsage(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       interface{}
+		want    interface{}
+		wantErr string
+	}{
+		{"ok", "digitalSignature", "digitalSignature", ""},
+		{"ok/case", "DigitalSignature", "digitalSignature", ""},
+		{"ok/lower", "crlsign", "crlSign", ""},
+		{"ok/underscores", "key_encipherment", "keyEncipherment", ""},
+		{"ok/list", []interface{}{"CertSign", "CRLSign"}, []string{"certSign", "crlSign"}, ""},
+		{"ok/strings", []string{"keyAgreement"}, []string{"keyAgreement"}, ""},
+		{"ok/empty", []interface{}{}, []string{}, ""},
+		{"fail/unknown", "digitalSignatures", nil, `error validating keyUsage: unknown keyUsage "digitalSignatures", valid values are ` + strings.Join(keyUsageNames, ", ")},
+		{"fail/ext", "serverAuth", nil, `error validating keyUsage: unknown keyUsage "serverAuth", valid values are ` + strings.Join(keyUsageNames, ", ")},
+		{"fail/list", []interface{}{"certSign", "crlSing"}, nil, `error validating keyUsage: unknown keyUsage "crlSing", valid values are ` + strings.Join(keyUsageNames, ", ")},
+		{"fail/element", []interface{}{"certSign", 1.0}, nil, "error validating keyUsage: element 1 of type float64 is not a string"},
+		{"fail/type", 1, nil, "error validating keyUsage: 1 of type int is not a string or a list of strings"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := keyUsage(tt.v)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_extKeyUsage(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       interface{}
+		want    interface{}
+		wantErr string
+	}{
+		{"ok", "serverAuth", "serverAuth", ""},
+		{"ok/case", "ServerAuth", "serverAuth", ""},
+		{"ok/upper", "OCSPSIGNING", "ocspSigning", ""},
+		{"ok/list", []interface{}{"serverAuth", "client_auth"}, []string{"serverAuth", "clientAuth"}, ""},
+		{"fail/typo", "serverAth", nil, `error validating extKeyUsage: unknown extKeyUsage "serverAth", valid values are ` + strings.Join(extKeyUsageNames, ", ")},
+		{"fail/list", []string{"codeSigning", "digitalSignature"}, nil, `error validating extKeyUsage: unknown extKeyUsage "digitalSignature", valid values are ` + strings.Join(extKeyUsageNames, ", ")},
+		{"fail/nil", nil, nil, "error validating extKeyUsage: <nil> of type <nil> is not a string or a list of strings"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := extKeyUsage(tt.v)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestTemplate_keyUsage(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"keyUsage": {{ keyUsage .KeyUsage | toJson }}, "extKeyUsage": {{ extKeyUsage .ExtKeyUsage | toJson }}}`))
+	require.NoError(t, err)
+	out, err := tmpl.Render([]byte(`{"KeyUsage": ["DigitalSignature", "key_encipherment"], "ExtKeyUsage": "ServerAuth"}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"keyUsage": ["digitalSignature","keyEncipherment"], "extKeyUsage": "serverAuth"}`, string(out))
+
+	err = tmpl.Validate([]byte(`{"KeyUsage": "digitalSignature", "ExtKeyUsage": ["serverAth"]}`))
+	assert.EqualError(t, err, `error executing template: error validating extKeyUsage: unknown extKeyUsage "serverAth", valid values are `+strings.Join(extKeyUsageNames, ", "))
+}
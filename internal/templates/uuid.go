@@ -0,0 +1,71 @@
+package templates
+
+import (
+	"crypto/sha1" //nolint:gosec // UUID version 5 by RFC 4122
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// uuidNamespaces are the name spaces defined by RFC 4122, appendix C, that can
+// be used by name in "uuidV5".
+var uuidNamespaces = map[string]string{
+	"dns":  "6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+	"url":  "6ba7b811-9dad-11d1-80b4-00c04fd430c8",
+	"oid":  "6ba7b812-9dad-11d1-80b4-00c04fd430c8",
+	"x500": "6ba7b814-9dad-11d1-80b4-00c04fd430c8",
+}
+
+// parseUUID returns the 16 bytes of the UUID s, in the standard form
+// "f81d4fae-7dec-11d0-a765-00a0c91e6bf6", in upper or lower case and
+// optionally with the "urn:uuid:" prefix.
+func parseUUID(s string) ([]byte, bool) {
+	s = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(s)), "urn:uuid:")
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return nil, false
+	}
+	b, err := hex.DecodeString(s[:8] + s[9:13] + s[14:18] + s[19:23] + s[24:])
+	if err != nil {
+		return nil, false
+	}
+	return b, true
+}
+
+// formatUUID returns the 16 bytes b as a UUID with the given version and the
+// variant of RFC 4122, in the standard form.
+func formatUUID(b []byte, version byte) string {
+	b[6] = b[6]&0x0f | version<<4
+	b[8] = b[8]&0x3f | 0x80
+	s := hex.EncodeToString(b)
+	return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
+
+// uuidV5 returns the version 5 UUID of RFC 4122 of name in the given name
+// space, the SHA-1 hash of the name space and the name. The name space is a
+// UUID or the name of one of the name spaces of RFC 4122, "dns", "url", "oid"
+// or "x500". The name is hashed like in sha256Sum, so the same name space and
+// name always return the same UUID.
+func uuidV5(namespace string, name interface{}) (string, error) {
+	if id, ok := uuidNamespaces[strings.ToLower(namespace)]; ok {
+		namespace = id
+	}
+	ns, ok := parseUUID(namespace)
+	if !ok {
+		return "", fmt.Errorf("error generating uuid: invalid namespace %q, it must be a UUID or one of dns, url, oid or x500", namespace)
+	}
+	h := sha1.New() //nolint:gosec // UUID version 5 by RFC 4122
+	h.Write(ns)
+	h.Write(hashBytes(name))
+	return formatUUID(h.Sum(nil)[:16], 5), nil
+}
+
+// uuidV4 returns a random UUID, version 4 of RFC 4122, with the random bytes
+// read from r.
+func uuidV4(r io.Reader) (string, error) {
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", fmt.Errorf("error generating uuid: %w", err)
+	}
+	return formatUUID(b, 4), nil
+}
@@ -0,0 +1,79 @@
+package templates
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_uuidV5(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace string
+		v         interface{}
+		want      string
+		wantErr   string
+	}{
+		{"ok/dns", "dns", "www.example.com", "2ed6657d-e927-568b-95e1-2665a8aea6a2", ""},
+		{"ok/dns-uuid", "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "www.example.com", "2ed6657d-e927-568b-95e1-2665a8aea6a2", ""},
+		{"ok/dns-upper", "DNS", []byte("www.example.com"), "2ed6657d-e927-568b-95e1-2665a8aea6a2", ""},
+		{"ok/url", "url", "spiffe://example.org/web", "85adbea5-f3f8-5f15-93d3-b07a0a85c9e9", ""},
+		{"ok/custom", "F81D4FAE-7DEC-11D0-A765-00A0C91E6BF6", "foo", "b68fa5f4-25c1-5b31-b9a9-8bfa3952efc5", ""},
+		{"ok/urn", "urn:uuid:f81d4fae-7dec-11d0-a765-00a0c91e6bf6", "foo", "b68fa5f4-25c1-5b31-b9a9-8bfa3952efc5", ""},
+		{"fail/namespace", "example", "foo", "", `error generating uuid: invalid namespace "example", it must be a UUID or one of dns, url, oid or x500`},
+		{"fail/short", "f81d4fae-7dec-11d0-a765-00a0c91e6bf", "foo", "", `error generating uuid: invalid namespace "f81d4fae-7dec-11d0-a765-00a0c91e6bf", it must be a UUID or one of dns, url, oid or x500`},
+		{"fail/hex", "g81d4fae-7dec-11d0-a765-00a0c91e6bf6", "foo", "", `error generating uuid: invalid namespace "g81d4fae-7dec-11d0-a765-00a0c91e6bf6", it must be a UUID or one of dns, url, oid or x500`},
+		{"fail/hyphens", "f81d4fae7dec-11d0-a765-00a0c91e6bf6-", "foo", "", `error generating uuid: invalid namespace "f81d4fae7dec-11d0-a765-00a0c91e6bf6-", it must be a UUID or one of dns, url, oid or x500`},
+		{"fail/empty", "", "foo", "", `error generating uuid: invalid namespace "", it must be a UUID or one of dns, url, oid or x500`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := uuidV5(tt.namespace, tt.v)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_uuidV4(t *testing.T) {
+	got, err := uuidV4(bytes.NewReader([]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}))
+	require.NoError(t, err)
+	assert.Equal(t, "00010203-0405-4607-8809-0a0b0c0d0e0f", got)
+
+	_, err = uuidV4(bytes.NewReader([]byte{1, 2, 3}))
+	assert.EqualError(t, err, "error generating uuid: unexpected EOF")
+}
+
+func TestTemplate_uuid(t *testing.T) {
+	text := []byte(`{"v5": {{ uuidV5 "dns" .Name | toJson }}, "v4": {{ uuidV4 | toJson }}}`)
+	data := []byte(`{"Name": "www.example.com"}`)
+
+	// Version 5 UUIDs are the same in every render.
+	tmpl, err := ParseTemplate(text, WithRandReader(bytes.NewReader(bytes.Repeat([]byte{0xff}, 32))))
+	require.NoError(t, err)
+	out, err := tmpl.Render(data)
+	require.NoError(t, err)
+	assert.Equal(t, `{"v5": "2ed6657d-e927-568b-95e1-2665a8aea6a2", "v4": "ffffffff-ffff-4fff-bfff-ffffffffffff"}`, string(out))
+
+	tmpl, err = ParseTemplate(text)
+	require.NoError(t, err)
+	v4 := regexp.MustCompile(`"v4": "[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}"`)
+	first, err := tmpl.Render(data)
+	require.NoError(t, err)
+	second, err := tmpl.Render(data)
+	require.NoError(t, err)
+	assert.Regexp(t, v4, string(first))
+	assert.Regexp(t, v4, string(second))
+	assert.NotEqual(t, first, second)
+	assert.Equal(t, first[:49], second[:49])
+
+	err = ValidateTemplateWithData([]byte(`{"id": {{ uuidV5 .NS "foo" | toJson }}}`), []byte(`{"NS": "bad"}`))
+	assert.EqualError(t, err, `error executing template: error generating uuid: invalid namespace "bad", it must be a UUID or one of dns, url, oid or x500`)
+}
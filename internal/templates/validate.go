@@ -1,10 +1,17 @@
 package templates
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"text/template"
+	"unicode/utf8"
 )
 
 // ValidateTemplate validates a text template results in valid JSON
@@ -12,34 +19,491 @@ import (
 // results in invalid JSON, the template is invalid. When the template
 // is valid, it can be used safely. A valid template can still result
 // in invalid JSON when non-empty template data is provided.
-func ValidateTemplate(data []byte) error {
+//
+// With the WithValidateDefinitions option, each template defined in the text
+// with {{ define }} is also executed with empty template data, and it's
+// invalid if it fails or if its output is not valid JSON. The failures of all
+// the definitions are returned in an Errors sorted by name, each one a
+// TemplateError with the Name of the definition and a message starting with
+// it, like `template "x509": error validating json template data: ...`, so
+// files with several templates show which ones are broken.
+//
+// With the WithDelims option, the template is parsed with the given
+// delimiters instead of "{{" and "}}", and with the WithDeniedFuncs option,
+// the template is invalid if it uses any of the denied functions.
+func ValidateTemplate(data []byte, opts ...Option) error {
 	if len(data) == 0 {
 		return nil
 	}
 
-	// get the default supported functions
-	var failMessage string
-	funcMap := GetFuncMap(&failMessage)
+	t, err := ParseTemplate(data, opts...)
+	if err != nil || !t.o.validateDefinitions {
+		return err
+	}
+	return t.validateDefinitions()
+}
 
-	// prepare the template with our template functions
-	_, err := template.New("template").Funcs(funcMap).Parse(string(data))
-	if err != nil {
-		return fmt.Errorf("error parsing template: %w", err)
+// validateDefinitions validates each template defined in t with {{ define }}
+// like Validate does with empty template data.
+func (t *Template) validateDefinitions() error {
+	var names []string
+	for _, d := range t.tmpl.Templates() {
+		if d.Tree != nil && d.Name() != t.tmpl.Name() {
+			names = append(names, d.Name())
+		}
 	}
+	sort.Strings(names)
 
-	return nil
+	var errs Errors
+	for _, name := range names {
+		out, m, err := t.render(context.Background(), name, nil, nil)
+		if err == nil {
+			err = validateOutput(out, t.text, m, t.o)
+		}
+		if err == nil {
+			continue
+		}
+		var te *TemplateError
+		if !errors.As(err, &te) {
+			te = newTemplateError(ExecError, err, err.Error())
+		}
+		te.Name = name
+		te.msg = fmt.Sprintf("template %q: %s", name, te.msg)
+		errs = append(errs, te)
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// ValidateTemplateWithData validates that a text template results in valid
+// JSON when it's executed with the given template data. The template data can
+// be any JSON value, usually an object, and an empty template data is treated
+// as an empty object. The output can be any JSON value too, like an array.
+// Errors executing the template are reported as "error executing template",
+// while invalid JSON output is reported as "error validating json template
+// data" and includes the position in the template that caused it.
+//
+// With the WithStrict option, references to keys not present in the data are
+// reported as errors instead of being rendered as "<no value>", with the
+// WithMaxOutputBytes option, the execution fails if the output is too large,
+// with the WithRejectEmptyOutput option, if there's no output, with the
+// WithAllowedTopLevelKeys option, if the output has an unknown top-level key,
+// with the WithRangeCheck option, if a number is out of range, with the
+// WithRejectNoValue option, if it contains "<no value>", with the
+// WithRejectInvalidUTF8 option, if it's not valid UTF-8, with the
+// WithOutputValidators option, if a validator of the caller rejects it, and
+// with the WithTimeout option, if it takes too long.
+func ValidateTemplateWithData(text, data []byte, opts ...Option) error {
+	if len(text) == 0 {
+		return nil
+	}
+
+	t, err := ParseTemplate(text, opts...)
+	if err != nil {
+		return err
+	}
+	return t.Validate(data)
 }
 
 // ValidateTemplateData validates that template data is
-// valid JSON.
-func ValidateTemplateData(data []byte) error {
+// valid JSON. Syntax errors include the path of the value where the error was
+// found, like "subject.names[2].type", and its line and column.
+//
+// With the WithRejectDuplicateKeys option, objects with duplicate keys are
+// also rejected, and with the WithLenientJSON option, comments and trailing
+// commas are allowed. With the WithAllErrors option, up to 10 syntax errors
+// are reported at once in an Errors. NaN and infinite numbers are rejected,
+// and so are documents nested more than WithMaxDepth levels, 100 by default.
+func ValidateTemplateData(data []byte, opts ...Option) error {
+	o := newOptions(opts)
+	if o.lenientJSON {
+		data = stripJSONExtensions(data)
+	}
+	return validateData(data, o)
+}
+
+// validateData validates the template data without preprocessing it.
+func validateData(data []byte, o *options) error {
 	if len(data) == 0 {
 		return nil
 	}
 
 	if ok := json.Valid(data); !ok {
-		return errors.New("error validating json template data")
+		te, offset := dataSyntaxError(data)
+		if !o.allErrors || offset < 0 {
+			return te
+		}
+
+		// Replace the invalid values and look for more errors, until the data
+		// is valid or it cannot be fixed.
+		errs := Errors{te}
+		for len(errs) < maxDataErrors {
+			fixed, ok := recoverJSON(data, offset)
+			if !ok || json.Valid(fixed) {
+				break
+			}
+			next, nextOffset := dataSyntaxError(fixed)
+			if nextOffset <= offset {
+				break
+			}
+			errs = append(errs, next)
+			data, offset = fixed, nextOffset
+		}
+		if len(errs) == 1 {
+			return errs[0]
+		}
+		return errs
+	}
+
+	return checkJSON(data, data, nil, o)
+}
+
+// dataSyntaxError returns the error for invalid template data, with the path
+// and position of the error, and the offset of the byte that caused it, or -1
+// if the error is not a syntax error.
+func dataSyntaxError(data []byte) (*TemplateError, int) {
+	var v interface{}
+	path := jsonErrorPath(data)
+	err := json.Unmarshal(data, &v)
+	var syntaxError *json.SyntaxError
+	if !errors.As(err, &syntaxError) {
+		return newTemplateError(JSONError, err, "error validating json template data: "+err.Error()), -1
+	}
+	offset := int(syntaxError.Offset) - 1
+	if tok := nonFiniteToken(data, offset); tok != "" {
+		err = fmt.Errorf("invalid JSON at %s (%s): %s is not a valid JSON number: %w", displayPath(path), locate(offset, data, nil), tok, err)
+	} else {
+		err = fmt.Errorf("invalid JSON at %s (%s): %w", displayPath(path), locate(offset, data, nil), err)
+	}
+	te := newTemplateError(JSONError, err, "error validating json template data: "+err.Error())
+	te.Path = path
+	te.setPosition(offset, data, nil)
+	return te, offset
+}
+
+// NormalizeJSON returns the rendered output of a template in a normalized
+// form, so two semantically identical outputs can be compared or diffed. The
+// keys of the objects are sorted, the document is indented with two spaces,
+// and there's a new line at the end. Numbers are written as they are in the
+// input, for example 1.0 is not changed to 1, and if an object has duplicate
+// keys, the last one is used.
+func NormalizeJSON(rendered []byte) ([]byte, error) {
+	if !json.Valid(rendered) {
+		var v interface{}
+		err := enrichJSONError(json.Unmarshal(rendered, &v), rendered, nil)
+		return nil, newTemplateError(JSONError, err, "error normalizing json: "+err.Error())
+	}
+
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(rendered))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, newTemplateError(JSONError, err, "error normalizing json: "+err.Error())
+	}
+
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return nil, newTemplateError(JSONError, err, "error normalizing json: "+err.Error())
+	}
+	return buf.Bytes(), nil
+}
+
+// validateOutput validates that the rendered output of a template is valid
+// JSON. The sourceMap m is used to report the position of errors in the
+// template text src.
+func validateOutput(out, src []byte, m *sourceMap, o *options) error {
+	if o.rejectEmptyOutput && len(bytes.TrimSpace(out)) == 0 {
+		err := errors.New("template produced no output")
+		return newTemplateError(JSONError, err, "error validating json template data: "+err.Error())
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	if o.rejectNoValue {
+		if err := checkNoValue(out, src, m); err != nil {
+			return err
+		}
+	}
+	if o.rejectInvalidUTF8 {
+		if err := checkUTF8(out, src, m); err != nil {
+			return err
+		}
+	}
+
+	if ok := json.Valid(out); !ok {
+		var v interface{}
+		err := json.Unmarshal(out, &v)
+		var syntaxError *json.SyntaxError
+		isSyntaxError := errors.As(err, &syntaxError)
+		err = enrichJSONError(err, src, m)
+		te := newTemplateError(JSONError, err, "error validating json template data: "+err.Error())
+		if isSyntaxError {
+			te.setPosition(syntaxErrorOffset(syntaxError), src, m)
+		}
+		return te
+	}
+
+	if err := checkJSON(out, src, m, o); err != nil {
+		return err
+	}
+
+	// The template data is not a certificate, so only the output is checked
+	// against the profile.
+	if o.profile != 0 {
+		if err := checkProfile(out, src, m, o); err != nil {
+			return err
+		}
+	}
+	return runOutputValidators(out, o.outputValidators)
+}
+
+// runOutputValidators runs all the validators added with WithOutputValidators
+// on the valid JSON output out, and returns a SchemaError for each one that
+// fails.
+func runOutputValidators(out []byte, validators []func([]byte) error) error {
+	var errs Errors
+	for _, fn := range validators {
+		if err := fn(out); err != nil {
+			errs = append(errs, newTemplateError(SchemaError, err, "error validating json template data: "+err.Error()))
+		}
+	}
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return errs
+	}
+}
+
+// noValue is the text rendered by text/template for a missing key.
+const noValue = "<no value>"
+
+// maxNoValueErrors is the maximum number of occurrences of noValue reported by
+// checkNoValue.
+const maxNoValueErrors = 10
+
+// checkNoValue returns a JSONError for each occurrence of noValue in the
+// output out, with the position in the template src of the action that
+// rendered it, using m like in locate.
+func checkNoValue(out, src []byte, m *sourceMap) error {
+	n := bytes.Count(out, []byte(noValue))
+	if n == 0 {
+		return nil
+	}
+	var errs Errors
+	for i, offset := 0, 0; i < n && i < maxNoValueErrors; i++ {
+		offset += bytes.Index(out[offset:], []byte(noValue))
+		// The text is rendered by an action, so its position is the one of
+		// the action even if the offset is not at its start.
+		where := locate(offset, src, m)
+		if m != nil {
+			if pos, _ := m.lookup(offset); pos >= 0 {
+				line, col := position(src, pos)
+				where = fmt.Sprintf("template line %d, column %d", line, col)
+			}
+		}
+		err := fmt.Errorf("output contains %s at %s (%d of %d)", noValue, where, i+1, n)
+		te := newTemplateError(JSONError, err, "error validating json template data: "+err.Error())
+		te.setPosition(offset, src, m)
+		errs = append(errs, te)
+		offset += len(noValue)
+	}
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return errs
+}
+
+// checkUTF8 returns a JSONError for the first invalid UTF-8 sequence in the
+// output out, with its position in the template src using m like in locate.
+func checkUTF8(out, src []byte, m *sourceMap) error {
+	if utf8.Valid(out) {
+		return nil
+	}
+	offset := 0
+	for offset < len(out) {
+		r, size := utf8.DecodeRune(out[offset:])
+		if r == utf8.RuneError && size == 1 {
+			break
+		}
+		offset += size
+	}
+	err := fmt.Errorf("output contains invalid UTF-8 at %s: invalid byte 0x%02x", locate(offset, src, m), out[offset])
+	te := newTemplateError(JSONError, err, "error validating json template data: "+err.Error())
+	te.setPosition(offset, src, m)
+	return te
+}
+
+// checkJSON runs the additional checks enabled in the options on the valid
+// JSON document data. The position of the errors is reported using src and m
+// like in locate.
+func checkJSON(data, src []byte, m *sourceMap, o *options) error {
+	maxDepth := o.maxDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxDepth
+	}
+	if offset := exceedsDepth(data, maxDepth); offset >= 0 {
+		// The location in the output includes the offset.
+		at := fmt.Sprintf("offset %d (%s)", offset, locate(offset, src, m))
+		if m != nil {
+			at = locate(offset, src, m)
+		}
+		err := fmt.Errorf("maximum nesting depth of %d exceeded at %s", maxDepth, at)
+		te := newTemplateError(JSONError, err, "error validating json template data: "+err.Error())
+		te.setPosition(offset, src, m)
+		return te
+	}
+
+	if o.allowedKeys != nil {
+		if err := checkTopLevelKeys(data, src, m, o.allowedKeys); err != nil {
+			return err
+		}
 	}
 
+	if o.ranges != nil {
+		if err := checkRanges(data, src, m, o.ranges); err != nil {
+			return err
+		}
+	}
+
+	if !o.rejectDuplicateKeys {
+		return nil
+	}
+
+	if err := scanJSON(bytes.NewReader(data), o); err != nil {
+		var scanError *jsonScanError
+		if !errors.As(err, &scanError) {
+			return newTemplateError(JSONError, err, "error validating json template data: "+err.Error())
+		}
+		err = fmt.Errorf("%w at %s", scanError, locate(int(scanError.offset), src, m))
+		te := newTemplateError(JSONError, err, "error validating json template data: "+err.Error())
+		te.setPosition(int(scanError.offset), src, m)
+		return te
+	}
 	return nil
 }
+
+// enrichJSONError adds position information to JSON syntax errors found in
+// the rendered output of a template. Offsets reported by encoding/json point
+// into the rendered output, so if a sourceMap is available, the offset is
+// translated back to a line and column in the template source. Errors
+// unmarshaling a value into a Go type also get the path of the field, the type
+// expected and the kind of JSON value found. Any other error is returned as it
+// is.
+func enrichJSONError(err error, src []byte, m *sourceMap) error {
+	var syntaxError *json.SyntaxError
+	if errors.As(err, &syntaxError) {
+		return fmt.Errorf("invalid JSON at %s: %w", locate(syntaxErrorOffset(syntaxError), src, m), err)
+	}
+
+	var typeError *json.UnmarshalTypeError
+	if errors.As(err, &typeError) {
+		// The offset is right after the value, or after the opening bracket
+		// of objects and arrays.
+		msg := fmt.Sprintf("expected %s, got %s", typeError.Type, typeError.Value)
+		if typeError.Field != "" {
+			msg = fmt.Sprintf("field %s: %s", fieldPath(typeError.Field), msg)
+		}
+		return &jsonTypeError{
+			msg: fmt.Sprintf("invalid JSON at %s: %s", locate(int(typeError.Offset)-1, src, m), msg),
+			err: err,
+		}
+	}
+
+	return err
+}
+
+// syntaxErrorOffset returns the offset of the byte that caused a JSON syntax
+// error. The offset of the error is the number of bytes read before it, so
+// it's the last byte read, or the end of the input if it ended unexpectedly.
+func syntaxErrorOffset(err *json.SyntaxError) int {
+	if err.Error() == "unexpected end of JSON input" {
+		return int(err.Offset)
+	}
+	return int(err.Offset) - 1
+}
+
+// fieldPath converts the dotted path of a json.UnmarshalTypeError, like
+// "subject.names.2.type", to a path like "subject.names[2].type".
+func fieldPath(field string) string {
+	parts := strings.Split(field, ".")
+	var sb strings.Builder
+	for i, p := range parts {
+		if _, err := strconv.Atoi(p); err == nil && i > 0 {
+			sb.WriteString("[" + p + "]")
+			continue
+		}
+		if i > 0 {
+			sb.WriteByte('.')
+		}
+		sb.WriteString(p)
+	}
+	return sb.String()
+}
+
+// jsonTypeError is the error returned by enrichJSONError for a
+// json.UnmarshalTypeError. It replaces the message of the original error,
+// which is kept as the cause.
+type jsonTypeError struct {
+	msg string
+	err error
+}
+
+func (e *jsonTypeError) Error() string {
+	return e.msg
+}
+
+func (e *jsonTypeError) Unwrap() error {
+	return e.err
+}
+
+// locate returns a description of the position of the byte at offset. If a
+// sourceMap is given, offset is in the rendered output of the template src,
+// and the position is translated to a line and column in src. If there's no
+// sourceMap, offset is directly in src.
+func locate(offset int, src []byte, m *sourceMap) string {
+	if offset < 0 {
+		offset = 0
+	}
+	if m == nil {
+		if src == nil {
+			return fmt.Sprintf("offset %d", offset)
+		}
+		line, col := position(src, offset)
+		return fmt.Sprintf("line %d, column %d", line, col)
+	}
+
+	pos, exact := m.lookup(offset)
+	switch {
+	case pos < 0:
+		return fmt.Sprintf("offset %d", offset)
+	case exact:
+		line, col := position(src, pos)
+		return fmt.Sprintf("template line %d, column %d", line, col)
+	default:
+		line, col := position(src, pos)
+		return fmt.Sprintf("offset %d, near template line %d, column %d", offset, line, col)
+	}
+}
+
+var missingKeyRegexp = regexp.MustCompile(`at <([^>]*)>: map has no entry for key "([^"]*)"`)
+
+// parseMissingKey returns the field path and the key of a missing key error
+// reported by a template executed with the option "missingkey=error".
+func parseMissingKey(err error) (path, key string, ok bool) {
+	var execError template.ExecError
+	if !errors.As(err, &execError) {
+		return "", "", false
+	}
+	if m := missingKeyRegexp.FindStringSubmatch(execError.Error()); m != nil {
+		return m[1], m[2], true
+	}
+	return "", "", false
+}
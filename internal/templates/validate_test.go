@@ -1,10 +1,16 @@
 package templates
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
+	"strings"
 	"testing"
+	"text/template"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestValidateTemplate(t *testing.T) {
@@ -204,6 +210,55 @@ func TestValidateTemplate(t *testing.T) {
 	}
 }
 
+func TestValidateTemplate_definitions(t *testing.T) {
+	text := `{{ define "ssh" }}{"principals": {{ toJson .Principals }}}{{ end }}
+{{ define "x509" }}{
+  "subject": {{ toJson .Subject }},
+}{{ end }}
+{{ define "fails" }}{{ fail "not supported" }}{{ end }}
+{{ define "blank" }}{{ end }}`
+
+	// The definitions are only parsed by default.
+	assert.NoError(t, ValidateTemplate([]byte(text)))
+
+	err := ValidateTemplate([]byte(text), WithValidateDefinitions(true))
+	var errs Errors
+	require.True(t, errors.As(err, &errs))
+	require.Len(t, errs, 2)
+	assert.EqualError(t, err, `template "fails": error executing template: not supported; `+
+		`template "x509": error validating json template data: invalid JSON at template line 4, column 1: invalid character '}' looking for beginning of object key string`)
+
+	var te *TemplateError
+	if assert.True(t, errors.As(errs[0], &te)) {
+		assert.Equal(t, "fails", te.Name)
+		assert.Equal(t, ExecError, te.Kind)
+	}
+	if assert.True(t, errors.As(errs[1], &te)) {
+		assert.Equal(t, "x509", te.Name)
+		assert.Equal(t, JSONError, te.Kind)
+		assert.Equal(t, 4, te.Line)
+		assert.Equal(t, 1, te.Column)
+	}
+
+	// The definitions are valid, and the main template is only parsed.
+	assert.NoError(t, ValidateTemplate([]byte(`{{ define "ssh" }}{"principals": {{ toJson .Principals }}}{{ end }}{{ template "ssh" . }}`), WithValidateDefinitions(true)))
+	assert.NoError(t, ValidateTemplate([]byte(`{{ define "cn" }}{{ toJson .CommonName }}{{ end }}{"cn": {{ template "cn" .Subject }}`), WithValidateDefinitions(true)))
+}
+
+func TestValidateTemplate_partials(t *testing.T) {
+	// Partials that render fragments of JSON, or read nested fields, are
+	// valid.
+	text := []byte(`{{ define "ku" }}"keyUsage": ["digitalSignature"]{{ end }}
+{{ define "cr" }}{{ toJson .Insecure.CR.x }}{{ end }}
+{"subject": {"commonName": {{ toJson .CN }}}, {{ template "ku" }}, "x": {{ template "cr" . }}}`)
+	assert.NoError(t, ValidateTemplate(text))
+	assert.NoError(t, ValidateTemplateWithData(text, []byte(`{"CN": "foo", "Insecure": {"CR": {"x": 1}}}`)))
+
+	// They are not complete JSON documents.
+	err := ValidateTemplate(text, WithValidateDefinitions(true))
+	assert.EqualError(t, err, `template "ku": error validating json template data: invalid JSON at template line 1, column 28: invalid character ':' after top-level value`)
+}
+
 func TestValidateTemplateData(t *testing.T) {
 	tests := []struct {
 		name string
@@ -235,7 +290,7 @@ func TestValidateTemplateData(t *testing.T) {
 				"x": 1
 				"y": 2
 			}`),
-			err: errors.New("error validating json template data"),
+			err: errors.New(`error validating json template data: invalid JSON at x (line 3, column 5): invalid character '"' after object key:value pair`),
 		},
 	}
 	for _, tt := range tests {
@@ -251,3 +306,668 @@ func TestValidateTemplateData(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateTemplateData_path(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		path string
+		err  string
+	}{
+		{"nested", `{"subject": {"names": [{"type": "2.5.4.3"}, {"type": "2.5.4.6"}, {"type": }]}}`, "subject.names[2].type", `invalid JSON at subject.names[2].type (line 1, column 75): invalid character '}' looking for beginning of value`},
+		{"array", `{"sans": ["foo.com", "bar.com" "zar.com"]}`, "sans[2]", `invalid JSON at sans[2] (line 1, column 32): invalid character '"' after array element`},
+		{"array-of-arrays", `[[1, 2], [3, x]]`, "[1][1]", `invalid JSON at [1][1] (line 1, column 14): invalid character 'x' looking for beginning of value`},
+		{"quoted-key", `{"extra names": {"a-b": tru}}`, `["extra names"]["a-b"]`, `invalid JSON at ["extra names"]["a-b"] (line 1, column 28): invalid character '}' in literal true (expecting 'e')`},
+		{"multiline", "{\n  \"subject\": {\n    \"commonName\": \"foo\",\n  },\n}", "subject.commonName", `invalid JSON at subject.commonName (line 4, column 3): invalid character '}' looking for beginning of object key string`},
+		{"unexpected-end", `{"subject": {"commonName": "foo"`, "subject.commonName", `invalid JSON at subject.commonName (line 1, column 32): unexpected end of JSON input`},
+		{"top-level-scalar", `tru`, "", `invalid JSON at (root) (line 1, column 3): unexpected end of JSON input`},
+		{"top-level-trailing", `{"a": 1} x`, "", `invalid JSON at (root) (line 1, column 10): invalid character 'x' after top-level value`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateTemplateData([]byte(tt.data))
+			assert.EqualError(t, err, "error validating json template data: "+tt.err)
+			var te *TemplateError
+			if assert.True(t, errors.As(err, &te)) {
+				assert.Equal(t, JSONError, te.Kind)
+				assert.Equal(t, tt.path, te.Path)
+			}
+			var syntaxError *json.SyntaxError
+			assert.True(t, errors.As(err, &syntaxError))
+		})
+	}
+}
+
+func TestValidateTemplateData_allErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{"values", "{\n  \"a\": tru,\n  \"b\": [1, x, 3],\n  \"c\": \"ok\",\n  \"d\": }", []string{
+			`invalid JSON at a (line 2, column 11): invalid character ',' in literal true (expecting 'e')`,
+			`invalid JSON at b[1] (line 3, column 12): invalid character 'x' looking for beginning of value`,
+			`invalid JSON at d (line 5, column 8): invalid character '}' looking for beginning of value`,
+		}},
+		{"members", `{"a": 1,, "b" 2, "c": "\q", "d": 4,}`, []string{
+			`invalid JSON at a (line 1, column 9): invalid character ',' looking for beginning of object key string`,
+			`invalid JSON at b (line 1, column 15): invalid character '2' after object key`,
+			`invalid JSON at c (line 1, column 25): invalid escape sequence ` + "`\\q`" + ` in string`,
+			`invalid JSON at d (line 1, column 36): invalid character '}' looking for beginning of object key string`,
+		}},
+		{"arrays", `[[1,,2], [3,], [4 5]]`, []string{
+			`invalid JSON at [0][1] (line 1, column 5): invalid character ',' looking for beginning of value`,
+			`invalid JSON at [1][1] (line 1, column 13): invalid character ']' looking for beginning of value`,
+			`invalid JSON at [2][1] (line 1, column 19): invalid character '5' after array element`,
+		}},
+		{"single", `{"a": tru}`, []string{
+			`invalid JSON at a (line 1, column 10): invalid character '}' in literal true (expecting 'e')`,
+		}},
+		{"unterminated", `{"a": x, "b": y`, []string{
+			`invalid JSON at a (line 1, column 7): invalid character 'x' looking for beginning of value`,
+			`invalid JSON at b (line 1, column 15): invalid character 'y' looking for beginning of value`,
+		}},
+		{"mismatched-bracket", `{"a": [1, x}`, []string{
+			`invalid JSON at a[1] (line 1, column 11): invalid character 'x' looking for beginning of value`,
+			`invalid JSON at a[2] (line 1, column 12): invalid character '}' after array element`,
+		}},
+		{"unrecoverable", `{"a": 1} x {"b": y}`, []string{
+			`invalid JSON at (root) (line 1, column 10): invalid character 'x' after top-level value`,
+		}},
+		{"missing-value", `{"a": x, "b":}`, []string{
+			`invalid JSON at a (line 1, column 7): invalid character 'x' looking for beginning of value`,
+			`invalid JSON at b (line 1, column 14): invalid character '}' looking for beginning of value`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateTemplateData([]byte(tt.data), WithAllErrors(true))
+			require.Error(t, err)
+			var got []string
+			var errs Errors
+			if errors.As(err, &errs) {
+				for _, e := range errs {
+					got = append(got, strings.TrimPrefix(e.Error(), "error validating json template data: "))
+				}
+			} else {
+				got = append(got, strings.TrimPrefix(err.Error(), "error validating json template data: "))
+			}
+			assert.Equal(t, tt.want, got)
+
+			// Without the option only the first one is reported.
+			assert.EqualError(t, ValidateTemplateData([]byte(tt.data)), "error validating json template data: "+tt.want[0])
+		})
+	}
+
+	// There's a limit in the number of errors reported.
+	data := "[" + strings.Repeat("x,", 2*maxDataErrors) + "1]"
+	var errs Errors
+	if assert.True(t, errors.As(ValidateTemplateData([]byte(data), WithAllErrors(true)), &errs)) {
+		assert.Len(t, errs, maxDataErrors)
+	}
+}
+
+func TestValidateTemplateData_limits(t *testing.T) {
+	deep := func(n int) string {
+		return strings.Repeat(`{"a": [`, n) + "1" + strings.Repeat("]}", n)
+	}
+	tests := []struct {
+		name string
+		data string
+		opts []Option
+		err  string
+	}{
+		{"ok/default-depth", deep(50), nil, ""},
+		{"ok/depth", deep(2), []Option{WithMaxDepth(4)}, ""},
+		{"ok/brackets-in-strings", `[["[[[[[[[["]]`, []Option{WithMaxDepth(2)}, ""},
+		{"fail/default-depth", deep(51), nil, `maximum nesting depth of 100 exceeded at offset 350 (line 1, column 351)`},
+		{"fail/depth", deep(3), []Option{WithMaxDepth(4)}, `maximum nesting depth of 4 exceeded at offset 14 (line 1, column 15)`},
+		{"fail/depth-multiline", "[\n [\n  [1]\n ]\n]", []Option{WithMaxDepth(2)}, `maximum nesting depth of 2 exceeded at offset 7 (line 3, column 3)`},
+		{"fail/nan", `{"a": NaN}`, nil, `invalid JSON at a (line 1, column 7): NaN is not a valid JSON number: invalid character 'N' looking for beginning of value`},
+		{"fail/infinity", `{"a": [1, Infinity]}`, nil, `invalid JSON at a[1] (line 1, column 11): Infinity is not a valid JSON number: invalid character 'I' looking for beginning of value`},
+		{"fail/negative-infinity", `{"a": -Infinity}`, nil, `invalid JSON at a (line 1, column 8): -Infinity is not a valid JSON number: invalid character 'I' in numeric literal`},
+		{"fail/all-errors", `{"a": NaN, "b": -Inf}`, []Option{WithAllErrors(true)}, `invalid JSON at a (line 1, column 7): NaN is not a valid JSON number: invalid character 'N' looking for beginning of value; error validating json template data: invalid JSON at b (line 1, column 18): -Inf is not a valid JSON number: invalid character 'I' in numeric literal`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateTemplateData([]byte(tt.data), tt.opts...)
+			if tt.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, "error validating json template data: "+tt.err)
+		})
+	}
+
+	// The limit also applies to the output.
+	err := ValidateTemplateWithData([]byte(`[[{{ toJson .A }}]]`), []byte(`{"A": [[1]]}`), WithMaxDepth(3))
+	assert.EqualError(t, err, "error validating json template data: maximum nesting depth of 3 exceeded at offset 3, near template line 1, column 6")
+	var te *TemplateError
+	if assert.True(t, errors.As(err, &te)) {
+		assert.Equal(t, JSONError, te.Kind)
+		assert.Equal(t, 1, te.Line)
+		assert.Equal(t, 6, te.Column)
+	}
+}
+
+func Test_enrichJSONError(t *testing.T) {
+	render := func(t *testing.T, src string, data interface{}) ([]byte, *sourceMap, error) {
+		t.Helper()
+		var failMessage string
+		tmpl, err := template.New("template").Funcs(GetFuncMap(&failMessage)).Parse(src)
+		require.NoError(t, err)
+		out, m, err := executeTemplate(context.Background(), tmpl, data, 0)
+		require.NoError(t, err)
+		var v interface{}
+		return out, m, json.Unmarshal(out, &v)
+	}
+
+	tests := []struct {
+		name string
+		src  string
+		data interface{}
+		err  error
+	}{
+		{
+			name: "literal-after-multi-line-action",
+			src: `{
+	"subject": {{ toPrettyJson .Subject }},
+	"sans": {{ toJson .SANs }}
+	"keyUsage": ["digitalSignature"]
+}`,
+			data: map[string]interface{}{
+				"Subject": map[string]interface{}{"commonName": "foo", "country": "US"},
+				"SANs":    []string{"foo.com"},
+			},
+			err: errors.New(`invalid JSON at template line 4, column 2: invalid character '"' after object key:value pair`),
+		},
+		{
+			name: "inside-action-output",
+			src: `{
+	"subject": {{ toPrettyJson .Subject }},
+	"sans": {{ .SANs }}
+}`,
+			data: map[string]interface{}{
+				"Subject": map[string]interface{}{"commonName": "foo", "country": "US"},
+				"SANs":    []string{"foo.com"},
+			},
+			err: errors.New(`invalid JSON at offset 71, near template line 3, column 13: invalid character 'o' in literal false (expecting 'a')`),
+		},
+		{
+			name: "unexpected-end",
+			src:  `{"subject": {{ toJson .Subject }},`,
+			data: map[string]interface{}{"Subject": "foo"},
+			err:  errors.New(`invalid JSON at template line 1, column 35: unexpected end of JSON input`),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, m, err := render(t, tt.src, tt.data)
+			require.Error(t, err)
+			err = enrichJSONError(err, []byte(tt.src), m)
+			assert.EqualError(t, err, tt.err.Error())
+		})
+	}
+
+	t.Run("no-source-map", func(t *testing.T) {
+		var v interface{}
+		err := json.Unmarshal([]byte(`{"a" 1}`), &v)
+		assert.EqualError(t, enrichJSONError(err, nil, nil), "invalid JSON at offset 5: invalid character '1' after object key")
+	})
+
+	t.Run("type-error", func(t *testing.T) {
+		type target struct {
+			Subject struct {
+				SerialNumber string `json:"serialNumber"`
+				Names        []struct {
+					Type int `json:"type"`
+				} `json:"names"`
+			} `json:"subject"`
+			IsCA bool `json:"isCA"`
+		}
+		tests := []struct {
+			name string
+			src  string
+			want string
+		}{
+			{"number", `{"subject": {"serialNumber": 123}}`, "invalid JSON at line 1, column 32: field subject.serialNumber: expected string, got number"},
+			{"object", `{"subject": {"serialNumber": {"a": 1}}}`, "invalid JSON at line 1, column 30: field subject.serialNumber: expected string, got object"},
+			{"slice", "{\n  \"subject\": {\"names\": [{}, {\"type\": \"x\"}]}\n}", "invalid JSON at line 2, column 40: field subject.names[1].type: expected int, got string"},
+			{"bool", `{"isCA": "yes"}`, "invalid JSON at line 1, column 14: field isCA: expected bool, got string"},
+			{"root", `[1]`, "invalid JSON at line 1, column 1: expected templates.target, got array"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				var v target
+				err := json.Unmarshal([]byte(tt.src), &v)
+				require.Error(t, err)
+				got := enrichJSONError(err, []byte(tt.src), nil)
+				assert.EqualError(t, got, tt.want)
+				var typeError *json.UnmarshalTypeError
+				assert.True(t, errors.As(got, &typeError))
+			})
+		}
+	})
+
+	t.Run("other-error", func(t *testing.T) {
+		err := errors.New("some error")
+		assert.Equal(t, err, enrichJSONError(err, nil, nil))
+	})
+}
+
+func Test_fieldPath(t *testing.T) {
+	assert.Equal(t, "subject", fieldPath("subject"))
+	assert.Equal(t, "subject.names[2].type", fieldPath("subject.names.2.type"))
+	assert.Equal(t, "sans[0][1]", fieldPath("sans.0.1"))
+	assert.Equal(t, "0.a", fieldPath("0.a"))
+}
+
+func TestValidateTemplateWithData(t *testing.T) {
+	tests := []struct {
+		name string
+		text []byte
+		data []byte
+		err  error
+	}{
+		{
+			name: "ok",
+			text: []byte(`{
+				"subject": {{ toJson .Subject }},
+				"sans": {{ toJson .SANs }}
+			}`),
+			data: []byte(`{"Subject": {"commonName": "foo"}, "SANs": [{"type": "dns", "value": "foo.com"}]}`),
+			err:  nil,
+		},
+		{
+			name: "ok/empty-data",
+			text: []byte(`{"subject": {{ toJson .Subject }}}`),
+			data: nil,
+			err:  nil,
+		},
+		{
+			name: "ok/empty-template",
+			text: nil,
+			data: []byte(`{!?}`),
+			err:  nil,
+		},
+		{
+			name: "ok/deeply-nested-data",
+			text: []byte(`{"value": {{ toJson .a.b.c.d.e.f }}}`),
+			data: []byte(`{"a": {"b": {"c": {"d": {"e": {"f": [1, 2, {"g": null}]}}}}}}`),
+			err:  nil,
+		},
+		{
+			name: "ok/default",
+			text: []byte(`{"keyType": {{ default "RSA" .KeyType | toJson }}, "keyUsage": {{ default (list "digitalSignature") .KeyUsage | toJson }}, "isCA": {{ default true .IsCA }}}`),
+			data: []byte(`{"KeyUsage": [], "IsCA": false}`),
+			err:  nil,
+		},
+		{
+			name: "ok/base64",
+			text: []byte(`{"extensions": [{"id": "1.2.3.4", "value": {{ b64decStrict .der | b64encBytes | toJson }}}], "keyId": {{ b64urldec .keyId | b64urlenc | toJson }}}`),
+			data: []byte(`{"der": "MAMBAf8=", "keyId": "-_8"}`),
+			err:  nil,
+		},
+		{
+			name: "ok/hasElem",
+			text: []byte(`{"server": {{ hasElem "serverAuth" .ExtKeyUsage }}, "missing": {{ hasElem "serverAuth" .Missing }}, "pty": {{ hasMapKey .Extensions "permit-pty" }}, "count": {{ hasElem 2 .Counts }}}`),
+			data: []byte(`{"ExtKeyUsage": ["clientAuth", "serverAuth"], "Extensions": {"permit-pty": ""}, "Counts": [1, 2]}`),
+			err:  nil,
+		},
+		{
+			name: "ok/json-escaping",
+			text: []byte(`{"value": {{ toJson .value }}, "object": {{ mustToJson . }}}`),
+			data: []byte(`{"value": "a \"quoted\"\nstring\u0000 with ñ and \u2028"}`),
+			err:  nil,
+		},
+		{
+			name: "fail/parse",
+			text: []byte(`{"subject": {{ unknownFunction .Subject }}}`),
+			data: nil,
+			err:  errors.New(`error parsing template: template: template:1: function "unknownFunction" not defined`),
+		},
+		{
+			name: "fail/invalid-data",
+			text: []byte(`{"subject": {{ toJson .Subject }}}`),
+			data: []byte(`{"Subject": }`),
+			err:  errors.New("error validating json template data: invalid JSON at Subject (line 1, column 13): invalid character '}' looking for beginning of value"),
+		},
+		{
+			name: "fail/data-not-an-object",
+			text: []byte(`{"subject": {{ toJson .Subject }}}`),
+			data: []byte(`["foo"]`),
+			err:  errors.New(`error executing template: template: template:1:22: executing "template" at <.Subject>: can't evaluate field Subject in type []interface {}`),
+		},
+		{
+			name: "fail/execute",
+			text: []byte(`{"subject": {{ toJson .Subject.CommonName.First }}}`),
+			data: []byte(`{"Subject": "foo"}`),
+			err:  errors.New(`error executing template: template: template:1:30: executing "template" at <.Subject.CommonName.First>: can't evaluate field CommonName in type interface {}`),
+		},
+		{
+			name: "fail/execute-nil-map",
+			text: []byte(`{"value": {{ toJson .a.b }}}`),
+			data: []byte(`{"a": null}`),
+			err:  errors.New(`error executing template: template: template:1:22: executing "template" at <.a.b>: nil pointer evaluating interface {}.b`),
+		},
+		{
+			name: "fail/execute-fail-function",
+			text: []byte(`{{ if not .SANs }}{{ fail "at least one SAN is required" }}{{ end }}`),
+			data: []byte(`{}`),
+			err:  errors.New("error executing template: at least one SAN is required"),
+		},
+		{
+			name: "fail/execute-b64decStrict",
+			text: []byte(`{"value": {{ b64decStrict .value | toJson }}}`),
+			data: []byte(`{"value": "not base64!"}`),
+			err:  errors.New("error executing template: error decoding base64: illegal base64 data at input byte 3"),
+		},
+		{
+			name: "fail/invalid-json",
+			text: []byte(`{
+				"subject": {{ toJson .Subject }}
+				"sans": {{ toJson .SANs }}
+			}`),
+			data: []byte(`{"Subject": {"commonName": "foo"}, "SANs": []}`),
+			err:  errors.New(`error validating json template data: invalid JSON at template line 3, column 5: invalid character '"' after object key:value pair`),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateTemplateWithData(tt.text, tt.data)
+			if tt.err != nil {
+				assert.Error(t, err)
+				assert.EqualError(t, err, tt.err.Error())
+				return
+			}
+
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestValidateTemplateWithData_strict(t *testing.T) {
+	text := []byte(`{
+		"subject": {"commonName": {{ toJson .Subject.CommonName }}},
+		"sans": {{ toJson .SANs }}
+	}`)
+
+	tests := []struct {
+		name string
+		data []byte
+		opts []Option
+		err  error
+		path string
+	}{
+		{
+			name: "ok",
+			data: []byte(`{"Subject": {"CommonName": "foo"}, "SANs": []}`),
+			opts: []Option{WithStrict(true)},
+		},
+		{
+			name: "ok/lenient",
+			data: []byte(`{"Subject": {}, "SANs": []}`),
+		},
+		{
+			name: "ok/strict-disabled",
+			data: []byte(`{"Subject": {}, "SANs": []}`),
+			opts: []Option{WithStrict(false)},
+		},
+		{
+			name: "fail/missing-nested-key",
+			data: []byte(`{"Subject": {}, "SANs": []}`),
+			opts: []Option{WithStrict(true)},
+			err:  errors.New(`error executing template: missing key "CommonName" in .Subject.CommonName: template: template:2:46: executing "template" at <.Subject.CommonName>: map has no entry for key "CommonName"`),
+			path: ".Subject.CommonName",
+		},
+		{
+			name: "fail/missing-key",
+			data: []byte(`{"Subject": {"CommonName": "foo"}}`),
+			opts: []Option{WithStrict(true)},
+			err:  errors.New(`error executing template: missing key "SANs" in .SANs: template: template:3:20: executing "template" at <.SANs>: map has no entry for key "SANs"`),
+			path: ".SANs",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateTemplateWithData(text, tt.data, tt.opts...)
+			if tt.err != nil {
+				assert.EqualError(t, err, tt.err.Error())
+				var te *TemplateError
+				if assert.True(t, errors.As(err, &te)) {
+					assert.Equal(t, ExecError, te.Kind)
+					assert.Equal(t, tt.path, te.Path)
+				}
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestValidateTemplateData_duplicateKeys(t *testing.T) {
+	data := []byte(`{
+	"subject": {"commonName": "foo"},
+	"sans": [],
+	"subject": {"commonName": "bar"}
+}`)
+	assert.NoError(t, ValidateTemplateData(data))
+	assert.NoError(t, ValidateTemplateData(data, WithRejectDuplicateKeys(false)))
+	err := ValidateTemplateData(data, WithRejectDuplicateKeys(true))
+	assert.EqualError(t, err, `error validating json template data: duplicate key "subject" at line 4, column 2`)
+	var te *TemplateError
+	if assert.True(t, errors.As(err, &te)) {
+		assert.Equal(t, JSONError, te.Kind)
+	}
+}
+
+func TestValidateTemplateWithData_duplicateKeys(t *testing.T) {
+	text := []byte(`{
+	"subject": {{ toJson .Subject }},
+{{- if .Issuer }}
+	"subject": {{ toJson .Issuer }},
+{{- end }}
+	"sans": {{ toJson .SANs }}
+}`)
+	data := []byte(`{"Subject": {"commonName": "foo"}, "Issuer": {"commonName": "bar"}, "SANs": []}`)
+
+	assert.NoError(t, ValidateTemplateWithData(text, data))
+	err := ValidateTemplateWithData(text, data, WithRejectDuplicateKeys(true))
+	assert.EqualError(t, err, `error validating json template data: duplicate key "subject" at template line 4, column 2`)
+
+	err = ValidateTemplateWithData([]byte(`{}`), []byte(`{"a": 1, "a": 2}`), WithRejectDuplicateKeys(true))
+	assert.EqualError(t, err, `error validating json template data: duplicate key "a" at line 1, column 10`)
+}
+
+func TestValidateTemplateWithData_emptyOutput(t *testing.T) {
+	text := []byte(`{{ if .Enabled }}{"subject": {{ toJson .Subject }}}{{ end }}`)
+	off := []byte(`{"Enabled": false, "Subject": "foo"}`)
+
+	assert.NoError(t, ValidateTemplateWithData(text, off))
+	assert.NoError(t, ValidateTemplateWithData(text, []byte(`{"Enabled": true, "Subject": "foo"}`), WithRejectEmptyOutput(true)))
+
+	err := ValidateTemplateWithData(text, off, WithRejectEmptyOutput(true))
+	assert.EqualError(t, err, "error validating json template data: template produced no output")
+	var te *TemplateError
+	if assert.True(t, errors.As(err, &te)) {
+		assert.Equal(t, JSONError, te.Kind)
+	}
+
+	// White space is not output.
+	err = ValidateTemplateWithData([]byte("{{ if .Enabled }}{}{{ end }}\n\t \n"), off, WithRejectEmptyOutput(true))
+	assert.EqualError(t, err, "error validating json template data: template produced no output")
+
+	// An empty template is still valid.
+	assert.NoError(t, ValidateTemplateWithData(nil, off, WithRejectEmptyOutput(true)))
+	assert.NoError(t, ValidateTemplate(nil, WithRejectEmptyOutput(true)))
+}
+
+func TestValidateTemplateWithData_outputValidators(t *testing.T) {
+	errNotCorporate := errors.New("commonName must end with .corp.example.com")
+	corporateCN := func(out []byte) error {
+		var v struct {
+			Subject struct {
+				CommonName string `json:"commonName"`
+			} `json:"subject"`
+		}
+		if err := json.Unmarshal(out, &v); err != nil {
+			return err
+		}
+		if !strings.HasSuffix(v.Subject.CommonName, ".corp.example.com") {
+			return errNotCorporate
+		}
+		return nil
+	}
+	noRSA := func(out []byte) error {
+		if bytes.Contains(out, []byte(`"RSA"`)) {
+			return errors.New("RSA keys are not allowed")
+		}
+		return nil
+	}
+	var calls int
+	count := func(out []byte) error {
+		calls++
+		return nil
+	}
+
+	text := []byte(`{"subject": {"commonName": {{ toJson .CN }}}, "keyType": {{ toJson .KeyType }}}`)
+	opts := []Option{WithOutputValidators(corporateCN, noRSA), WithOutputValidators(count)}
+	assert.NoError(t, ValidateTemplateWithData(text, []byte(`{"CN": "a.corp.example.com", "KeyType": "EC"}`), opts...))
+	assert.Equal(t, 1, calls)
+
+	err := ValidateTemplateWithData(text, []byte(`{"CN": "a.example.com", "KeyType": "EC"}`), opts...)
+	assert.EqualError(t, err, "error validating json template data: commonName must end with .corp.example.com")
+	assert.ErrorIs(t, err, errNotCorporate)
+	var te *TemplateError
+	if assert.True(t, errors.As(err, &te)) {
+		assert.Equal(t, SchemaError, te.Kind)
+	}
+	assert.Equal(t, 2, calls)
+
+	// All the validators run.
+	err = ValidateTemplateWithData(text, []byte(`{"CN": "a.example.com", "KeyType": "RSA"}`), opts...)
+	var errs Errors
+	if assert.True(t, errors.As(err, &errs)) {
+		assert.EqualError(t, errs, "error validating json template data: commonName must end with .corp.example.com; error validating json template data: RSA keys are not allowed")
+	}
+	assert.Equal(t, 3, calls)
+
+	// The validators don't run on invalid output.
+	err = ValidateTemplateWithData([]byte(`{"subject": {{ .CN }}}`), []byte(`{"CN": "a.example.com"}`), opts...)
+	assert.True(t, errors.As(err, &te))
+	assert.Equal(t, JSONError, te.Kind)
+	assert.Equal(t, 3, calls)
+}
+
+func TestTemplate_Render_outputValidators(t *testing.T) {
+	fail := func(msg string) func([]byte) error {
+		return func([]byte) error { return errors.New(msg) }
+	}
+	tmpl, err := ParseTemplate([]byte(`{}`), WithOutputValidators(fail("a")))
+	require.NoError(t, err)
+	assert.EqualError(t, tmpl.Validate(nil), "error validating json template data: a")
+
+	// The validators of a render are added to the ones of the template.
+	_, err = tmpl.Render(nil, WithRenderMode(RenderCompact), WithOutputValidators(fail("b")))
+	assert.EqualError(t, err, "error validating json template data: a; error validating json template data: b")
+	assert.EqualError(t, tmpl.Validate(nil), "error validating json template data: a")
+}
+
+func TestValidateTemplateWithData_noValue(t *testing.T) {
+	text := []byte("{\n  \"cn\": \"{{ .CommonName }}\",\n  \"o\": \"{{ .Organization }}\",\n  \"ou\": {{ default \"IT\" .Unit | toJson }}\n}")
+	data := []byte(`{"CommonName": "foo", "Organization": "Acme"}`)
+
+	assert.NoError(t, ValidateTemplateWithData(text, data, WithRejectNoValue(true)))
+	assert.NoError(t, ValidateTemplateWithData(text, []byte(`{}`)))
+
+	err := ValidateTemplateWithData(text, []byte(`{"CommonName": "foo"}`), WithRejectNoValue(true))
+	assert.EqualError(t, err, "error validating json template data: output contains <no value> at template line 3, column 12 (1 of 1)")
+	var te *TemplateError
+	if assert.True(t, errors.As(err, &te)) {
+		assert.Equal(t, JSONError, te.Kind)
+		assert.Equal(t, 3, te.Line)
+		assert.Equal(t, 12, te.Column)
+	}
+
+	err = ValidateTemplateWithData(text, []byte(`{}`), WithRejectNoValue(true))
+	var errs Errors
+	if assert.True(t, errors.As(err, &errs)) && assert.Len(t, errs, 2) {
+		assert.EqualError(t, errs[0], "error validating json template data: output contains <no value> at template line 2, column 13 (1 of 2)")
+		assert.EqualError(t, errs[1], "error validating json template data: output contains <no value> at template line 3, column 12 (2 of 2)")
+	}
+
+	// The occurrences are counted, but only the first ones are reported.
+	text = []byte(`[{{ range .Names }}"{{ .Missing }}",{{ end }}"x"]`)
+	err = ValidateTemplateWithData(text, []byte(`{"Names": [{}, {}, {}, {}, {}, {}, {}, {}, {}, {}, {}, {}]}`), WithRejectNoValue(true))
+	if assert.True(t, errors.As(err, &errs)) && assert.Len(t, errs, 10) {
+		assert.EqualError(t, errs[9], "error validating json template data: output contains <no value> at template line 1, column 24 (10 of 12)")
+	}
+
+	// Invalid JSON with <no value> reports the missing value.
+	err = ValidateTemplateWithData([]byte(`{"cn": {{ .CommonName }}}`), []byte(`{}`), WithRejectNoValue(true))
+	assert.EqualError(t, err, "error validating json template data: output contains <no value> at template line 1, column 11 (1 of 1)")
+}
+
+func TestValidateTemplateWithData_invalidUTF8(t *testing.T) {
+	// "/w==" is the byte 0xff, "w6k=" is "é".
+	text := []byte("{\n  \"cn\": \"{{ b64dec .CN }}\",\n  \"o\": \"Acme\"\n}")
+	data := []byte(`{"CN": "/w=="}`)
+
+	assert.NoError(t, ValidateTemplateWithData(text, data))
+	assert.NoError(t, ValidateTemplateWithData(text, []byte(`{"CN": "w6k="}`), WithRejectInvalidUTF8(true)))
+
+	err := ValidateTemplateWithData(text, data, WithRejectInvalidUTF8(true))
+	assert.EqualError(t, err, "error validating json template data: output contains invalid UTF-8 at offset 11, near template line 2, column 13: invalid byte 0xff")
+	var te *TemplateError
+	if assert.True(t, errors.As(err, &te)) {
+		assert.Equal(t, JSONError, te.Kind)
+		assert.Equal(t, 2, te.Line)
+		assert.Equal(t, 13, te.Column)
+	}
+
+	// Invalid bytes in the template text are reported at their position.
+	err = ValidateTemplateWithData([]byte("{\"cn\": \"a\xc3\"}"), nil, WithRejectInvalidUTF8(true))
+	assert.EqualError(t, err, "error validating json template data: output contains invalid UTF-8 at template line 1, column 10: invalid byte 0xc3")
+
+	// A truncated sequence after valid multi-byte characters.
+	err = ValidateTemplateWithData([]byte(`{"cn": "{{ b64dec .CN }}"}`), []byte(`{"CN": "w6nDqeKC"}`), WithRejectInvalidUTF8(true))
+	assert.EqualError(t, err, "error validating json template data: output contains invalid UTF-8 at offset 12, near template line 1, column 12: invalid byte 0xe2")
+}
+
+func TestNormalizeJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		rendered string
+		want     string
+		err      string
+	}{
+		{"object", `{"b": 1, "a": {"d": [1, 2], "c": null}}`, "{\n  \"a\": {\n    \"c\": null,\n    \"d\": [\n      1,\n      2\n    ]\n  },\n  \"b\": 1\n}\n", ""},
+		{"numbers", `[1.0, 1e3, -0, 12345678901234567890123, 0.10]`, "[\n  1.0,\n  1e3,\n  -0,\n  12345678901234567890123,\n  0.10\n]\n", ""},
+		{"strings", `{"html": "<a&b>", "unicode": "ññ"}`, "{\n  \"html\": \"<a&b>\",\n  \"unicode\": \"ññ\"\n}\n", ""},
+		{"duplicate-keys", `{"a": 1, "a": 2}`, "{\n  \"a\": 2\n}\n", ""},
+		{"scalar", `  "foo"  `, "\"foo\"\n", ""},
+		{"empty-containers", `{"a": {}, "b": []}`, "{\n  \"a\": {},\n  \"b\": []\n}\n", ""},
+		{"fail/invalid", "{\n  \"a\": 1\n  \"b\": 2\n}", "", `error normalizing json: invalid JSON at line 3, column 3: invalid character '"' after object key:value pair`},
+		{"fail/empty", ``, "", `error normalizing json: invalid JSON at line 1, column 1: unexpected end of JSON input`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeJSON([]byte(tt.rendered))
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				assert.Nil(t, got)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+
+	// Equivalent documents have the same normalized form.
+	a, err := NormalizeJSON([]byte(`{"sans": ["a", "b"], "subject": {"commonName": "foo"}}`))
+	require.NoError(t, err)
+	b, err := NormalizeJSON([]byte("{\n\t\"subject\": {\"commonName\":\"foo\"},\n\t\"sans\": [\"a\",\"b\"]\n}"))
+	require.NoError(t, err)
+	assert.Equal(t, a, b)
+}
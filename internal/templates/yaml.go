@@ -0,0 +1,223 @@
+package templates
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ValidateTemplateDataYAML validates that template data written in YAML can
+// be converted to valid JSON template data. Anchors and aliases are resolved,
+// documents whose aliases expand to too many values are rejected like yaml.v3
+// does, duplicate keys are rejected, and integers are kept with full precision. The
+// errors reported include the YAML line that caused them.
+func ValidateTemplateDataYAML(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	b, err := yamlToJSON(data)
+	if err != nil {
+		return newTemplateError(JSONError, err, "error validating yaml template data: "+err.Error())
+	}
+	return ValidateTemplateData(b)
+}
+
+// yamlToJSON converts a YAML document to JSON.
+func yamlToJSON(data []byte) ([]byte, error) {
+	var doc yaml.Node
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(&doc); err != nil {
+		if errors.Is(err, io.EOF) {
+			return []byte("null"), nil
+		}
+		return nil, err
+	}
+
+	c := &yamlConverter{visiting: make(map[*yaml.Node]bool)}
+	v, err := c.convert(&doc)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+type yamlConverter struct {
+	visiting   map[*yaml.Node]bool
+	nodes      int
+	aliasNodes int
+	aliasDepth int
+}
+
+// yamlAliasRatio returns the maximum ratio of nodes converted through an
+// alias to all the nodes converted, for the given number of nodes. It's the
+// limit used by yaml.v3 to reject documents like the billion laughs attack:
+// small documents can use aliases freely, and large ones are limited to 10%.
+func yamlAliasRatio(nodes int) float64 {
+	switch {
+	case nodes <= 400000:
+		return 0.99
+	case nodes >= 4000000:
+		return 0.10
+	default:
+		return 0.99 - 0.89*float64(nodes-400000)/3600000
+	}
+}
+
+var yamlDecimalRegexp = regexp.MustCompile(`^[-+]?[0-9][0-9_]*$`)
+
+func (c *yamlConverter) convert(n *yaml.Node) (interface{}, error) {
+	c.nodes++
+	if c.aliasDepth > 0 {
+		c.aliasNodes++
+		if c.aliasNodes > 100 && c.nodes > 1000 && float64(c.aliasNodes)/float64(c.nodes) > yamlAliasRatio(c.nodes) {
+			return nil, fmt.Errorf("line %d: document contains excessive aliasing", n.Line)
+		}
+	}
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return nil, nil
+		}
+		return c.convert(n.Content[0])
+	case yaml.AliasNode:
+		if c.visiting[n.Alias] {
+			return nil, fmt.Errorf("line %d: alias %q references itself", n.Line, n.Value)
+		}
+		c.visiting[n.Alias] = true
+		c.aliasDepth++
+		defer func() {
+			delete(c.visiting, n.Alias)
+			c.aliasDepth--
+		}()
+		return c.convert(n.Alias)
+	case yaml.SequenceNode:
+		s := make([]interface{}, 0, len(n.Content))
+		for _, child := range n.Content {
+			v, err := c.convert(child)
+			if err != nil {
+				return nil, err
+			}
+			s = append(s, v)
+		}
+		return s, nil
+	case yaml.MappingNode:
+		return c.convertMapping(n)
+	case yaml.ScalarNode:
+		return c.convertScalar(n)
+	default:
+		return nil, fmt.Errorf("line %d: unsupported yaml node", n.Line)
+	}
+}
+
+func (c *yamlConverter) convertMapping(n *yaml.Node) (interface{}, error) {
+	m := make(map[string]interface{}, len(n.Content)/2)
+	lines := make(map[string]int, len(n.Content)/2)
+	var merged []map[string]interface{}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		if k.Kind == yaml.ScalarNode && k.ShortTag() == "!!merge" {
+			mm, err := c.convertMerge(v)
+			if err != nil {
+				return nil, err
+			}
+			merged = append(merged, mm...)
+			continue
+		}
+		if k.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("line %d: mapping keys must be scalars", k.Line)
+		}
+		if line, ok := lines[k.Value]; ok {
+			return nil, fmt.Errorf("line %d: duplicate key %q already defined at line %d", k.Line, k.Value, line)
+		}
+		value, err := c.convert(v)
+		if err != nil {
+			return nil, err
+		}
+		m[k.Value] = value
+		lines[k.Value] = k.Line
+	}
+	// Explicit keys take precedence over the merged ones, and the first merged
+	// mapping takes precedence over the following ones.
+	for _, mm := range merged {
+		for k, v := range mm {
+			if _, ok := m[k]; !ok {
+				m[k] = v
+			}
+		}
+	}
+	return m, nil
+}
+
+func (c *yamlConverter) convertMerge(n *yaml.Node) ([]map[string]interface{}, error) {
+	nodes := []*yaml.Node{n}
+	if n.Kind == yaml.SequenceNode {
+		nodes = n.Content
+	}
+	var res []map[string]interface{}
+	for _, node := range nodes {
+		v, err := c.convert(node)
+		if err != nil {
+			return nil, err
+		}
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("line %d: merge value must be a mapping", node.Line)
+		}
+		res = append(res, m)
+	}
+	return res, nil
+}
+
+func (c *yamlConverter) convertScalar(n *yaml.Node) (interface{}, error) {
+	tag := n.ShortTag()
+	switch tag {
+	case "!!null":
+		return nil, nil
+	case "!!bool":
+		var b bool
+		if err := n.Decode(&b); err != nil {
+			return nil, err
+		}
+		return b, nil
+	case "!!int", "!!float":
+		// Decimal integers are kept as arbitrary precision numbers, YAML
+		// resolves the ones that don't fit in 64 bits as floats.
+		if yamlDecimalRegexp.MatchString(n.Value) {
+			i, ok := new(big.Int).SetString(strings.ReplaceAll(n.Value, "_", ""), 10)
+			if !ok {
+				return nil, fmt.Errorf("line %d: invalid integer %q", n.Line, n.Value)
+			}
+			return json.Number(i.String()), nil
+		}
+		if tag == "!!int" {
+			var v int64
+			if err := n.Decode(&v); err != nil {
+				var u uint64
+				if err := n.Decode(&u); err != nil {
+					return nil, err
+				}
+				return json.Number(fmt.Sprint(u)), nil
+			}
+			return json.Number(fmt.Sprint(v)), nil
+		}
+		var f float64
+		if err := n.Decode(&f); err != nil {
+			return nil, err
+		}
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("line %d: %s is not a valid JSON number", n.Line, n.Value)
+		}
+		return f, nil
+	default:
+		return n.Value, nil
+	}
+}
@@ -0,0 +1,130 @@
+package templates
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTemplateDataYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{
+			name: "ok",
+			data: []byte(`
+subject:
+  commonName: foo
+sans:
+  - type: dns
+    value: foo.com
+isCA: false
+`),
+		},
+		{
+			name: "ok/empty",
+			data: nil,
+		},
+		{
+			name: "ok/anchors-and-aliases",
+			data: []byte(`
+base: &base
+  organization: Smallstep
+  country: US
+subject:
+  <<: *base
+  commonName: foo
+issuer: *base
+`),
+		},
+		{
+			name: "ok/big-integer",
+			data: []byte(`serialNumber: 123456789012345678901234567890`),
+		},
+		{
+			name: "ok/hex-integer",
+			data: []byte(`value: 0xff`),
+		},
+		{
+			name: "fail/syntax",
+			data: []byte("subject:\n  commonName: foo\n bad: indentation"),
+			err:  errors.New("error validating yaml template data: yaml: line 2: did not find expected key"),
+		},
+		{
+			name: "fail/duplicate-key",
+			data: []byte("subject:\n  commonName: foo\nsans: []\nsubject:\n  commonName: bar\n"),
+			err:  errors.New(`error validating yaml template data: line 4: duplicate key "subject" already defined at line 1`),
+		},
+		{
+			name: "fail/nested-duplicate-key",
+			data: []byte("subject:\n  commonName: foo\n  commonName: bar\n"),
+			err:  errors.New(`error validating yaml template data: line 3: duplicate key "commonName" already defined at line 2`),
+		},
+		{
+			name: "fail/non-scalar-key",
+			data: []byte("? [a, b]\n: value\n"),
+			err:  errors.New("error validating yaml template data: line 1: mapping keys must be scalars"),
+		},
+		{
+			name: "fail/nan",
+			data: []byte("value: .nan\n"),
+			err:  errors.New("error validating yaml template data: line 1: .nan is not a valid JSON number"),
+		},
+		{
+			name: "fail/billion-laughs",
+			data: []byte(`a: &a ["lol","lol","lol","lol","lol","lol","lol","lol","lol"]
+b: &b [*a,*a,*a,*a,*a,*a,*a,*a,*a]
+c: &c [*b,*b,*b,*b,*b,*b,*b,*b,*b]
+d: &d [*c,*c,*c,*c,*c,*c,*c,*c,*c]
+e: &e [*d,*d,*d,*d,*d,*d,*d,*d,*d]
+f: &f [*e,*e,*e,*e,*e,*e,*e,*e,*e]
+g: &g [*f,*f,*f,*f,*f,*f,*f,*f,*f]
+h: &h [*g,*g,*g,*g,*g,*g,*g,*g,*g]
+i: &i [*h,*h,*h,*h,*h,*h,*h,*h,*h]
+`),
+			err: errors.New("error validating yaml template data: line 2: document contains excessive aliasing"),
+		},
+		{
+			name: "fail/merge-not-a-mapping",
+			data: []byte("a: &a [1, 2]\nb:\n  <<: *a\n"),
+			err:  errors.New("error validating yaml template data: line 3: merge value must be a mapping"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateTemplateDataYAML(tt.data)
+			if tt.err != nil {
+				assert.EqualError(t, err, tt.err.Error())
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func Test_yamlToJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"scalars", "a: 1\nb: 1.5\nc: true\nd: null\ne: foo\nf: '1'", `{"a":1,"b":1.5,"c":true,"d":null,"e":"foo","f":"1"}`},
+		{"big-integer", "a: 123456789012345678901234567890\nb: -1_000", `{"a":123456789012345678901234567890,"b":-1000}`},
+		{"hex-and-octal", "a: 0x1F\nb: 0o17", `{"a":31,"b":15}`},
+		{"aliases", "base: &b {x: 1}\nc: *b\nd: [*b, *b]", `{"base":{"x":1},"c":{"x":1},"d":[{"x":1},{"x":1}]}`},
+		{"merge-precedence", "a: &a {x: 1, y: 1}\nb: &b {y: 2, z: 2}\nc:\n  <<: [*a, *b]\n  x: 3", `{"a":{"x":1,"y":1},"b":{"y":2,"z":2},"c":{"x":3,"y":1,"z":2}}`},
+		{"top-level-array", "- a\n- b", `["a","b"]`},
+		{"empty-document", "", `null`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := yamlToJSON([]byte(tt.data))
+			if assert.NoError(t, err) {
+				assert.JSONEq(t, tt.want, string(got))
+			}
+		})
+	}
+}
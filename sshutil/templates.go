@@ -41,6 +41,12 @@ func ValidateTemplateData(data []byte) error {
 	return templates.ValidateTemplateData(data)
 }
 
+// ValidateTemplateWithData validates that a text template results in valid JSON
+// when it's executed with the given JSON template data.
+func ValidateTemplateWithData(text, data []byte) error {
+	return templates.ValidateTemplateWithData(text, data)
+}
+
 // TemplateData is an alias for map[string]interface{}. It represents the data
 // passed to the templates.
 type TemplateData map[string]interface{}
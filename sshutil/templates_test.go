@@ -635,3 +635,38 @@ func TestValidateTemplateData(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateTemplateWithData(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    []byte
+		data    []byte
+		wantErr bool
+	}{
+		{
+			name:    "ok",
+			text:    []byte(DefaultTemplate),
+			data:    []byte(`{"Type": "user", "KeyID": "foo", "Principals": ["foo"]}`),
+			wantErr: false,
+		},
+		{
+			name:    "fail/invalid-json",
+			text:    []byte("{!?}"),
+			data:    []byte("{}"),
+			wantErr: true,
+		},
+		{
+			name:    "fail/invalid-data",
+			text:    []byte(DefaultTemplate),
+			data:    []byte("{!?}"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateTemplateWithData(tt.text, tt.data); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateTemplateWithData() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}